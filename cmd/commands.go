@@ -0,0 +1,405 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/convert"
+	"github.com/call-me-snake/user_balance_service/internal/hashchain"
+	"github.com/call-me-snake/user_balance_service/internal/i18n"
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	"github.com/call-me-snake/user_balance_service/internal/reconcile"
+	"github.com/call-me-snake/user_balance_service/internal/storage"
+	"github.com/jessevdk/go-flags"
+)
+
+//errCheckFailed - проверка выполнена и обнаружила нарушения. Процесс завершается с кодом 1
+var errCheckFailed = errors.New("проверка обнаружила нарушения")
+
+//exitCode - код завершения процесса по результату команды: 0 - успешно, 1 - проверка обнаружила нарушения,
+//2 - ошибка. Справка выводится в stdout, ошибки - в stderr
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if flagsErr, ok := err.(*flags.Error); ok && flagsErr.Type == flags.ErrHelp {
+		fmt.Fprintln(os.Stdout, err)
+		return 0
+	}
+	fmt.Fprintln(os.Stderr, err)
+	if err == errCheckFailed {
+		return 1
+	}
+	return 2
+}
+
+//openStorage - подключение к базе данных с параметрами командной строки
+func openStorage() (model.IBalanceInfoStorage, error) {
+	config, err := initConfig()
+	if err != nil {
+		return nil, err
+	}
+	accSt, err := storage.New(config.AccountStorageConn, config.Storage)
+	if err != nil {
+		return nil, err
+	}
+	//команды работают с актуальными данными, а не с репликами
+	return accSt.Primary(), nil
+}
+
+//printJSON - вывод value в stdout в формате JSON
+func printJSON(value interface{}) {
+	out, _ := json.MarshalIndent(value, "", "  ")
+	fmt.Println(string(out))
+}
+
+//accountArg - идентификатор аккаунта в позиционном аргументе команды
+type accountArg struct {
+	Id int `positional-arg-name:"id" required:"yes"`
+}
+
+//serveCommand - запуск сервиса
+type serveCommand struct{}
+
+//Execute - реализует интерфейс flags.Commander
+func (c *serveCommand) Execute(args []string) error {
+	return serve()
+}
+
+//migrateCommand - применение миграций схемы базы данных
+type migrateCommand struct{}
+
+//Execute - реализует интерфейс flags.Commander
+func (c *migrateCommand) Execute(args []string) error {
+	accSt, err := openStorage()
+	if err != nil {
+		return err
+	}
+	applied, custErr := accSt.Migrate()
+	for _, version := range applied {
+		fmt.Printf("применена миграция %d\n", version)
+	}
+	if custErr != nil {
+		return custErr.Err
+	}
+	fmt.Printf("версия схемы базы данных: %d\n", model.SchemaVersion)
+	return nil
+}
+
+//accountCommand - команды для работы с аккаунтами
+type accountCommand struct {
+	Show     accountShowCommand     `command:"show" description:"Print account balance and last operations"`
+	Adjust   accountAdjustCommand   `command:"adjust" description:"Change account balance by delta"`
+	Freeze   accountFreezeCommand   `command:"freeze" description:"Freeze account: its balance can not be changed"`
+	Unfreeze accountUnfreezeCommand `command:"unfreeze" description:"Unfreeze account"`
+	Parent   accountParentCommand   `command:"parent" description:"Make account a sub-account of the parent account"`
+	Product  accountProductCommand  `command:"product" description:"Set account product that defines interest rate"`
+}
+
+//accountShowCommand - вывод баланса и последних операций аккаунта
+type accountShowCommand struct {
+	Last int        `long:"last" description:"Number of last operations to print" default:"10"`
+	Args accountArg `positional-args:"yes" required:"yes"`
+}
+
+//Execute - реализует интерфейс flags.Commander
+func (c *accountShowCommand) Execute(args []string) error {
+	accSt, err := openStorage()
+	if err != nil {
+		return err
+	}
+	account, custErr := accSt.GetAccountBalance(c.Args.Id)
+	if custErr != nil {
+		return custErr.Err
+	}
+	history, custErr := accSt.GetSortedTransactionsHistory(c.Args.Id, model.TransactionTime, true, model.HistoryFilter{})
+	if custErr != nil {
+		return custErr.Err
+	}
+	if len(history) > c.Last {
+		history = history[:c.Last]
+	}
+	i18n.LocalizeHistory(i18n.DefaultLang, history)
+	printJSON(struct {
+		Account        *model.BalanceInfo
+		LastOperations []model.TransactionRecord
+	}{Account: account, LastOperations: history})
+	return nil
+}
+
+//accountAdjustCommand - изменение баланса аккаунта (как операция пополнения или снятия средств)
+type accountAdjustCommand struct {
+	Delta   float64    `long:"delta" description:"Amount to add to the balance (negative - to withdraw)" required:"yes"`
+	Purpose string     `long:"purpose" description:"Purpose of the operation"`
+	Ref     string     `long:"ref" description:"External reference of the operation (e.g. ticket id)"`
+	Args    accountArg `positional-args:"yes" required:"yes"`
+}
+
+//Execute - реализует интерфейс flags.Commander
+func (c *accountAdjustCommand) Execute(args []string) error {
+	if c.Delta == 0 {
+		return errors.New(i18n.Message(i18n.DefaultLang, i18n.NullSum))
+	}
+	accSt, err := openStorage()
+	if err != nil {
+		return err
+	}
+	result, custErr := accSt.ChangeAccountBalance(c.Args.Id, c.Delta, model.OperationDetails{Purpose: c.Purpose, ExternalRef: c.Ref})
+	if custErr != nil {
+		return custErr.Err
+	}
+	fmt.Println(i18n.OperationMessage(i18n.DefaultLang, result))
+	return nil
+}
+
+//accountFreezeCommand - блокировка аккаунта
+type accountFreezeCommand struct {
+	Args accountArg `positional-args:"yes" required:"yes"`
+}
+
+//Execute - реализует интерфейс flags.Commander
+func (c *accountFreezeCommand) Execute(args []string) error {
+	return setAccountFrozen(c.Args.Id, true)
+}
+
+//accountUnfreezeCommand - разблокировка аккаунта
+type accountUnfreezeCommand struct {
+	Args accountArg `positional-args:"yes" required:"yes"`
+}
+
+//Execute - реализует интерфейс flags.Commander
+func (c *accountUnfreezeCommand) Execute(args []string) error {
+	return setAccountFrozen(c.Args.Id, false)
+}
+
+//setAccountFrozen - блокировка или разблокировка аккаунта id
+func setAccountFrozen(id int, frozen bool) error {
+	accSt, err := openStorage()
+	if err != nil {
+		return err
+	}
+	if custErr := accSt.SetAccountFrozen(id, frozen); custErr != nil {
+		return custErr.Err
+	}
+	state := "разблокирован"
+	if frozen {
+		state = "заблокирован"
+	}
+	fmt.Printf("аккаунт %d %s\n", id, state)
+	return nil
+}
+
+//accountParentCommand - подчинение аккаунта родительскому аккаунту
+type accountParentCommand struct {
+	Parent int        `long:"parent" description:"Parent account id (0 - detach from the parent)" required:"yes"`
+	Args   accountArg `positional-args:"yes" required:"yes"`
+}
+
+//Execute - реализует интерфейс flags.Commander
+func (c *accountParentCommand) Execute(args []string) error {
+	accSt, err := openStorage()
+	if err != nil {
+		return err
+	}
+	if custErr := accSt.SetAccountParent(c.Args.Id, c.Parent); custErr != nil {
+		return custErr.Err
+	}
+	if c.Parent == 0 {
+		fmt.Printf("аккаунт %d отделен от родительского аккаунта\n", c.Args.Id)
+	} else {
+		fmt.Printf("аккаунт %d подчинен аккаунту %d\n", c.Args.Id, c.Parent)
+	}
+	return nil
+}
+
+//accountProductCommand - подключение аккаунта к продукту
+type accountProductCommand struct {
+	Product string     `long:"product" description:"Product (empty - disconnect from the product)" required:"yes"`
+	Args    accountArg `positional-args:"yes" required:"yes"`
+}
+
+//Execute - реализует интерфейс flags.Commander
+func (c *accountProductCommand) Execute(args []string) error {
+	accSt, err := openStorage()
+	if err != nil {
+		return err
+	}
+	if custErr := accSt.SetAccountProduct(c.Args.Id, c.Product); custErr != nil {
+		return custErr.Err
+	}
+	if c.Product == "" {
+		fmt.Printf("аккаунт %d отключен от продукта\n", c.Args.Id)
+	} else {
+		fmt.Printf("аккаунт %d подключен к продукту %s\n", c.Args.Id, c.Product)
+	}
+	return nil
+}
+
+//historyCommand - команды для работы с историей операций
+type historyCommand struct {
+	Export historyExportCommand `command:"export" description:"Export account transaction history"`
+	Verify historyVerifyCommand `command:"verify" description:"Verify history hash chain of the account (all accounts if no id is given)"`
+}
+
+//historyExportCommand - выгрузка истории операций аккаунта в CSV или JSON
+type historyExportCommand struct {
+	Format       string     `long:"format" description:"Output format" choice:"csv" choice:"json" default:"csv"`
+	Output       string     `long:"output" short:"o" description:"Output file (stdout by default)"`
+	Types        []string   `long:"type" description:"Export only operations of the type (can be repeated)" choice:"deposit" choice:"withdrawal" choice:"transfer_in" choice:"transfer_out" choice:"fee" choice:"reversal" choice:"interest"`
+	Counterparty int        `long:"counterparty" description:"Export only operations with the counterparty account"`
+	Args         accountArg `positional-args:"yes" required:"yes"`
+}
+
+//Execute - реализует интерфейс flags.Commander
+func (c *historyExportCommand) Execute(args []string) error {
+	accSt, err := openStorage()
+	if err != nil {
+		return err
+	}
+	history, custErr := accSt.GetSortedTransactionsHistory(c.Args.Id, model.TransactionTime, false, model.HistoryFilter{OperationTypes: c.Types, CounterpartyId: c.Counterparty})
+	if custErr != nil {
+		return custErr.Err
+	}
+	i18n.LocalizeHistory(i18n.DefaultLang, history)
+
+	out := io.Writer(os.Stdout)
+	if c.Output != "" {
+		file, err := os.Create(c.Output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	if c.Format == "json" {
+		if history == nil {
+			history = []model.TransactionRecord{}
+		}
+		return json.NewEncoder(out).Encode(history)
+	}
+	return writeHistoryCSV(out, history)
+}
+
+//writeHistoryCSV - запись истории операций в формате CSV с заголовком
+func writeHistoryCSV(out io.Writer, history []model.TransactionRecord) error {
+	writer := csv.NewWriter(out)
+	writer.Write([]string{"id", "account_id", "created_at", "operation_type", "delta", "remaining_balance", "counterparty_id", "message", "purpose", "external_ref", "metadata", "hash"})
+	for _, record := range history {
+		counterparty := ""
+		if record.CounterpartyId != nil {
+			counterparty = strconv.Itoa(*record.CounterpartyId)
+		}
+		metadata := ""
+		if len(record.Metadata) > 0 {
+			data, _ := json.Marshal(record.Metadata)
+			metadata = string(data)
+		}
+		writer.Write([]string{
+			strconv.FormatInt(record.Id, 10),
+			strconv.Itoa(record.AccountId),
+			record.CreatedAt.Format(time.RFC3339Nano),
+			record.OperationType,
+			strconv.FormatFloat(record.Delta, 'f', -1, 64),
+			strconv.FormatFloat(record.RemainingBalance, 'f', -1, 64),
+			counterparty,
+			record.TransactionMessage,
+			record.Purpose,
+			record.ExternalRef,
+			metadata,
+			record.Hash,
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+//historyVerifyCommand - проверка цепочки хешей истории. Выводятся результаты проверки нарушенных цепочек,
+//для одного аккаунта - результат в любом случае
+type historyVerifyCommand struct {
+	Args struct {
+		Id int `positional-arg-name:"id"`
+	} `positional-args:"yes"`
+}
+
+//Execute - реализует интерфейс flags.Commander
+func (c *historyVerifyCommand) Execute(args []string) error {
+	accSt, err := openStorage()
+	if err != nil {
+		return err
+	}
+	ids := []int{c.Args.Id}
+	if c.Args.Id == 0 {
+		var custErr *model.CustomErr
+		if ids, custErr = accSt.GetAccountIds(); custErr != nil {
+			return custErr.Err
+		}
+	}
+	valid := true
+	for _, id := range ids {
+		history, custErr := accSt.GetHistoryChain(id)
+		if custErr != nil {
+			return custErr.Err
+		}
+		result := hashchain.Verify(id, history)
+		if !result.Valid || c.Args.Id != 0 {
+			printJSON(result)
+		}
+		valid = valid && result.Valid
+	}
+	if !valid {
+		return errCheckFailed
+	}
+	return nil
+}
+
+//reconcileCommand - сверка балансов с историей операций
+type reconcileCommand struct{}
+
+//Execute - реализует интерфейс flags.Commander
+func (c *reconcileCommand) Execute(args []string) error {
+	accSt, err := openStorage()
+	if err != nil {
+		return err
+	}
+	run, custErr := reconcile.NewJob(accSt, 0).RunOnce(time.Now())
+	if custErr != nil {
+		return custErr.Err
+	}
+	printJSON(run)
+	if run.DiscrepancyCount > 0 {
+		return errCheckFailed
+	}
+	return nil
+}
+
+//ratesCommand - команды для работы с курсами валют
+type ratesCommand struct {
+	Refresh ratesRefreshCommand `command:"refresh" description:"Request current exchange rates from the provider and print them"`
+}
+
+//ratesRefreshCommand - запрос текущих курсов валют у поставщика
+type ratesRefreshCommand struct{}
+
+//Execute - реализует интерфейс flags.Commander
+func (c *ratesRefreshCommand) Execute(args []string) error {
+	config, err := initConfig()
+	if err != nil {
+		return err
+	}
+	convert.Configure(config.Rates)
+	data, err := (&convert.ConvertDataStorerStruct{}).Refresh()
+	if err != nil {
+		return err
+	}
+	if len(data.Rates) == 0 {
+		return fmt.Errorf("поставщик не вернул курсы валют")
+	}
+	printJSON(data)
+	return nil
+}
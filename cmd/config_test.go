@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//writeConfigFile - временный файл конфигурации с содержимым content
+func writeConfigFile(t *testing.T, content string) string {
+	file, err := ioutil.TempFile("", "config*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	file.WriteString(content)
+	return file.Name()
+}
+
+//TestLoadConfigFile - значения из файла заменяют значения по умолчанию, отсутствующие в файле остаются
+func TestLoadConfigFile(t *testing.T) {
+	path := writeConfigFile(t, "server:\n  http: \":8080\"\n  write_timeout: 1m\ndatabase:\n  replicas: [\"host=r1\", \"host=r2\"]\n")
+	defer os.Remove(path)
+	e := defaultEnvs()
+	assert.Nil(t, loadConfigFile(path, &e))
+	assert.Equal(t, ":8080", e.Server.Address)
+	assert.Equal(t, time.Minute, e.Server.WriteTimeout)
+	assert.Equal(t, []string{"host=r1", "host=r2"}, e.Database.Replicas)
+	assert.Equal(t, ":9000", e.Server.GrpcAddress)
+	assert.Equal(t, defaultEnvs().Database.Conn, e.Database.Conn)
+	assert.Nil(t, e.validate())
+}
+
+//TestLoadConfigFileUnknownField - неизвестный параметр файла является ошибкой
+func TestLoadConfigFileUnknownField(t *testing.T) {
+	path := writeConfigFile(t, "server:\n  htp: \":8080\"\n")
+	defer os.Remove(path)
+	e := defaultEnvs()
+	assert.Error(t, loadConfigFile(path, &e))
+}
+
+//TestConfigFilePath - путь к файлу находится среди остальных флагов и команд
+func TestConfigFilePath(t *testing.T) {
+	assert.Equal(t, "c.yaml", configFilePath([]string{"--http", ":1", "config", "print", "--config", "c.yaml"}))
+	assert.Equal(t, "c.yaml", configFilePath([]string{"--config=c.yaml", "serve"}))
+}
+
+//TestValidateDefaults - значения по умолчанию проходят проверку
+func TestValidateDefaults(t *testing.T) {
+	assert.Nil(t, defaultEnvs().validate())
+}
+
+//TestValidateFail - проверка находит все нарушения
+func TestValidateFail(t *testing.T) {
+	e := defaultEnvs()
+	e.Server.ReadTimeout = -time.Second
+	e.Server.MaxBodyBytes = 0
+	e.Database.MaxIdleConns = 50
+	e.Rates.URL = "api.exchangeratesapi.io"
+	e.Rates.HistoricalURL = "https://api.exchangeratesapi.io/latest"
+	e.Rates.DefaultCurrency = "dollar"
+	e.Jobs.SchedulerInterval = 0
+	e.Limits.RateLimits = "* client=many"
+	e.Logging.Level = "verbose"
+	err := e.validate()
+	if assert.Error(t, err) {
+		for _, name := range []string{"server.read_timeout", "server.max_body_bytes", "database.max_idle_conns", "rates.url", "rates.historical_url",
+			"rates.default_currency", "jobs.scheduler_interval", "limits.rate_limits", "logging.level"} {
+			assert.Contains(t, err.Error(), name)
+		}
+	}
+}
+
+//TestMaskPasswords - пароли в строках подключения скрываются
+func TestMaskPasswords(t *testing.T) {
+	assert.Equal(t, "user=postgres password=*** host=db", maskPasswords("user=postgres password=example host=db"))
+	assert.Equal(t, "postgres://user:***@db/accounts", maskPasswords("postgres://user:secret@db/accounts"))
+	assert.Equal(t, "postgres://db/accounts", maskPasswords("postgres://db/accounts"))
+}
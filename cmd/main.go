@@ -1,51 +1,276 @@
 package main
 
 import (
-	"fmt"
+	"os"
+	"strings"
+	"time"
 
+	"github.com/call-me-snake/user_balance_service/internal/bonus"
+	"github.com/call-me-snake/user_balance_service/internal/convert"
+	"github.com/call-me-snake/user_balance_service/internal/grpcserver"
+	"github.com/call-me-snake/user_balance_service/internal/interest"
 	"github.com/call-me-snake/user_balance_service/internal/model"
+	"github.com/call-me-snake/user_balance_service/internal/ratelimit"
+	"github.com/call-me-snake/user_balance_service/internal/reconcile"
+	"github.com/call-me-snake/user_balance_service/internal/scheduler"
 	"github.com/call-me-snake/user_balance_service/internal/server"
+	"github.com/call-me-snake/user_balance_service/internal/snapshot"
+	"github.com/call-me-snake/user_balance_service/internal/statement"
 	"github.com/call-me-snake/user_balance_service/internal/storage"
+	"github.com/call-me-snake/user_balance_service/internal/tlsconfig"
+	"github.com/call-me-snake/user_balance_service/internal/webhook"
 	"github.com/jessevdk/go-flags"
 	"github.com/labstack/gommon/log"
 )
 
-//envs получает переменные окружения
+//envs - параметры сервиса. Значения по умолчанию (defaultEnvs) переопределяются файлом конфигурации,
+//затем переменными окружения и флагами командной строки
 type envs struct {
-	ServerAddress      string `long:"http" env:"SERVER" description:"address of microservice" default:":8000"`
-	AccountStorageConn string `long:"accstconn" env:"ACC_STORAGE" description:"Connection string to account storage database" default:"user=postgres password=example dbname=accounts sslmode=disable port=5432 host=localhost"`
+	ConfigFile string       `long:"config" env:"CONFIG_FILE" description:"Path to YAML configuration file" yaml:"-"`
+	Server     serverEnvs   `group:"Server options" yaml:"server"`
+	Database   databaseEnvs `group:"Database options" yaml:"database"`
+	Rates      ratesEnvs    `group:"Exchange rates options" yaml:"rates"`
+	Jobs       jobsEnvs     `group:"Background jobs options" yaml:"jobs"`
+	TLS        tlsEnvs      `group:"TLS options" yaml:"tls"`
+	Limits     limitsEnvs   `group:"Rate limiting options" yaml:"limits"`
+	Logging    loggingEnvs  `group:"Logging options" yaml:"logging"`
 }
 
-//initConfig - получает переменные окружения с помощью envs
+//serverEnvs - адреса и тайм-ауты серверов
+type serverEnvs struct {
+	Address           string        `long:"http" env:"SERVER" description:"address of microservice" yaml:"http"`
+	GrpcAddress       string        `long:"grpc" env:"GRPC_SERVER" description:"address of gRPC server" yaml:"grpc"`
+	ReadTimeout       time.Duration `long:"readtimeout" env:"SERVER_READ_TIMEOUT" description:"Maximum duration for reading an HTTP request (0 - unlimited)" yaml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `long:"readheadertimeout" env:"SERVER_READ_HEADER_TIMEOUT" description:"Maximum duration for reading HTTP request headers (0 - read timeout)" yaml:"read_header_timeout"`
+	WriteTimeout      time.Duration `long:"writetimeout" env:"SERVER_WRITE_TIMEOUT" description:"Maximum duration for writing an HTTP response (0 - unlimited)" yaml:"write_timeout"`
+	IdleTimeout       time.Duration `long:"idletimeout" env:"SERVER_IDLE_TIMEOUT" description:"Maximum time to wait for the next request on a keep-alive connection (0 - read timeout)" yaml:"idle_timeout"`
+	MaxBodyBytes      int64         `long:"maxbodybytes" env:"SERVER_MAX_BODY_BYTES" description:"Maximum size of an HTTP request body in bytes" yaml:"max_body_bytes"`
+	SwaggerUIDir      string        `long:"swaggeruidir" env:"SWAGGER_UI_DIR" description:"Directory with swagger-ui-dist assets served at /docs/assets" yaml:"swagger_ui_dir"`
+}
+
+//databaseEnvs - подключение к базе данных, пул соединений и реплики
+type databaseEnvs struct {
+	Conn             string        `long:"accstconn" env:"ACC_STORAGE" description:"Connection string to account storage database" yaml:"conn"`
+	MaxOpenConns     int           `long:"dbmaxopen" env:"DB_MAX_OPEN_CONNS" description:"Maximum number of open database connections (0 - unlimited)" yaml:"max_open_conns"`
+	MaxIdleConns     int           `long:"dbmaxidle" env:"DB_MAX_IDLE_CONNS" description:"Maximum number of idle database connections" yaml:"max_idle_conns"`
+	ConnMaxLifetime  time.Duration `long:"dbconnlifetime" env:"DB_CONN_MAX_LIFETIME" description:"Maximum time a database connection may be reused (0 - unlimited)" yaml:"conn_max_lifetime"`
+	StatementTimeout time.Duration `long:"dbstatementtimeout" env:"DB_STATEMENT_TIMEOUT" description:"Maximum execution time of a database statement (0 - unlimited)" yaml:"statement_timeout"`
+	PingInterval     time.Duration `long:"dbpinginterval" env:"DB_PING_INTERVAL" description:"Interval between database connection checks" yaml:"ping_interval"`
+	BreakerThreshold int           `long:"dbbreakerthreshold" env:"DB_BREAKER_THRESHOLD" description:"Consecutive database connection failures that open the circuit breaker" yaml:"breaker_threshold"`
+	BreakerCooldown  time.Duration `long:"dbbreakercooldown" env:"DB_BREAKER_COOLDOWN" description:"Time the circuit breaker stays open" yaml:"breaker_cooldown"`
+	Replicas         []string      `long:"replicas" env:"READ_REPLICAS" env-delim:";" description:"Connection strings to read replicas (separated by ';' in the environment variable)" yaml:"replicas"`
+	ReplicaMaxLag    time.Duration `long:"replicamaxlag" env:"REPLICA_MAX_LAG" description:"Maximum replication lag of a replica used for reads" yaml:"replica_max_lag"`
+	ReplicaBalance   bool          `long:"replicabalance" env:"REPLICA_BALANCE_READS" description:"Read account balances from replicas" yaml:"replica_balance_reads"`
+}
+
+//ratesEnvs - поставщик курсов валют
+type ratesEnvs struct {
+	URL             string        `long:"ratesurl" env:"RATES_URL" description:"URL of current exchange rates to the base currency" yaml:"url"`
+	HistoricalURL   string        `long:"rateshistoricalurl" env:"RATES_HISTORICAL_URL" description:"URL template of exchange rates for a date (%s - date in YYYY-MM-DD format)" yaml:"historical_url"`
+	CacheTTL        time.Duration `long:"ratescachettl" env:"RATES_CACHE_TTL" description:"Time the current exchange rates are cached" yaml:"cache_ttl"`
+	RequestTimeout  time.Duration `long:"ratestimeout" env:"RATES_REQUEST_TIMEOUT" description:"Timeout of a request to the exchange rates provider" yaml:"request_timeout"`
+	DefaultCurrency string        `long:"defaultcurrency" env:"DEFAULT_CURRENCY" description:"Currency of the balance when a request does not specify one" yaml:"default_currency"`
+}
+
+//tlsEnvs - TLS серверов HTTP и gRPC и проверка сертификатов клиентов
+type tlsEnvs struct {
+	CertFile           string            `long:"tlscert" env:"TLS_CERT_FILE" description:"Server certificate file (TLS is disabled if empty)" yaml:"cert_file"`
+	KeyFile            string            `long:"tlskey" env:"TLS_KEY_FILE" description:"Server private key file" yaml:"key_file"`
+	ClientCAFile       string            `long:"tlsclientca" env:"TLS_CLIENT_CA_FILE" description:"CA certificates to verify client certificates (client certificates are not requested if empty)" yaml:"client_ca_file"`
+	ClientCertOptional bool              `long:"tlsclientoptional" env:"TLS_CLIENT_CERT_OPTIONAL" description:"Accept connections without client certificate (such clients can access only health checks)" yaml:"client_cert_optional"`
+	AllowedClients     map[string]string `long:"tlsclient" env:"TLS_ALLOWED_CLIENTS" env-delim:";" description:"Allowed client certificate subject or common name and its client identity as subject:identity (any verified client if empty)" yaml:"allowed_clients"`
+	ReloadInterval     time.Duration     `long:"tlsreloadinterval" env:"TLS_RELOAD_INTERVAL" description:"Interval between checks for changed certificate files" yaml:"reload_interval"`
+}
+
+//jobsEnvs - интервалы фоновых задач
+type jobsEnvs struct {
+	SchedulerInterval time.Duration `long:"schedinterval" env:"SCHEDULER_INTERVAL" description:"Interval between checks for due scheduled transfers" yaml:"scheduler_interval"`
+	WebhookInterval   time.Duration `long:"webhookinterval" env:"WEBHOOK_INTERVAL" description:"Interval between checks for pending webhook deliveries" yaml:"webhook_interval"`
+	SnapshotInterval  time.Duration `long:"snapshotinterval" env:"SNAPSHOT_INTERVAL" description:"Interval between checks for days without balance snapshots" yaml:"snapshot_interval"`
+	ReconcileInterval time.Duration `long:"reconcileinterval" env:"RECONCILE_INTERVAL" description:"Interval between ledger reconciliations (0 - disabled)" yaml:"reconcile_interval"`
+	StatementInterval time.Duration `long:"statementinterval" env:"STATEMENT_INTERVAL" description:"Interval between checks for completed months without account statements" yaml:"statement_interval"`
+	InterestInterval  time.Duration `long:"interestinterval" env:"INTEREST_INTERVAL" description:"Interval between checks for completed days without interest accrual" yaml:"interest_interval"`
+	BonusInterval     time.Duration `long:"bonusinterval" env:"BONUS_INTERVAL" description:"Interval between checks for expired bonus lots" yaml:"bonus_interval"`
+}
+
+//limitsEnvs - ограничение частоты запросов
+type limitsEnvs struct {
+	RateLimits       string `long:"ratelimits" env:"RATE_LIMITS" description:"Rate limits per route, client and account" yaml:"rate_limits"`
+	RateLimitBackend string `long:"ratelimitbackend" env:"RATE_LIMIT_BACKEND" description:"Rate limit bucket storage: memory or postgres" choice:"memory" choice:"postgres" yaml:"rate_limit_backend"`
+}
+
+//loggingEnvs - журнал сервиса
+type loggingEnvs struct {
+	Level string `long:"loglevel" env:"LOG_LEVEL" description:"Log level" choice:"debug" choice:"info" choice:"warn" choice:"error" choice:"off" yaml:"level"`
+	File  string `long:"logfile" env:"LOG_FILE" description:"Log file (stderr by default)" yaml:"file"`
+}
+
+//commandLine - общие параметры (envs) и команды сервиса. Без команды выполняется serve
+type commandLine struct {
+	envs
+	Serve     serveCommand     `command:"serve" description:"Start HTTP and gRPC servers (default command)"`
+	Migrate   migrateCommand   `command:"migrate" description:"Apply pending database schema migrations"`
+	Account   accountCommand   `command:"account" description:"Inspect and manage accounts"`
+	History   historyCommand   `command:"history" description:"Export and verify transaction history"`
+	Reconcile reconcileCommand `command:"reconcile" description:"Reconcile balances with transaction history, print the report and exit"`
+	Rates     ratesCommand     `command:"rates" description:"Manage exchange rates"`
+	Config    configCommand    `command:"config" description:"Inspect service configuration"`
+}
+
+//cmdLine - разобранная командная строка. Команды получают общие параметры из нее
+var cmdLine commandLine
+
+//initConfig - проверенная конфигурация из файла, переменных окружения и флагов командной строки
 func initConfig() (model.Config, error) {
-	e := envs{}
+	e := cmdLine.envs
+	if err := e.validate(); err != nil {
+		return model.Config{}, err
+	}
 	c := model.Config{}
-	var err error
-	parser := flags.NewParser(&e, flags.Default)
-	if _, err = parser.Parse(); err != nil {
-		return c, fmt.Errorf("Init: %v", err)
+	c.ServerAddress = e.Server.Address
+	c.GrpcAddress = e.Server.GrpcAddress
+	c.AccountStorageConn = e.Database.Conn
+	c.SchedulerInterval = e.Jobs.SchedulerInterval
+	c.WebhookInterval = e.Jobs.WebhookInterval
+	c.SnapshotInterval = e.Jobs.SnapshotInterval
+	c.ReconcileInterval = e.Jobs.ReconcileInterval
+	c.StatementInterval = e.Jobs.StatementInterval
+	c.InterestInterval = e.Jobs.InterestInterval
+	c.BonusInterval = e.Jobs.BonusInterval
+	c.RateLimits = e.Limits.RateLimits
+	if c.RateLimits == "" {
+		c.RateLimits = ratelimit.DefaultConfig
+	}
+	c.RateLimitBackend = e.Limits.RateLimitBackend
+	c.Storage = model.StorageOptions{
+		MaxOpenConns:     e.Database.MaxOpenConns,
+		MaxIdleConns:     e.Database.MaxIdleConns,
+		ConnMaxLifetime:  e.Database.ConnMaxLifetime,
+		StatementTimeout: e.Database.StatementTimeout,
+		BreakerThreshold: e.Database.BreakerThreshold,
+		BreakerCooldown:  e.Database.BreakerCooldown,
+		PingInterval:     e.Database.PingInterval,
+
+		ReplicaMaxLag:       e.Database.ReplicaMaxLag,
+		ReplicaBalanceReads: e.Database.ReplicaBalance,
+	}
+	for _, conn := range e.Database.Replicas {
+		if conn = strings.TrimSpace(conn); conn != "" {
+			c.Storage.ReplicaConns = append(c.Storage.ReplicaConns, conn)
+		}
+	}
+	c.ServerTimeouts = model.ServerTimeouts{
+		ReadTimeout:       e.Server.ReadTimeout,
+		ReadHeaderTimeout: e.Server.ReadHeaderTimeout,
+		WriteTimeout:      e.Server.WriteTimeout,
+		IdleTimeout:       e.Server.IdleTimeout,
+	}
+	c.MaxBodyBytes = e.Server.MaxBodyBytes
+	c.SwaggerUIDir = e.Server.SwaggerUIDir
+	c.Rates = model.RatesOptions{
+		URL:             e.Rates.URL,
+		HistoricalURL:   e.Rates.HistoricalURL,
+		CacheTTL:        e.Rates.CacheTTL,
+		RequestTimeout:  e.Rates.RequestTimeout,
+		DefaultCurrency: strings.ToUpper(e.Rates.DefaultCurrency),
+	}
+	c.TLS = model.TLSOptions{
+		CertFile:           e.TLS.CertFile,
+		KeyFile:            e.TLS.KeyFile,
+		ClientCAFile:       e.TLS.ClientCAFile,
+		ClientCertOptional: e.TLS.ClientCertOptional,
+		AllowedClients:     e.TLS.AllowedClients,
+		ReloadInterval:     e.TLS.ReloadInterval,
 	}
-	c.ServerAddress = e.ServerAddress
-	c.AccountStorageConn = e.AccountStorageConn
+	c.LogLevel = e.Logging.Level
+	c.LogFile = e.Logging.File
 	return c, nil
 }
 
 func main() {
-	log.Print("Started")
-	//Устанавливаем значения переменных окружения
+	//сервис работает по UTC: время created_at сохраняется и дни (снимки, обороты, проценты) считаются по UTC
+	//независимо от часового пояса хоста
+	time.Local = time.UTC
+	//значения из файла конфигурации заполняются до разбора командной строки, чтобы их переопределяли
+	//переменные окружения и флаги
+	cmdLine.envs = defaultEnvs()
+	err := loadConfigFile(configFilePath(os.Args[1:]), &cmdLine.envs)
+	if err == nil {
+		parser := flags.NewParser(&cmdLine, flags.HelpFlag|flags.PassDoubleDash)
+		parser.SubcommandsOptional = true
+		_, err = parser.Parse()
+		if err == nil && parser.Active == nil {
+			err = serve()
+		}
+	}
+	os.Exit(exitCode(err))
+}
+
+//serve - запуск фоновых задач, gRPC и HTTP серверов. Возвращает ошибку, с которой остановился HTTP сервер
+func serve() error {
 	config, err := initConfig()
 	if err != nil {
-		log.Print(err.Error())
-		return
+		return err
 	}
+	if err = setupLogging(config); err != nil {
+		return err
+	}
+	convert.Configure(config.Rates)
+	log.Print("Started")
 	//Подключаемся к бд
-	accSt, err := storage.New(config.AccountStorageConn)
+	accSt, err := storage.New(config.AccountStorageConn, config.Storage)
 	if err != nil {
+		return err
+	}
+	//Запускаем выполнение запланированных переводов
+	scheduler.NewRunner(accSt, config.SchedulerInterval).Start()
+	//Запускаем доставку событий подписчикам
+	webhook.NewDispatcher(accSt, config.WebhookInterval).Start()
+	//Запускаем сохранение снимков балансов на конец дня
+	snapshot.NewJob(accSt, config.SnapshotInterval).Start()
+	//Запускаем периодическую сверку балансов с историей операций
+	reconcile.NewJob(accSt, config.ReconcileInterval).Start()
+	//Запускаем сохранение ежемесячных выписок по аккаунтам
+	statement.NewJob(accSt, config.StatementInterval).Start()
+	//Запускаем начисление и выплату процентов
+	interest.NewJob(accSt, config.InterestInterval).Start()
+	//Запускаем списание просроченных бонусов
+	bonus.NewJob(accSt, config.BonusInterval).Start()
+	//Загружаем сертификаты и следим за их изменением
+	var certs *tlsconfig.Manager
+	if config.TLS.CertFile != "" {
+		if certs, err = tlsconfig.New(config.TLS); err != nil {
+			return err
+		}
+		certs.Start()
+	}
+	//Разворачиваем gRPC сервер
+	grpcServer := grpcserver.New(config.GrpcAddress)
+	if certs != nil {
+		grpcServer.SetTLS(certs)
+	}
+	go func() {
+		err := grpcServer.Start(accSt)
 		log.Print(err.Error())
-		return
+	}()
+	//Настраиваем ограничение частоты запросов
+	limits, err := ratelimit.ParseConfig(config.RateLimits)
+	if err != nil {
+		return err
+	}
+	backend := ratelimit.NewMemoryBackend()
+	if config.RateLimitBackend == "postgres" {
+		backend = ratelimit.NewStorageBackend(accSt, limits)
 	}
 	//Разворачиваем сервер
 	s := server.New(config.ServerAddress)
-	err = s.Start(accSt)
-	log.Print(err.Error())
+	s.SetTimeouts(config.ServerTimeouts)
+	s.SetMaxBodyBytes(config.MaxBodyBytes)
+	s.SetSwaggerUIDir(config.SwaggerUIDir)
+	if certs != nil {
+		s.SetTLS(certs)
+	}
+	s.SetRateLimiter(ratelimit.NewLimiter(limits, backend))
+	return s.Start(accSt)
 }
+
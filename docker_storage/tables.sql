@@ -2,6 +2,9 @@ CREATE TABLE accounts
 (
     account_id INTEGER CONSTRAINT account_id_pk PRIMARY KEY,
     balance NUMERIC CONSTRAINT positive_balance CHECK (balance>=0),
+    tier TEXT NOT NULL DEFAULT 'standard',
+    frozen BOOLEAN NOT NULL DEFAULT FALSE,
+    parent_id INTEGER REFERENCES accounts ON DELETE RESTRICT,
     CONSTRAINT positive_id CHECK (account_id>0)
 );
 
@@ -9,9 +12,266 @@ CREATE TABLE accounts
 
 CREATE TABLE transactions_history
 (
+    id BIGSERIAL CONSTRAINT transactions_history_pk PRIMARY KEY,
     account_id INTEGER REFERENCES accounts ON DELETE RESTRICT,
     delta NUMERIC,
     remaining_balance NUMERIC CONSTRAINT positive_balance CHECK (remaining_balance>=0),
+    operation_type TEXT NOT NULL,
+    counterparty_id INTEGER,
     transaction_message TEXT,
-    created_at TIMESTAMP 
-);
\ No newline at end of file
+    purpose TEXT NOT NULL DEFAULT '',
+    external_ref TEXT NOT NULL DEFAULT '',
+    metadata JSONB,
+    reversal_of BIGINT,
+    pair_id BIGINT,
+    operation_currency TEXT NOT NULL DEFAULT '',
+    operation_rate NUMERIC,
+    created_at TIMESTAMP,
+    prev_hash TEXT NOT NULL DEFAULT '',
+    hash TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE fee_rules
+(
+    id SERIAL CONSTRAINT fee_rules_pk PRIMARY KEY,
+    operation TEXT NOT NULL,
+    currency TEXT NOT NULL DEFAULT '',
+    account_tier TEXT NOT NULL DEFAULT '',
+    fixed NUMERIC NOT NULL DEFAULT 0,
+    percent NUMERIC NOT NULL DEFAULT 0,
+    min_fee NUMERIC NOT NULL DEFAULT 0,
+    max_fee NUMERIC NOT NULL DEFAULT 0,
+    revenue_account_id INTEGER NOT NULL CONSTRAINT positive_revenue_account_id CHECK (revenue_account_id>0)
+);
+
+--INSERT INTO fee_rules (operation,percent,min_fee,max_fee,revenue_account_id) VALUES ('transfer',1,10,500,1000000);
+--INSERT INTO fee_rules (operation,account_tier,fixed,revenue_account_id) VALUES ('withdrawal','premium',0,1000000);
+
+CREATE TABLE scheduled_transfers
+(
+    id SERIAL CONSTRAINT scheduled_transfers_pk PRIMARY KEY,
+    from_id INTEGER NOT NULL CONSTRAINT positive_from_id CHECK (from_id>0),
+    to_id INTEGER NOT NULL CONSTRAINT positive_to_id CHECK (to_id>0),
+    delta NUMERIC NOT NULL CONSTRAINT positive_delta CHECK (delta>0),
+    recurrence TEXT NOT NULL DEFAULT '',
+    next_run_at TIMESTAMP NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    max_retries INTEGER NOT NULL DEFAULT 0,
+    retry_interval_sec INTEGER NOT NULL DEFAULT 0,
+    retry_count INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    locked_until TIMESTAMP,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX scheduled_transfers_due_idx ON scheduled_transfers (next_run_at) WHERE active;
+
+CREATE TABLE scheduled_transfer_runs
+(
+    id SERIAL CONSTRAINT scheduled_transfer_runs_pk PRIMARY KEY,
+    schedule_id INTEGER NOT NULL REFERENCES scheduled_transfers ON DELETE CASCADE,
+    run_at TIMESTAMP NOT NULL,
+    attempt INTEGER NOT NULL,
+    success BOOLEAN NOT NULL,
+    message TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE outbox_events
+(
+    id BIGSERIAL CONSTRAINT outbox_events_pk PRIMARY KEY,
+    event_type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX outbox_events_created_at_idx ON outbox_events (created_at);
+
+CREATE TABLE webhook_subscriptions
+(
+    id SERIAL CONSTRAINT webhook_subscriptions_pk PRIMARY KEY,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE webhook_deliveries
+(
+    id BIGSERIAL CONSTRAINT webhook_deliveries_pk PRIMARY KEY,
+    event_id BIGINT NOT NULL REFERENCES outbox_events ON DELETE CASCADE,
+    subscription_id INTEGER NOT NULL REFERENCES webhook_subscriptions ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL,
+    last_error TEXT NOT NULL DEFAULT '',
+    locked_until TIMESTAMP,
+    delivered_at TIMESTAMP
+);
+
+CREATE INDEX webhook_deliveries_pending_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+
+CREATE TABLE rate_limit_buckets
+(
+    key TEXT CONSTRAINT rate_limit_buckets_pk PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE schema_migrations
+(
+    version INTEGER CONSTRAINT schema_migrations_pk PRIMARY KEY,
+    applied_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+INSERT INTO schema_migrations (version) VALUES (1);
+
+CREATE TABLE balance_snapshots
+(
+    account_id INTEGER NOT NULL,
+    snapshot_date DATE NOT NULL,
+    balance NUMERIC NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    CONSTRAINT balance_snapshots_pk PRIMARY KEY (account_id, snapshot_date)
+);
+
+CREATE INDEX transactions_history_account_created_idx ON transactions_history (account_id, created_at);
+
+INSERT INTO schema_migrations (version) VALUES (2);
+
+CREATE TABLE reconciliation_runs
+(
+    id BIGSERIAL CONSTRAINT reconciliation_runs_pk PRIMARY KEY,
+    started_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP NOT NULL,
+    accounts_checked INTEGER NOT NULL,
+    discrepancy_count INTEGER NOT NULL,
+    report JSONB NOT NULL
+);
+
+INSERT INTO schema_migrations (version) VALUES (3);
+
+CREATE INDEX transactions_history_account_id_idx ON transactions_history (account_id, id);
+
+INSERT INTO schema_migrations (version) VALUES (4);
+
+INSERT INTO schema_migrations (version) VALUES (5);
+
+CREATE TABLE account_statements
+(
+    id BIGSERIAL CONSTRAINT account_statements_pk PRIMARY KEY,
+    account_id INTEGER NOT NULL,
+    period_start TIMESTAMP NOT NULL,
+    period_end TIMESTAMP NOT NULL,
+    opening_balance NUMERIC NOT NULL,
+    closing_balance NUMERIC NOT NULL,
+    total_credits NUMERIC NOT NULL,
+    total_debits NUMERIC NOT NULL,
+    movement_count INTEGER NOT NULL,
+    generated_at TIMESTAMP NOT NULL,
+    movements JSONB NOT NULL,
+    CONSTRAINT account_statements_period_key UNIQUE (account_id, period_start, period_end)
+);
+
+INSERT INTO schema_migrations (version) VALUES (6);
+
+CREATE TABLE daily_turnover
+(
+    account_id INTEGER NOT NULL,
+    day DATE NOT NULL,
+    operation_type TEXT NOT NULL,
+    credits NUMERIC NOT NULL,
+    debits NUMERIC NOT NULL,
+    operation_count INTEGER NOT NULL,
+    CONSTRAINT daily_turnover_pk PRIMARY KEY (account_id, day, operation_type)
+);
+
+CREATE INDEX daily_turnover_day_idx ON daily_turnover (day);
+
+INSERT INTO schema_migrations (version) VALUES (7);
+
+CREATE INDEX transactions_history_external_ref_idx ON transactions_history (external_ref) WHERE external_ref <> '';
+
+INSERT INTO schema_migrations (version) VALUES (8);
+
+CREATE UNIQUE INDEX transactions_history_reversal_of_idx ON transactions_history (reversal_of) WHERE reversal_of IS NOT NULL;
+CREATE INDEX transactions_history_counterparty_idx ON transactions_history (account_id, counterparty_id);
+
+INSERT INTO schema_migrations (version) VALUES (9);
+
+CREATE INDEX accounts_parent_id_idx ON accounts (parent_id) WHERE parent_id IS NOT NULL;
+
+INSERT INTO schema_migrations (version) VALUES (10);
+
+CREATE TABLE account_products
+(
+    product TEXT CONSTRAINT account_products_pk PRIMARY KEY,
+    annual_rate NUMERIC NOT NULL CONSTRAINT non_negative_annual_rate CHECK (annual_rate>=0),
+    expense_account_id INTEGER NOT NULL REFERENCES accounts ON DELETE RESTRICT,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+--INSERT INTO account_products (product,annual_rate,expense_account_id,description) VALUES ('savings',4.5,1000001,'Накопительный счет');
+
+ALTER TABLE accounts ADD COLUMN product TEXT REFERENCES account_products ON DELETE RESTRICT;
+
+CREATE TABLE interest_accruals
+(
+    account_id INTEGER NOT NULL,
+    day DATE NOT NULL,
+    balance NUMERIC NOT NULL,
+    annual_rate NUMERIC NOT NULL,
+    amount NUMERIC NOT NULL,
+    expense_account_id INTEGER NOT NULL,
+    paid_record_id BIGINT,
+    CONSTRAINT interest_accruals_pk PRIMARY KEY (account_id, day)
+);
+
+CREATE INDEX interest_accruals_unpaid_idx ON interest_accruals (account_id, day) WHERE paid_record_id IS NULL;
+
+CREATE TABLE interest_accrual_days
+(
+    day DATE CONSTRAINT interest_accrual_days_pk PRIMARY KEY,
+    account_count INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+INSERT INTO schema_migrations (version) VALUES (11);
+
+CREATE TABLE bonus_lots
+(
+    id BIGSERIAL CONSTRAINT bonus_lots_pk PRIMARY KEY,
+    account_id INTEGER NOT NULL REFERENCES accounts ON DELETE RESTRICT,
+    amount NUMERIC NOT NULL CONSTRAINT positive_bonus_amount CHECK (amount>0),
+    remaining NUMERIC NOT NULL CONSTRAINT valid_bonus_remaining CHECK (remaining>=0 AND remaining<=amount),
+    purpose TEXT NOT NULL DEFAULT '',
+    external_ref TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX bonus_lots_active_idx ON bonus_lots (account_id, id) WHERE remaining > 0;
+
+CREATE INDEX bonus_lots_expiry_idx ON bonus_lots (expires_at) WHERE remaining > 0;
+
+CREATE TABLE bonus_history
+(
+    id BIGSERIAL CONSTRAINT bonus_history_pk PRIMARY KEY,
+    account_id INTEGER NOT NULL REFERENCES accounts ON DELETE RESTRICT,
+    lot_id BIGINT NOT NULL REFERENCES bonus_lots ON DELETE RESTRICT,
+    delta NUMERIC NOT NULL,
+    remaining_balance NUMERIC NOT NULL,
+    operation_type TEXT NOT NULL,
+    purpose TEXT NOT NULL DEFAULT '',
+    external_ref TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX bonus_history_account_idx ON bonus_history (account_id, id);
+
+INSERT INTO schema_migrations (version) VALUES (12);
+
+CREATE INDEX transactions_history_pair_id_idx ON transactions_history (pair_id) WHERE pair_id IS NOT NULL;
+
+INSERT INTO schema_migrations (version) VALUES (13);
+
+INSERT INTO schema_migrations (version) VALUES (14);
@@ -0,0 +1,41 @@
+package bonus
+
+import (
+	"log"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/model"
+)
+
+//Job - списывает остатки партий бонусов, срок действия которых истек, с записью в историю бонусов
+type Job struct {
+	accStorage model.IBalanceInfoStorage
+	interval   time.Duration
+}
+
+//NewJob - конструктор *Job. interval - период проверки просроченных партий бонусов
+func NewJob(accStorage model.IBalanceInfoStorage, interval time.Duration) *Job {
+	return &Job{accStorage: accStorage, interval: interval}
+}
+
+//Start - запускает периодическое списание просроченных бонусов в отдельной горутине
+func (j *Job) Start() {
+	go func() {
+		for {
+			j.RunDue(time.Now())
+			time.Sleep(j.interval)
+		}
+	}()
+}
+
+//RunDue - списывает остатки всех партий бонусов, срок действия которых истек к моменту now
+func (j *Job) RunDue(now time.Time) {
+	count, custErr := j.accStorage.ExpireBonusLots(now)
+	if custErr != nil {
+		log.Printf("bonus.RunDue: %s", custErr.Err.Error())
+		return
+	}
+	if count > 0 {
+		log.Printf("bonus.RunDue: списаны просроченные партии бонусов: %d", count)
+	}
+}
@@ -0,0 +1,32 @@
+package bonus
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	mock_model "github.com/call-me-snake/user_balance_service/internal/model/mock"
+	"github.com/golang/mock/gomock"
+)
+
+//TestRunDue - просроченные партии списываются на момент запуска
+func TestRunDue(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	accStorage := mock_model.NewMockIBalanceInfoStorage(mockCtrl)
+	now := time.Date(2020, 10, 2, 0, 30, 0, 0, time.UTC)
+	accStorage.EXPECT().ExpireBonusLots(now).Return(int64(3), nil)
+	NewJob(accStorage, time.Hour).RunDue(now)
+}
+
+//TestRunDueError - ошибка базы данных не прерывает работу задачи
+func TestRunDueError(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	accStorage := mock_model.NewMockIBalanceInfoStorage(mockCtrl)
+	now := time.Date(2020, 10, 2, 0, 30, 0, 0, time.UTC)
+	accStorage.EXPECT().ExpireBonusLots(now).
+		Return(int64(0), &model.CustomErr{Err: errors.New("Ошибка"), ErrCode: model.DefaultErrCode})
+	NewJob(accStorage, time.Hour).RunDue(now)
+}
@@ -0,0 +1,62 @@
+package breaker
+
+import (
+	"sync"
+	"time"
+)
+
+//Значения по умолчанию
+const (
+	DefaultThreshold = 3
+	DefaultCooldown  = 10 * time.Second
+)
+
+//Breaker - автоматический выключатель: после threshold ошибок подряд размыкается на время cooldown,
+//в течение которого обращения к зависимости не выполняются. По истечении cooldown пропускает обращения
+//и снова размыкается при первой ошибке (пока не будет успешного обращения)
+type Breaker struct {
+	mutex     sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+}
+
+//New - конструктор *Breaker. Нулевые значения параметров заменяются значениями по умолчанию
+func New(threshold int, cooldown time.Duration) *Breaker {
+	if threshold <= 0 {
+		threshold = DefaultThreshold
+	}
+	if cooldown <= 0 {
+		cooldown = DefaultCooldown
+	}
+	return &Breaker{threshold: threshold, cooldown: cooldown}
+}
+
+//Success - успешное обращение: выключатель замыкается
+func (b *Breaker) Success() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.failures = 0
+	b.openUntil = time.Time{}
+}
+
+//Failure - неудачное обращение в момент now
+func (b *Breaker) Failure(now time.Time) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.failures++
+	if b.failures >= b.threshold && !now.Before(b.openUntil) {
+		b.openUntil = now.Add(b.cooldown)
+	}
+}
+
+//Open - разомкнут ли выключатель в момент now и через какое время будет пропущено следующее обращение
+func (b *Breaker) Open(now time.Time) (open bool, retryAfter time.Duration) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if now.Before(b.openUntil) {
+		return true, b.openUntil.Sub(now)
+	}
+	return false, 0
+}
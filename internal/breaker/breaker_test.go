@@ -0,0 +1,34 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//TestBreaker - размыкание после серии ошибок, пропуск обращений по истечении cooldown и замыкание после успеха
+func TestBreaker(t *testing.T) {
+	b := New(2, time.Second)
+	now := time.Date(2020, 9, 21, 0, 0, 0, 0, time.UTC)
+
+	b.Failure(now)
+	open, _ := b.Open(now)
+	assert.False(t, open)
+
+	b.Failure(now)
+	open, retryAfter := b.Open(now.Add(400 * time.Millisecond))
+	assert.True(t, open)
+	assert.Equal(t, 600*time.Millisecond, retryAfter)
+
+	now = now.Add(time.Second)
+	open, _ = b.Open(now)
+	assert.False(t, open)
+	b.Failure(now)
+	open, _ = b.Open(now)
+	assert.True(t, open)
+
+	b.Success()
+	open, _ = b.Open(now)
+	assert.False(t, open)
+}
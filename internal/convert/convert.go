@@ -6,22 +6,86 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/call-me-snake/user_balance_service/internal/model"
 )
 
 var (
-	convertDataStorage model.ConvertData
-	coursesStorerUrl   = "https://api.exchangeratesapi.io/latest?base=RUB"
+	//convertDataStorage - текущие курсы валют, доступ через convertDataStorageMutex
+	convertDataStorage      model.ConvertData
+	convertDataStorageMutex sync.RWMutex
+	coursesStorerUrl        = "https://api.exchangeratesapi.io/latest?base=RUB"
+	//historicalCoursesStorerUrl - шаблон адреса курсов на дату, подставляется дата в формате historicalDateLayout
+	historicalCoursesStorerUrl = "https://api.exchangeratesapi.io/%s?base=RUB"
+
+	//historicalDataStorage - кеш курсов на дату. Курсы прошедших дней не меняются, поэтому записи не обновляются,
+	//а при превышении maxHistoricalDays вытесняются в порядке добавления (historicalDays)
+	historicalDataStorage      = map[string]model.ConvertData{}
+	historicalDays             []string
+	historicalRequests         = map[string]*historicalRequest{}
+	historicalDataStorageMutex sync.Mutex
+
+	updateDataInterval = time.Hour
+	httpClient         = &http.Client{Timeout: 10 * time.Second}
+	defaultCurrency    = rubCurrency
 )
 
-const rubCurrency = "RUB"
-const updateDataInterval time.Duration = time.Hour
+const rubCurrency = model.BaseCurrency
+
+//ErrUnknownCurrency - в курсах валют нет запрошенной валюты
+var ErrUnknownCurrency = errors.New("неизвестная валюта")
+
+const historicalDateLayout = "2006-01-02"
+
+//maxHistoricalDays - наибольшее количество дат в кеше курсов на дату
+const maxHistoricalDays = 1000
+
+//historicalRequest (internal) - выполняющийся запрос курсов на дату. Остальные запросы той же даты ждут закрытия done
+//и получают его результат
+type historicalRequest struct {
+	done chan struct{}
+	data model.ConvertData
+	err  error
+}
+
+//Configure - настройка поставщика курсов валют. Нулевые значения options оставляют настройки по умолчанию.
+//Должна вызываться до первого запроса курсов
+func Configure(options model.RatesOptions) {
+	if options.URL != "" {
+		coursesStorerUrl = options.URL
+	}
+	if options.HistoricalURL != "" {
+		historicalCoursesStorerUrl = options.HistoricalURL
+	}
+	if options.CacheTTL > 0 {
+		updateDataInterval = options.CacheTTL
+	}
+	if options.RequestTimeout > 0 {
+		httpClient = &http.Client{Timeout: options.RequestTimeout}
+	}
+	if options.DefaultCurrency != "" {
+		defaultCurrency = options.DefaultCurrency
+	}
+}
+
+//DefaultCurrency - валюта, в которой возвращается баланс, если клиент ее не указал
+func DefaultCurrency() string {
+	return defaultCurrency
+}
 
-//ConvertDataStorer - содержит метод GetConvertData. Нужен для mock, чтобы не вызывать http
+//MaxRatesAge - допустимый возраст текущих курсов валют: два интервала обновления (rates.cache_ttl)
+func MaxRatesAge() time.Duration {
+	return 2 * updateDataInterval
+}
+
+//ConvertDataStorer - содержит методы GetConvertData, GetConvertDataForDate и CachedConvertData. Нужен для mock, чтобы не вызывать http
 type ConvertDataStorer interface {
 	GetConvertData() (model.ConvertData, error)
+	GetConvertDataForDate(date time.Time) (model.ConvertData, error)
+	//CachedConvertData - сохраненные текущие курсы без запроса к поставщику
+	CachedConvertData() model.ConvertData
 }
 
 //ConvertDataStorerStruct - структура для реализации Updater
@@ -29,24 +93,98 @@ type ConvertDataStorerStruct struct{}
 
 //GetConvertData - получает структуру данных, необходимую для конвертации валют
 func (c *ConvertDataStorerStruct) GetConvertData() (model.ConvertData, error) {
-	t := convertDataStorage.FillingTime
-	if time.Since(t) > updateDataInterval {
-		req, _ := http.NewRequest(http.MethodGet, coursesStorerUrl, nil)
-		resp, err := http.DefaultClient.Do(req)
-		if err != nil {
-			return convertDataStorage, fmt.Errorf("convert.getConvertData: %v", err)
-		}
-		r, err := ioutil.ReadAll(resp.Body)
+	data := c.CachedConvertData()
+	if time.Since(data.FillingTime) > updateDataInterval {
+		fresh, err := c.Refresh()
 		if err != nil {
-			return convertDataStorage, fmt.Errorf("convert.getConvertData: %v", err)
+			return data, fmt.Errorf("convert.getConvertData: %v", err)
 		}
-		err = json.Unmarshal(r, &convertDataStorage)
-		if err != nil {
-			return convertDataStorage, fmt.Errorf("convert.getConvertData: %v", err)
-		}
-		convertDataStorage.FillingTime = time.Now()
+		return fresh, nil
+	}
+	return data, nil
+}
+
+//CachedConvertData - реализует метод интерфейса ConvertDataStorer
+func (c *ConvertDataStorerStruct) CachedConvertData() model.ConvertData {
+	convertDataStorageMutex.RLock()
+	defer convertDataStorageMutex.RUnlock()
+	return convertDataStorage
+}
+
+//Refresh - запрашивает текущие курсы валют, не дожидаясь устаревания сохраненных.
+//Запрос выполняется без блокировки, сохраненные курсы заменяются после его успешного завершения
+func (c *ConvertDataStorerStruct) Refresh() (model.ConvertData, error) {
+	data := model.ConvertData{}
+	err := requestConvertData(coursesStorerUrl, &data)
+	if err != nil {
+		return c.CachedConvertData(), fmt.Errorf("convert.Refresh: %v", err)
+	}
+	data.FillingTime = time.Now()
+	convertDataStorageMutex.Lock()
+	convertDataStorage = data
+	convertDataStorageMutex.Unlock()
+	return data, nil
+}
+
+//GetConvertDataForDate - получает структуру данных для конвертации валют по курсу на выбранную дату
+func (c *ConvertDataStorerStruct) GetConvertDataForDate(date time.Time) (model.ConvertData, error) {
+	day := date.Format(historicalDateLayout)
+	historicalDataStorageMutex.Lock()
+	if data, ok := historicalDataStorage[day]; ok {
+		historicalDataStorageMutex.Unlock()
+		return data, nil
+	}
+	//запрос курсов на эту дату уже выполняется - ждем его результата, не блокируя запросы других дат
+	if request, ok := historicalRequests[day]; ok {
+		historicalDataStorageMutex.Unlock()
+		<-request.done
+		return request.data, request.err
 	}
-	return convertDataStorage, nil
+	request := &historicalRequest{done: make(chan struct{})}
+	historicalRequests[day] = request
+	historicalDataStorageMutex.Unlock()
+
+	err := requestConvertData(fmt.Sprintf(historicalCoursesStorerUrl, day), &request.data)
+	if err != nil {
+		request.err = fmt.Errorf("convert.GetConvertDataForDate: %v", err)
+	} else {
+		request.data.FillingTime = time.Now()
+	}
+
+	historicalDataStorageMutex.Lock()
+	delete(historicalRequests, day)
+	if request.err == nil {
+		storeHistoricalData(day, request.data)
+	}
+	historicalDataStorageMutex.Unlock()
+	close(request.done)
+	return request.data, request.err
+}
+
+//storeHistoricalData (internal) - добавляет курсы на дату day в кеш, вытесняя самые давние записи при превышении
+//maxHistoricalDays. Вызывается под historicalDataStorageMutex
+func storeHistoricalData(day string, data model.ConvertData) {
+	historicalDataStorage[day] = data
+	historicalDays = append(historicalDays, day)
+	for len(historicalDays) > maxHistoricalDays {
+		delete(historicalDataStorage, historicalDays[0])
+		historicalDays = historicalDays[1:]
+	}
+}
+
+//requestConvertData (internal) - запрашивает курсы валют по адресу url
+func requestConvertData(url string, data *model.ConvertData) error {
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	r, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(r, data)
 }
 
 //ConvertToCurrency - конвертирует сумму в выбранную валюту
@@ -58,12 +196,54 @@ func ConvertToCurrency(balance float64, currency string, storer ConvertDataStore
 	if data, err = storer.GetConvertData(); err != nil {
 		return 0, fmt.Errorf("convert.ConvertToCurrency: %s", err.Error())
 	}
+	course, err := getCourse(data, currency)
+	if err != nil {
+		return 0, fmt.Errorf("convert.ConvertToCurrency: %s", err.Error())
+	}
+	return course * balance, nil
+}
+
+//GetCourse - возвращает текущий курс выбранной валюты к рублю и дату курса
+func GetCourse(currency string, storer ConvertDataStorer) (course float64, courseDate string, err error) {
+	if currency == "" {
+		return 0, "", errors.New("convert.GetCourse: Пустая строка на входе")
+	}
+	var data model.ConvertData
+	if data, err = storer.GetConvertData(); err != nil {
+		return 0, "", fmt.Errorf("convert.GetCourse: %s", err.Error())
+	}
+	if course, err = getCourse(data, currency); err != nil {
+		return 0, "", fmt.Errorf("convert.GetCourse: %w", err)
+	}
+	return course, data.Date, nil
+}
+
+//GetCourseForDate - возвращает курс выбранной валюты к рублю на дату date и дату курса
+//(может отличаться от date, если на эту дату курс не публиковался)
+func GetCourseForDate(currency string, date time.Time, storer ConvertDataStorer) (course float64, courseDate string, err error) {
+	if currency == "" {
+		return 0, "", errors.New("convert.GetCourseForDate: Пустая строка на входе")
+	}
+	var data model.ConvertData
+	if data, err = storer.GetConvertDataForDate(date); err != nil {
+		return 0, "", fmt.Errorf("convert.GetCourseForDate: %s", err.Error())
+	}
+	if course, err = getCourse(data, currency); err != nil {
+		return 0, "", fmt.Errorf("convert.GetCourseForDate: %s", err.Error())
+	}
+	return course, data.Date, nil
+}
+
+//getCourse (internal) - извлекает курс валюты currency из data
+func getCourse(data model.ConvertData, currency string) (float64, error) {
 	if data.Base != rubCurrency {
-		return 0, fmt.Errorf("convert.ConvertToCurrency: convertDataStorage содержит неверную информацию: %#v", data)
+		return 0, fmt.Errorf("convertDataStorage содержит неверную информацию: %#v", data)
+	}
+	if currency == rubCurrency {
+		return 1, nil
 	}
 	if course, ok := data.Rates[currency]; ok {
-		balanceInCurrency = course * balance
-		return balanceInCurrency, nil
+		return course, nil
 	}
-	return 0, fmt.Errorf("convert.ConvertToCurrency: convertDataStorage %#v не содержит значения cur: %s", data, currency)
+	return 0, fmt.Errorf("%w: convertDataStorage %#v не содержит значения cur: %s", ErrUnknownCurrency, data, currency)
 }
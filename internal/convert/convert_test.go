@@ -2,7 +2,14 @@ package convert
 
 import (
 	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	mock_convert "github.com/call-me-snake/user_balance_service/internal/convert/mock"
 	"github.com/call-me-snake/user_balance_service/internal/model"
@@ -61,3 +68,92 @@ func TestConvertToCurrencyEmptyCur(t *testing.T) {
 	_, err := ConvertToCurrency(1, "", mockStorer)
 	assert.Error(t, err)
 }
+
+//TestGetCourseForDate - тест получения курса на дату
+func TestGetCourseForDate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	date := time.Date(2020, 9, 21, 18, 45, 0, 0, time.UTC)
+	data := testConvertData1
+	data.Date = "2020-09-21"
+	mockStorer := mock_convert.NewMockConvertDataStorer(ctrl)
+	mockStorer.EXPECT().GetConvertDataForDate(date).Return(data, nil)
+	course, courseDate, err := GetCourseForDate(dollarCur, date, mockStorer)
+	assert.Nil(t, err)
+	assert.Equal(t, data.Rates[dollarCur], course)
+	assert.Equal(t, data.Date, courseDate)
+}
+
+//TestGetCourseCurrent - тест получения текущего курса
+func TestGetCourseCurrent(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStorer := mock_convert.NewMockConvertDataStorer(ctrl)
+	mockStorer.EXPECT().GetConvertData().Return(testConvertData1, nil)
+	course, _, err := GetCourse(dollarCur, mockStorer)
+	assert.Nil(t, err)
+	assert.Equal(t, testConvertData1.Rates[dollarCur], course)
+}
+
+//TestGetCourseUnknownCurrency - ошибка курса неизвестной валюты отличается от недоступности курсов
+func TestGetCourseUnknownCurrency(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStorer := mock_convert.NewMockConvertDataStorer(ctrl)
+	mockStorer.EXPECT().GetConvertData().Return(testConvertData1, nil)
+	mockStorer.EXPECT().GetConvertData().Return(model.ConvertData{}, errors.New("Ошибка"))
+	_, _, err := GetCourse("XYZ", mockStorer)
+	assert.True(t, errors.Is(err, ErrUnknownCurrency))
+	_, _, err = GetCourse(dollarCur, mockStorer)
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, ErrUnknownCurrency))
+}
+
+//TestGetConvertDataForDate - курсы на дату запрашиваются один раз для всех одновременных запросов этой даты,
+//медленный запрос одной даты не задерживает запросы других дат, размер кеша ограничен
+func TestGetConvertDataForDate(t *testing.T) {
+	slow := make(chan struct{})
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		day := strings.TrimPrefix(r.URL.Path, "/")
+		if day == "2020-09-21" {
+			<-slow
+		}
+		fmt.Fprintf(w, `{"base":"RUB","date":"%s","rates":{"USD":0.013}}`, day)
+	}))
+	defer server.Close()
+	defer func(url string) {
+		historicalCoursesStorerUrl = url
+		historicalDataStorage = map[string]model.ConvertData{}
+		historicalDays = nil
+	}(historicalCoursesStorerUrl)
+	historicalCoursesStorerUrl = server.URL + "/%s"
+	storer := &ConvertDataStorerStruct{}
+	slowDate := time.Date(2020, 9, 21, 12, 0, 0, 0, time.UTC)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data, err := storer.GetConvertDataForDate(slowDate)
+			assert.Nil(t, err)
+			assert.Equal(t, "2020-09-21", data.Date)
+		}()
+	}
+	data, err := storer.GetConvertDataForDate(time.Date(2020, 9, 22, 0, 0, 0, 0, time.UTC))
+	assert.Nil(t, err)
+	assert.Equal(t, "2020-09-22", data.Date)
+	close(slow)
+	wg.Wait()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < maxHistoricalDays+10; i++ {
+		_, err = storer.GetConvertDataForDate(start.AddDate(0, 0, -i))
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, maxHistoricalDays, len(historicalDataStorage))
+	assert.Equal(t, maxHistoricalDays, len(historicalDays))
+}
@@ -6,6 +6,7 @@ package mock_convert
 
 import (
 	reflect "reflect"
+	time "time"
 
 	model "github.com/call-me-snake/user_balance_service/internal/model"
 	gomock "github.com/golang/mock/gomock"
@@ -34,6 +35,20 @@ func (m *MockConvertDataStorer) EXPECT() *MockConvertDataStorerMockRecorder {
 	return m.recorder
 }
 
+// CachedConvertData mocks base method.
+func (m *MockConvertDataStorer) CachedConvertData() model.ConvertData {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CachedConvertData")
+	ret0, _ := ret[0].(model.ConvertData)
+	return ret0
+}
+
+// CachedConvertData indicates an expected call of CachedConvertData.
+func (mr *MockConvertDataStorerMockRecorder) CachedConvertData() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CachedConvertData", reflect.TypeOf((*MockConvertDataStorer)(nil).CachedConvertData))
+}
+
 // GetConvertData mocks base method.
 func (m *MockConvertDataStorer) GetConvertData() (model.ConvertData, error) {
 	m.ctrl.T.Helper()
@@ -48,3 +63,18 @@ func (mr *MockConvertDataStorerMockRecorder) GetConvertData() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetConvertData", reflect.TypeOf((*MockConvertDataStorer)(nil).GetConvertData))
 }
+
+// GetConvertDataForDate mocks base method.
+func (m *MockConvertDataStorer) GetConvertDataForDate(date time.Time) (model.ConvertData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetConvertDataForDate", date)
+	ret0, _ := ret[0].(model.ConvertData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetConvertDataForDate indicates an expected call of GetConvertDataForDate.
+func (mr *MockConvertDataStorerMockRecorder) GetConvertDataForDate(date interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetConvertDataForDate", reflect.TypeOf((*MockConvertDataStorer)(nil).GetConvertDataForDate), date)
+}
@@ -0,0 +1,53 @@
+package fee
+
+import (
+	"math"
+
+	"github.com/call-me-snake/user_balance_service/internal/model"
+)
+
+//FindRule - выбирает из rules правило для операции operation в валюте currency для аккаунта уровня tier.
+//Из подходящих правил выбирается наиболее специфичное: точное совпадение валюты и уровня аккаунта
+//приоритетнее правила, заданного для любой валюты (уровня). Возвращает nil, если подходящих правил нет
+func FindRule(rules []model.FeeRule, operation, currency, tier string) *model.FeeRule {
+	var found *model.FeeRule
+	bestScore := -1
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Operation != operation {
+			continue
+		}
+		score := 0
+		if rule.Currency != "" {
+			if rule.Currency != currency {
+				continue
+			}
+			score++
+		}
+		if rule.AccountTier != "" {
+			if rule.AccountTier != tier {
+				continue
+			}
+			score++
+		}
+		if score > bestScore {
+			found, bestScore = rule, score
+		}
+	}
+	return found
+}
+
+//Calculate - расчет комиссии по правилу rule для суммы amount. Результат округляется до копеек
+func Calculate(rule *model.FeeRule, amount float64) float64 {
+	if rule == nil {
+		return 0
+	}
+	fee := rule.Fixed + math.Abs(amount)*rule.Percent/100
+	if fee < rule.MinFee {
+		fee = rule.MinFee
+	}
+	if rule.MaxFee > 0 && fee > rule.MaxFee {
+		fee = rule.MaxFee
+	}
+	return math.Round(fee*100) / 100
+}
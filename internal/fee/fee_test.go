@@ -0,0 +1,45 @@
+package fee
+
+import (
+	"testing"
+
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+var testRules = []model.FeeRule{
+	{Id: 1, Operation: model.FeeOperationTransfer, Percent: 1, MinFee: 10, MaxFee: 500},
+	{Id: 2, Operation: model.FeeOperationTransfer, AccountTier: "premium", Fixed: 0},
+	{Id: 3, Operation: model.FeeOperationTransfer, Currency: "USD", AccountTier: "premium", Fixed: 1},
+	{Id: 4, Operation: model.FeeOperationWithdrawal, Currency: model.BaseCurrency, Fixed: 30, Percent: 0.5},
+}
+
+//TestFindRuleMostSpecific - тест выбора наиболее специфичного правила
+func TestFindRuleMostSpecific(t *testing.T) {
+	rule := FindRule(testRules, model.FeeOperationTransfer, model.BaseCurrency, "premium")
+	assert.NotNil(t, rule)
+	assert.Equal(t, 2, rule.Id)
+
+	rule = FindRule(testRules, model.FeeOperationTransfer, "USD", "premium")
+	assert.NotNil(t, rule)
+	assert.Equal(t, 3, rule.Id)
+
+	rule = FindRule(testRules, model.FeeOperationTransfer, model.BaseCurrency, model.DefaultAccountTier)
+	assert.NotNil(t, rule)
+	assert.Equal(t, 1, rule.Id)
+}
+
+//TestFindRuleNotFound - тест отсутствия подходящего правила
+func TestFindRuleNotFound(t *testing.T) {
+	assert.Nil(t, FindRule(testRules, model.FeeOperationWithdrawal, "USD", model.DefaultAccountTier))
+	assert.Nil(t, FindRule(testRules, "unknown", model.BaseCurrency, model.DefaultAccountTier))
+}
+
+//TestCalculate - тест расчета комиссии с учетом минимального и максимального значений
+func TestCalculate(t *testing.T) {
+	assert.Equal(t, 10.0, Calculate(&testRules[0], 100))
+	assert.Equal(t, 25.0, Calculate(&testRules[0], 2500))
+	assert.Equal(t, 500.0, Calculate(&testRules[0], 100000))
+	assert.Equal(t, 30.61, Calculate(&testRules[3], -122))
+	assert.Equal(t, 0.0, Calculate(nil, 100))
+}
@@ -0,0 +1,241 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package grpcapi
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion7
+
+// BalanceServiceClient is the client API for BalanceService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type BalanceServiceClient interface {
+	// GetBalance - получение баланса аккаунта, при указанной currency - в выбранной валюте
+	GetBalance(ctx context.Context, in *GetBalanceRequest, opts ...grpc.CallOption) (*GetBalanceResponse, error)
+	// ChangeBalance - изменение баланса по принципу newBalance = curBalance + delta
+	ChangeBalance(ctx context.Context, in *ChangeBalanceRequest, opts ...grpc.CallOption) (*OperationResponse, error)
+	// Transfer - перевод суммы delta с аккаунта id1 на аккаунт id2
+	Transfer(ctx context.Context, in *TransferRequest, opts ...grpc.CallOption) (*OperationResponse, error)
+	// GetHistory - история операций по аккаунту, по одной записи в сообщении
+	GetHistory(ctx context.Context, in *GetHistoryRequest, opts ...grpc.CallOption) (BalanceService_GetHistoryClient, error)
+}
+
+type balanceServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewBalanceServiceClient(cc grpc.ClientConnInterface) BalanceServiceClient {
+	return &balanceServiceClient{cc}
+}
+
+func (c *balanceServiceClient) GetBalance(ctx context.Context, in *GetBalanceRequest, opts ...grpc.CallOption) (*GetBalanceResponse, error) {
+	out := new(GetBalanceResponse)
+	err := c.cc.Invoke(ctx, "/balance.v1.BalanceService/GetBalance", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *balanceServiceClient) ChangeBalance(ctx context.Context, in *ChangeBalanceRequest, opts ...grpc.CallOption) (*OperationResponse, error) {
+	out := new(OperationResponse)
+	err := c.cc.Invoke(ctx, "/balance.v1.BalanceService/ChangeBalance", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *balanceServiceClient) Transfer(ctx context.Context, in *TransferRequest, opts ...grpc.CallOption) (*OperationResponse, error) {
+	out := new(OperationResponse)
+	err := c.cc.Invoke(ctx, "/balance.v1.BalanceService/Transfer", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *balanceServiceClient) GetHistory(ctx context.Context, in *GetHistoryRequest, opts ...grpc.CallOption) (BalanceService_GetHistoryClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_BalanceService_serviceDesc.Streams[0], "/balance.v1.BalanceService/GetHistory", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &balanceServiceGetHistoryClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type BalanceService_GetHistoryClient interface {
+	Recv() (*TransactionRecord, error)
+	grpc.ClientStream
+}
+
+type balanceServiceGetHistoryClient struct {
+	grpc.ClientStream
+}
+
+func (x *balanceServiceGetHistoryClient) Recv() (*TransactionRecord, error) {
+	m := new(TransactionRecord)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// BalanceServiceServer is the server API for BalanceService service.
+// All implementations must embed UnimplementedBalanceServiceServer
+// for forward compatibility
+type BalanceServiceServer interface {
+	// GetBalance - получение баланса аккаунта, при указанной currency - в выбранной валюте
+	GetBalance(context.Context, *GetBalanceRequest) (*GetBalanceResponse, error)
+	// ChangeBalance - изменение баланса по принципу newBalance = curBalance + delta
+	ChangeBalance(context.Context, *ChangeBalanceRequest) (*OperationResponse, error)
+	// Transfer - перевод суммы delta с аккаунта id1 на аккаунт id2
+	Transfer(context.Context, *TransferRequest) (*OperationResponse, error)
+	// GetHistory - история операций по аккаунту, по одной записи в сообщении
+	GetHistory(*GetHistoryRequest, BalanceService_GetHistoryServer) error
+	mustEmbedUnimplementedBalanceServiceServer()
+}
+
+// UnimplementedBalanceServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedBalanceServiceServer struct {
+}
+
+func (UnimplementedBalanceServiceServer) GetBalance(context.Context, *GetBalanceRequest) (*GetBalanceResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBalance not implemented")
+}
+func (UnimplementedBalanceServiceServer) ChangeBalance(context.Context, *ChangeBalanceRequest) (*OperationResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ChangeBalance not implemented")
+}
+func (UnimplementedBalanceServiceServer) Transfer(context.Context, *TransferRequest) (*OperationResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Transfer not implemented")
+}
+func (UnimplementedBalanceServiceServer) GetHistory(*GetHistoryRequest, BalanceService_GetHistoryServer) error {
+	return status.Errorf(codes.Unimplemented, "method GetHistory not implemented")
+}
+func (UnimplementedBalanceServiceServer) mustEmbedUnimplementedBalanceServiceServer() {}
+
+// UnsafeBalanceServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to BalanceServiceServer will
+// result in compilation errors.
+type UnsafeBalanceServiceServer interface {
+	mustEmbedUnimplementedBalanceServiceServer()
+}
+
+func RegisterBalanceServiceServer(s *grpc.Server, srv BalanceServiceServer) {
+	s.RegisterService(&_BalanceService_serviceDesc, srv)
+}
+
+func _BalanceService_GetBalance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetBalanceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BalanceServiceServer).GetBalance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/balance.v1.BalanceService/GetBalance",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BalanceServiceServer).GetBalance(ctx, req.(*GetBalanceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BalanceService_ChangeBalance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChangeBalanceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BalanceServiceServer).ChangeBalance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/balance.v1.BalanceService/ChangeBalance",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BalanceServiceServer).ChangeBalance(ctx, req.(*ChangeBalanceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BalanceService_Transfer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TransferRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BalanceServiceServer).Transfer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/balance.v1.BalanceService/Transfer",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BalanceServiceServer).Transfer(ctx, req.(*TransferRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BalanceService_GetHistory_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetHistoryRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BalanceServiceServer).GetHistory(m, &balanceServiceGetHistoryServer{stream})
+}
+
+type BalanceService_GetHistoryServer interface {
+	Send(*TransactionRecord) error
+	grpc.ServerStream
+}
+
+type balanceServiceGetHistoryServer struct {
+	grpc.ServerStream
+}
+
+func (x *balanceServiceGetHistoryServer) Send(m *TransactionRecord) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+var _BalanceService_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "balance.v1.BalanceService",
+	HandlerType: (*BalanceServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetBalance",
+			Handler:    _BalanceService_GetBalance_Handler,
+		},
+		{
+			MethodName: "ChangeBalance",
+			Handler:    _BalanceService_ChangeBalance_Handler,
+		},
+		{
+			MethodName: "Transfer",
+			Handler:    _BalanceService_Transfer_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "GetHistory",
+			Handler:       _BalanceService_GetHistory_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "internal/grpcapi/balance.proto",
+}
@@ -0,0 +1,269 @@
+package grpcserver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/call-me-snake/user_balance_service/internal/convert"
+	"github.com/call-me-snake/user_balance_service/internal/grpcapi"
+	"github.com/call-me-snake/user_balance_service/internal/i18n"
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	"github.com/call-me-snake/user_balance_service/internal/tlsconfig"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/labstack/gommon/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+//convertStorer - источник курсов валют. Переменная нужна для подмены в тестах
+var convertStorer convert.ConvertDataStorer = &convert.ConvertDataStorerStruct{}
+
+//Connector - gRPC сервер
+type Connector struct {
+	server  *grpc.Server
+	address string
+}
+
+//New - Конструктор *Connector
+func New(addr string) *Connector {
+	c := &Connector{}
+	c.server = grpc.NewServer()
+	c.address = addr
+	return c
+}
+
+//SetTLS - прием соединений по TLS с сертификатами manager. Должен вызываться до Start
+func (c *Connector) SetTLS(manager *tlsconfig.Manager) {
+	options := []grpc.ServerOption{grpc.Creds(credentials.NewTLS(manager.Config()))}
+	if manager.VerifiesClients() {
+		options = append(options, grpc.UnaryInterceptor(clientCertInterceptor(manager)),
+			grpc.StreamInterceptor(clientCertStreamInterceptor(manager)))
+	}
+	c.server = grpc.NewServer(options...)
+}
+
+//Start запуск gRPC сервера
+func (c *Connector) Start(accStorage model.IBalanceInfoStorage) error {
+	listener, err := net.Listen("tcp", c.address)
+	if err != nil {
+		return fmt.Errorf("grpcserver.Start: %v", err)
+	}
+	err = c.serve(listener, accStorage)
+	return fmt.Errorf("grpcserver.Start: %v", err)
+}
+
+//serve (internal) - регистрация сервиса и обработка соединений listener
+func (c *Connector) serve(listener net.Listener, accStorage model.IBalanceInfoStorage) error {
+	grpcapi.RegisterBalanceServiceServer(c.server, &balanceService{accStorage: accStorage})
+	return c.server.Serve(listener)
+}
+
+//balanceService - реализация grpcapi.BalanceServiceServer поверх model.IBalanceInfoStorage
+type balanceService struct {
+	grpcapi.UnimplementedBalanceServiceServer
+	accStorage model.IBalanceInfoStorage
+}
+
+//GetBalance - возврат информации об аккаунте
+func (s *balanceService) GetBalance(ctx context.Context, req *grpcapi.GetBalanceRequest) (*grpcapi.GetBalanceResponse, error) {
+	if req.Id <= 0 {
+		return nil, status.Error(codes.InvalidArgument, message(ctx, i18n.InvalidId))
+	}
+	acc, custErr := readStorage(ctx, s.accStorage).GetAccountBalance(int(req.Id))
+	if custErr != nil {
+		return nil, statusFromCustomErr(ctx, custErr)
+	}
+
+	resp := &grpcapi.GetBalanceResponse{Id: int64(acc.AccountId), Balance: acc.Balance, Currency: model.BaseCurrency}
+	currency := strings.ToUpper(req.Currency)
+	if currency == "" && convert.DefaultCurrency() != model.BaseCurrency {
+		currency = convert.DefaultCurrency()
+	}
+	if currency != "" {
+		balanceInCurrency, err := convert.ConvertToCurrency(acc.Balance, currency, convertStorer)
+		if err != nil {
+			log.Print(err.Error())
+			return nil, status.Error(codes.Unavailable, message(ctx, i18n.CourseError))
+		}
+		resp.Balance = balanceInCurrency
+		resp.Currency = currency
+	}
+	return resp, nil
+}
+
+//ChangeBalance - выполняет пополнение аккаунта на delta
+func (s *balanceService) ChangeBalance(ctx context.Context, req *grpcapi.ChangeBalanceRequest) (*grpcapi.OperationResponse, error) {
+	if req.Delta == 0 {
+		return nil, status.Error(codes.InvalidArgument, message(ctx, i18n.NullSum))
+	}
+	result, custErr := s.accStorage.ChangeAccountBalance(int(req.Id), req.Delta, model.OperationDetails{})
+	if custErr != nil {
+		return nil, statusFromCustomErr(ctx, custErr)
+	}
+	return &grpcapi.OperationResponse{Message: i18n.OperationMessage(contextLang(ctx), result)}, nil
+}
+
+//Transfer - выполняет перевод суммы между аккаунтами
+func (s *balanceService) Transfer(ctx context.Context, req *grpcapi.TransferRequest) (*grpcapi.OperationResponse, error) {
+	if req.Id1 == req.Id2 {
+		return nil, problemStatus(ctx, model.SameAccountsCode)
+	}
+	if req.Delta == 0 {
+		return nil, status.Error(codes.InvalidArgument, message(ctx, i18n.NullTransferSum))
+	}
+	result, custErr := s.accStorage.TransferSumBetweenAccounts(int(req.Id1), int(req.Id2), req.Delta, model.OperationDetails{})
+	if custErr != nil {
+		return nil, statusFromCustomErr(ctx, custErr)
+	}
+	return &grpcapi.OperationResponse{Message: i18n.OperationMessage(contextLang(ctx), result)}, nil
+}
+
+//GetHistory - отправляет историю операций по аккаунту, по одной записи в сообщении
+func (s *balanceService) GetHistory(req *grpcapi.GetHistoryRequest, stream grpcapi.BalanceService_GetHistoryServer) error {
+	var sortedBy string
+	switch req.SortedBy {
+	case grpcapi.SortField_SORT_FIELD_TRANSACTION_TIME:
+		sortedBy = model.TransactionTime
+	case grpcapi.SortField_SORT_FIELD_TRANSACTION_SUM:
+		sortedBy = model.TransactionSum
+	}
+	ctx := stream.Context()
+	history, custErr := readStorage(stream.Context(), s.accStorage).GetSortedTransactionsHistory(int(req.Id), sortedBy, req.SortedByDesc, model.HistoryFilter{})
+	if custErr != nil {
+		return statusFromCustomErr(ctx, custErr)
+	}
+	if len(history) == 0 {
+		return status.Error(codes.NotFound, message(ctx, i18n.HistoryNotFound))
+	}
+	i18n.LocalizeHistory(contextLang(ctx), history)
+	for _, record := range history {
+		createdAt, _ := ptypes.TimestampProto(record.CreatedAt)
+		message := &grpcapi.TransactionRecord{
+			AccountId:          int64(record.AccountId),
+			Delta:              record.Delta,
+			RemainingBalance:   record.RemainingBalance,
+			TransactionMessage: record.TransactionMessage,
+			CreatedAt:          createdAt,
+			OperationType:      record.OperationType,
+		}
+		if record.CounterpartyId != nil {
+			message.CounterpartyId = int64(*record.CounterpartyId)
+		}
+		err := stream.Send(message)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//statusFromCustomErr - преобразует ошибку хранилища в статус gRPC по коду CustomErr.ErrCode.
+//Текст внутренних ошибок не передается клиенту, а пишется в лог
+func statusFromCustomErr(ctx context.Context, custErr *model.CustomErr) error {
+	log.Print(custErr.Err.Error())
+	return problemStatus(ctx, custErr.ErrCode)
+}
+
+//problemStatus - статус gRPC для кода ошибки code. Текст статуса - заголовок ошибки на языке клиента
+func problemStatus(ctx context.Context, code model.ErrorCode) error {
+	title := i18n.ProblemTitle(contextLang(ctx), string(code))
+	switch code {
+	case model.InsufficientFundsCode, model.AccountFrozenCode, model.AlreadyReversedCode, model.NotSubAccountCode:
+		return status.Error(codes.FailedPrecondition, title)
+	case model.WrongInputParamsCode, model.ValidationFailedCode, model.ZeroAmountCode, model.SameAccountsCode:
+		return status.Error(codes.InvalidArgument, title)
+	case model.NotFoundCode, model.HistoryNotFoundCode, model.ScheduleNotFoundCode, model.WebhookNotFoundCode:
+		return status.Error(codes.NotFound, title)
+	case model.RateLimitedCode:
+		return status.Error(codes.ResourceExhausted, title)
+	case model.ForbiddenCode:
+		return status.Error(codes.PermissionDenied, title)
+	case model.RateUnavailableCode, model.UnavailableCode:
+		return status.Error(codes.Unavailable, title)
+	default:
+		return status.Error(codes.Internal, title)
+	}
+}
+
+//readStorage - хранилище для чтения. С метаданными x-consistency: strong чтение выполняется на основном сервере базы данных
+func readStorage(ctx context.Context, accStorage model.IBalanceInfoStorage) model.IBalanceInfoStorage {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("x-consistency") {
+		if strings.EqualFold(value, "strong") {
+			return accStorage.Primary()
+		}
+	}
+	return accStorage
+}
+
+//contextLang - язык сообщений, выбранный клиентом в метаданных запроса accept-language
+func contextLang(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return i18n.FromAcceptLanguage(strings.Join(md.Get("accept-language"), ","))
+}
+
+//message - текст сообщения key на языке клиента
+func message(ctx context.Context, key string) string {
+	return i18n.Message(contextLang(ctx), key)
+}
+
+//clientIdentityKey - ключ контекста вызова, под которым хранится идентификатор клиента из его сертификата
+type clientIdentityKey struct{}
+
+//clientCertInterceptor - вызовы клиентов без сертификата и клиентов, субъекта сертификата которых нет в списке
+//допустимых, отклоняются со статусом PermissionDenied. Идентификатор клиента сохраняется в контексте вызова
+func clientCertInterceptor(manager *tlsconfig.Manager) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authorizeClient(ctx, manager)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+//clientCertStreamInterceptor - проверка сертификата клиента clientCertInterceptor для потоковых вызовов
+func clientCertStreamInterceptor(manager *tlsconfig.Manager) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authorizeClient(stream.Context(), manager)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &identifiedStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+//identifiedStream (internal) - поток вызова с контекстом, в котором сохранен идентификатор клиента
+type identifiedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+//Context - контекст вызова с идентификатором клиента
+func (s *identifiedStream) Context() context.Context {
+	return s.ctx
+}
+
+//authorizeClient (internal) - проверка сертификата клиента вызова. Возвращает контекст с идентификатором клиента
+//или ошибку со статусом PermissionDenied
+func authorizeClient(ctx context.Context, manager *tlsconfig.Manager) (context.Context, error) {
+	var tlsInfo credentials.TLSInfo
+	if p, ok := peer.FromContext(ctx); ok {
+		tlsInfo, _ = p.AuthInfo.(credentials.TLSInfo)
+	}
+	if len(tlsInfo.State.PeerCertificates) == 0 {
+		return nil, status.Error(codes.PermissionDenied, message(ctx, i18n.ClientCertRequired))
+	}
+	cert := tlsInfo.State.PeerCertificates[0]
+	identity, ok := manager.ClientIdentity(cert)
+	if !ok {
+		return nil, status.Error(codes.PermissionDenied, i18n.Message(contextLang(ctx), i18n.ClientNotAllowed, cert.Subject.String()))
+	}
+	return context.WithValue(ctx, clientIdentityKey{}, identity), nil
+}
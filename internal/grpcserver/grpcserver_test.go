@@ -0,0 +1,229 @@
+package grpcserver
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/grpcapi"
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	mock_model "github.com/call-me-snake/user_balance_service/internal/model/mock"
+	"github.com/call-me-snake/user_balance_service/internal/tlsconfig"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	testId1     = 1
+	testId2     = 2
+	testBalance = 1000.0
+	testDelta   = 15.0
+	testHistory = []model.TransactionRecord{
+		{AccountId: testId1, Delta: testDelta, RemainingBalance: testBalance, TransactionMessage: "Сообщение", CreatedAt: time.Date(2020, 9, 21, 18, 45, 0, 0, time.UTC)},
+		{AccountId: testId1, Delta: -testDelta, RemainingBalance: testBalance - testDelta, TransactionMessage: "Сообщение"},
+	}
+)
+
+//startTestServer - запускает сервер на свободном порту и возвращает подключенного клиента
+func startTestServer(t *testing.T, accStorage model.IBalanceInfoStorage) (grpcapi.BalanceServiceClient, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := New(listener.Addr().String())
+	go c.serve(listener, accStorage)
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return grpcapi.NewBalanceServiceClient(conn), func() {
+		conn.Close()
+		c.server.Stop()
+	}
+}
+
+//TestGetBalance - тест успешного получения баланса
+func TestGetBalance(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockdb := mock_model.NewMockIBalanceInfoStorage(ctrl)
+	mockdb.EXPECT().GetAccountBalance(testId1).Return(&model.BalanceInfo{AccountId: testId1, Balance: testBalance}, nil)
+	client, stop := startTestServer(t, mockdb)
+	defer stop()
+
+	resp, err := client.GetBalance(context.Background(), &grpcapi.GetBalanceRequest{Id: int64(testId1)})
+	assert.Nil(t, err)
+	assert.Equal(t, testBalance, resp.Balance)
+	assert.Equal(t, model.BaseCurrency, resp.Currency)
+}
+
+//TestTransferInsufficientFunds - тест преобразования кода ошибки хранилища в статус gRPC
+func TestTransferInsufficientFunds(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockdb := mock_model.NewMockIBalanceInfoStorage(ctrl)
+	mockdb.EXPECT().TransferSumBetweenAccounts(testId1, testId2, testDelta, model.OperationDetails{}).
+		Return(nil, &model.CustomErr{Err: errors.New("Ошибка"), ErrCode: model.InsufficientFundsCode})
+	client, stop := startTestServer(t, mockdb)
+	defer stop()
+
+	_, err := client.Transfer(context.Background(), &grpcapi.TransferRequest{Id1: int64(testId1), Id2: int64(testId2), Delta: testDelta})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	_, err = client.Transfer(context.Background(), &grpcapi.TransferRequest{Id1: int64(testId1), Id2: int64(testId1), Delta: testDelta})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+//TestGetHistory - тест потоковой выдачи истории операций
+func TestGetHistory(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockdb := mock_model.NewMockIBalanceInfoStorage(ctrl)
+	mockdb.EXPECT().GetSortedTransactionsHistory(testId1, model.TransactionSum, true, model.HistoryFilter{}).Return(testHistory, nil)
+	client, stop := startTestServer(t, mockdb)
+	defer stop()
+
+	stream, err := client.GetHistory(context.Background(), &grpcapi.GetHistoryRequest{
+		Id:           int64(testId1),
+		SortedBy:     grpcapi.SortField_SORT_FIELD_TRANSACTION_SUM,
+		SortedByDesc: true,
+	})
+	assert.Nil(t, err)
+	var received []*grpcapi.TransactionRecord
+	for {
+		record, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if !assert.Nil(t, err) {
+			return
+		}
+		received = append(received, record)
+	}
+	assert.Len(t, received, len(testHistory))
+	assert.Equal(t, testHistory[1].Delta, received[1].Delta)
+	assert.Equal(t, testHistory[0].CreatedAt.Unix(), received[0].CreatedAt.Seconds)
+}
+
+//newTestCert - сертификат с ключом и субъектом commonName, подписанный ca (nil - самоподписанный центр)
+func newTestCert(t *testing.T, commonName string, ca *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{"localhost"},
+	}
+	signer, signerKey := template, interface{}(key)
+	if ca == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = ca.Leaf, ca.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+//writeTestCert - запись сертификата и ключа в файлы dir/name.crt и dir/name.key
+func writeTestCert(t *testing.T, cert tls.Certificate, dir, name string) (certFile, keyFile string) {
+	certFile, keyFile = filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	keyDer, _ := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+//TestGetHistoryClientCert - потоковый вызов без сертификата клиента или с сертификатом, субъекта которого нет
+//в списке допустимых, отклоняется
+func TestGetHistoryClientCert(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockdb := mock_model.NewMockIBalanceInfoStorage(ctrl)
+	mockdb.EXPECT().GetSortedTransactionsHistory(testId1, "", false, model.HistoryFilter{}).Return(testHistory, nil).AnyTimes()
+
+	dir, err := ioutil.TempDir("", "grpcserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca := newTestCert(t, "test ca", nil)
+	caFile, _ := writeTestCert(t, ca, dir, "ca")
+	certFile, keyFile := writeTestCert(t, newTestCert(t, "localhost", &ca), dir, "server")
+	manager, err := tlsconfig.New(model.TLSOptions{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile,
+		ClientCertOptional: true, AllowedClients: map[string]string{"billing": "billing-service"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := New(listener.Addr().String())
+	c.SetTLS(manager)
+	go c.serve(listener, mockdb)
+	defer c.server.Stop()
+
+	history := func(certs []tls.Certificate) (int, error) {
+		creds := credentials.NewTLS(&tls.Config{InsecureSkipVerify: true, Certificates: certs})
+		conn, err := grpc.Dial(listener.Addr().String(), grpc.WithTransportCredentials(creds))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		stream, err := grpcapi.NewBalanceServiceClient(conn).GetHistory(context.Background(), &grpcapi.GetHistoryRequest{Id: int64(testId1)})
+		if err != nil {
+			return 0, err
+		}
+		received := 0
+		for {
+			if _, err = stream.Recv(); err == io.EOF {
+				return received, nil
+			} else if err != nil {
+				return received, err
+			}
+			received++
+		}
+	}
+
+	_, err = history(nil)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = history([]tls.Certificate{newTestCert(t, "reports", &ca)})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	received, err := history([]tls.Certificate{newTestCert(t, "billing", &ca)})
+	assert.NoError(t, err)
+	assert.Equal(t, len(testHistory), received)
+}
@@ -0,0 +1,93 @@
+package hashchain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/model"
+)
+
+//timeLayout - формат времени создания записи в хешируемом содержимом. База данных хранит время с точностью
+//до микросекунд и без часового пояса, поэтому хешируется время по часам сервиса с этой точностью
+const timeLayout = "2006-01-02 15:04:05.000000"
+
+//Precision - точность времени создания записи, которая сохраняется в базе данных без потерь
+const Precision = time.Microsecond
+
+//Hash - хеш SHA-256 содержимого записи истории record и хеша prevHash предыдущей записи аккаунта.
+//Purpose, ExternalRef, Metadata, ReversalOf, PairId и валюта операции с курсом хешируются только у записей, в которых они заполнены, поэтому хеши записей,
+//созданных до их появления, не меняются
+func Hash(record model.TransactionRecord, prevHash string) string {
+	counterparty := ""
+	if record.CounterpartyId != nil {
+		counterparty = strconv.Itoa(*record.CounterpartyId)
+	}
+	fields := []string{
+		strconv.Itoa(record.AccountId),
+		strconv.FormatFloat(record.Delta, 'f', -1, 64),
+		strconv.FormatFloat(record.RemainingBalance, 'f', -1, 64),
+		record.OperationType,
+		counterparty,
+		record.TransactionMessage,
+		record.CreatedAt.Format(timeLayout),
+	}
+	if record.Purpose != "" || record.ExternalRef != "" || len(record.Metadata) > 0 {
+		//json.Marshal сортирует ключи, поэтому содержимое не зависит от порядка обхода map
+		metadata, _ := json.Marshal(record.Metadata)
+		fields = append(fields, record.Purpose, record.ExternalRef, string(metadata))
+	}
+	if record.ReversalOf != nil {
+		fields = append(fields, "reversal_of="+strconv.FormatInt(*record.ReversalOf, 10))
+	}
+	if record.PairId != nil {
+		fields = append(fields, "pair_id="+strconv.FormatInt(*record.PairId, 10))
+	}
+	if record.OperationCurrency != "" && record.OperationRate != nil {
+		fields = append(fields, "currency="+record.OperationCurrency+"@"+strconv.FormatFloat(*record.OperationRate, 'f', -1, 64))
+	}
+	content := strings.Join(append(fields, prevHash), "|")
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+//Verify - проверка цепочки хешей записей истории аккаунта accountId, упорядоченных по порядку добавления.
+//Записи без хеша в начале истории созданы до появления цепочки и не проверяются. Возвращает первое нарушение цепочки:
+//запись без хеша после начала цепочки, запись, содержимое которой не соответствует хешу, или запись,
+//PrevHash которой не равен хешу предыдущей записи (предыдущая запись удалена, вставлена или переставлена)
+func Verify(accountId int, records []model.TransactionRecord) model.ChainVerification {
+	result := model.ChainVerification{AccountId: accountId, Valid: true}
+	prevHash := ""
+	started := false
+	for i := range records {
+		record := &records[i]
+		if record.Hash == "" && !started {
+			result.UnhashedRecords++
+			continue
+		}
+		started = true
+		result.RecordsChecked++
+		reason := ""
+		switch {
+		case record.Hash == "":
+			reason = model.ChainHashMissing
+		case record.PrevHash != prevHash:
+			reason = model.ChainPrevHashMismatch
+		case Hash(*record, record.PrevHash) != record.Hash:
+			reason = model.ChainHashMismatch
+		}
+		if reason != "" {
+			createdAt := record.CreatedAt
+			result.Valid = false
+			result.BrokenRecordId = record.Id
+			result.BrokenAt = &createdAt
+			result.Reason = reason
+			return result
+		}
+		prevHash = record.Hash
+	}
+	return result
+}
@@ -0,0 +1,121 @@
+package hashchain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+//testChain - цепочка из трех записей аккаунта 1, перед которой есть запись, созданная до появления цепочки
+func testChain() []model.TransactionRecord {
+	counterparty := 2
+	records := []model.TransactionRecord{
+		{Id: 1, AccountId: 1, Delta: 100, RemainingBalance: 100, TransactionMessage: "Пополнение счета"},
+		{Id: 2, AccountId: 1, Delta: 50.5, RemainingBalance: 150.5, OperationType: model.OperationDeposit},
+		{Id: 3, AccountId: 1, Delta: -20, RemainingBalance: 130.5, OperationType: model.OperationTransferOut, CounterpartyId: &counterparty},
+		{Id: 4, AccountId: 1, Delta: -0.2, RemainingBalance: 130.3, OperationType: model.OperationFee, CounterpartyId: &counterparty},
+	}
+	prevHash := ""
+	for i := range records {
+		records[i].CreatedAt = time.Date(2020, 9, 21, 10, i, 0, 0, time.UTC)
+		if i == 0 {
+			continue
+		}
+		records[i].PrevHash = prevHash
+		records[i].Hash = Hash(records[i], prevHash)
+		prevHash = records[i].Hash
+	}
+	return records
+}
+
+//TestVerifyValid - неизмененная цепочка проходит проверку, записи до начала цепочки не проверяются
+func TestVerifyValid(t *testing.T) {
+	result := Verify(1, testChain())
+	assert.Equal(t, model.ChainVerification{AccountId: 1, Valid: true, RecordsChecked: 3, UnhashedRecords: 1}, result)
+}
+
+//TestVerifyEdited - изменение суммы записи обнаруживается на этой записи
+func TestVerifyEdited(t *testing.T) {
+	records := testChain()
+	records[2].Delta = -10
+	result := Verify(1, records)
+	assert.False(t, result.Valid)
+	assert.Equal(t, int64(3), result.BrokenRecordId)
+	assert.Equal(t, model.ChainHashMismatch, result.Reason)
+}
+
+//TestVerifyDeleted - удаление записи обнаруживается на следующей за ней записи
+func TestVerifyDeleted(t *testing.T) {
+	records := testChain()
+	records = append(records[:2], records[3])
+	result := Verify(1, records)
+	assert.False(t, result.Valid)
+	assert.Equal(t, int64(4), result.BrokenRecordId)
+	assert.Equal(t, model.ChainPrevHashMismatch, result.Reason)
+}
+
+//TestVerifyHashRemoved - удаление хеша записи после начала цепочки обнаруживается
+func TestVerifyHashRemoved(t *testing.T) {
+	records := testChain()
+	records[3].Hash = ""
+	result := Verify(1, records)
+	assert.False(t, result.Valid)
+	assert.Equal(t, int64(4), result.BrokenRecordId)
+	assert.Equal(t, model.ChainHashMissing, result.Reason)
+}
+
+//TestHashDetails - данные операции входят в хеш только при их наличии, изменение метаданных обнаруживается
+func TestHashDetails(t *testing.T) {
+	record := testChain()[1]
+	plain := Hash(record, "")
+	record.Metadata = model.Metadata{}
+	assert.Equal(t, plain, Hash(record, ""))
+
+	record.ExternalRef = "order-1"
+	record.Metadata = model.Metadata{"channel": "web", "campaign": "autumn"}
+	records := []model.TransactionRecord{record}
+	records[0].Hash = Hash(record, "")
+	assert.NotEqual(t, plain, records[0].Hash)
+	assert.True(t, Verify(1, records).Valid)
+
+	records[0].Metadata = model.Metadata{"channel": "app", "campaign": "autumn"}
+	assert.Equal(t, model.ChainHashMismatch, Verify(1, records).Reason)
+}
+
+//TestHashReversal - запись отмены хешируется вместе с отменяемой записью
+func TestHashReversal(t *testing.T) {
+	record := testChain()[1]
+	reversalOf, other := int64(2), int64(3)
+	record.ReversalOf = &reversalOf
+	hash := Hash(record, "")
+	record.ReversalOf = &other
+	assert.NotEqual(t, hash, Hash(record, ""))
+}
+
+//TestHashPair - связь со второй записью операции хешируется, записи без связи хешируются как раньше
+func TestHashPair(t *testing.T) {
+	record := testChain()[1]
+	hash := Hash(record, "")
+	pairId := int64(1)
+	record.PairId = &pairId
+	assert.NotEqual(t, hash, Hash(record, ""))
+	record.PairId = nil
+	assert.Equal(t, hash, Hash(record, ""))
+}
+
+//TestHashOperationCurrency - валюта операции и курс хешируются, записи без валюты хешируются как раньше
+func TestHashOperationCurrency(t *testing.T) {
+	record := testChain()[1]
+	hash := Hash(record, "")
+	rate := 0.0125
+	record.OperationCurrency = "USD"
+	record.OperationRate = &rate
+	withRate := Hash(record, "")
+	assert.NotEqual(t, hash, withRate)
+	rate = 0.013
+	assert.NotEqual(t, withRate, Hash(record, ""))
+	record.OperationCurrency, record.OperationRate = "", nil
+	assert.Equal(t, hash, Hash(record, ""))
+}
@@ -0,0 +1,154 @@
+package health
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/convert"
+	"github.com/call-me-snake/user_balance_service/internal/model"
+)
+
+//Состояния проверки и сервиса в целом
+const (
+	StatusOk       = "ok"
+	StatusFail     = "fail"
+	StatusDegraded = "degraded"
+)
+
+//DefaultTimeout - время, за которое должна завершиться каждая проверка
+const DefaultTimeout = 2 * time.Second
+
+//Check - проверка зависимости. Critical - при неудаче проверки сервис не готов принимать запросы,
+//иначе он работает с ограничениями. Run возвращает пояснение к результату проверки
+type Check struct {
+	Name     string
+	Critical bool
+	Run      func() (detail string, err error)
+}
+
+//CheckResult - результат проверки
+type CheckResult struct {
+	Status    string
+	Critical  bool
+	LatencyMs float64
+	Detail    string `json:",omitempty"`
+	Error     string `json:",omitempty"`
+}
+
+//Report - результаты всех проверок. Status - ok, degraded (не прошли некритичные проверки) или fail
+type Report struct {
+	Status string
+	Checks map[string]CheckResult
+}
+
+//Ready - готов ли сервис принимать запросы
+func (r Report) Ready() bool {
+	return r.Status != StatusFail
+}
+
+//Run - параллельное выполнение проверок. Проверка, не завершившаяся за timeout, считается неудачной
+func Run(checks []Check, timeout time.Duration) Report {
+	report := Report{Status: StatusOk, Checks: make(map[string]CheckResult, len(checks))}
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range checks {
+		wg.Add(1)
+		go func(check Check) {
+			defer wg.Done()
+			result := runCheck(check, timeout)
+			mutex.Lock()
+			defer mutex.Unlock()
+			report.Checks[check.Name] = result
+			if result.Status == StatusOk {
+				return
+			}
+			if check.Critical {
+				report.Status = StatusFail
+			} else if report.Status == StatusOk {
+				report.Status = StatusDegraded
+			}
+		}(check)
+	}
+	wg.Wait()
+	return report
+}
+
+//runCheck (internal) - выполнение проверки с ограничением времени
+func runCheck(check Check, timeout time.Duration) CheckResult {
+	type outcome struct {
+		detail string
+		err    error
+	}
+	done := make(chan outcome, 1)
+	start := time.Now()
+	go func() {
+		detail, err := check.Run()
+		done <- outcome{detail: detail, err: err}
+	}()
+	result := CheckResult{Status: StatusOk, Critical: check.Critical}
+	select {
+	case o := <-done:
+		result.Detail = o.detail
+		if o.err != nil {
+			result.Status, result.Error = StatusFail, o.err.Error()
+		}
+	case <-time.After(timeout):
+		result.Status, result.Error = StatusFail, fmt.Sprintf("проверка не завершилась за %v", timeout)
+	}
+	result.LatencyMs = float64(time.Since(start)) / float64(time.Millisecond)
+	return result
+}
+
+//ReadinessChecks - проверки готовности сервиса: соединение с базой данных, версия схемы базы данных,
+//доступность реплик и актуальность курсов валют. Проверки реплик и курсов некритичные:
+//без реплик чтение выполняется на основном сервере, без курсов недоступна только конвертация
+func ReadinessChecks(accStorage model.IBalanceInfoStorage, storer convert.ConvertDataStorer) []Check {
+	return []Check{
+		{Name: "database", Critical: true, Run: func() (string, error) {
+			if custErr := accStorage.Ping(); custErr != nil {
+				return "", custErr.Err
+			}
+			state := accStorage.Health()
+			return fmt.Sprintf("восстановлений соединения: %d", state.Reconnects), nil
+		}},
+		{Name: "migrations", Critical: true, Run: func() (string, error) {
+			version, custErr := accStorage.GetSchemaVersion()
+			if custErr != nil {
+				return "", custErr.Err
+			}
+			detail := fmt.Sprintf("версия схемы %d, требуется %d", version, model.SchemaVersion)
+			if version < model.SchemaVersion {
+				return detail, fmt.Errorf("схема базы данных устарела")
+			}
+			return detail, nil
+		}},
+		{Name: "replicas", Critical: false, Run: func() (string, error) {
+			replicas := accStorage.Health().Replicas
+			usable := 0
+			for _, replica := range replicas {
+				if replica.Usable {
+					usable++
+				}
+			}
+			detail := fmt.Sprintf("используется реплик: %d из %d", usable, len(replicas))
+			if len(replicas) > 0 && usable == 0 {
+				return detail, fmt.Errorf("нет доступных реплик, чтение выполняется на основном сервере")
+			}
+			return detail, nil
+		}},
+		{Name: "exchange_rates", Critical: false, Run: func() (string, error) {
+			//проверяются только сохраненные курсы: проверка готовности не должна обращаться к поставщику курсов
+			data := storer.CachedConvertData()
+			if data.FillingTime.IsZero() {
+				return "", fmt.Errorf("курсы валют не загружены")
+			}
+			age := time.Since(data.FillingTime).Truncate(time.Second)
+			detail := fmt.Sprintf("курсы на %s, обновлены %v назад", data.Date, age)
+			if age > convert.MaxRatesAge() {
+				return detail, fmt.Errorf("курсы валют устарели")
+			}
+			return detail, nil
+		}},
+	}
+}
@@ -0,0 +1,82 @@
+package health
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/convert"
+	mock_convert "github.com/call-me-snake/user_balance_service/internal/convert/mock"
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	mock_model "github.com/call-me-snake/user_balance_service/internal/model/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+//TestRunChecks - неудача некритичной проверки не делает сервис неготовым, зависшая проверка прерывается по времени
+func TestRunChecks(t *testing.T) {
+	ok := Check{Name: "ok", Critical: true, Run: func() (string, error) { return "detail", nil }}
+	optional := Check{Name: "optional", Run: func() (string, error) { return "", errors.New("Ошибка") }}
+	slow := Check{Name: "slow", Critical: true, Run: func() (string, error) {
+		time.Sleep(time.Second)
+		return "", nil
+	}}
+
+	report := Run([]Check{ok, optional}, time.Second)
+	assert.Equal(t, StatusDegraded, report.Status)
+	assert.True(t, report.Ready())
+	assert.Equal(t, "detail", report.Checks["ok"].Detail)
+	assert.Equal(t, StatusFail, report.Checks["optional"].Status)
+	assert.Equal(t, "Ошибка", report.Checks["optional"].Error)
+
+	report = Run([]Check{ok, slow}, 10*time.Millisecond)
+	assert.Equal(t, StatusFail, report.Status)
+	assert.False(t, report.Ready())
+	assert.Equal(t, StatusFail, report.Checks["slow"].Status)
+}
+
+//TestReadinessChecks - проверки базы данных, версии схемы, реплик и курсов валют
+func TestReadinessChecks(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	accStorage := mock_model.NewMockIBalanceInfoStorage(mockCtrl)
+	storer := mock_convert.NewMockConvertDataStorer(mockCtrl)
+
+	accStorage.EXPECT().Ping().Return(nil)
+	accStorage.EXPECT().Health().Return(model.StorageHealth{Connected: true}).Times(2)
+	accStorage.EXPECT().GetSchemaVersion().Return(model.SchemaVersion, nil)
+	storer.EXPECT().CachedConvertData().Return(model.ConvertData{FillingTime: time.Now(), Date: "2020-09-21"})
+	report := Run(ReadinessChecks(accStorage, storer), time.Second)
+	assert.Equal(t, StatusOk, report.Status)
+
+	replicas := []model.ReplicaHealth{{Name: "replica-1", Healthy: true, Lag: time.Minute}}
+	accStorage.EXPECT().Ping().Return(nil)
+	accStorage.EXPECT().Health().Return(model.StorageHealth{Connected: true, Replicas: replicas}).Times(2)
+	accStorage.EXPECT().GetSchemaVersion().Return(model.SchemaVersion-1, nil)
+	storer.EXPECT().CachedConvertData().Return(model.ConvertData{FillingTime: time.Now().Add(-3 * time.Hour)})
+	report = Run(ReadinessChecks(accStorage, storer), time.Second)
+	assert.Equal(t, StatusFail, report.Status)
+	assert.Equal(t, StatusFail, report.Checks["migrations"].Status)
+	assert.Equal(t, StatusFail, report.Checks["exchange_rates"].Status)
+	assert.Equal(t, StatusFail, report.Checks["replicas"].Status)
+	assert.Equal(t, StatusOk, report.Checks["database"].Status)
+}
+
+//TestExchangeRatesMaxAge - допустимый возраст курсов валют зависит от интервала их обновления
+func TestExchangeRatesMaxAge(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	storer := mock_convert.NewMockConvertDataStorer(mockCtrl)
+	checks := ReadinessChecks(nil, storer)
+	ratesCheck := checks[len(checks)-1]
+	storer.EXPECT().CachedConvertData().Return(model.ConvertData{FillingTime: time.Now().Add(-3 * time.Hour)}).Times(2)
+
+	convert.Configure(model.RatesOptions{CacheTTL: 2 * time.Hour})
+	defer convert.Configure(model.RatesOptions{CacheTTL: time.Hour})
+	_, err := ratesCheck.Run()
+	assert.NoError(t, err)
+
+	convert.Configure(model.RatesOptions{CacheTTL: time.Hour})
+	_, err = ratesCheck.Run()
+	assert.Error(t, err)
+}
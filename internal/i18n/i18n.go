@@ -0,0 +1,447 @@
+package i18n
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/call-me-snake/user_balance_service/internal/model"
+)
+
+//Поддерживаемые языки сообщений
+const (
+	Ru = "ru"
+	En = "en"
+	//DefaultLang - язык, используемый при отсутствии или неподдерживаемом значении Accept-Language
+	DefaultLang = Ru
+)
+
+//Ключи сообщений каталога
+const (
+	NullSum             = "null_sum"
+	NullTransferSum     = "null_transfer_sum"
+	CourseError         = "course_error"
+	UnknownCurrency     = "unknown_currency"
+	HistoryNotFound     = "history_not_found"
+	InvalidId           = "invalid_id"
+	InvalidRateType     = "invalid_rate_type"
+	InvalidAt           = "invalid_at"
+	InvalidFeeOperation = "invalid_fee_operation"
+	InvalidWebhookUrl   = "invalid_webhook_url"
+	InvalidStatus       = "invalid_status"
+	ScheduleAccounts    = "schedule_accounts"
+	ScheduleDelta       = "schedule_delta"
+	ScheduleRetries     = "schedule_retries"
+	ScheduleRecurrence  = "schedule_recurrence"
+	ReconcileNotFound   = "reconcile_not_found"
+	ClientCertRequired  = "client_cert_required"
+	ClientNotAllowed    = "client_not_allowed"
+	InvalidPeriod       = "invalid_period"
+	InvalidMonth        = "invalid_month"
+	InvalidFormat       = "invalid_format"
+	StatementNotFound   = "statement_not_found"
+
+	InvalidTurnoverPeriod = "invalid_turnover_period"
+	InvalidTurnoverGroup  = "invalid_turnover_group"
+	InvalidDateRange      = "invalid_date_range"
+
+	InvalidOperationDetails = "invalid_operation_details"
+	ExternalRefRequired     = "external_ref_required"
+	InvalidOperationType    = "invalid_operation_type"
+	NotReversible           = "not_reversible"
+	InvalidAccountHierarchy = "invalid_account_hierarchy"
+	InvalidBonusAmount      = "invalid_bonus_amount"
+	InvalidBonusExpiry      = "invalid_bonus_expiry"
+	BonusPurchaseRequired   = "bonus_purchase_required"
+
+	StatementTitle       = "statement_title"
+	StatementPeriod      = "statement_period"
+	StatementOpening     = "statement_opening"
+	StatementClosing     = "statement_closing"
+	StatementCredits     = "statement_credits"
+	StatementDebits      = "statement_debits"
+	StatementMovements   = "statement_movements"
+	StatementDate        = "statement_date"
+	StatementOperation   = "statement_operation"
+	StatementAmount      = "statement_amount"
+	StatementBalance     = "statement_balance"
+	StatementNoMovements = "statement_no_movements"
+
+	ValidationMissingParam = "validation_missing_param"
+	ValidationMissingField = "validation_missing_field"
+	ValidationUnknownField = "validation_unknown_field"
+	ValidationBodyRead     = "validation_body_read"
+	ValidationBodyTooLarge = "validation_body_too_large"
+	ValidationBodyMissing  = "validation_body_missing"
+	ValidationBodyJSON     = "validation_body_json"
+	ValidationObject       = "validation_object"
+	ValidationArray        = "validation_array"
+	ValidationString       = "validation_string"
+	ValidationNumber       = "validation_number"
+	ValidationInteger      = "validation_integer"
+	ValidationBoolean      = "validation_boolean"
+	ValidationDateTime     = "validation_date_time"
+	ValidationPattern      = "validation_pattern"
+	ValidationMinimum      = "validation_minimum"
+	ValidationExclusiveMin = "validation_exclusive_minimum"
+	ValidationEnum         = "validation_enum"
+)
+
+//Ключи описаний операций истории, используются RecordMessage и OperationMessage
+const (
+	operationDeposit     = "operation_deposit"
+	operationWithdrawal  = "operation_withdrawal"
+	operationTransfer    = "operation_transfer"
+	operationFeeCharged  = "operation_fee_charged"
+	operationFeeReceived = "operation_fee_received"
+	operationFeeSuffix   = "operation_fee_suffix"
+	operationUnknown     = "operation_unknown"
+	operationReversal    = "operation_reversal"
+	operationInterest    = "operation_interest"
+	operationInterestOut = "operation_interest_out"
+	bonusCredit          = "bonus_credit"
+	bonusSpend           = "bonus_spend"
+	bonusExpiry          = "bonus_expiry"
+)
+
+//problemTitlePrefix - префикс ключей заголовков ошибок, ключ заголовка - problemTitlePrefix + код ошибки model.ErrorCode
+const problemTitlePrefix = "problem_"
+
+//catalogue - тексты сообщений по языкам. Аргументы подставляются через fmt.Sprintf
+var catalogue = map[string]map[string]string{
+	Ru: {
+		NullSum:             "Нулевая сумма пополнения",
+		NullTransferSum:     "Нулевая сумма перевода",
+		CourseError:         "Не удалось предоставить информацию для выбранного курса валюты",
+		UnknownCurrency:     "Поле Currency должно содержать код валюты, для которой известен курс.",
+		HistoryNotFound:     "Отсутсвуют записи по выбранным условиям поиска",
+		InvalidId:           "Поле id должно быть числовым целочисленным типом больше 0.",
+		InvalidRateType:     "Поле RateType может принимать значения current или historical.",
+		InvalidAt:           "Параметр at должен содержать дату и время в формате RFC 3339.",
+		InvalidFeeOperation: "Поле Operation может принимать значения withdrawal или transfer.",
+		InvalidWebhookUrl:   "Поле Url должно содержать http(s) адрес.",
+		InvalidStatus:       "Параметр status может принимать значения pending, delivered или dead.",
+		ScheduleAccounts:    "Поля FromId и ToId должны быть различными целыми числами больше 0.",
+		ScheduleDelta:       "Поле Delta должно быть больше 0.",
+		ScheduleRetries:     "Поля MaxRetries и RetryIntervalSec не могут быть отрицательными.",
+		ScheduleRecurrence:  "Некорректное расписание в поле Recurrence.",
+		ReconcileNotFound:   "Сверка балансов еще не выполнялась.",
+		ClientCertRequired:  "Требуется сертификат клиента.",
+		ClientNotAllowed:    "Клиенту с сертификатом %s доступ запрещен.",
+		InvalidPeriod:       "Параметры from и to должны содержать дату и время в формате RFC 3339, from должен быть раньше to.",
+		InvalidMonth:        "Месяц должен быть указан в формате YYYY-MM.",
+		InvalidFormat:       "Параметр format может принимать значения json или html.",
+		StatementNotFound:   "Выписка за указанный месяц не найдена.",
+
+		InvalidTurnoverPeriod: "Параметр period может принимать значения day, week или month.",
+		InvalidTurnoverGroup:  "Параметр by может принимать значение operation_type.",
+		InvalidDateRange:      "Параметры from и to должны содержать дату в формате YYYY-MM-DD, from должен быть раньше to.",
+
+		InvalidOperationDetails: "Purpose должен быть не длиннее %d символов, ExternalRef - не длиннее %d символов, Metadata - содержать не больше %d пар с непустыми ключами не длиннее %d символов и значениями не длиннее %d символов.",
+		ExternalRefRequired:     "Параметр ref должен содержать внешний идентификатор операции.",
+		InvalidOperationType:    "OperationTypes может содержать значения deposit, withdrawal, transfer_in, transfer_out, fee, reversal, interest.",
+		NotReversible:           "Отменить можно только пополнение, снятие, перевод или комиссию.",
+		InvalidAccountHierarchy: "Аккаунт не может быть подчинен своему субаккаунту, глубина иерархии не должна превышать %d уровней.",
+		InvalidBonusAmount:      "Поле Amount должно быть больше 0.",
+		InvalidBonusExpiry:      "Поле ExpiresInDays должно быть целым числом больше 0.",
+		BonusPurchaseRequired:   "Бонусы списываются только в оплату покупки: поле ExternalRef должно содержать идентификатор заказа.",
+
+		StatementTitle:       "Выписка по аккаунту %d",
+		StatementPeriod:      "Период: с %s по %s",
+		StatementOpening:     "Остаток на начало периода",
+		StatementClosing:     "Остаток на конец периода",
+		StatementCredits:     "Зачисления",
+		StatementDebits:      "Списания",
+		StatementMovements:   "Операции",
+		StatementDate:        "Дата",
+		StatementOperation:   "Операция",
+		StatementAmount:      "Сумма",
+		StatementBalance:     "Остаток",
+		StatementNoMovements: "Операций за период нет.",
+
+		ValidationMissingParam: "обязательный параметр отсутствует",
+		ValidationMissingField: "обязательное поле отсутствует",
+		ValidationUnknownField: "неизвестное поле",
+		ValidationBodyRead:     "не удалось прочитать тело запроса",
+		ValidationBodyTooLarge: "размер тела запроса превышает %d байт",
+		ValidationBodyMissing:  "тело запроса отсутствует",
+		ValidationBodyJSON:     "тело запроса не является корректным JSON",
+		ValidationObject:       "ожидается объект",
+		ValidationArray:        "ожидается массив",
+		ValidationString:       "ожидается строка",
+		ValidationNumber:       "ожидается число",
+		ValidationInteger:      "ожидается целое число",
+		ValidationBoolean:      "ожидается логическое значение",
+		ValidationDateTime:     "ожидается дата и время в формате RFC 3339",
+		ValidationPattern:      "значение не соответствует формату",
+		ValidationMinimum:      "значение должно быть больше или равно %v",
+		ValidationExclusiveMin: "значение должно быть больше %v",
+		ValidationEnum:         "допустимые значения: %v",
+
+		problemTitlePrefix + "internal_error":      "Внутренняя ошибка сервера",
+		problemTitlePrefix + "invalid_input":       "Некорректные входные данные",
+		problemTitlePrefix + "validation_failed":   "Запрос не соответствует описанию API",
+		problemTitlePrefix + "zero_amount":         "Нулевая сумма операции",
+		problemTitlePrefix + "same_accounts":       "Аккаунты отправителя и получателя совпадают",
+		problemTitlePrefix + "insufficient_funds":  "Недостаточно средств на счету",
+		problemTitlePrefix + "rate_unavailable":    "Курс валюты недоступен",
+		problemTitlePrefix + "not_found":           "Объект не найден",
+		problemTitlePrefix + "history_not_found":   "Записи истории не найдены",
+		problemTitlePrefix + "schedule_not_found":  "Запланированный перевод не найден",
+		problemTitlePrefix + "webhook_not_found":   "Подписка или доставка не найдена",
+		problemTitlePrefix + "rate_limited":        "Превышено ограничение частоты запросов",
+		problemTitlePrefix + "service_unavailable": "База данных временно недоступна",
+		problemTitlePrefix + "account_frozen":      "Аккаунт заблокирован",
+		problemTitlePrefix + "forbidden":           "Доступ запрещен",
+		problemTitlePrefix + "already_reversed":    "Операция уже отменена",
+		problemTitlePrefix + "not_sub_account":     "Аккаунт не является субаккаунтом",
+
+		operationDeposit:     "Аккаунт %d успешно пополнен на сумму %.2f руб.",
+		operationWithdrawal:  "С аккаунта %d успешно снята сумма %.2f руб.",
+		operationTransfer:    "Перевод на сумму %.2f руб. с аккаунта %d на аккаунт %d выполнен успешно.",
+		operationFeeCharged:  "С аккаунта %d списана комиссия %.2f руб.",
+		operationFeeReceived: "Зачислена комиссия %.2f руб. с аккаунта %d",
+		operationFeeSuffix:   " Комиссия %.2f руб.",
+		operationUnknown:     "Операция на сумму %.2f руб.",
+		operationReversal:    "Отмена операции %d: баланс аккаунта %d изменен на %+.2f руб.",
+		operationInterest:    "На аккаунт %d выплачены проценты %.2f руб.",
+		operationInterestOut: "Выплачены проценты %.2f руб. на аккаунт %d",
+		bonusCredit:          "На аккаунт %d начислено %.2f бонусов.",
+		bonusSpend:           "С аккаунта %d списано %.2f бонусов в оплату покупки.",
+		bonusExpiry:          "С аккаунта %d списано %.2f бонусов по истечении срока действия.",
+	},
+	En: {
+		NullSum:             "Zero top-up amount",
+		NullTransferSum:     "Zero transfer amount",
+		CourseError:         "Exchange rate for the selected currency is unavailable",
+		UnknownCurrency:     "Field Currency must contain a currency code with a known exchange rate.",
+		HistoryNotFound:     "No records match the search criteria",
+		InvalidId:           "Field id must be an integer greater than 0.",
+		InvalidRateType:     "Field RateType must be current or historical.",
+		InvalidAt:           "Parameter at must be an RFC 3339 date-time.",
+		InvalidFeeOperation: "Field Operation must be withdrawal or transfer.",
+		InvalidWebhookUrl:   "Field Url must contain an http(s) address.",
+		InvalidStatus:       "Parameter status must be pending, delivered or dead.",
+		ScheduleAccounts:    "Fields FromId and ToId must be different integers greater than 0.",
+		ScheduleDelta:       "Field Delta must be greater than 0.",
+		ScheduleRetries:     "Fields MaxRetries and RetryIntervalSec must not be negative.",
+		ScheduleRecurrence:  "Invalid schedule in field Recurrence.",
+		ReconcileNotFound:   "Reconciliation has not been run yet.",
+		ClientCertRequired:  "A client certificate is required.",
+		ClientNotAllowed:    "Client with certificate %s is not allowed.",
+		InvalidPeriod:       "Parameters from and to must be RFC 3339 date-times, from must be before to.",
+		InvalidMonth:        "Month must be in YYYY-MM format.",
+		InvalidFormat:       "Parameter format must be json or html.",
+		StatementNotFound:   "No statement for the specified month.",
+
+		InvalidTurnoverPeriod: "Parameter period must be day, week or month.",
+		InvalidTurnoverGroup:  "Parameter by must be operation_type.",
+		InvalidDateRange:      "Parameters from and to must be dates in YYYY-MM-DD format, from must be before to.",
+
+		InvalidOperationDetails: "Purpose must be at most %d characters, ExternalRef at most %d characters, Metadata at most %d pairs with non-empty keys of at most %d characters and values of at most %d characters.",
+		ExternalRefRequired:     "Parameter ref must contain the external reference of the operation.",
+		InvalidOperationType:    "OperationTypes may contain deposit, withdrawal, transfer_in, transfer_out, fee, reversal, interest.",
+		NotReversible:           "Only a top-up, withdrawal, transfer or fee can be reversed.",
+		InvalidAccountHierarchy: "An account cannot be placed under its own sub-account, and the hierarchy cannot exceed %d levels.",
+		InvalidBonusAmount:      "Field Amount must be greater than 0.",
+		InvalidBonusExpiry:      "Field ExpiresInDays must be an integer greater than 0.",
+		BonusPurchaseRequired:   "Bonus points can only be spent on a purchase: field ExternalRef must contain the order reference.",
+
+		StatementTitle:       "Statement of account %d",
+		StatementPeriod:      "Period: from %s to %s",
+		StatementOpening:     "Opening balance",
+		StatementClosing:     "Closing balance",
+		StatementCredits:     "Credits",
+		StatementDebits:      "Debits",
+		StatementMovements:   "Movements",
+		StatementDate:        "Date",
+		StatementOperation:   "Operation",
+		StatementAmount:      "Amount",
+		StatementBalance:     "Balance",
+		StatementNoMovements: "No movements in the period.",
+
+		ValidationMissingParam: "required parameter is missing",
+		ValidationMissingField: "required field is missing",
+		ValidationUnknownField: "unknown field",
+		ValidationBodyRead:     "failed to read request body",
+		ValidationBodyTooLarge: "request body exceeds %d bytes",
+		ValidationBodyMissing:  "request body is missing",
+		ValidationBodyJSON:     "request body is not valid JSON",
+		ValidationObject:       "object expected",
+		ValidationArray:        "array expected",
+		ValidationString:       "string expected",
+		ValidationNumber:       "number expected",
+		ValidationInteger:      "integer expected",
+		ValidationBoolean:      "boolean expected",
+		ValidationDateTime:     "RFC 3339 date-time expected",
+		ValidationPattern:      "value does not match the format",
+		ValidationMinimum:      "value must be greater than or equal to %v",
+		ValidationExclusiveMin: "value must be greater than %v",
+		ValidationEnum:         "allowed values: %v",
+
+		problemTitlePrefix + "internal_error":      "Internal server error",
+		problemTitlePrefix + "invalid_input":       "Invalid input data",
+		problemTitlePrefix + "validation_failed":   "Request does not match the API description",
+		problemTitlePrefix + "zero_amount":         "Zero operation amount",
+		problemTitlePrefix + "same_accounts":       "Sender and recipient accounts are the same",
+		problemTitlePrefix + "insufficient_funds":  "Insufficient funds",
+		problemTitlePrefix + "rate_unavailable":    "Exchange rate unavailable",
+		problemTitlePrefix + "not_found":           "Object not found",
+		problemTitlePrefix + "history_not_found":   "History records not found",
+		problemTitlePrefix + "schedule_not_found":  "Scheduled transfer not found",
+		problemTitlePrefix + "webhook_not_found":   "Subscription or delivery not found",
+		problemTitlePrefix + "rate_limited":        "Too many requests",
+		problemTitlePrefix + "service_unavailable": "Database is temporarily unavailable",
+		problemTitlePrefix + "account_frozen":      "Account is frozen",
+		problemTitlePrefix + "forbidden":           "Access denied",
+		problemTitlePrefix + "already_reversed":    "Operation already reversed",
+		problemTitlePrefix + "not_sub_account":     "Account is not a sub-account",
+
+		operationDeposit:     "Account %d topped up by %.2f RUB.",
+		operationWithdrawal:  "%.2[2]f RUB withdrawn from account %[1]d.",
+		operationTransfer:    "Transfer of %.2f RUB from account %d to account %d completed.",
+		operationFeeCharged:  "Fee of %.2[2]f RUB charged to account %[1]d.",
+		operationFeeReceived: "Fee of %.2f RUB received from account %d",
+		operationFeeSuffix:   " Fee %.2f RUB.",
+		operationUnknown:     "Operation of %.2f RUB.",
+		operationReversal:    "Reversal of operation %d: balance of account %d changed by %+.2f RUB.",
+		operationInterest:    "Interest of %.2[2]f RUB paid to account %[1]d.",
+		operationInterestOut: "Interest of %.2f RUB paid to account %d.",
+		bonusCredit:          "%.2[2]f bonus points credited to account %[1]d.",
+		bonusSpend:           "%.2[2]f bonus points spent on a purchase from account %[1]d.",
+		bonusExpiry:          "%.2[2]f bonus points expired on account %[1]d.",
+	},
+}
+
+//Message - текст сообщения key на языке lang. При отсутствии перевода используется DefaultLang
+func Message(lang, key string, args ...interface{}) string {
+	format, ok := catalogue[lang][key]
+	if !ok {
+		if format, ok = catalogue[DefaultLang][key]; !ok {
+			return key
+		}
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+//ProblemTitle - заголовок ошибки с кодом code (model.ErrorCode) на языке lang
+func ProblemTitle(lang, code string) string {
+	return Message(lang, problemTitlePrefix+code)
+}
+
+//FromAcceptLanguage - выбор поддерживаемого языка по заголовку Accept-Language с учетом весов q
+func FromAcceptLanguage(header string) string {
+	type candidate struct {
+		lang string
+		q    float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		if tag == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if value, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = value
+				}
+			}
+		}
+		if i := strings.IndexAny(tag, "-_"); i >= 0 {
+			tag = tag[:i]
+		}
+		if _, ok := catalogue[tag]; ok && q > 0 {
+			candidates = append(candidates, candidate{lang: tag, q: q})
+		}
+	}
+	if len(candidates) == 0 {
+		return DefaultLang
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+	return candidates[0].lang
+}
+
+//RecordMessage - описание операции по записи истории на языке lang.
+//Для записей, сохраненных до появления поля OperationType, возвращается сохраненный текст
+func RecordMessage(lang string, record *model.TransactionRecord) string {
+	amount := math.Abs(record.Delta)
+	counterparty := 0
+	if record.CounterpartyId != nil {
+		counterparty = *record.CounterpartyId
+	}
+	switch record.OperationType {
+	case "":
+		return record.TransactionMessage
+	case model.OperationDeposit:
+		return Message(lang, operationDeposit, record.AccountId, amount)
+	case model.OperationWithdrawal:
+		return Message(lang, operationWithdrawal, record.AccountId, amount)
+	case model.OperationTransferOut:
+		return Message(lang, operationTransfer, amount, record.AccountId, counterparty)
+	case model.OperationTransferIn:
+		return Message(lang, operationTransfer, amount, counterparty, record.AccountId)
+	case model.OperationFee:
+		if record.Delta < 0 {
+			return Message(lang, operationFeeCharged, record.AccountId, amount)
+		}
+		return Message(lang, operationFeeReceived, amount, counterparty)
+	case model.OperationReversal:
+		var reversalOf int64
+		if record.ReversalOf != nil {
+			reversalOf = *record.ReversalOf
+		}
+		return Message(lang, operationReversal, reversalOf, record.AccountId, record.Delta)
+	case model.OperationInterest:
+		if record.Delta > 0 {
+			return Message(lang, operationInterest, record.AccountId, amount)
+		}
+		return Message(lang, operationInterestOut, amount, counterparty)
+	}
+	return Message(lang, operationUnknown, record.Delta)
+}
+
+//OperationMessage - сообщение об успешном изменении баланса или переводе на языке lang
+func OperationMessage(lang string, result *model.OperationResult) string {
+	message := RecordMessage(lang, &result.Record)
+	if result.Fee > 0 {
+		message += Message(lang, operationFeeSuffix, result.Fee)
+	}
+	return message
+}
+
+//LocalizeHistory - заполняет TransactionMessage записей истории на языке lang
+func LocalizeHistory(lang string, history []model.TransactionRecord) {
+	for i := range history {
+		history[i].TransactionMessage = RecordMessage(lang, &history[i])
+	}
+}
+
+//BonusRecordMessage - описание операции с бонусами по записи истории бонусов на языке lang
+func BonusRecordMessage(lang string, record *model.BonusRecord) string {
+	amount := math.Abs(record.Delta)
+	switch record.OperationType {
+	case model.BonusCredit:
+		return Message(lang, bonusCredit, record.AccountId, amount)
+	case model.BonusSpend:
+		return Message(lang, bonusSpend, record.AccountId, amount)
+	case model.BonusExpiry:
+		return Message(lang, bonusExpiry, record.AccountId, amount)
+	}
+	return Message(lang, operationUnknown, record.Delta)
+}
+
+//LocalizeBonusHistory - заполняет TransactionMessage записей истории бонусов на языке lang
+func LocalizeBonusHistory(lang string, history []model.BonusRecord) {
+	for i := range history {
+		history[i].TransactionMessage = BonusRecordMessage(lang, &history[i])
+	}
+}
@@ -0,0 +1,56 @@
+package i18n
+
+import (
+	"testing"
+
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+//TestFromAcceptLanguage - тест выбора языка по заголовку Accept-Language
+func TestFromAcceptLanguage(t *testing.T) {
+	assert.Equal(t, DefaultLang, FromAcceptLanguage(""))
+	assert.Equal(t, En, FromAcceptLanguage("en-US,en;q=0.9"))
+	assert.Equal(t, Ru, FromAcceptLanguage("de-DE, ru;q=0.8, en;q=0.5"))
+	assert.Equal(t, En, FromAcceptLanguage("ru;q=0.3, en-GB;q=0.7"))
+	assert.Equal(t, DefaultLang, FromAcceptLanguage("fr, de;q=0.5"))
+	assert.Equal(t, Ru, FromAcceptLanguage("en;q=0, ru"))
+}
+
+//TestRecordMessage - тест формирования описания операции по структурированной записи истории
+func TestRecordMessage(t *testing.T) {
+	counterparty := 2
+	transferOut := &model.TransactionRecord{AccountId: 1, Delta: -150, OperationType: model.OperationTransferOut, CounterpartyId: &counterparty}
+	transferIn := &model.TransactionRecord{AccountId: 1, Delta: 150, OperationType: model.OperationTransferIn, CounterpartyId: &counterparty}
+	withdrawal := &model.TransactionRecord{AccountId: 1, Delta: -20, OperationType: model.OperationWithdrawal}
+	legacy := &model.TransactionRecord{AccountId: 1, Delta: 10, TransactionMessage: "Сохраненный текст"}
+	interest := &model.TransactionRecord{AccountId: 1, Delta: 3.25, OperationType: model.OperationInterest, CounterpartyId: &counterparty}
+	interestOut := &model.TransactionRecord{AccountId: 2, Delta: -3.25, OperationType: model.OperationInterest, CounterpartyId: &interest.AccountId}
+
+	assert.Equal(t, "Перевод на сумму 150.00 руб. с аккаунта 1 на аккаунт 2 выполнен успешно.", RecordMessage(Ru, transferOut))
+	assert.Equal(t, "Transfer of 150.00 RUB from account 2 to account 1 completed.", RecordMessage(En, transferIn))
+	assert.Equal(t, "20.00 RUB withdrawn from account 1.", RecordMessage(En, withdrawal))
+	assert.Equal(t, "Сохраненный текст", RecordMessage(En, legacy))
+	assert.Equal(t, "На аккаунт 1 выплачены проценты 3.25 руб.", RecordMessage(Ru, interest))
+	assert.Equal(t, "Interest of 3.25 RUB paid to account 1.", RecordMessage(En, interestOut))
+	assert.Equal(t, "С аккаунта 1 успешно снята сумма 20.00 руб. Комиссия 1.50 руб.",
+		OperationMessage(Ru, &model.OperationResult{Record: *withdrawal, Fee: 1.5}))
+}
+
+//TestBonusRecordMessage - тест формирования описания операции с бонусами
+func TestBonusRecordMessage(t *testing.T) {
+	credit := &model.BonusRecord{AccountId: 1, Delta: 50, OperationType: model.BonusCredit}
+	spend := &model.BonusRecord{AccountId: 1, Delta: -12.5, OperationType: model.BonusSpend}
+	expiry := &model.BonusRecord{AccountId: 1, Delta: -37.5, OperationType: model.BonusExpiry}
+
+	assert.Equal(t, "На аккаунт 1 начислено 50.00 бонусов.", BonusRecordMessage(Ru, credit))
+	assert.Equal(t, "12.50 bonus points spent on a purchase from account 1.", BonusRecordMessage(En, spend))
+	assert.Equal(t, "С аккаунта 1 списано 37.50 бонусов по истечении срока действия.", BonusRecordMessage(Ru, expiry))
+}
+
+//TestMessageFallback - при отсутствии языка используется язык по умолчанию
+func TestMessageFallback(t *testing.T) {
+	assert.Equal(t, Message(Ru, NullSum), Message("de", NullSum))
+	assert.Equal(t, "Zero top-up amount", Message(En, NullSum))
+	assert.Equal(t, "Insufficient funds", ProblemTitle(En, "insufficient_funds"))
+}
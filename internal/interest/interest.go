@@ -0,0 +1,96 @@
+package interest
+
+import (
+	"log"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/model"
+)
+
+//settleDelay - задержка начисления после окончания дня, чтобы успели завершиться операции, начатые до полуночи
+const settleDelay = 10 * time.Minute
+
+//Job - начисляет проценты на баланс на конец каждого дня (по UTC) и выплачивает их после окончания месяца
+type Job struct {
+	accStorage model.IBalanceInfoStorage
+	interval   time.Duration
+}
+
+//NewJob - конструктор *Job. interval - период проверки завершившихся дней без начисления процентов
+func NewJob(accStorage model.IBalanceInfoStorage, interval time.Duration) *Job {
+	return &Job{accStorage: accStorage, interval: interval}
+}
+
+//Start - запускает периодическое начисление и выплату процентов в отдельной горутине
+func (j *Job) Start() {
+	go func() {
+		for {
+			j.RunDue(time.Now())
+			time.Sleep(j.interval)
+		}
+	}()
+}
+
+//RunDue - начисляет проценты за все дни, завершившиеся к моменту now, начиная со дня после последнего начисления
+//(если начислений еще не было - только за последний завершившийся день), затем выплачивает проценты за завершившиеся
+//месяцы. Выплата аккаунту, который заблокирован или на счете расходов которого недостаточно средств, откладывается
+//до следующего запуска и не мешает выплатам другим аккаунтам
+func (j *Job) RunDue(now time.Time) {
+	lastDay := day(now.Add(-settleDelay)).AddDate(0, 0, -1)
+	last, custErr := j.accStorage.GetLastInterestAccrualDate()
+	if custErr != nil {
+		log.Printf("interest.RunDue: %s", custErr.Err.Error())
+		return
+	}
+	next := lastDay
+	if last != nil {
+		next = day(*last).AddDate(0, 0, 1)
+	}
+	for ; !next.After(lastDay); next = next.AddDate(0, 0, 1) {
+		count, custErr := j.accStorage.AccrueInterest(next)
+		if custErr != nil {
+			log.Printf("interest.RunDue: %s", custErr.Err.Error())
+			return
+		}
+		if count > 0 {
+			log.Printf("interest.RunDue: начислены проценты за %s аккаунтам: %d", next.Format("2006-01-02"), count)
+		}
+	}
+
+	//проценты за дни до начала текущего месяца уже начислены
+	periodEnd := month(lastDay.AddDate(0, 0, 1))
+	ids, custErr := j.accStorage.GetUnpaidInterestAccountIds(periodEnd)
+	if custErr != nil {
+		log.Printf("interest.RunDue: %s", custErr.Err.Error())
+		return
+	}
+	paid := 0
+	for _, id := range ids {
+		amount, custErr := j.accStorage.CapitalizeInterest(id, periodEnd)
+		if custErr != nil {
+			log.Printf("interest.RunDue: %s", custErr.Err.Error())
+			if custErr.ErrCode == model.AccountFrozenCode || custErr.ErrCode == model.InsufficientFundsCode {
+				continue
+			}
+			return
+		}
+		if amount > 0 {
+			paid++
+		}
+	}
+	if paid > 0 {
+		log.Printf("interest.RunDue: выплачены проценты аккаунтам: %d", paid)
+	}
+}
+
+//day (internal) - начало дня (по UTC), которому принадлежит момент t
+func day(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+//month (internal) - начало месяца (по UTC), которому принадлежит момент t
+func month(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,78 @@
+package interest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	mock_model "github.com/call-me-snake/user_balance_service/internal/model/mock"
+	"github.com/golang/mock/gomock"
+)
+
+//TestRunDueCatchUp - проценты начисляются за все дни после последнего начисления, затем выплачиваются
+//за завершившийся месяц
+func TestRunDueCatchUp(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	accStorage := mock_model.NewMockIBalanceInfoStorage(mockCtrl)
+	last := time.Date(2020, 9, 29, 0, 0, 0, 0, time.UTC)
+	october := time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC)
+	gomock.InOrder(
+		accStorage.EXPECT().GetLastInterestAccrualDate().Return(&last, nil),
+		accStorage.EXPECT().AccrueInterest(time.Date(2020, 9, 30, 0, 0, 0, 0, time.UTC)).Return(int64(2), nil),
+		accStorage.EXPECT().AccrueInterest(october).Return(int64(2), nil),
+		accStorage.EXPECT().GetUnpaidInterestAccountIds(october).Return([]int{1, 2}, nil),
+		accStorage.EXPECT().CapitalizeInterest(1, october).Return(12.34, nil),
+		accStorage.EXPECT().CapitalizeInterest(2, october).Return(0.0, nil),
+	)
+	NewJob(accStorage, time.Hour).RunDue(time.Date(2020, 10, 2, 0, 30, 0, 0, time.UTC))
+}
+
+//TestRunDueFirstRun - без начислений проценты начисляются только за последний завершившийся день;
+//сразу после полуночи день еще не считается завершившимся
+func TestRunDueFirstRun(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	accStorage := mock_model.NewMockIBalanceInfoStorage(mockCtrl)
+	gomock.InOrder(
+		accStorage.EXPECT().GetLastInterestAccrualDate().Return(nil, nil),
+		accStorage.EXPECT().AccrueInterest(time.Date(2020, 9, 30, 0, 0, 0, 0, time.UTC)).Return(int64(0), nil),
+		accStorage.EXPECT().GetUnpaidInterestAccountIds(time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC)).Return([]int{}, nil),
+	)
+	NewJob(accStorage, time.Hour).RunDue(time.Date(2020, 10, 2, 0, 5, 0, 0, time.UTC))
+}
+
+//TestRunDueCapitalizeErrors - выплата, отложенная из-за блокировки аккаунта или нехватки средств на счете расходов,
+//не мешает выплатам другим аккаунтам; при ошибке базы данных выплаты прекращаются
+func TestRunDueCapitalizeErrors(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	accStorage := mock_model.NewMockIBalanceInfoStorage(mockCtrl)
+	last := time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC)
+	october := time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC)
+	gomock.InOrder(
+		accStorage.EXPECT().GetLastInterestAccrualDate().Return(&last, nil),
+		accStorage.EXPECT().GetUnpaidInterestAccountIds(october).Return([]int{1, 2, 3, 4}, nil),
+		accStorage.EXPECT().CapitalizeInterest(1, october).
+			Return(0.0, &model.CustomErr{Err: errors.New("Ошибка"), ErrCode: model.AccountFrozenCode}),
+		accStorage.EXPECT().CapitalizeInterest(2, october).
+			Return(0.0, &model.CustomErr{Err: errors.New("Ошибка"), ErrCode: model.InsufficientFundsCode}),
+		accStorage.EXPECT().CapitalizeInterest(3, october).
+			Return(0.0, &model.CustomErr{Err: errors.New("Ошибка"), ErrCode: model.DefaultErrCode}),
+	)
+	NewJob(accStorage, time.Hour).RunDue(time.Date(2020, 10, 2, 0, 5, 0, 0, time.UTC))
+}
+
+//TestRunDueAccrualError - при ошибке начисления следующие дни не обрабатываются и проценты не выплачиваются
+func TestRunDueAccrualError(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	accStorage := mock_model.NewMockIBalanceInfoStorage(mockCtrl)
+	last := time.Date(2020, 9, 28, 0, 0, 0, 0, time.UTC)
+	accStorage.EXPECT().GetLastInterestAccrualDate().Return(&last, nil)
+	accStorage.EXPECT().AccrueInterest(time.Date(2020, 9, 29, 0, 0, 0, 0, time.UTC)).
+		Return(int64(0), &model.CustomErr{Err: errors.New("Ошибка"), ErrCode: model.DefaultErrCode})
+	NewJob(accStorage, time.Hour).RunDue(time.Date(2020, 10, 2, 0, 30, 0, 0, time.UTC))
+}
+
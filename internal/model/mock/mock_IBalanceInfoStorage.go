@@ -6,6 +6,7 @@ package mock_model
 
 import (
 	reflect "reflect"
+	time "time"
 
 	model "github.com/call-me-snake/user_balance_service/internal/model"
 	gomock "github.com/golang/mock/gomock"
@@ -49,47 +50,904 @@ func (mr *MockIBalanceInfoStorageMockRecorder) GetAccountBalance(id interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAccountBalance", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).GetAccountBalance), id)
 }
 
+// GetAccountBalanceAt mocks base method.
+func (m *MockIBalanceInfoStorage) GetAccountBalanceAt(id int, at time.Time) (*model.BalanceInfo, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAccountBalanceAt", id, at)
+	ret0, _ := ret[0].(*model.BalanceInfo)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// GetAccountBalanceAt indicates an expected call of GetAccountBalanceAt.
+func (mr *MockIBalanceInfoStorageMockRecorder) GetAccountBalanceAt(id, at interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAccountBalanceAt", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).GetAccountBalanceAt), id, at)
+}
+
 // ChangeAccountBalance mocks base method.
-func (m *MockIBalanceInfoStorage) ChangeAccountBalance(id int, delta float64) (string, *model.CustomErr) {
+func (m *MockIBalanceInfoStorage) ChangeAccountBalance(id int, delta float64, details model.OperationDetails) (*model.OperationResult, *model.CustomErr) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ChangeAccountBalance", id, delta)
-	ret0, _ := ret[0].(string)
+	ret := m.ctrl.Call(m, "ChangeAccountBalance", id, delta, details)
+	ret0, _ := ret[0].(*model.OperationResult)
 	ret1, _ := ret[1].(*model.CustomErr)
 	return ret0, ret1
 }
 
 // ChangeAccountBalance indicates an expected call of ChangeAccountBalance.
-func (mr *MockIBalanceInfoStorageMockRecorder) ChangeAccountBalance(id, delta interface{}) *gomock.Call {
+func (mr *MockIBalanceInfoStorageMockRecorder) ChangeAccountBalance(id, delta, details interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChangeAccountBalance", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).ChangeAccountBalance), id, delta)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChangeAccountBalance", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).ChangeAccountBalance), id, delta, details)
 }
 
 // TransferSumBetweenAccounts mocks base method.
-func (m *MockIBalanceInfoStorage) TransferSumBetweenAccounts(id1, id2 int, delta float64) (string, *model.CustomErr) {
+func (m *MockIBalanceInfoStorage) TransferSumBetweenAccounts(id1, id2 int, delta float64, details model.OperationDetails) (*model.OperationResult, *model.CustomErr) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "TransferSumBetweenAccounts", id1, id2, delta)
-	ret0, _ := ret[0].(string)
+	ret := m.ctrl.Call(m, "TransferSumBetweenAccounts", id1, id2, delta, details)
+	ret0, _ := ret[0].(*model.OperationResult)
 	ret1, _ := ret[1].(*model.CustomErr)
 	return ret0, ret1
 }
 
 // TransferSumBetweenAccounts indicates an expected call of TransferSumBetweenAccounts.
-func (mr *MockIBalanceInfoStorageMockRecorder) TransferSumBetweenAccounts(id1, id2, delta interface{}) *gomock.Call {
+func (mr *MockIBalanceInfoStorageMockRecorder) TransferSumBetweenAccounts(id1, id2, delta, details interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TransferSumBetweenAccounts", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).TransferSumBetweenAccounts), id1, id2, delta, details)
+}
+
+// ReverseOperation mocks base method.
+func (m *MockIBalanceInfoStorage) ReverseOperation(recordId int64, details model.OperationDetails) (*model.OperationResult, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReverseOperation", recordId, details)
+	ret0, _ := ret[0].(*model.OperationResult)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// ReverseOperation indicates an expected call of ReverseOperation.
+func (mr *MockIBalanceInfoStorageMockRecorder) ReverseOperation(recordId, details interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TransferSumBetweenAccounts", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).TransferSumBetweenAccounts), id1, id2, delta)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReverseOperation", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).ReverseOperation), recordId, details)
 }
 
 // GetSortedTransactionsHistory mocks base method.
-func (m *MockIBalanceInfoStorage) GetSortedTransactionsHistory(id int, sortedBy string, sortedByDesc bool) ([]model.TransactionRecord, *model.CustomErr) {
+func (m *MockIBalanceInfoStorage) GetSortedTransactionsHistory(id int, sortedBy string, sortedByDesc bool, filter model.HistoryFilter) ([]model.TransactionRecord, *model.CustomErr) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetSortedTransactionsHistory", id, sortedBy, sortedByDesc)
+	ret := m.ctrl.Call(m, "GetSortedTransactionsHistory", id, sortedBy, sortedByDesc, filter)
 	ret0, _ := ret[0].([]model.TransactionRecord)
 	ret1, _ := ret[1].(*model.CustomErr)
 	return ret0, ret1
 }
 
 // GetSortedTransactionsHistory indicates an expected call of GetSortedTransactionsHistory.
-func (mr *MockIBalanceInfoStorageMockRecorder) GetSortedTransactionsHistory(id, sortedBy, sortedByDesc interface{}) *gomock.Call {
+func (mr *MockIBalanceInfoStorageMockRecorder) GetSortedTransactionsHistory(id, sortedBy, sortedByDesc, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSortedTransactionsHistory", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).GetSortedTransactionsHistory), id, sortedBy, sortedByDesc, filter)
+}
+
+// FindTransactionsByExternalRef mocks base method.
+func (m *MockIBalanceInfoStorage) FindTransactionsByExternalRef(externalRef string, accountId int) ([]model.TransactionRecord, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindTransactionsByExternalRef", externalRef, accountId)
+	ret0, _ := ret[0].([]model.TransactionRecord)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// FindTransactionsByExternalRef indicates an expected call of FindTransactionsByExternalRef.
+func (mr *MockIBalanceInfoStorageMockRecorder) FindTransactionsByExternalRef(externalRef, accountId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindTransactionsByExternalRef", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).FindTransactionsByExternalRef), externalRef, accountId)
+}
+
+// QuoteFee mocks base method.
+func (m *MockIBalanceInfoStorage) QuoteFee(operation string, id int, amount float64, currency string) (*model.FeeQuote, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "QuoteFee", operation, id, amount, currency)
+	ret0, _ := ret[0].(*model.FeeQuote)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// QuoteFee indicates an expected call of QuoteFee.
+func (mr *MockIBalanceInfoStorageMockRecorder) QuoteFee(operation, id, amount, currency interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QuoteFee", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).QuoteFee), operation, id, amount, currency)
+}
+
+// CreateScheduledTransfer mocks base method.
+func (m *MockIBalanceInfoStorage) CreateScheduledTransfer(schedule *model.ScheduledTransfer) (*model.ScheduledTransfer, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateScheduledTransfer", schedule)
+	ret0, _ := ret[0].(*model.ScheduledTransfer)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// CreateScheduledTransfer indicates an expected call of CreateScheduledTransfer.
+func (mr *MockIBalanceInfoStorageMockRecorder) CreateScheduledTransfer(schedule interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateScheduledTransfer", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).CreateScheduledTransfer), schedule)
+}
+
+// GetScheduledTransfer mocks base method.
+func (m *MockIBalanceInfoStorage) GetScheduledTransfer(id int) (*model.ScheduledTransfer, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetScheduledTransfer", id)
+	ret0, _ := ret[0].(*model.ScheduledTransfer)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// GetScheduledTransfer indicates an expected call of GetScheduledTransfer.
+func (mr *MockIBalanceInfoStorageMockRecorder) GetScheduledTransfer(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetScheduledTransfer", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).GetScheduledTransfer), id)
+}
+
+// GetAccountScheduledTransfers mocks base method.
+func (m *MockIBalanceInfoStorage) GetAccountScheduledTransfers(accountId int) ([]model.ScheduledTransfer, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAccountScheduledTransfers", accountId)
+	ret0, _ := ret[0].([]model.ScheduledTransfer)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// GetAccountScheduledTransfers indicates an expected call of GetAccountScheduledTransfers.
+func (mr *MockIBalanceInfoStorageMockRecorder) GetAccountScheduledTransfers(accountId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAccountScheduledTransfers", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).GetAccountScheduledTransfers), accountId)
+}
+
+// UpdateScheduledTransfer mocks base method.
+func (m *MockIBalanceInfoStorage) UpdateScheduledTransfer(schedule *model.ScheduledTransfer) *model.CustomErr {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateScheduledTransfer", schedule)
+	ret0, _ := ret[0].(*model.CustomErr)
+	return ret0
+}
+
+// UpdateScheduledTransfer indicates an expected call of UpdateScheduledTransfer.
+func (mr *MockIBalanceInfoStorageMockRecorder) UpdateScheduledTransfer(schedule interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateScheduledTransfer", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).UpdateScheduledTransfer), schedule)
+}
+
+// DeleteScheduledTransfer mocks base method.
+func (m *MockIBalanceInfoStorage) DeleteScheduledTransfer(id int) *model.CustomErr {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteScheduledTransfer", id)
+	ret0, _ := ret[0].(*model.CustomErr)
+	return ret0
+}
+
+// DeleteScheduledTransfer indicates an expected call of DeleteScheduledTransfer.
+func (mr *MockIBalanceInfoStorageMockRecorder) DeleteScheduledTransfer(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteScheduledTransfer", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).DeleteScheduledTransfer), id)
+}
+
+// ClaimDueScheduledTransfers mocks base method.
+func (m *MockIBalanceInfoStorage) ClaimDueScheduledTransfers(now time.Time, lease time.Duration, limit int) ([]model.ScheduledTransfer, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClaimDueScheduledTransfers", now, lease, limit)
+	ret0, _ := ret[0].([]model.ScheduledTransfer)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// ClaimDueScheduledTransfers indicates an expected call of ClaimDueScheduledTransfers.
+func (mr *MockIBalanceInfoStorageMockRecorder) ClaimDueScheduledTransfers(now, lease, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClaimDueScheduledTransfers", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).ClaimDueScheduledTransfers), now, lease, limit)
+}
+
+// ExecuteScheduledTransfer mocks base method.
+func (m *MockIBalanceInfoStorage) ExecuteScheduledTransfer(claimed, next *model.ScheduledTransfer, run *model.ScheduledTransferRun) (*model.OperationResult, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExecuteScheduledTransfer", claimed, next, run)
+	ret0, _ := ret[0].(*model.OperationResult)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// ExecuteScheduledTransfer indicates an expected call of ExecuteScheduledTransfer.
+func (mr *MockIBalanceInfoStorageMockRecorder) ExecuteScheduledTransfer(claimed, next, run interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExecuteScheduledTransfer", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).ExecuteScheduledTransfer), claimed, next, run)
+}
+
+// SaveScheduledTransferRun mocks base method.
+func (m *MockIBalanceInfoStorage) SaveScheduledTransferRun(claimed, next *model.ScheduledTransfer, run *model.ScheduledTransferRun) *model.CustomErr {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveScheduledTransferRun", claimed, next, run)
+	ret0, _ := ret[0].(*model.CustomErr)
+	return ret0
+}
+
+// SaveScheduledTransferRun indicates an expected call of SaveScheduledTransferRun.
+func (mr *MockIBalanceInfoStorageMockRecorder) SaveScheduledTransferRun(claimed, next, run interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveScheduledTransferRun", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).SaveScheduledTransferRun), claimed, next, run)
+}
+
+// GetScheduledTransferRuns mocks base method.
+func (m *MockIBalanceInfoStorage) GetScheduledTransferRuns(scheduleId int) ([]model.ScheduledTransferRun, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetScheduledTransferRuns", scheduleId)
+	ret0, _ := ret[0].([]model.ScheduledTransferRun)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// GetScheduledTransferRuns indicates an expected call of GetScheduledTransferRuns.
+func (mr *MockIBalanceInfoStorageMockRecorder) GetScheduledTransferRuns(scheduleId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetScheduledTransferRuns", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).GetScheduledTransferRuns), scheduleId)
+}
+
+// CreateWebhookSubscription mocks base method.
+func (m *MockIBalanceInfoStorage) CreateWebhookSubscription(subscription *model.WebhookSubscription) (*model.WebhookSubscription, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateWebhookSubscription", subscription)
+	ret0, _ := ret[0].(*model.WebhookSubscription)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// CreateWebhookSubscription indicates an expected call of CreateWebhookSubscription.
+func (mr *MockIBalanceInfoStorageMockRecorder) CreateWebhookSubscription(subscription interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateWebhookSubscription", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).CreateWebhookSubscription), subscription)
+}
+
+// GetWebhookSubscriptions mocks base method.
+func (m *MockIBalanceInfoStorage) GetWebhookSubscriptions() ([]model.WebhookSubscription, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWebhookSubscriptions")
+	ret0, _ := ret[0].([]model.WebhookSubscription)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// GetWebhookSubscriptions indicates an expected call of GetWebhookSubscriptions.
+func (mr *MockIBalanceInfoStorageMockRecorder) GetWebhookSubscriptions() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWebhookSubscriptions", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).GetWebhookSubscriptions))
+}
+
+// DeleteWebhookSubscription mocks base method.
+func (m *MockIBalanceInfoStorage) DeleteWebhookSubscription(id int) *model.CustomErr {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteWebhookSubscription", id)
+	ret0, _ := ret[0].(*model.CustomErr)
+	return ret0
+}
+
+// DeleteWebhookSubscription indicates an expected call of DeleteWebhookSubscription.
+func (mr *MockIBalanceInfoStorageMockRecorder) DeleteWebhookSubscription(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteWebhookSubscription", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).DeleteWebhookSubscription), id)
+}
+
+// ClaimPendingWebhookDeliveries mocks base method.
+func (m *MockIBalanceInfoStorage) ClaimPendingWebhookDeliveries(now time.Time, lease time.Duration, limit int) ([]model.WebhookDeliveryTask, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClaimPendingWebhookDeliveries", now, lease, limit)
+	ret0, _ := ret[0].([]model.WebhookDeliveryTask)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// ClaimPendingWebhookDeliveries indicates an expected call of ClaimPendingWebhookDeliveries.
+func (mr *MockIBalanceInfoStorageMockRecorder) ClaimPendingWebhookDeliveries(now, lease, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClaimPendingWebhookDeliveries", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).ClaimPendingWebhookDeliveries), now, lease, limit)
+}
+
+// SaveWebhookDelivery mocks base method.
+func (m *MockIBalanceInfoStorage) SaveWebhookDelivery(delivery *model.WebhookDelivery) *model.CustomErr {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveWebhookDelivery", delivery)
+	ret0, _ := ret[0].(*model.CustomErr)
+	return ret0
+}
+
+// SaveWebhookDelivery indicates an expected call of SaveWebhookDelivery.
+func (mr *MockIBalanceInfoStorageMockRecorder) SaveWebhookDelivery(delivery interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveWebhookDelivery", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).SaveWebhookDelivery), delivery)
+}
+
+// GetWebhookDeliveries mocks base method.
+func (m *MockIBalanceInfoStorage) GetWebhookDeliveries(status string, limit int) ([]model.WebhookDelivery, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWebhookDeliveries", status, limit)
+	ret0, _ := ret[0].([]model.WebhookDelivery)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// GetWebhookDeliveries indicates an expected call of GetWebhookDeliveries.
+func (mr *MockIBalanceInfoStorageMockRecorder) GetWebhookDeliveries(status, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWebhookDeliveries", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).GetWebhookDeliveries), status, limit)
+}
+
+// ReplayWebhookDelivery mocks base method.
+func (m *MockIBalanceInfoStorage) ReplayWebhookDelivery(id int64) *model.CustomErr {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReplayWebhookDelivery", id)
+	ret0, _ := ret[0].(*model.CustomErr)
+	return ret0
+}
+
+// ReplayWebhookDelivery indicates an expected call of ReplayWebhookDelivery.
+func (mr *MockIBalanceInfoStorageMockRecorder) ReplayWebhookDelivery(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplayWebhookDelivery", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).ReplayWebhookDelivery), id)
+}
+
+// ReplayWebhookEvents mocks base method.
+func (m *MockIBalanceInfoStorage) ReplayWebhookEvents(subscriptionId int, since time.Time) (int64, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReplayWebhookEvents", subscriptionId, since)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// ReplayWebhookEvents indicates an expected call of ReplayWebhookEvents.
+func (mr *MockIBalanceInfoStorageMockRecorder) ReplayWebhookEvents(subscriptionId, since interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplayWebhookEvents", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).ReplayWebhookEvents), subscriptionId, since)
+}
+
+// GetLastBalanceSnapshotDate mocks base method.
+func (m *MockIBalanceInfoStorage) GetLastBalanceSnapshotDate() (*time.Time, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLastBalanceSnapshotDate")
+	ret0, _ := ret[0].(*time.Time)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// GetLastBalanceSnapshotDate indicates an expected call of GetLastBalanceSnapshotDate.
+func (mr *MockIBalanceInfoStorageMockRecorder) GetLastBalanceSnapshotDate() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLastBalanceSnapshotDate", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).GetLastBalanceSnapshotDate))
+}
+
+// CreateBalanceSnapshots mocks base method.
+func (m *MockIBalanceInfoStorage) CreateBalanceSnapshots(day time.Time) (int64, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateBalanceSnapshots", day)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// CreateBalanceSnapshots indicates an expected call of CreateBalanceSnapshots.
+func (mr *MockIBalanceInfoStorageMockRecorder) CreateBalanceSnapshots(day interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateBalanceSnapshots", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).CreateBalanceSnapshots), day)
+}
+
+// FindLedgerDiscrepancies mocks base method.
+func (m *MockIBalanceInfoStorage) FindLedgerDiscrepancies() (int, []model.LedgerDiscrepancy, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindLedgerDiscrepancies")
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].([]model.LedgerDiscrepancy)
+	ret2, _ := ret[2].(*model.CustomErr)
+	return ret0, ret1, ret2
+}
+
+// FindLedgerDiscrepancies indicates an expected call of FindLedgerDiscrepancies.
+func (mr *MockIBalanceInfoStorageMockRecorder) FindLedgerDiscrepancies() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindLedgerDiscrepancies", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).FindLedgerDiscrepancies))
+}
+
+// SaveReconciliationRun mocks base method.
+func (m *MockIBalanceInfoStorage) SaveReconciliationRun(run *model.ReconciliationRun) *model.CustomErr {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveReconciliationRun", run)
+	ret0, _ := ret[0].(*model.CustomErr)
+	return ret0
+}
+
+// SaveReconciliationRun indicates an expected call of SaveReconciliationRun.
+func (mr *MockIBalanceInfoStorageMockRecorder) SaveReconciliationRun(run interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveReconciliationRun", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).SaveReconciliationRun), run)
+}
+
+// GetLastReconciliationRun mocks base method.
+func (m *MockIBalanceInfoStorage) GetLastReconciliationRun() (*model.ReconciliationRun, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLastReconciliationRun")
+	ret0, _ := ret[0].(*model.ReconciliationRun)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// GetLastReconciliationRun indicates an expected call of GetLastReconciliationRun.
+func (mr *MockIBalanceInfoStorageMockRecorder) GetLastReconciliationRun() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLastReconciliationRun", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).GetLastReconciliationRun))
+}
+
+// BuildStatement mocks base method.
+func (m *MockIBalanceInfoStorage) BuildStatement(accountId int, from, to time.Time) (*model.Statement, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BuildStatement", accountId, from, to)
+	ret0, _ := ret[0].(*model.Statement)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// BuildStatement indicates an expected call of BuildStatement.
+func (mr *MockIBalanceInfoStorageMockRecorder) BuildStatement(accountId, from, to interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BuildStatement", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).BuildStatement), accountId, from, to)
+}
+
+// SaveStatement mocks base method.
+func (m *MockIBalanceInfoStorage) SaveStatement(statement *model.Statement) *model.CustomErr {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveStatement", statement)
+	ret0, _ := ret[0].(*model.CustomErr)
+	return ret0
+}
+
+// SaveStatement indicates an expected call of SaveStatement.
+func (mr *MockIBalanceInfoStorageMockRecorder) SaveStatement(statement interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveStatement", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).SaveStatement), statement)
+}
+
+// GetStatement mocks base method.
+func (m *MockIBalanceInfoStorage) GetStatement(accountId int, periodStart time.Time) (*model.Statement, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetStatement", accountId, periodStart)
+	ret0, _ := ret[0].(*model.Statement)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// GetStatement indicates an expected call of GetStatement.
+func (mr *MockIBalanceInfoStorageMockRecorder) GetStatement(accountId, periodStart interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStatement", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).GetStatement), accountId, periodStart)
+}
+
+// GetAccountStatements mocks base method.
+func (m *MockIBalanceInfoStorage) GetAccountStatements(accountId int) ([]model.Statement, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAccountStatements", accountId)
+	ret0, _ := ret[0].([]model.Statement)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// GetAccountStatements indicates an expected call of GetAccountStatements.
+func (mr *MockIBalanceInfoStorageMockRecorder) GetAccountStatements(accountId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAccountStatements", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).GetAccountStatements), accountId)
+}
+
+// GetLastStatementPeriod mocks base method.
+func (m *MockIBalanceInfoStorage) GetLastStatementPeriod() (*time.Time, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLastStatementPeriod")
+	ret0, _ := ret[0].(*time.Time)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// GetLastStatementPeriod indicates an expected call of GetLastStatementPeriod.
+func (mr *MockIBalanceInfoStorageMockRecorder) GetLastStatementPeriod() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLastStatementPeriod", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).GetLastStatementPeriod))
+}
+
+// GetMissingStatementAccountIds mocks base method.
+func (m *MockIBalanceInfoStorage) GetMissingStatementAccountIds(periodStart, periodEnd time.Time) ([]int, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMissingStatementAccountIds", periodStart, periodEnd)
+	ret0, _ := ret[0].([]int)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// GetMissingStatementAccountIds indicates an expected call of GetMissingStatementAccountIds.
+func (mr *MockIBalanceInfoStorageMockRecorder) GetMissingStatementAccountIds(periodStart, periodEnd interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMissingStatementAccountIds", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).GetMissingStatementAccountIds), periodStart, periodEnd)
+}
+
+// GetTurnover mocks base method.
+func (m *MockIBalanceInfoStorage) GetTurnover(filter model.TurnoverFilter) ([]model.Turnover, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTurnover", filter)
+	ret0, _ := ret[0].([]model.Turnover)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// GetTurnover indicates an expected call of GetTurnover.
+func (mr *MockIBalanceInfoStorageMockRecorder) GetTurnover(filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTurnover", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).GetTurnover), filter)
+}
+
+// GetHistoryChain mocks base method.
+func (m *MockIBalanceInfoStorage) GetHistoryChain(accountId int) ([]model.TransactionRecord, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetHistoryChain", accountId)
+	ret0, _ := ret[0].([]model.TransactionRecord)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// GetHistoryChain indicates an expected call of GetHistoryChain.
+func (mr *MockIBalanceInfoStorageMockRecorder) GetHistoryChain(accountId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetHistoryChain", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).GetHistoryChain), accountId)
+}
+
+// GetAccountIds mocks base method.
+func (m *MockIBalanceInfoStorage) GetAccountIds() ([]int, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAccountIds")
+	ret0, _ := ret[0].([]int)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// GetAccountIds indicates an expected call of GetAccountIds.
+func (mr *MockIBalanceInfoStorageMockRecorder) GetAccountIds() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAccountIds", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).GetAccountIds))
+}
+
+// SetAccountFrozen mocks base method.
+func (m *MockIBalanceInfoStorage) SetAccountFrozen(id int, frozen bool) *model.CustomErr {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetAccountFrozen", id, frozen)
+	ret0, _ := ret[0].(*model.CustomErr)
+	return ret0
+}
+
+// SetAccountFrozen indicates an expected call of SetAccountFrozen.
+func (mr *MockIBalanceInfoStorageMockRecorder) SetAccountFrozen(id, frozen interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetAccountFrozen", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).SetAccountFrozen), id, frozen)
+}
+
+// SetAccountParent mocks base method.
+func (m *MockIBalanceInfoStorage) SetAccountParent(id, parentId int) *model.CustomErr {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetAccountParent", id, parentId)
+	ret0, _ := ret[0].(*model.CustomErr)
+	return ret0
+}
+
+// SetAccountParent indicates an expected call of SetAccountParent.
+func (mr *MockIBalanceInfoStorageMockRecorder) SetAccountParent(id, parentId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetAccountParent", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).SetAccountParent), id, parentId)
+}
+
+// GetConsolidatedBalance mocks base method.
+func (m *MockIBalanceInfoStorage) GetConsolidatedBalance(id int) (*model.ConsolidatedBalance, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetConsolidatedBalance", id)
+	ret0, _ := ret[0].(*model.ConsolidatedBalance)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// GetConsolidatedBalance indicates an expected call of GetConsolidatedBalance.
+func (mr *MockIBalanceInfoStorageMockRecorder) GetConsolidatedBalance(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetConsolidatedBalance", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).GetConsolidatedBalance), id)
+}
+
+// FundSubAccount mocks base method.
+func (m *MockIBalanceInfoStorage) FundSubAccount(parentId, childId int, amount float64, details model.OperationDetails) (*model.OperationResult, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FundSubAccount", parentId, childId, amount, details)
+	ret0, _ := ret[0].(*model.OperationResult)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// FundSubAccount indicates an expected call of FundSubAccount.
+func (mr *MockIBalanceInfoStorageMockRecorder) FundSubAccount(parentId, childId, amount, details interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FundSubAccount", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).FundSubAccount), parentId, childId, amount, details)
+}
+
+// SweepSubAccount mocks base method.
+func (m *MockIBalanceInfoStorage) SweepSubAccount(parentId, childId int, amount float64, details model.OperationDetails) (*model.OperationResult, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SweepSubAccount", parentId, childId, amount, details)
+	ret0, _ := ret[0].(*model.OperationResult)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// SweepSubAccount indicates an expected call of SweepSubAccount.
+func (mr *MockIBalanceInfoStorageMockRecorder) SweepSubAccount(parentId, childId, amount, details interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SweepSubAccount", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).SweepSubAccount), parentId, childId, amount, details)
+}
+
+// SetAccountProduct mocks base method.
+func (m *MockIBalanceInfoStorage) SetAccountProduct(id int, product string) *model.CustomErr {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetAccountProduct", id, product)
+	ret0, _ := ret[0].(*model.CustomErr)
+	return ret0
+}
+
+// SetAccountProduct indicates an expected call of SetAccountProduct.
+func (mr *MockIBalanceInfoStorageMockRecorder) SetAccountProduct(id, product interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetAccountProduct", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).SetAccountProduct), id, product)
+}
+
+// GetLastInterestAccrualDate mocks base method.
+func (m *MockIBalanceInfoStorage) GetLastInterestAccrualDate() (*time.Time, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLastInterestAccrualDate")
+	ret0, _ := ret[0].(*time.Time)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// GetLastInterestAccrualDate indicates an expected call of GetLastInterestAccrualDate.
+func (mr *MockIBalanceInfoStorageMockRecorder) GetLastInterestAccrualDate() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLastInterestAccrualDate", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).GetLastInterestAccrualDate))
+}
+
+// AccrueInterest mocks base method.
+func (m *MockIBalanceInfoStorage) AccrueInterest(day time.Time) (int64, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AccrueInterest", day)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// AccrueInterest indicates an expected call of AccrueInterest.
+func (mr *MockIBalanceInfoStorageMockRecorder) AccrueInterest(day interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AccrueInterest", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).AccrueInterest), day)
+}
+
+// GetUnpaidInterestAccountIds mocks base method.
+func (m *MockIBalanceInfoStorage) GetUnpaidInterestAccountIds(periodEnd time.Time) ([]int, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUnpaidInterestAccountIds", periodEnd)
+	ret0, _ := ret[0].([]int)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// GetUnpaidInterestAccountIds indicates an expected call of GetUnpaidInterestAccountIds.
+func (mr *MockIBalanceInfoStorageMockRecorder) GetUnpaidInterestAccountIds(periodEnd interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUnpaidInterestAccountIds", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).GetUnpaidInterestAccountIds), periodEnd)
+}
+
+// CapitalizeInterest mocks base method.
+func (m *MockIBalanceInfoStorage) CapitalizeInterest(accountId int, periodEnd time.Time) (float64, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CapitalizeInterest", accountId, periodEnd)
+	ret0, _ := ret[0].(float64)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// CapitalizeInterest indicates an expected call of CapitalizeInterest.
+func (mr *MockIBalanceInfoStorageMockRecorder) CapitalizeInterest(accountId, periodEnd interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CapitalizeInterest", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).CapitalizeInterest), accountId, periodEnd)
+}
+
+// GetAccruedInterest mocks base method.
+func (m *MockIBalanceInfoStorage) GetAccruedInterest(accountId int) (*model.InterestPreview, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAccruedInterest", accountId)
+	ret0, _ := ret[0].(*model.InterestPreview)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// GetAccruedInterest indicates an expected call of GetAccruedInterest.
+func (mr *MockIBalanceInfoStorageMockRecorder) GetAccruedInterest(accountId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAccruedInterest", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).GetAccruedInterest), accountId)
+}
+
+// CreditBonus mocks base method.
+func (m *MockIBalanceInfoStorage) CreditBonus(id int, amount float64, expiresAt time.Time, details model.OperationDetails) (*model.BonusRecord, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreditBonus", id, amount, expiresAt, details)
+	ret0, _ := ret[0].(*model.BonusRecord)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// CreditBonus indicates an expected call of CreditBonus.
+func (mr *MockIBalanceInfoStorageMockRecorder) CreditBonus(id, amount, expiresAt, details interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreditBonus", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).CreditBonus), id, amount, expiresAt, details)
+}
+
+// SpendBonus mocks base method.
+func (m *MockIBalanceInfoStorage) SpendBonus(id int, amount float64, details model.OperationDetails) ([]model.BonusRecord, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SpendBonus", id, amount, details)
+	ret0, _ := ret[0].([]model.BonusRecord)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// SpendBonus indicates an expected call of SpendBonus.
+func (mr *MockIBalanceInfoStorageMockRecorder) SpendBonus(id, amount, details interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SpendBonus", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).SpendBonus), id, amount, details)
+}
+
+// ExpireBonusLots mocks base method.
+func (m *MockIBalanceInfoStorage) ExpireBonusLots(now time.Time) (int64, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExpireBonusLots", now)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// ExpireBonusLots indicates an expected call of ExpireBonusLots.
+func (mr *MockIBalanceInfoStorageMockRecorder) ExpireBonusLots(now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExpireBonusLots", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).ExpireBonusLots), now)
+}
+
+// GetBonusLots mocks base method.
+func (m *MockIBalanceInfoStorage) GetBonusLots(id int) ([]model.BonusLot, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBonusLots", id)
+	ret0, _ := ret[0].([]model.BonusLot)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// GetBonusLots indicates an expected call of GetBonusLots.
+func (mr *MockIBalanceInfoStorageMockRecorder) GetBonusLots(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBonusLots", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).GetBonusLots), id)
+}
+
+// GetBonusHistory mocks base method.
+func (m *MockIBalanceInfoStorage) GetBonusHistory(id int) ([]model.BonusRecord, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBonusHistory", id)
+	ret0, _ := ret[0].([]model.BonusRecord)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// GetBonusHistory indicates an expected call of GetBonusHistory.
+func (mr *MockIBalanceInfoStorageMockRecorder) GetBonusHistory(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBonusHistory", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).GetBonusHistory), id)
+}
+
+// Migrate mocks base method.
+func (m *MockIBalanceInfoStorage) Migrate() ([]int, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Migrate")
+	ret0, _ := ret[0].([]int)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// Migrate indicates an expected call of Migrate.
+func (mr *MockIBalanceInfoStorageMockRecorder) Migrate() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Migrate", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).Migrate))
+}
+
+// TakeRateLimitToken mocks base method.
+func (m *MockIBalanceInfoStorage) TakeRateLimitToken(key string, rate float64, burst int, now time.Time) (time.Duration, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TakeRateLimitToken", key, rate, burst, now)
+	ret0, _ := ret[0].(time.Duration)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// TakeRateLimitToken indicates an expected call of TakeRateLimitToken.
+func (mr *MockIBalanceInfoStorageMockRecorder) TakeRateLimitToken(key, rate, burst, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TakeRateLimitToken", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).TakeRateLimitToken), key, rate, burst, now)
+}
+
+// DeleteRateLimitBuckets mocks base method.
+func (m *MockIBalanceInfoStorage) DeleteRateLimitBuckets(updatedBefore time.Time) (int64, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteRateLimitBuckets", updatedBefore)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// DeleteRateLimitBuckets indicates an expected call of DeleteRateLimitBuckets.
+func (mr *MockIBalanceInfoStorageMockRecorder) DeleteRateLimitBuckets(updatedBefore interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteRateLimitBuckets", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).DeleteRateLimitBuckets), updatedBefore)
+}
+
+// Ping mocks base method.
+func (m *MockIBalanceInfoStorage) Ping() *model.CustomErr {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Ping")
+	ret0, _ := ret[0].(*model.CustomErr)
+	return ret0
+}
+
+// Ping indicates an expected call of Ping.
+func (mr *MockIBalanceInfoStorageMockRecorder) Ping() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ping", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).Ping))
+}
+
+// GetSchemaVersion mocks base method.
+func (m *MockIBalanceInfoStorage) GetSchemaVersion() (int, *model.CustomErr) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSchemaVersion")
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(*model.CustomErr)
+	return ret0, ret1
+}
+
+// GetSchemaVersion indicates an expected call of GetSchemaVersion.
+func (mr *MockIBalanceInfoStorageMockRecorder) GetSchemaVersion() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSchemaVersion", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).GetSchemaVersion))
+}
+
+// Health mocks base method.
+func (m *MockIBalanceInfoStorage) Health() model.StorageHealth {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Health")
+	ret0, _ := ret[0].(model.StorageHealth)
+	return ret0
+}
+
+// Health indicates an expected call of Health.
+func (mr *MockIBalanceInfoStorageMockRecorder) Health() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Health", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).Health))
+}
+
+// Primary mocks base method.
+func (m *MockIBalanceInfoStorage) Primary() model.IBalanceInfoStorage {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Primary")
+	ret0, _ := ret[0].(model.IBalanceInfoStorage)
+	return ret0
+}
+
+// Primary indicates an expected call of Primary.
+func (mr *MockIBalanceInfoStorageMockRecorder) Primary() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSortedTransactionsHistory", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).GetSortedTransactionsHistory), id, sortedBy, sortedByDesc)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Primary", reflect.TypeOf((*MockIBalanceInfoStorage)(nil).Primary))
 }
@@ -1,34 +1,283 @@
 package model
 
-import "time"
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
+//ErrorCode - машиночитаемый код ошибки (поле CustomErr.ErrCode). Коды возвращаются клиентам API,
+//поэтому существующие значения не меняются, а новые только добавляются
+type ErrorCode string
 
+//Каталог кодов ошибок
 const (
-	DefaultErrCode        = 0
-	InsufficientFundsCode = 1
-	WrongInputParamsCode  = 2
+	DefaultErrCode        ErrorCode = "internal_error"
+	WrongInputParamsCode  ErrorCode = "invalid_input"
+	ValidationFailedCode  ErrorCode = "validation_failed"
+	ZeroAmountCode        ErrorCode = "zero_amount"
+	SameAccountsCode      ErrorCode = "same_accounts"
+	InsufficientFundsCode ErrorCode = "insufficient_funds"
+	RateUnavailableCode   ErrorCode = "rate_unavailable"
+	NotFoundCode          ErrorCode = "not_found"
+	HistoryNotFoundCode   ErrorCode = "history_not_found"
+	ScheduleNotFoundCode  ErrorCode = "schedule_not_found"
+	WebhookNotFoundCode   ErrorCode = "webhook_not_found"
+	RateLimitedCode       ErrorCode = "rate_limited"
+	UnavailableCode       ErrorCode = "service_unavailable"
+	AccountFrozenCode     ErrorCode = "account_frozen"
+	ForbiddenCode         ErrorCode = "forbidden"
+	AlreadyReversedCode   ErrorCode = "already_reversed"
+	NotSubAccountCode     ErrorCode = "not_sub_account"
+)
 
+const (
 	//Строковые константы используются в качестве возможных значений поля sortedBy в методе IBalanceInfoStorage.GetSortedTransactionsHistory
 	TransactionSum  = "transaction_sum"
 	TransactionTime = "transaction_time"
+
+	//Строковые константы - типы операций, для которых настраиваются комиссии (поле FeeRule.Operation)
+	FeeOperationWithdrawal = "withdrawal"
+	FeeOperationTransfer   = "transfer"
+
+	//Строковые константы - типы событий об изменении баланса (поле OutboxEvent.EventType)
+	BalanceChangedEvent     = "balance.changed"
+	BalanceTransferredEvent = "balance.transferred"
+	BalanceReversedEvent    = "balance.reversed"
+	BalanceInterestEvent    = "balance.interest"
+
+	//Строковые константы - состояния доставки события подписчику (поле WebhookDelivery.Status)
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+
+	//Строковые константы - типы операций в истории (поле TransactionRecord.OperationType)
+	OperationDeposit     = "deposit"
+	OperationWithdrawal  = "withdrawal"
+	OperationTransferIn  = "transfer_in"
+	OperationTransferOut = "transfer_out"
+	OperationFee         = "fee"
+	OperationReversal    = "reversal"
+	OperationInterest    = "interest"
+
+	//Строковые константы - типы операций с бонусами (поле BonusRecord.OperationType)
+	BonusCredit = "bonus_credit"
+	BonusSpend  = "bonus_spend"
+	BonusExpiry = "bonus_expiry"
+
+	//BaseCurrency - валюта, в которой хранятся балансы аккаунтов
+	BaseCurrency = "RUB"
+	//DefaultAccountTier - уровень обслуживания аккаунта по умолчанию
+	DefaultAccountTier = "standard"
+
+	//Строковые константы - виды расхождений, найденных при сверке (поле LedgerDiscrepancy.Kind)
+	DiscrepancyBalance    = "balance_mismatch"
+	DiscrepancyChain      = "remaining_balance_chain"
+	DiscrepancyLastRecord = "last_record_mismatch"
+
+	//Строковые константы - причины нарушения цепочки хешей истории (поле ChainVerification.Reason)
+	ChainHashMissing      = "hash_missing"
+	ChainHashMismatch     = "hash_mismatch"
+	ChainPrevHashMismatch = "prev_hash_mismatch"
+
+	//Строковые константы - периоды, по которым группируются обороты (поле TurnoverFilter.Period)
+	TurnoverDay   = "day"
+	TurnoverWeek  = "week"
+	TurnoverMonth = "month"
+
+	//MaxAccountDepth - наибольшее количество уровней субаккаунтов под аккаунтом верхнего уровня
+	MaxAccountDepth = 5
+
+	//SchemaVersion - версия схемы базы данных (таблица schema_migrations), с которой работает сервис
+	SchemaVersion = 14
 )
 
 //IBalanceInfoStorage - интерфейс для работы с балансом пользователей
 type IBalanceInfoStorage interface {
-	//GetAccountBalance - получение баланса аккаунта
+	//GetAccountBalance - получение баланса аккаунта вместе с бонусным балансом
 	GetAccountBalance(id int) (*BalanceInfo, *CustomErr)
-	//ChangeAccountBalance: баланс меняется по принципу newBalance = curBalance + delta
-	ChangeAccountBalance(id int, delta float64) (successMessage string, err *CustomErr)
+	//GetAccountBalanceAt - получение баланса аккаунта на момент at: последний снимок баланса на конец дня,
+	//завершившегося не позже at, плюс изменения из истории операций после него
+	GetAccountBalanceAt(id int, at time.Time) (*BalanceInfo, *CustomErr)
+	//ChangeAccountBalance: баланс меняется по принципу newBalance = curBalance + delta.
+	//details сохраняются во всех записях истории операции
+	ChangeAccountBalance(id int, delta float64, details OperationDetails) (result *OperationResult, err *CustomErr)
 	//TransferSumBetweenAccounts: delta может быть как положительной, так и отрицательной
 	//баланс аккаунтов меняется по принципу newBalance1 = curBalance1 - delta; newBalance2 = curBalance2 + delta
-	TransferSumBetweenAccounts(id1, id2 int, delta float64) (successMessage string, err *CustomErr)
-	//GetSortedTransactionsHistory - получение отсортированной истории переводов для пользователя
-	GetSortedTransactionsHistory(id int, sortedBy string, sortedByDesc bool) (history []TransactionRecord, err *CustomErr)
+	//в результате возвращается запись истории аккаунта id1
+	TransferSumBetweenAccounts(id1, id2 int, delta float64, details OperationDetails) (result *OperationResult, err *CustomErr)
+	//ReverseOperation - отмена операции, в которой создана запись истории recordId: изменение баланса отменяется записью
+	//с типом OperationReversal, перевод и комиссия - записями у обоих аккаунтов. Комиссия за отменяемую операцию не возвращается.
+	//При отсутствии записи возвращается ошибка с кодом HistoryNotFoundCode, для уже отмененной операции - AlreadyReversedCode
+	ReverseOperation(recordId int64, details OperationDetails) (result *OperationResult, err *CustomErr)
+	//GetSortedTransactionsHistory - получение отсортированной истории переводов для пользователя с условиями filter
+	GetSortedTransactionsHistory(id int, sortedBy string, sortedByDesc bool, filter HistoryFilter) (history []TransactionRecord, err *CustomErr)
+	//FindTransactionsByExternalRef - записи истории с внешним идентификатором externalRef в порядке добавления.
+	//Нулевой accountId - записи всех аккаунтов
+	FindTransactionsByExternalRef(externalRef string, accountId int) (history []TransactionRecord, err *CustomErr)
+	//QuoteFee - расчет комиссии за операцию operation на сумму amount в валюте currency (пустая - BaseCurrency),
+	//которую оплачивает аккаунт id
+	QuoteFee(operation string, id int, amount float64, currency string) (quote *FeeQuote, err *CustomErr)
+
+	//CreateScheduledTransfer - сохранение нового запланированного перевода
+	CreateScheduledTransfer(schedule *ScheduledTransfer) (created *ScheduledTransfer, err *CustomErr)
+	//GetScheduledTransfer - получение запланированного перевода. При его отсутствии возвращается ошибка с кодом ScheduleNotFoundCode
+	GetScheduledTransfer(id int) (schedule *ScheduledTransfer, err *CustomErr)
+	//GetAccountScheduledTransfers - получение запланированных переводов, в которых аккаунт является отправителем или получателем
+	GetAccountScheduledTransfers(accountId int) (schedules []ScheduledTransfer, err *CustomErr)
+	//UpdateScheduledTransfer - сохранение изменений параметров запланированного перевода.
+	//При его отсутствии возвращается ошибка с кодом ScheduleNotFoundCode
+	UpdateScheduledTransfer(schedule *ScheduledTransfer) (err *CustomErr)
+	//DeleteScheduledTransfer - удаление запланированного перевода вместе с историей его выполнения
+	DeleteScheduledTransfer(id int) (err *CustomErr)
+	//ClaimDueScheduledTransfers - выбор не более limit активных переводов, время выполнения которых наступило к моменту now.
+	//Выбранные переводы блокируются на время lease, чтобы их не выполнил параллельно другой экземпляр сервиса
+	ClaimDueScheduledTransfers(now time.Time, lease time.Duration, limit int) (schedules []ScheduledTransfer, err *CustomErr)
+	//ExecuteScheduledTransfer - выполнение перевода, выбранного в состоянии claimed, в одной транзакции с сохранением
+	//результата run и переводом расписания в состояние next со снятием блокировки. Если расписание изменили или удалили
+	//после выбора, перевод не выполняется и возвращается пустой результат без ошибки
+	ExecuteScheduledTransfer(claimed, next *ScheduledTransfer, run *ScheduledTransferRun) (result *OperationResult, err *CustomErr)
+	//SaveScheduledTransferRun - сохранение результата неудачного выполнения перевода, выбранного в состоянии claimed,
+	//и перевод расписания в состояние next со снятием блокировки. Параллельные изменения расписания не перезаписываются,
+	//для удаленного расписания результат не сохраняется
+	SaveScheduledTransferRun(claimed, next *ScheduledTransfer, run *ScheduledTransferRun) (err *CustomErr)
+	//GetScheduledTransferRuns - история выполнения запланированного перевода
+	GetScheduledTransferRuns(scheduleId int) (runs []ScheduledTransferRun, err *CustomErr)
+
+	//CreateWebhookSubscription - регистрация адреса для получения событий об изменении баланса
+	CreateWebhookSubscription(subscription *WebhookSubscription) (created *WebhookSubscription, err *CustomErr)
+	//GetWebhookSubscriptions - список зарегистрированных подписок
+	GetWebhookSubscriptions() (subscriptions []WebhookSubscription, err *CustomErr)
+	//DeleteWebhookSubscription - удаление подписки вместе с ее доставками. При ее отсутствии возвращается ошибка с кодом WebhookNotFoundCode
+	DeleteWebhookSubscription(id int) (err *CustomErr)
+	//ClaimPendingWebhookDeliveries - выбор не более limit доставок, время попытки которых наступило к моменту now.
+	//Выбранные доставки блокируются на время lease
+	ClaimPendingWebhookDeliveries(now time.Time, lease time.Duration, limit int) (tasks []WebhookDeliveryTask, err *CustomErr)
+	//SaveWebhookDelivery - сохранение результата попытки доставки с снятием блокировки. Если доставка удалена
+	//или ее блокировка LockedUntil изменилась (истекла и доставка выбрана снова или повторена), результат не сохраняется
+	//и возвращается ошибка с кодом WebhookNotFoundCode
+	SaveWebhookDelivery(delivery *WebhookDelivery) (err *CustomErr)
+	//GetWebhookDeliveries - список доставок в состоянии status (пустая строка - в любом состоянии), начиная с последних
+	GetWebhookDeliveries(status string, limit int) (deliveries []WebhookDelivery, err *CustomErr)
+	//ReplayWebhookDelivery - повторная отправка доставки (в том числе недоставленной). При ее отсутствии возвращается ошибка с кодом WebhookNotFoundCode
+	ReplayWebhookDelivery(id int64) (err *CustomErr)
+	//ReplayWebhookEvents - повторная отправка подписчику всех событий, созданных начиная с since. Возвращает количество поставленных в очередь событий
+	ReplayWebhookEvents(subscriptionId int, since time.Time) (count int64, err *CustomErr)
+
+	//GetLastBalanceSnapshotDate - день последнего снимка балансов (nil - снимков нет)
+	GetLastBalanceSnapshotDate() (day *time.Time, err *CustomErr)
+	//CreateBalanceSnapshots - сохранение снимков балансов всех аккаунтов на конец дня day.
+	//Уже сохраненные снимки не изменяются. Возвращает количество сохраненных снимков
+	CreateBalanceSnapshots(day time.Time) (count int64, err *CustomErr)
+
+	//FindLedgerDiscrepancies - сверка балансов аккаунтов с историей операций на согласованном снимке данных.
+	//Возвращает количество проверенных аккаунтов и найденные расхождения
+	FindLedgerDiscrepancies() (accountsChecked int, discrepancies []LedgerDiscrepancy, err *CustomErr)
+	//SaveReconciliationRun - сохранение результата сверки
+	SaveReconciliationRun(run *ReconciliationRun) (err *CustomErr)
+	//GetLastReconciliationRun - результат последней сверки. Если сверка не выполнялась, возвращается ошибка с кодом NotFoundCode
+	GetLastReconciliationRun() (run *ReconciliationRun, err *CustomErr)
+	//BuildStatement - выписка по аккаунту за период [from, to) на согласованном снимке данных. Выписка не сохраняется.
+	//При отсутствии аккаунта возвращается ошибка с кодом NotFoundCode
+	BuildStatement(accountId int, from, to time.Time) (statement *Statement, err *CustomErr)
+	//SaveStatement - сохранение выписки. Уже сохраненная выписка аккаунта за тот же период не изменяется
+	SaveStatement(statement *Statement) (err *CustomErr)
+	//GetStatement - сохраненная выписка аккаунта за период, начинающийся в periodStart.
+	//При ее отсутствии возвращается ошибка с кодом NotFoundCode
+	GetStatement(accountId int, periodStart time.Time) (statement *Statement, err *CustomErr)
+	//GetAccountStatements - сохраненные выписки аккаунта без операций, начиная с последних
+	GetAccountStatements(accountId int) (statements []Statement, err *CustomErr)
+	//GetLastStatementPeriod - начало периода последней сохраненной выписки (nil - выписок нет)
+	GetLastStatementPeriod() (periodStart *time.Time, err *CustomErr)
+	//GetMissingStatementAccountIds - аккаунты, у которых есть операции до periodEnd, но нет сохраненной выписки
+	//за период, начинающийся в periodStart
+	GetMissingStatementAccountIds(periodStart, periodEnd time.Time) (ids []int, err *CustomErr)
+	//GetTurnover - обороты аккаунта (или всего сервиса) за период, сгруппированные по дням, неделям или месяцам
+	//и, при filter.ByOperationType, по типам операций
+	GetTurnover(filter TurnoverFilter) (turnover []Turnover, err *CustomErr)
+	//GetHistoryChain - все записи истории аккаунта в порядке добавления (по Id) для проверки цепочки хешей
+	GetHistoryChain(accountId int) (history []TransactionRecord, err *CustomErr)
+	//GetAccountIds - идентификаторы всех аккаунтов по возрастанию
+	GetAccountIds() (ids []int, err *CustomErr)
+	//SetAccountFrozen - блокировка (frozen = true) или разблокировка аккаунта. Баланс заблокированного аккаунта и всех его
+	//субаккаунтов не меняется. При отсутствии аккаунта возвращается ошибка с кодом NotFoundCode
+	SetAccountFrozen(id int, frozen bool) (err *CustomErr)
+	//SetAccountParent - подчинение аккаунта id родительскому аккаунту parentId (0 - отделение от родителя).
+	//Отсутствующий аккаунт id создается с нулевым балансом. При отсутствии родителя возвращается ошибка с кодом NotFoundCode,
+	//если подчинение образует цикл или превышает MaxAccountDepth уровней - WrongInputParamsCode
+	SetAccountParent(id, parentId int) (err *CustomErr)
+	//GetConsolidatedBalance - баланс аккаунта вместе с балансами всех его субаккаунтов.
+	//При отсутствии аккаунта возвращается ошибка с кодом NotFoundCode
+	GetConsolidatedBalance(id int) (balance *ConsolidatedBalance, err *CustomErr)
+	//FundSubAccount - перевод суммы amount с родительского аккаунта parentId на его непосредственный субаккаунт childId без
+	//комиссии. Если childId не является субаккаунтом parentId, возвращается ошибка с кодом NotSubAccountCode
+	FundSubAccount(parentId, childId int, amount float64, details OperationDetails) (result *OperationResult, err *CustomErr)
+	//SweepSubAccount - перевод суммы amount (0 - всего баланса) с субаккаунта childId на его родительский аккаунт parentId
+	//без комиссии. Если childId не является субаккаунтом parentId, возвращается ошибка с кодом NotSubAccountCode
+	SweepSubAccount(parentId, childId int, amount float64, details OperationDetails) (result *OperationResult, err *CustomErr)
+	//SetAccountProduct - подключение аккаунта id к продукту product (пустая строка - отключение от продукта).
+	//При отсутствии аккаунта или продукта возвращается ошибка с кодом NotFoundCode
+	SetAccountProduct(id int, product string) (err *CustomErr)
+	//GetLastInterestAccrualDate - последний день, за который начислены проценты (nil - начислений не было)
+	GetLastInterestAccrualDate() (day *time.Time, err *CustomErr)
+	//AccrueInterest - начисление процентов за день day на баланс на конец дня аккаунтов продуктов с процентной ставкой.
+	//Повторное начисление за тот же день не выполняется. Возвращает количество аккаунтов, которым начислены проценты
+	AccrueInterest(day time.Time) (count int64, err *CustomErr)
+	//GetUnpaidInterestAccountIds - аккаунты, у которых есть невыплаченные проценты за дни до periodEnd
+	GetUnpaidInterestAccountIds(periodEnd time.Time) (ids []int, err *CustomErr)
+	//CapitalizeInterest - выплата на аккаунт невыплаченных процентов за дни до periodEnd, округленных до копеек, со счета
+	//расходов продукта. Возвращает выплаченную сумму (0, если сумма меньше копейки - проценты выплачиваются позже).
+	//Если на счете расходов недостаточно средств, возвращается ошибка с кодом InsufficientFundsCode
+	CapitalizeInterest(accountId int, periodEnd time.Time) (amount float64, err *CustomErr)
+	//GetAccruedInterest - начисленные, но еще не выплаченные проценты аккаунта.
+	//При отсутствии аккаунта возвращается ошибка с кодом NotFoundCode
+	GetAccruedInterest(accountId int) (preview *InterestPreview, err *CustomErr)
+	//CreditBonus - начисление бонусов amount на аккаунт id отдельной партией, которая сгорает в момент expiresAt.
+	//Отсутствующий аккаунт создается с нулевым балансом. Возвращает запись истории бонусов о начислении
+	CreditBonus(id int, amount float64, expiresAt time.Time, details OperationDetails) (record *BonusRecord, err *CustomErr)
+	//SpendBonus - списание бонусов amount с аккаунта id в оплату покупки. Бонусы списываются с действующих партий в порядке
+	//начисления, по записи истории на каждую партию. Если бонусов недостаточно, возвращается ошибка с кодом InsufficientFundsCode
+	SpendBonus(id int, amount float64, details OperationDetails) (records []BonusRecord, err *CustomErr)
+	//ExpireBonusLots - списание остатков партий бонусов, срок действия которых истек к моменту now, с записью в историю
+	//бонусов. Возвращает количество сгоревших партий, при ошибке - количество партий, списанных до нее
+	ExpireBonusLots(now time.Time) (count int64, err *CustomErr)
+	//GetBonusLots - действующие партии бонусов аккаунта с ненулевым остатком в порядке начисления
+	GetBonusLots(id int) (lots []BonusLot, err *CustomErr)
+	//GetBonusHistory - история бонусов аккаунта в порядке добавления
+	GetBonusHistory(id int) (history []BonusRecord, err *CustomErr)
+	//Migrate - применение к базе данных миграций схемы, версия которых больше текущей. Возвращает версии примененных миграций
+	Migrate() (applied []int, err *CustomErr)
+
+	//TakeRateLimitToken - списание токена из корзины key (rate токенов в секунду, не более burst) на момент now.
+	//Возвращает 0, если токен списан, иначе время до появления токена
+	TakeRateLimitToken(key string, rate float64, burst int, now time.Time) (retryAfter time.Duration, err *CustomErr)
+	//DeleteRateLimitBuckets - удаление корзин, не изменявшихся с момента updatedBefore. Возвращает количество удаленных корзин
+	DeleteRateLimitBuckets(updatedBefore time.Time) (deleted int64, err *CustomErr)
+
+	//Ping - проверка соединения с базой данных
+	Ping() (err *CustomErr)
+	//GetSchemaVersion - версия схемы базы данных (последняя примененная миграция)
+	GetSchemaVersion() (version int, err *CustomErr)
+	//Health - состояние соединения с базой данных по результатам последней фоновой проверки
+	Health() StorageHealth
+	//Primary - хранилище, все чтения которого выполняются на основном сервере, а не на репликах.
+	//Используется для запросов, которым нужно видеть результат только что выполненных изменений
+	Primary() IBalanceInfoStorage
 }
 
-//BalanceInfo - структура для хранения информации по балансу пользователя
+//BalanceInfo - структура для хранения информации по балансу пользователя.
+//ParentId - родительский аккаунт субаккаунта, Product - продукт аккаунта (AccountProduct),
+//BonusBalance - сумма остатков действующих партий бонусов (BonusLot)
 type BalanceInfo struct {
-	AccountId int     `gorm:"primary_key;column:account_id"`
-	Balance   float64 `gorm:"column:balance"`
+	AccountId    int     `gorm:"primary_key;column:account_id"`
+	Balance      float64 `gorm:"column:balance"`
+	Tier         string  `gorm:"column:tier;default:'standard'"`
+	Frozen       bool    `gorm:"column:frozen"`
+	ParentId     *int    `gorm:"column:parent_id" json:",omitempty"`
+	Product      *string `gorm:"column:product" json:",omitempty"`
+	BonusBalance float64 `gorm:"-" json:",omitempty"`
 }
 
 // TableName - declare table name for GORM
@@ -40,16 +289,33 @@ func (BalanceInfo) TableName() string {
 //Содержит переменную ErrCode, указывающую на тип ошибки
 type CustomErr struct {
 	Err     error
-	ErrCode int
+	ErrCode ErrorCode
 }
 
-//TransactionRecord - структура для сохранения успешного изменения баланса в истории
+//TransactionRecord - структура для сохранения успешного изменения баланса в истории.
+//Текст TransactionMessage формируется при чтении по OperationType и CounterpartyId на языке клиента,
+//в базе данных он хранится только для записей, созданных до появления OperationType.
+//Id задает порядок записей аккаунта в цепочке хешей: Hash - хеш содержимого записи и хеша PrevHash предыдущей записи аккаунта.
+//Purpose, ExternalRef и Metadata - данные OperationDetails, переданные клиентом вместе с операцией.
+//ReversalOf - запись, которую отменяет запись с типом OperationReversal
 type TransactionRecord struct {
+	Id                 int64     `gorm:"primary_key;column:id" json:",omitempty"`
 	AccountId          int       `gorm:"column:account_id"`
 	Delta              float64   `gorm:"column:delta"`
 	RemainingBalance   float64   `gorm:"column:remaining_balance"`
+	OperationType      string    `gorm:"column:operation_type"`
+	CounterpartyId     *int      `gorm:"column:counterparty_id" json:",omitempty"`
 	TransactionMessage string    `gorm:"column:transaction_message"`
+	Purpose            string    `gorm:"column:purpose" json:",omitempty"`
+	ExternalRef        string    `gorm:"column:external_ref" json:",omitempty"`
+	Metadata           Metadata  `gorm:"column:metadata" json:",omitempty"`
+	ReversalOf         *int64    `gorm:"column:reversal_of" json:",omitempty"`
+	PairId             *int64    `gorm:"column:pair_id" json:",omitempty"`
+	OperationCurrency  string    `gorm:"column:operation_currency" json:",omitempty"`
+	OperationRate      *float64  `gorm:"column:operation_rate" json:",omitempty"`
 	CreatedAt          time.Time `gorm:"column:created_at"`
+	PrevHash           string    `gorm:"column:prev_hash" json:",omitempty"`
+	Hash               string    `gorm:"column:hash" json:",omitempty"`
 }
 
 // TableName - declare table name for GORM
@@ -57,10 +323,539 @@ func (TransactionRecord) TableName() string {
 	return "transactions_history"
 }
 
-//Config хранит переменные окружения
+//OperationTypes - все типы операций в истории
+var OperationTypes = []string{OperationDeposit, OperationWithdrawal, OperationTransferIn, OperationTransferOut, OperationFee, OperationReversal,
+	OperationInterest}
+
+//HistoryFilter - условия отбора записей истории: типы операций OperationTypes (пустой список - любые)
+//и второй аккаунт операции CounterpartyId (0 - любой)
+type HistoryFilter struct {
+	OperationTypes []string
+	CounterpartyId int
+}
+
+//OperationDetails - необязательные данные операции от клиента: назначение платежа Purpose, внешний идентификатор
+//ExternalRef (например, номер заказа), по которому ищутся записи истории, произвольные пары ключ-значение Metadata
+//и валюта операции Currency (пустая - BaseCurrency), по которой подбирается правило комиссии, с курсом Rate к BaseCurrency,
+//по которому сумма операции пересчитана в BaseCurrency
+type OperationDetails struct {
+	Purpose     string
+	ExternalRef string
+	Metadata    Metadata
+	Currency    string
+	Rate        float64
+}
+
+//OperationCurrency - валюта операции, по которой подбирается правило комиссии
+func (d OperationDetails) OperationCurrency() string {
+	if d.Currency == "" {
+		return BaseCurrency
+	}
+	return d.Currency
+}
+
+//Apply - сохранение данных операции в записи истории record. Валюта операции с курсом сохраняется, если она указана
+func (d OperationDetails) Apply(record *TransactionRecord) {
+	record.Purpose = d.Purpose
+	record.ExternalRef = d.ExternalRef
+	record.Metadata = d.Metadata
+	if d.Currency != "" {
+		rate := d.Rate
+		record.OperationCurrency = d.Currency
+		record.OperationRate = &rate
+	}
+}
+
+//Metadata - пары ключ-значение операции. В базе данных хранятся в поле типа JSONB, пустые - как NULL
+type Metadata map[string]string
+
+//Value - реализует интерфейс driver.Valuer
+func (m Metadata) Value() (driver.Value, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(m)
+	return string(data), err
+}
+
+//Scan - реализует интерфейс sql.Scanner
+func (m *Metadata) Scan(src interface{}) error {
+	var data []byte
+	switch value := src.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case []byte:
+		data = value
+	case string:
+		data = []byte(value)
+	default:
+		return fmt.Errorf("model.Metadata.Scan: неподдерживаемый тип %T", src)
+	}
+	return json.Unmarshal(data, m)
+}
+
+//OperationResult - результат изменения баланса или перевода: запись истории операции и удержанная комиссия
+type OperationResult struct {
+	Record TransactionRecord
+	Fee    float64
+}
+
+//FeeRule - правило расчета комиссии. Пустые Currency и AccountTier означают, что правило применяется к любой валюте (уровню аккаунта).
+//Комиссия считается как Fixed + amount*Percent/100 и ограничивается снизу MinFee, сверху MaxFee (если MaxFee > 0)
+type FeeRule struct {
+	Id               int     `gorm:"primary_key;column:id"`
+	Operation        string  `gorm:"column:operation"`
+	Currency         string  `gorm:"column:currency"`
+	AccountTier      string  `gorm:"column:account_tier"`
+	Fixed            float64 `gorm:"column:fixed"`
+	Percent          float64 `gorm:"column:percent"`
+	MinFee           float64 `gorm:"column:min_fee"`
+	MaxFee           float64 `gorm:"column:max_fee"`
+	RevenueAccountId int     `gorm:"column:revenue_account_id"`
+}
+
+// TableName - declare table name for GORM
+func (FeeRule) TableName() string {
+	return "fee_rules"
+}
+
+//FeeQuote - результат расчета комиссии за операцию
+type FeeQuote struct {
+	Operation        string
+	AccountId        int
+	Amount           float64
+	Fee              float64
+	Total            float64
+	Currency         string
+	RevenueAccountId int
+}
+
+//ScheduledTransfer - запланированный перевод суммы Delta с аккаунта FromId на аккаунт ToId.
+//Recurrence задает расписание повторения (пустая строка - разовый перевод), NextRunAt - время следующего выполнения.
+//При ошибке выполнения перевод повторяется до MaxRetries раз с интервалом RetryIntervalSec секунд
+type ScheduledTransfer struct {
+	Id               int        `gorm:"primary_key;column:id"`
+	FromId           int        `gorm:"column:from_id"`
+	ToId             int        `gorm:"column:to_id"`
+	Delta            float64    `gorm:"column:delta"`
+	Recurrence       string     `gorm:"column:recurrence"`
+	NextRunAt        time.Time  `gorm:"column:next_run_at"`
+	Active           bool       `gorm:"column:active"`
+	MaxRetries       int        `gorm:"column:max_retries"`
+	RetryIntervalSec int        `gorm:"column:retry_interval_sec"`
+	RetryCount       int        `gorm:"column:retry_count"`
+	LastError        string     `gorm:"column:last_error"`
+	LockedUntil      *time.Time `gorm:"column:locked_until"`
+	CreatedAt        time.Time  `gorm:"column:created_at"`
+}
+
+// TableName - declare table name for GORM
+func (ScheduledTransfer) TableName() string {
+	return "scheduled_transfers"
+}
+
+//ScheduledTransferRun - результат попытки выполнения запланированного перевода
+type ScheduledTransferRun struct {
+	Id         int       `gorm:"primary_key;column:id"`
+	ScheduleId int       `gorm:"column:schedule_id"`
+	RunAt      time.Time `gorm:"column:run_at"`
+	Attempt    int       `gorm:"column:attempt"`
+	Success    bool      `gorm:"column:success"`
+	Message    string    `gorm:"column:message"`
+}
+
+// TableName - declare table name for GORM
+func (ScheduledTransferRun) TableName() string {
+	return "scheduled_transfer_runs"
+}
+
+//OutboxEvent - событие об изменении баланса. Записывается в одной транзакции с историей операций.
+//Payload содержит json с записями истории, созданными операцией
+type OutboxEvent struct {
+	Id        int64     `gorm:"primary_key;column:id"`
+	EventType string    `gorm:"column:event_type"`
+	Payload   string    `gorm:"column:payload"`
+	CreatedAt time.Time `gorm:"column:created_at"`
+}
+
+// TableName - declare table name for GORM
+func (OutboxEvent) TableName() string {
+	return "outbox_events"
+}
+
+//BalanceEventPayload - содержимое события об изменении баланса
+type BalanceEventPayload struct {
+	EventType string
+	Records   []TransactionRecord
+}
+
+//WebhookSubscription - адрес, на который доставляются события. Тело запроса подписывается HMAC с ключом Secret
+type WebhookSubscription struct {
+	Id        int       `gorm:"primary_key;column:id"`
+	Url       string    `gorm:"column:url"`
+	Secret    string    `gorm:"column:secret"`
+	Active    bool      `gorm:"column:active"`
+	CreatedAt time.Time `gorm:"column:created_at"`
+}
+
+// TableName - declare table name for GORM
+func (WebhookSubscription) TableName() string {
+	return "webhook_subscriptions"
+}
+
+//WebhookDelivery - состояние доставки события EventId подписчику SubscriptionId
+type WebhookDelivery struct {
+	Id             int64      `gorm:"primary_key;column:id"`
+	EventId        int64      `gorm:"column:event_id"`
+	SubscriptionId int        `gorm:"column:subscription_id"`
+	Status         string     `gorm:"column:status"`
+	Attempts       int        `gorm:"column:attempts"`
+	NextAttemptAt  time.Time  `gorm:"column:next_attempt_at"`
+	LastError      string     `gorm:"column:last_error"`
+	LockedUntil    *time.Time `gorm:"column:locked_until"`
+	DeliveredAt    *time.Time `gorm:"column:delivered_at"`
+}
+
+// TableName - declare table name for GORM
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
+
+//WebhookDeliveryTask - доставка вместе с данными события и подписки, необходимыми для отправки
+type WebhookDeliveryTask struct {
+	WebhookDelivery
+	EventType string    `gorm:"column:event_type"`
+	Payload   string    `gorm:"column:payload"`
+	CreatedAt time.Time `gorm:"column:created_at"`
+	Url       string    `gorm:"column:url"`
+	Secret    string    `gorm:"column:secret"`
+}
+
+//BalanceSnapshot - баланс аккаунта на конец дня SnapshotDate
+type BalanceSnapshot struct {
+	AccountId    int       `gorm:"primary_key;column:account_id"`
+	SnapshotDate time.Time `gorm:"primary_key;column:snapshot_date"`
+	Balance      float64   `gorm:"column:balance"`
+	CreatedAt    time.Time `gorm:"column:created_at"`
+}
+
+// TableName - declare table name for GORM
+func (BalanceSnapshot) TableName() string {
+	return "balance_snapshots"
+}
+
+//LedgerDiscrepancy - расхождение, найденное при сверке. Expected - значение, рассчитанное по истории операций,
+//Actual - сохраненное значение. RecordCreatedAt - время записи истории, на которой нарушена цепочка остатков
+type LedgerDiscrepancy struct {
+	AccountId       int
+	Kind            string
+	Expected        float64
+	Actual          float64
+	RecordCreatedAt *time.Time `json:",omitempty"`
+}
+
+//ReconciliationRun - результат сверки балансов с историей операций. Расхождения хранятся в поле Report в формате JSON
+type ReconciliationRun struct {
+	Id               int64               `gorm:"primary_key;column:id"`
+	StartedAt        time.Time           `gorm:"column:started_at"`
+	FinishedAt       time.Time           `gorm:"column:finished_at"`
+	AccountsChecked  int                 `gorm:"column:accounts_checked"`
+	DiscrepancyCount int                 `gorm:"column:discrepancy_count"`
+	Report           string              `gorm:"column:report" json:"-"`
+	Discrepancies    []LedgerDiscrepancy `gorm:"-"`
+}
+
+// TableName - declare table name for GORM
+func (ReconciliationRun) TableName() string {
+	return "reconciliation_runs"
+}
+
+//ChainVerification - результат проверки цепочки хешей истории аккаунта. UnhashedRecords - записи, созданные до появления
+//цепочки хешей. Если цепочка нарушена, BrokenRecordId - первая запись, на которой она нарушена, Reason - причина
+type ChainVerification struct {
+	AccountId       int
+	Valid           bool
+	RecordsChecked  int
+	UnhashedRecords int
+	BrokenRecordId  int64      `json:",omitempty"`
+	BrokenAt        *time.Time `json:",omitempty"`
+	Reason          string     `json:",omitempty"`
+}
+
+//Statement - выписка по аккаунту за период [PeriodStart, PeriodEnd): остатки на начало и конец периода, суммы
+//зачислений и списаний и операции периода. Операции сохраняются в поле MovementsData в формате JSON
+type Statement struct {
+	Id             int64               `gorm:"primary_key;column:id" json:",omitempty"`
+	AccountId      int                 `gorm:"column:account_id"`
+	PeriodStart    time.Time           `gorm:"column:period_start"`
+	PeriodEnd      time.Time           `gorm:"column:period_end"`
+	OpeningBalance float64             `gorm:"column:opening_balance"`
+	ClosingBalance float64             `gorm:"column:closing_balance"`
+	TotalCredits   float64             `gorm:"column:total_credits"`
+	TotalDebits    float64             `gorm:"column:total_debits"`
+	MovementCount  int                 `gorm:"column:movement_count"`
+	GeneratedAt    time.Time           `gorm:"column:generated_at"`
+	MovementsData  string              `gorm:"column:movements" json:"-"`
+	Movements      []TransactionRecord `gorm:"-" json:",omitempty"`
+}
+
+// TableName - declare table name for GORM
+func (Statement) TableName() string {
+	return "account_statements"
+}
+
+//ConsolidatedBalance - баланс аккаунта и его субаккаунтов всех уровней. ConsolidatedBalance - сумма баланса аккаунта
+//и балансов всех субаккаунтов
+type ConsolidatedBalance struct {
+	AccountId           int
+	ParentId            *int `json:",omitempty"`
+	Balance             float64
+	ConsolidatedBalance float64
+	SubAccounts         []SubAccountBalance
+}
+
+//SubAccountBalance - баланс субаккаунта на уровне Depth под аккаунтом консолидированного баланса (1 - непосредственный
+//субаккаунт) вместе с балансами его собственных субаккаунтов
+type SubAccountBalance struct {
+	AccountId           int     `gorm:"column:account_id"`
+	ParentId            int     `gorm:"column:parent_id"`
+	Depth               int     `gorm:"column:depth"`
+	Balance             float64 `gorm:"column:balance"`
+	Frozen              bool    `gorm:"column:frozen"`
+	ConsolidatedBalance float64 `gorm:"-"`
+}
+
+//AccountProduct - продукт аккаунта: годовая процентная ставка AnnualRate (в процентах), проценты выплачиваются
+//со счета расходов ExpenseAccountId
+type AccountProduct struct {
+	Product          string  `gorm:"primary_key;column:product"`
+	AnnualRate       float64 `gorm:"column:annual_rate"`
+	ExpenseAccountId int     `gorm:"column:expense_account_id"`
+	Description      string  `gorm:"column:description"`
+}
+
+// TableName - declare table name for GORM
+func (AccountProduct) TableName() string {
+	return "account_products"
+}
+
+//InterestAccrual - проценты Amount, начисленные за день Day на баланс на конец дня Balance по ставке AnnualRate.
+//PaidRecordId - запись истории, которой проценты выплачены (nil - еще не выплачены)
+type InterestAccrual struct {
+	AccountId        int       `gorm:"primary_key;column:account_id"`
+	Day              time.Time `gorm:"primary_key;column:day"`
+	Balance          float64   `gorm:"column:balance"`
+	AnnualRate       float64   `gorm:"column:annual_rate"`
+	Amount           float64   `gorm:"column:amount"`
+	ExpenseAccountId int       `gorm:"column:expense_account_id"`
+	PaidRecordId     *int64    `gorm:"column:paid_record_id" json:",omitempty"`
+}
+
+// TableName - declare table name for GORM
+func (InterestAccrual) TableName() string {
+	return "interest_accruals"
+}
+
+//InterestPreview - начисленные, но еще не выплаченные проценты аккаунта за дни [AccruedFrom, AccruedTo].
+//Accrued - их сумма, округленная до копеек, как при выплате
+type InterestPreview struct {
+	AccountId   int
+	Product     string  `json:",omitempty"`
+	AnnualRate  float64 `json:",omitempty"`
+	Accrued     float64
+	AccruedFrom *time.Time `json:",omitempty"`
+	AccruedTo   *time.Time `json:",omitempty"`
+	Accruals    []InterestAccrual
+}
+
+//BonusLot - партия бонусов Amount, начисленная на аккаунт; Remaining - ее неизрасходованный остаток,
+//который сгорает в момент ExpiresAt
+type BonusLot struct {
+	Id          int64     `gorm:"primary_key;column:id"`
+	AccountId   int       `gorm:"column:account_id"`
+	Amount      float64   `gorm:"column:amount"`
+	Remaining   float64   `gorm:"column:remaining"`
+	Purpose     string    `gorm:"column:purpose" json:",omitempty"`
+	ExternalRef string    `gorm:"column:external_ref" json:",omitempty"`
+	CreatedAt   time.Time `gorm:"column:created_at"`
+	ExpiresAt   time.Time `gorm:"column:expires_at"`
+}
+
+// TableName - declare table name for GORM
+func (BonusLot) TableName() string {
+	return "bonus_lots"
+}
+
+//BonusRecord - запись истории бонусов: изменение Delta остатка партии LotId и бонусный баланс аккаунта после операции
+//RemainingBalance. TransactionMessage формируется при чтении
+type BonusRecord struct {
+	Id                 int64     `gorm:"primary_key;column:id" json:",omitempty"`
+	AccountId          int       `gorm:"column:account_id"`
+	LotId              int64     `gorm:"column:lot_id"`
+	Delta              float64   `gorm:"column:delta"`
+	RemainingBalance   float64   `gorm:"column:remaining_balance"`
+	OperationType      string    `gorm:"column:operation_type"`
+	TransactionMessage string    `gorm:"-"`
+	Purpose            string    `gorm:"column:purpose" json:",omitempty"`
+	ExternalRef        string    `gorm:"column:external_ref" json:",omitempty"`
+	CreatedAt          time.Time `gorm:"column:created_at"`
+}
+
+// TableName - declare table name for GORM
+func (BonusRecord) TableName() string {
+	return "bonus_history"
+}
+
+//TurnoverFilter - условия запроса оборотов: дни [From, To) (по дате создания записей истории), период группировки
+//Period (TurnoverDay, TurnoverWeek - недели с понедельника, TurnoverMonth). Нулевой AccountId - обороты всего сервиса
+type TurnoverFilter struct {
+	AccountId       int
+	Period          string
+	From            time.Time
+	To              time.Time
+	ByOperationType bool
+}
+
+//Turnover - оборот за период, начинающийся в PeriodStart: суммы зачислений и списаний, количество операций и изменение
+//баланса. OperationType заполняется при группировке по типам операций
+type Turnover struct {
+	PeriodStart    time.Time `gorm:"column:period_start"`
+	OperationType  *string   `gorm:"column:operation_type" json:",omitempty"`
+	Credits        float64   `gorm:"column:credits"`
+	Debits         float64   `gorm:"column:debits"`
+	OperationCount int       `gorm:"column:operation_count"`
+	NetChange      float64   `gorm:"column:net_change"`
+}
+
+//RateLimitBucket - корзина токенов ограничения частоты запросов
+type RateLimitBucket struct {
+	Key       string    `gorm:"primary_key;column:key"`
+	Tokens    float64   `gorm:"column:tokens"`
+	UpdatedAt time.Time `gorm:"column:updated_at"`
+}
+
+// TableName - declare table name for GORM
+func (RateLimitBucket) TableName() string {
+	return "rate_limit_buckets"
+}
+
+//Take - пополняет корзину за время, прошедшее до now, и списывает токен.
+//Возвращает 0, если токен списан, иначе время до появления токена
+func (b *RateLimitBucket) Take(rate float64, burst int, now time.Time) time.Duration {
+	if elapsed := now.Sub(b.UpdatedAt).Seconds(); elapsed > 0 {
+		b.Tokens = math.Min(float64(burst), b.Tokens+elapsed*rate)
+		b.UpdatedAt = now
+	}
+	if b.Tokens >= 1 {
+		b.Tokens--
+		return 0
+	}
+	return time.Duration(math.Ceil((1 - b.Tokens) / rate * float64(time.Second)))
+}
+
+//StorageHealth - состояние соединения с базой данных. Reconnects - количество восстановлений соединения после разрыва.
+//CircuitOpen - разомкнут ли автоматический выключатель (обращения к базе данных не выполняются), RetryAfter - время до
+//следующей попытки
+type StorageHealth struct {
+	Connected   bool
+	CheckedAt   time.Time
+	LastError   string
+	Reconnects  int
+	CircuitOpen bool
+	RetryAfter  time.Duration
+	Replicas    []ReplicaHealth
+}
+
+//ReplicaHealth - состояние реплики для чтения. Usable - направляются ли на реплику запросы (доступна и отстает
+//не более допустимого)
+type ReplicaHealth struct {
+	Name      string
+	Healthy   bool
+	Usable    bool
+	Lag       time.Duration
+	LastError string
+}
+
+//StorageOptions - настройки пула соединений с базой данных и автоматического выключателя.
+//Нулевые значения оставляют настройки по умолчанию
+type StorageOptions struct {
+	MaxOpenConns     int
+	MaxIdleConns     int
+	ConnMaxLifetime  time.Duration
+	StatementTimeout time.Duration
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	//PingInterval - интервал фоновой проверки соединения с базой данных
+	PingInterval time.Duration
+
+	//ReplicaConns - строки подключения к репликам для чтения истории (и баланса при ReplicaBalanceReads).
+	//Реплика, отстающая больше ReplicaMaxLag, не используется
+	ReplicaConns        []string
+	ReplicaMaxLag       time.Duration
+	ReplicaBalanceReads bool
+}
+
+//ServerTimeouts - тайм-ауты HTTP сервера. Нулевые значения - без ограничения
+type ServerTimeouts struct {
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+}
+
+//RatesOptions - настройки поставщика курсов валют. Нулевые значения оставляют настройки по умолчанию
+type RatesOptions struct {
+	//URL - адрес текущих курсов, HistoricalURL - шаблон адреса курсов на дату (подставляется дата в формате 2006-01-02).
+	//Поставщик должен возвращать курсы к BaseCurrency
+	URL           string
+	HistoricalURL string
+	//CacheTTL - время, в течение которого полученные текущие курсы не запрашиваются повторно
+	CacheTTL       time.Duration
+	RequestTimeout time.Duration
+	//DefaultCurrency - валюта, в которой возвращается баланс, если клиент ее не указал
+	DefaultCurrency string
+}
+
+//TLSOptions - настройки TLS серверов HTTP и gRPC. Пустой CertFile - соединения без TLS
+type TLSOptions struct {
+	CertFile string
+	KeyFile  string
+	//ClientCAFile - сертификаты центров, которыми подписываются сертификаты клиентов. Пустая строка - сертификаты
+	//клиентов не запрашиваются. При ClientCertOptional клиенты без сертификата получают доступ только к проверкам доступности
+	ClientCAFile       string
+	ClientCertOptional bool
+	//AllowedClients - идентификаторы клиентов по субъекту сертификата ("CN=billing,O=Acme") или его CommonName.
+	//Пустой список - допускается любой клиент с проверенным сертификатом, идентификатор - CommonName
+	AllowedClients map[string]string
+	//ReloadInterval - интервал проверки изменения файлов сертификатов
+	ReloadInterval time.Duration
+}
+
+//Config хранит параметры сервиса из файла конфигурации, переменных окружения и командной строки
 type Config struct {
 	ServerAddress      string
+	GrpcAddress        string
 	AccountStorageConn string
+	SchedulerInterval  time.Duration
+	WebhookInterval    time.Duration
+	SnapshotInterval   time.Duration
+	ReconcileInterval  time.Duration
+	StatementInterval  time.Duration
+	InterestInterval   time.Duration
+	BonusInterval      time.Duration
+	RateLimits         string
+	RateLimitBackend   string
+	Storage            StorageOptions
+	ServerTimeouts     ServerTimeouts
+	Rates              RatesOptions
+	TLS                TLSOptions
+	//MaxBodyBytes - максимальный размер тела HTTP запроса, SwaggerUIDir - каталог с файлами swagger-ui-dist
+	MaxBodyBytes int64
+	SwaggerUIDir string
+	//LogLevel - уровень журнала сервиса (debug, info, warn, error, off), LogFile - файл журнала (пустая строка - stderr)
+	LogLevel string
+	LogFile  string
 }
 
 //ConvertData - структура для хранения коэффициэнтов конвертирования
@@ -0,0 +1,1015 @@
+package openapi
+
+//specJSON - описание HTTP API сервиса в формате OpenAPI 3.
+//При добавлении маршрута в server.Connector.executeHandlers его необходимо описать здесь
+const specJSON = `{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "User balance service",
+    "description": "Сервис для работы с балансом пользователей",
+    "version": "1.0.0"
+  },
+  "paths": {
+    "/alive": {
+      "get": {
+        "summary": "Проверка доступности сервиса",
+        "responses": {
+          "200": {"description": "Сервис доступен", "content": {"text/plain": {"schema": {"type": "string"}}}}
+        }
+      }
+    },
+    "/healthz": {
+      "get": {
+        "summary": "Проверка работы процесса сервиса",
+        "responses": {
+          "200": {"description": "Процесс сервиса работает", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/HealthReport"}}}}
+        }
+      }
+    },
+    "/readyz": {
+      "get": {
+        "summary": "Проверка готовности сервиса: соединение с базой данных, версия схемы, актуальность курсов валют",
+        "responses": {
+          "200": {"description": "Сервис готов (Status ok или degraded)", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/HealthReport"}}}},
+          "503": {"description": "Не прошла критичная проверка", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/HealthReport"}}}}
+        }
+      }
+    },
+    "/openapi.json": {
+      "get": {
+        "summary": "Описание API в формате OpenAPI 3",
+        "responses": {
+          "200": {"description": "Документ OpenAPI", "content": {"application/json": {"schema": {"type": "object"}}}}
+        }
+      }
+    },
+    "/docs": {
+      "get": {
+        "summary": "Swagger UI",
+        "responses": {
+          "200": {"description": "Страница Swagger UI", "content": {"text/html": {"schema": {"type": "string"}}}}
+        }
+      }
+    },
+    "/docs/assets/{file}": {
+      "get": {
+        "summary": "Скрипты и стили Swagger UI",
+        "parameters": [
+          {"name": "file", "in": "path", "required": true, "schema": {"type": "string", "enum": ["swagger-ui.css", "swagger-ui-bundle.js"]}}
+        ],
+        "responses": {
+          "200": {"description": "Файл swagger-ui-dist", "content": {"text/css": {"schema": {"type": "string"}}, "application/javascript": {"schema": {"type": "string"}}}},
+          "404": {"description": "Файл не найден"}
+        }
+      }
+    },
+    "/account/balance/info/{id}": {
+      "get": {
+        "summary": "Информация о балансе аккаунта",
+        "parameters": [
+          {"$ref": "#/components/parameters/Id"},
+          {"name": "currency", "in": "query", "description": "Валюта, в которую конвертируется баланс", "schema": {"type": "string", "pattern": "^[A-Za-z]{3}$"}},
+          {"name": "at", "in": "query", "description": "Момент времени, на который рассчитывается баланс (RFC 3339)", "schema": {"type": "string", "format": "date-time"}},
+          {"$ref": "#/components/parameters/Consistency"}
+        ],
+        "responses": {
+          "200": {"description": "Баланс аккаунта", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/AccountBalance"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/account/balance/change": {
+      "post": {
+        "summary": "Пополнение (Delta > 0) или списание (Delta < 0) средств",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ChangeBalanceRequest"}}}},
+        "responses": {
+          "200": {"$ref": "#/components/responses/Operation"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/account/balance/transfer": {
+      "post": {
+        "summary": "Перевод между аккаунтами",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/TransferRequest"}}}},
+        "responses": {
+          "200": {"$ref": "#/components/responses/Operation"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/account/balance/reversal": {
+      "post": {
+        "summary": "Отмена операции по записи истории",
+        "description": "Перевод и комиссия отменяются записями у обоих аккаунтов, комиссия за отменяемую операцию не возвращается",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ReversalRequest"}}}},
+        "responses": {
+          "200": {"$ref": "#/components/responses/Operation"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/account/balance/consolidated/{id}": {
+      "get": {
+        "summary": "Консолидированный баланс аккаунта и всех его субаккаунтов",
+        "parameters": [
+          {"$ref": "#/components/parameters/Id"},
+          {"$ref": "#/components/parameters/Consistency"}
+        ],
+        "responses": {
+          "200": {"description": "Консолидированный баланс", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ConsolidatedBalance"}}}},
+          "404": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/account/interest/{id}": {
+      "get": {
+        "summary": "Начисленные, но еще не выплаченные проценты аккаунта",
+        "description": "Проценты начисляются за каждый завершившийся день на баланс на конец дня и выплачиваются после окончания месяца",
+        "parameters": [
+          {"$ref": "#/components/parameters/Id"},
+          {"$ref": "#/components/parameters/Consistency"}
+        ],
+        "responses": {
+          "200": {"description": "Невыплаченные проценты", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/InterestPreview"}}}},
+          "404": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/account/bonus/credit": {
+      "post": {
+        "summary": "Начисление партии бонусов со сроком действия",
+        "description": "Отсутствующий аккаунт создается с нулевым балансом. Бонусы учитываются отдельно от баланса и не конвертируются в валюту",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/BonusCreditRequest"}}}},
+        "responses": {
+          "200": {"$ref": "#/components/responses/BonusOperation"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/account/bonus/spend": {
+      "post": {
+        "summary": "Списание бонусов в оплату покупки",
+        "description": "Бонусы списываются с действующих партий в порядке начисления. Снять или перевести бонусы нельзя",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/BonusSpendRequest"}}}},
+        "responses": {
+          "200": {"$ref": "#/components/responses/BonusOperation"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/account/bonus/{id}": {
+      "get": {
+        "summary": "Бонусный баланс и действующие партии бонусов аккаунта",
+        "parameters": [
+          {"$ref": "#/components/parameters/Id"},
+          {"$ref": "#/components/parameters/Consistency"}
+        ],
+        "responses": {
+          "200": {"description": "Действующие партии в порядке списания", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/BonusLots"}}}},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/account/bonus/{id}/history": {
+      "get": {
+        "summary": "История начислений, списаний и сгорания бонусов аккаунта",
+        "parameters": [
+          {"$ref": "#/components/parameters/Id"},
+          {"$ref": "#/components/parameters/Consistency"}
+        ],
+        "responses": {
+          "200": {"description": "Записи истории бонусов", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/BonusRecord"}}}}},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/account/subaccounts": {
+      "post": {
+        "summary": "Подчинение аккаунта родительскому аккаунту",
+        "description": "Отсутствующий субаккаунт создается с нулевым балансом. Блокировка родительского аккаунта распространяется на все его субаккаунты",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/SubAccountRequest"}}}},
+        "responses": {
+          "204": {"description": "Аккаунт подчинен"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/account/subaccounts/{id}": {
+      "delete": {
+        "summary": "Отделение субаккаунта от родительского аккаунта",
+        "parameters": [{"$ref": "#/components/parameters/Id"}],
+        "responses": {
+          "204": {"description": "Субаккаунт отделен"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/account/subaccounts/fund": {
+      "post": {
+        "summary": "Пополнение субаккаунта с родительского аккаунта без комиссии",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/SubAccountFundsRequest"}}}},
+        "responses": {
+          "200": {"$ref": "#/components/responses/Operation"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/account/subaccounts/sweep": {
+      "post": {
+        "summary": "Перевод средств субаккаунта на родительский аккаунт без комиссии",
+        "description": "Если Delta не задана, переводится весь баланс субаккаунта",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/SubAccountFundsRequest"}}}},
+        "responses": {
+          "200": {"$ref": "#/components/responses/Operation"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/account/balance/history": {
+      "post": {
+        "summary": "История операций аккаунта",
+        "parameters": [{"$ref": "#/components/parameters/Consistency"}],
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/HistoryRequest"}}}},
+        "responses": {
+          "200": {"description": "Записи истории", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/TransactionRecordInCurrency"}}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/account/balance/history/search": {
+      "get": {
+        "summary": "Поиск записей истории по внешнему идентификатору операции",
+        "parameters": [
+          {"name": "ref", "in": "query", "required": true, "description": "Внешний идентификатор операции", "schema": {"type": "string"}},
+          {"name": "id", "in": "query", "description": "Аккаунт (по умолчанию - все аккаунты)", "schema": {"type": "integer", "minimum": 1}},
+          {"$ref": "#/components/parameters/Consistency"}
+        ],
+        "responses": {
+          "200": {"description": "Записи истории в порядке добавления", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/TransactionRecordInCurrency"}}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/account/balance/history/verify/{id}": {
+      "get": {
+        "summary": "Проверка цепочки хешей истории операций аккаунта",
+        "parameters": [{"$ref": "#/components/parameters/Id"}],
+        "responses": {
+          "200": {"description": "Результат проверки", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ChainVerification"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/account/balance/statement/{id}": {
+      "get": {
+        "summary": "Выписка по аккаунту за период, рассчитанная в момент запроса",
+        "description": "Период задается параметром month или параметрами from и to. По умолчанию - текущий месяц до момента запроса",
+        "parameters": [
+          {"$ref": "#/components/parameters/Id"},
+          {"name": "month", "in": "query", "description": "Месяц выписки", "schema": {"type": "string", "pattern": "^[0-9]{4}-(0[1-9]|1[0-2])$"}},
+          {"name": "from", "in": "query", "description": "Начало периода (включительно)", "schema": {"type": "string", "format": "date-time"}},
+          {"name": "to", "in": "query", "description": "Конец периода (не включительно)", "schema": {"type": "string", "format": "date-time"}},
+          {"$ref": "#/components/parameters/StatementFormat"}
+        ],
+        "responses": {
+          "200": {"$ref": "#/components/responses/Statement"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/account/balance/statements/{id}": {
+      "get": {
+        "summary": "Сохраненные ежемесячные выписки аккаунта (без операций)",
+        "parameters": [{"$ref": "#/components/parameters/Id"}],
+        "responses": {
+          "200": {"description": "Выписки, начиная с последних", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Statement"}}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/account/balance/statements/{id}/{month}": {
+      "get": {
+        "summary": "Сохраненная выписка аккаунта за месяц",
+        "parameters": [
+          {"$ref": "#/components/parameters/Id"},
+          {"name": "month", "in": "path", "required": true, "description": "Месяц выписки", "schema": {"type": "string", "pattern": "^[0-9]{4}-(0[1-9]|1[0-2])$"}},
+          {"$ref": "#/components/parameters/StatementFormat"}
+        ],
+        "responses": {
+          "200": {"$ref": "#/components/responses/Statement"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/account/balance/turnover/{id}": {
+      "get": {
+        "summary": "Обороты аккаунта по дням, неделям или месяцам",
+        "parameters": [
+          {"$ref": "#/components/parameters/Id"},
+          {"$ref": "#/components/parameters/TurnoverPeriod"},
+          {"$ref": "#/components/parameters/TurnoverFrom"},
+          {"$ref": "#/components/parameters/TurnoverTo"},
+          {"$ref": "#/components/parameters/TurnoverBy"},
+          {"$ref": "#/components/parameters/Consistency"}
+        ],
+        "responses": {
+          "200": {"$ref": "#/components/responses/Turnover"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/account/balance/fee/quote": {
+      "post": {
+        "summary": "Расчет комиссии за операцию",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/FeeQuoteRequest"}}}},
+        "responses": {
+          "200": {"description": "Комиссия", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/FeeQuote"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/account/balance/schedule": {
+      "post": {
+        "summary": "Создание запланированного перевода",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ScheduledTransferRequest"}}}},
+        "responses": {
+          "200": {"$ref": "#/components/responses/ScheduledTransfer"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/account/balance/schedule/{id}": {
+      "parameters": [{"$ref": "#/components/parameters/Id"}],
+      "get": {
+        "summary": "Получение запланированного перевода",
+        "responses": {
+          "200": {"$ref": "#/components/responses/ScheduledTransfer"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "put": {
+        "summary": "Изменение запланированного перевода",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ScheduledTransferRequest"}}}},
+        "responses": {
+          "200": {"$ref": "#/components/responses/ScheduledTransfer"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "delete": {
+        "summary": "Удаление запланированного перевода",
+        "responses": {
+          "204": {"description": "Перевод удален"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/account/balance/schedule/{id}/runs": {
+      "get": {
+        "summary": "История выполнения запланированного перевода",
+        "parameters": [{"$ref": "#/components/parameters/Id"}],
+        "responses": {
+          "200": {"description": "Выполнения перевода", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/ScheduledTransferRun"}}}}},
+          "404": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/account/balance/schedules/{id}": {
+      "get": {
+        "summary": "Запланированные переводы аккаунта",
+        "parameters": [{"$ref": "#/components/parameters/Id"}],
+        "responses": {
+          "200": {"description": "Запланированные переводы", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/ScheduledTransfer"}}}}},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/webhooks": {
+      "post": {
+        "summary": "Регистрация подписки на события об изменении баланса",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/WebhookSubscriptionRequest"}}}},
+        "responses": {
+          "200": {"description": "Созданная подписка", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/WebhookSubscription"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "get": {
+        "summary": "Список подписок",
+        "responses": {
+          "200": {"description": "Подписки", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/WebhookSubscription"}}}}},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/webhooks/{id}": {
+      "delete": {
+        "summary": "Удаление подписки",
+        "parameters": [{"$ref": "#/components/parameters/Id"}],
+        "responses": {
+          "204": {"description": "Подписка удалена"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/webhooks/{id}/replay": {
+      "post": {
+        "summary": "Повторная отправка подписчику событий начиная с Since",
+        "parameters": [{"$ref": "#/components/parameters/Id"}],
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/WebhookReplayRequest"}}}},
+        "responses": {
+          "202": {"description": "Количество поставленных в очередь доставок", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/WebhookReplayResult"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/webhooks/deliveries": {
+      "get": {
+        "summary": "Последние доставки событий",
+        "parameters": [
+          {"name": "status", "in": "query", "schema": {"type": "string", "enum": ["pending", "delivered", "dead"]}}
+        ],
+        "responses": {
+          "200": {"description": "Доставки", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/WebhookDelivery"}}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/webhooks/deliveries/{id}/replay": {
+      "post": {
+        "summary": "Повторная отправка доставки",
+        "parameters": [{"$ref": "#/components/parameters/Id"}],
+        "responses": {
+          "202": {"description": "Доставка поставлена в очередь"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/admin/reconciliation": {
+      "get": {
+        "summary": "Результат последней сверки балансов с историей операций",
+        "responses": {
+          "200": {"description": "Результат сверки", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ReconciliationRun"}}}},
+          "404": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "post": {
+        "summary": "Сверка балансов с историей операций",
+        "responses": {
+          "200": {"description": "Результат сверки", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ReconciliationRun"}}}},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/admin/turnover": {
+      "get": {
+        "summary": "Обороты всех аккаунтов сервиса по дням, неделям или месяцам",
+        "parameters": [
+          {"$ref": "#/components/parameters/TurnoverPeriod"},
+          {"$ref": "#/components/parameters/TurnoverFrom"},
+          {"$ref": "#/components/parameters/TurnoverTo"},
+          {"$ref": "#/components/parameters/TurnoverBy"},
+          {"$ref": "#/components/parameters/Consistency"}
+        ],
+        "responses": {
+          "200": {"$ref": "#/components/responses/Turnover"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    }
+  },
+  "components": {
+    "parameters": {
+      "Id": {"name": "id", "in": "path", "required": true, "schema": {"type": "integer", "minimum": 1}},
+      "StatementFormat": {"name": "format", "in": "query", "description": "Формат выписки (по умолчанию json)", "schema": {"type": "string", "enum": ["json", "html"]}},
+      "TurnoverPeriod": {"name": "period", "in": "query", "description": "Период группировки (по умолчанию day, недели начинаются с понедельника)", "schema": {"type": "string", "enum": ["day", "week", "month"]}},
+      "TurnoverFrom": {"name": "from", "in": "query", "description": "Первый день (по умолчанию 30 дней, 12 недель или 12 месяцев до to)", "schema": {"type": "string", "pattern": "^[0-9]{4}-[0-9]{2}-[0-9]{2}$"}},
+      "TurnoverTo": {"name": "to", "in": "query", "description": "День после последнего (по умолчанию завтрашний)", "schema": {"type": "string", "pattern": "^[0-9]{4}-[0-9]{2}-[0-9]{2}$"}},
+      "TurnoverBy": {"name": "by", "in": "query", "description": "Группировка по типам операций", "schema": {"type": "string", "enum": ["operation_type"]}},
+      "Consistency": {"name": "X-Consistency", "in": "header", "description": "strong - чтение с основного сервера базы данных, а не с реплики", "schema": {"type": "string", "enum": ["strong"]}}
+    },
+    "responses": {
+      "Error": {"description": "Ошибка (RFC 7807)", "content": {"application/problem+json": {"schema": {"$ref": "#/components/schemas/Problem"}}}},
+      "Operation": {"description": "Операция выполнена", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/OperationResult"}}}},
+      "BonusOperation": {"description": "Операция с бонусами выполнена", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/BonusOperationResult"}}}},
+      "Statement": {"description": "Выписка", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Statement"}}, "text/html": {"schema": {"type": "string"}}}},
+      "Turnover": {"description": "Обороты", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/TurnoverReport"}}}},
+      "ScheduledTransfer": {"description": "Запланированный перевод", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ScheduledTransfer"}}}}
+    },
+    "schemas": {
+      "Problem": {
+        "type": "object",
+        "required": ["type", "title", "status", "code"],
+        "properties": {
+          "type": {"type": "string"},
+          "title": {"type": "string"},
+          "status": {"type": "integer"},
+          "detail": {"type": "string"},
+          "code": {"type": "string", "enum": ["internal_error", "invalid_input", "validation_failed", "zero_amount", "same_accounts", "insufficient_funds", "rate_unavailable", "not_found", "history_not_found", "schedule_not_found", "webhook_not_found", "rate_limited", "service_unavailable", "account_frozen", "forbidden", "already_reversed", "not_sub_account"]},
+          "errors": {"type": "array", "items": {"$ref": "#/components/schemas/FieldError"}}
+        }
+      },
+      "HealthReport": {
+        "type": "object",
+        "properties": {
+          "Status": {"type": "string", "enum": ["ok", "degraded", "fail"]},
+          "Checks": {
+            "type": "object",
+            "properties": {
+              "database": {"$ref": "#/components/schemas/HealthCheck"},
+              "migrations": {"$ref": "#/components/schemas/HealthCheck"},
+              "replicas": {"$ref": "#/components/schemas/HealthCheck"},
+              "exchange_rates": {"$ref": "#/components/schemas/HealthCheck"}
+            }
+          }
+        }
+      },
+      "HealthCheck": {
+        "type": "object",
+        "properties": {
+          "Status": {"type": "string", "enum": ["ok", "fail"]},
+          "Critical": {"type": "boolean"},
+          "LatencyMs": {"type": "number"},
+          "Detail": {"type": "string"},
+          "Error": {"type": "string"}
+        }
+      },
+      "ReconciliationRun": {
+        "type": "object",
+        "properties": {
+          "Id": {"type": "integer"},
+          "StartedAt": {"type": "string", "format": "date-time"},
+          "FinishedAt": {"type": "string", "format": "date-time"},
+          "AccountsChecked": {"type": "integer"},
+          "DiscrepancyCount": {"type": "integer"},
+          "Discrepancies": {"type": "array", "items": {"$ref": "#/components/schemas/LedgerDiscrepancy"}}
+        }
+      },
+      "LedgerDiscrepancy": {
+        "type": "object",
+        "properties": {
+          "AccountId": {"type": "integer"},
+          "Kind": {"type": "string", "enum": ["balance_mismatch", "remaining_balance_chain", "last_record_mismatch"]},
+          "Expected": {"type": "number"},
+          "Actual": {"type": "number"},
+          "RecordCreatedAt": {"type": "string", "format": "date-time"}
+        }
+      },
+      "FieldError": {
+        "type": "object",
+        "properties": {
+          "field": {"type": "string"},
+          "message": {"type": "string"}
+        }
+      },
+      "OperationResult": {
+        "type": "object",
+        "properties": {
+          "Message": {"type": "string"}
+        }
+      },
+      "AccountBalance": {
+        "type": "object",
+        "properties": {
+          "Id": {"type": "integer"},
+          "Balance": {"type": "number"},
+          "Currency": {"type": "string"},
+          "BonusBalance": {"type": "number", "description": "Бонусный баланс, только для текущего баланса (без параметра at)"},
+          "At": {"type": "string", "format": "date-time"}
+        }
+      },
+      "ChangeBalanceRequest": {
+        "type": "object",
+        "required": ["Id", "Delta"],
+        "additionalProperties": false,
+        "properties": {
+          "Id": {"type": "integer", "minimum": 1},
+          "Delta": {"type": "number", "description": "Сумма операции, не равная 0"},
+          "Currency": {"$ref": "#/components/schemas/OperationCurrency"},
+          "Purpose": {"$ref": "#/components/schemas/Purpose"},
+          "ExternalRef": {"$ref": "#/components/schemas/ExternalRef"},
+          "Metadata": {"$ref": "#/components/schemas/Metadata"}
+        }
+      },
+      "TransferRequest": {
+        "type": "object",
+        "required": ["Id1", "Id2", "Delta"],
+        "additionalProperties": false,
+        "properties": {
+          "Id1": {"type": "integer", "minimum": 1},
+          "Id2": {"type": "integer", "minimum": 1},
+          "Delta": {"type": "number", "description": "Сумма перевода. При Delta > 0 средства переводятся с Id2 на Id1"},
+          "Currency": {"$ref": "#/components/schemas/OperationCurrency"},
+          "Purpose": {"$ref": "#/components/schemas/Purpose"},
+          "ExternalRef": {"$ref": "#/components/schemas/ExternalRef"},
+          "Metadata": {"$ref": "#/components/schemas/Metadata"}
+        }
+      },
+      "OperationCurrency": {"type": "string", "pattern": "^[A-Za-z]{3}$", "description": "Валюта суммы Delta (по умолчанию RUB). Сумма пересчитывается в RUB по текущему курсу, по валюте подбирается правило комиссии"},
+      "Purpose": {"type": "string", "description": "Назначение операции, не длиннее 500 символов"},
+      "ExternalRef": {"type": "string", "description": "Внешний идентификатор операции (например, номер заказа), не длиннее 100 символов"},
+      "Metadata": {"type": "object", "description": "Не больше 20 пар ключ-значение, значения - строки. Ключи не длиннее 64 символов, значения - 500 символов"},
+      "HistoryRequest": {
+        "type": "object",
+        "required": ["Id"],
+        "additionalProperties": false,
+        "properties": {
+          "Id": {"type": "integer", "minimum": 1},
+          "SortedBy": {"type": "string", "enum": ["transaction_time", "transaction_sum"]},
+          "SortedByDesc": {"type": "boolean"},
+          "Currency": {"type": "string", "pattern": "^[A-Za-z]{3}$"},
+          "RateType": {"type": "string", "enum": ["current", "historical"]},
+          "OperationTypes": {"type": "array", "description": "Отбор по типам операций", "items": {"$ref": "#/components/schemas/OperationType"}},
+          "CounterpartyId": {"type": "integer", "minimum": 1, "description": "Отбор по второму аккаунту операции"}
+        }
+      },
+      "ReversalRequest": {
+        "type": "object",
+        "required": ["Id"],
+        "additionalProperties": false,
+        "properties": {
+          "Id": {"type": "integer", "minimum": 1, "description": "Запись истории отменяемой операции"},
+          "Purpose": {"$ref": "#/components/schemas/Purpose"},
+          "ExternalRef": {"$ref": "#/components/schemas/ExternalRef"},
+          "Metadata": {"$ref": "#/components/schemas/Metadata"}
+        }
+      },
+      "SubAccountRequest": {
+        "type": "object",
+        "required": ["ParentId", "ChildId"],
+        "additionalProperties": false,
+        "properties": {
+          "ParentId": {"type": "integer", "minimum": 1},
+          "ChildId": {"type": "integer", "minimum": 1}
+        }
+      },
+      "SubAccountFundsRequest": {
+        "type": "object",
+        "required": ["ParentId", "ChildId"],
+        "additionalProperties": false,
+        "properties": {
+          "ParentId": {"type": "integer", "minimum": 1},
+          "ChildId": {"type": "integer", "minimum": 1, "description": "Непосредственный субаккаунт ParentId"},
+          "Delta": {"type": "number", "minimum": 0, "description": "Сумма перевода"},
+          "Purpose": {"$ref": "#/components/schemas/Purpose"},
+          "ExternalRef": {"$ref": "#/components/schemas/ExternalRef"},
+          "Metadata": {"$ref": "#/components/schemas/Metadata"}
+        }
+      },
+      "ConsolidatedBalance": {
+        "type": "object",
+        "properties": {
+          "AccountId": {"type": "integer"},
+          "ParentId": {"type": "integer"},
+          "Balance": {"type": "number"},
+          "ConsolidatedBalance": {"type": "number", "description": "Сумма баланса аккаунта и балансов всех субаккаунтов"},
+          "SubAccounts": {"type": "array", "items": {"$ref": "#/components/schemas/SubAccountBalance"}}
+        }
+      },
+      "InterestPreview": {
+        "type": "object",
+        "properties": {
+          "AccountId": {"type": "integer"},
+          "Product": {"type": "string", "description": "Продукт аккаунта"},
+          "AnnualRate": {"type": "number", "description": "Годовая процентная ставка продукта, %"},
+          "Accrued": {"type": "number", "description": "Сумма невыплаченных процентов, округленная до копеек"},
+          "AccruedFrom": {"type": "string", "format": "date-time"},
+          "AccruedTo": {"type": "string", "format": "date-time"},
+          "Accruals": {"type": "array", "items": {"$ref": "#/components/schemas/InterestAccrual"}}
+        }
+      },
+      "InterestAccrual": {
+        "type": "object",
+        "properties": {
+          "AccountId": {"type": "integer"},
+          "Day": {"type": "string", "format": "date-time"},
+          "Balance": {"type": "number", "description": "Баланс на конец дня"},
+          "AnnualRate": {"type": "number"},
+          "Amount": {"type": "number", "description": "Проценты за день без округления"},
+          "ExpenseAccountId": {"type": "integer"}
+        }
+      },
+      "BonusCreditRequest": {
+        "type": "object",
+        "required": ["Id", "Amount", "ExpiresInDays"],
+        "additionalProperties": false,
+        "properties": {
+          "Id": {"type": "integer", "minimum": 1},
+          "Amount": {"type": "number", "minimum": 0, "exclusiveMinimum": true},
+          "ExpiresInDays": {"type": "integer", "minimum": 1, "description": "Срок действия партии в днях"},
+          "Purpose": {"$ref": "#/components/schemas/Purpose"},
+          "ExternalRef": {"$ref": "#/components/schemas/ExternalRef"}
+        }
+      },
+      "BonusSpendRequest": {
+        "type": "object",
+        "required": ["Id", "Amount", "ExternalRef"],
+        "additionalProperties": false,
+        "properties": {
+          "Id": {"type": "integer", "minimum": 1},
+          "Amount": {"type": "number", "minimum": 0, "exclusiveMinimum": true},
+          "Purpose": {"$ref": "#/components/schemas/Purpose"},
+          "ExternalRef": {"type": "string", "description": "Идентификатор заказа, который оплачивается бонусами, не длиннее 100 символов"}
+        }
+      },
+      "BonusOperationResult": {
+        "type": "object",
+        "properties": {
+          "Message": {"type": "string"},
+          "BonusBalance": {"type": "number", "description": "Бонусный баланс после операции"}
+        }
+      },
+      "BonusLots": {
+        "type": "object",
+        "properties": {
+          "AccountId": {"type": "integer"},
+          "BonusBalance": {"type": "number"},
+          "Lots": {"type": "array", "items": {"$ref": "#/components/schemas/BonusLot"}}
+        }
+      },
+      "BonusLot": {
+        "type": "object",
+        "properties": {
+          "Id": {"type": "integer"},
+          "AccountId": {"type": "integer"},
+          "Amount": {"type": "number", "description": "Начисленная сумма"},
+          "Remaining": {"type": "number", "description": "Неизрасходованный остаток"},
+          "Purpose": {"$ref": "#/components/schemas/Purpose"},
+          "ExternalRef": {"$ref": "#/components/schemas/ExternalRef"},
+          "CreatedAt": {"type": "string", "format": "date-time"},
+          "ExpiresAt": {"type": "string", "format": "date-time", "description": "Момент сгорания остатка"}
+        }
+      },
+      "BonusRecord": {
+        "type": "object",
+        "properties": {
+          "Id": {"type": "integer"},
+          "AccountId": {"type": "integer"},
+          "LotId": {"type": "integer", "description": "Партия, остаток которой изменился"},
+          "Delta": {"type": "number"},
+          "RemainingBalance": {"type": "number", "description": "Бонусный баланс после операции"},
+          "OperationType": {"type": "string", "enum": ["bonus_credit", "bonus_spend", "bonus_expiry"]},
+          "TransactionMessage": {"type": "string", "description": "Описание операции на языке из заголовка Accept-Language"},
+          "Purpose": {"$ref": "#/components/schemas/Purpose"},
+          "ExternalRef": {"$ref": "#/components/schemas/ExternalRef"},
+          "CreatedAt": {"type": "string", "format": "date-time"}
+        }
+      },
+      "SubAccountBalance": {
+        "type": "object",
+        "properties": {
+          "AccountId": {"type": "integer"},
+          "ParentId": {"type": "integer"},
+          "Depth": {"type": "integer", "description": "Уровень субаккаунта, 1 - непосредственный субаккаунт"},
+          "Balance": {"type": "number"},
+          "Frozen": {"type": "boolean"},
+          "ConsolidatedBalance": {"type": "number"}
+        }
+      },
+      "OperationType": {"type": "string", "enum": ["deposit", "withdrawal", "transfer_in", "transfer_out", "fee", "reversal", "interest"]},
+      "TransactionRecordInCurrency": {
+        "type": "object",
+        "properties": {
+          "Id": {"type": "integer"},
+          "AccountId": {"type": "integer"},
+          "Delta": {"type": "number"},
+          "RemainingBalance": {"type": "number"},
+          "OperationType": {"$ref": "#/components/schemas/OperationType"},
+          "CounterpartyId": {"type": "integer", "description": "Второй аккаунт перевода или комиссии"},
+          "ReversalOf": {"type": "integer", "description": "Запись, которую отменяет запись с типом reversal"},
+          "PairId": {"type": "integer", "description": "Первая запись перевода, комиссии или отмены у второго аккаунта операции"},
+          "OperationCurrency": {"type": "string", "description": "Валюта операции, если сумма указана не в RUB"},
+          "OperationRate": {"type": "number", "description": "Курс OperationCurrency к RUB, по которому пересчитана сумма операции"},
+          "TransactionMessage": {"type": "string", "description": "Описание операции на языке из заголовка Accept-Language"},
+          "Purpose": {"$ref": "#/components/schemas/Purpose"},
+          "ExternalRef": {"$ref": "#/components/schemas/ExternalRef"},
+          "Metadata": {"$ref": "#/components/schemas/Metadata"},
+          "CreatedAt": {"type": "string", "format": "date-time"},
+          "PrevHash": {"type": "string", "description": "Хеш предыдущей записи аккаунта"},
+          "Hash": {"type": "string", "description": "Хеш SHA-256 содержимого записи и PrevHash"},
+          "Currency": {"type": "string", "description": "Только при конвертации"},
+          "Rate": {"type": "number", "description": "Только при конвертации"},
+          "RateType": {"type": "string", "description": "Только при конвертации"},
+          "RateDate": {"type": "string", "description": "Только при конвертации"}
+        }
+      },
+      "Statement": {
+        "type": "object",
+        "properties": {
+          "Id": {"type": "integer", "description": "Только для сохраненных выписок"},
+          "AccountId": {"type": "integer"},
+          "PeriodStart": {"type": "string", "format": "date-time"},
+          "PeriodEnd": {"type": "string", "format": "date-time"},
+          "OpeningBalance": {"type": "number"},
+          "ClosingBalance": {"type": "number"},
+          "TotalCredits": {"type": "number"},
+          "TotalDebits": {"type": "number"},
+          "MovementCount": {"type": "integer"},
+          "GeneratedAt": {"type": "string", "format": "date-time"},
+          "Movements": {"type": "array", "items": {"$ref": "#/components/schemas/TransactionRecordInCurrency"}}
+        }
+      },
+      "TurnoverReport": {
+        "type": "object",
+        "properties": {
+          "AccountId": {"type": "integer", "description": "Отсутствует для оборотов всего сервиса"},
+          "Period": {"type": "string", "enum": ["day", "week", "month"]},
+          "From": {"type": "string", "format": "date"},
+          "To": {"type": "string", "format": "date"},
+          "Turnover": {"type": "array", "items": {"$ref": "#/components/schemas/Turnover"}}
+        }
+      },
+      "Turnover": {
+        "type": "object",
+        "properties": {
+          "PeriodStart": {"type": "string", "format": "date-time"},
+          "OperationType": {"type": "string", "description": "Только при группировке по типам операций"},
+          "Credits": {"type": "number"},
+          "Debits": {"type": "number"},
+          "OperationCount": {"type": "integer"},
+          "NetChange": {"type": "number"}
+        }
+      },
+      "ChainVerification": {
+        "type": "object",
+        "properties": {
+          "AccountId": {"type": "integer"},
+          "Valid": {"type": "boolean"},
+          "RecordsChecked": {"type": "integer"},
+          "UnhashedRecords": {"type": "integer", "description": "Записи, созданные до появления цепочки хешей"},
+          "BrokenRecordId": {"type": "integer", "description": "Первая запись, на которой нарушена цепочка"},
+          "BrokenAt": {"type": "string", "format": "date-time"},
+          "Reason": {"type": "string", "enum": ["hash_missing", "hash_mismatch", "prev_hash_mismatch"]}
+        }
+      },
+      "FeeQuoteRequest": {
+        "type": "object",
+        "required": ["Operation", "Id", "Delta"],
+        "additionalProperties": false,
+        "properties": {
+          "Operation": {"type": "string", "enum": ["withdrawal", "transfer"]},
+          "Id": {"type": "integer", "minimum": 1},
+          "Delta": {"type": "number"},
+          "Currency": {"$ref": "#/components/schemas/OperationCurrency"}
+        }
+      },
+      "FeeQuote": {
+        "type": "object",
+        "properties": {
+          "Operation": {"type": "string"},
+          "Id": {"type": "integer"},
+          "Amount": {"type": "number", "description": "Сумма операции в RUB"},
+          "Fee": {"type": "number", "description": "Комиссия в RUB"},
+          "Total": {"type": "number", "description": "Сумма с комиссией в RUB"},
+          "Currency": {"type": "string", "description": "Валюта операции, по которой подобрано правило комиссии"},
+          "Rate": {"type": "number", "description": "Курс Currency к RUB, по которому пересчитана сумма Delta (только для валюты, отличной от RUB)"}
+        }
+      },
+      "ScheduledTransferRequest": {
+        "type": "object",
+        "required": ["FromId", "ToId", "Delta"],
+        "additionalProperties": false,
+        "properties": {
+          "FromId": {"type": "integer", "minimum": 1},
+          "ToId": {"type": "integer", "minimum": 1},
+          "Delta": {"type": "number", "minimum": 0, "exclusiveMinimum": true},
+          "Recurrence": {"type": "string", "description": "Расписание в формате cron или @daily, @weekly, @monthly, @yearly, @hourly"},
+          "StartAt": {"type": "string", "format": "date-time"},
+          "MaxRetries": {"type": "integer", "minimum": 0},
+          "RetryIntervalSec": {"type": "integer", "minimum": 0},
+          "Active": {"type": "boolean"}
+        }
+      },
+      "ScheduledTransfer": {
+        "type": "object",
+        "properties": {
+          "Id": {"type": "integer"},
+          "FromId": {"type": "integer"},
+          "ToId": {"type": "integer"},
+          "Delta": {"type": "number"},
+          "Recurrence": {"type": "string"},
+          "NextRunAt": {"type": "string", "format": "date-time"},
+          "Active": {"type": "boolean"},
+          "MaxRetries": {"type": "integer"},
+          "RetryIntervalSec": {"type": "integer"},
+          "RetryCount": {"type": "integer"},
+          "LastError": {"type": "string"},
+          "CreatedAt": {"type": "string", "format": "date-time"}
+        }
+      },
+      "ScheduledTransferRun": {
+        "type": "object",
+        "properties": {
+          "RunAt": {"type": "string", "format": "date-time"},
+          "Attempt": {"type": "integer"},
+          "Success": {"type": "boolean"},
+          "Message": {"type": "string"}
+        }
+      },
+      "WebhookSubscriptionRequest": {
+        "type": "object",
+        "required": ["Url"],
+        "additionalProperties": false,
+        "properties": {
+          "Url": {"type": "string", "pattern": "^https?://"},
+          "Secret": {"type": "string"}
+        }
+      },
+      "WebhookSubscription": {
+        "type": "object",
+        "properties": {
+          "Id": {"type": "integer"},
+          "Url": {"type": "string"},
+          "Secret": {"type": "string", "description": "Только в ответе на создание"},
+          "Active": {"type": "boolean"},
+          "CreatedAt": {"type": "string", "format": "date-time"}
+        }
+      },
+      "WebhookDelivery": {
+        "type": "object",
+        "properties": {
+          "Id": {"type": "integer"},
+          "EventId": {"type": "integer"},
+          "SubscriptionId": {"type": "integer"},
+          "Status": {"type": "string", "enum": ["pending", "delivered", "dead"]},
+          "Attempts": {"type": "integer"},
+          "NextAttemptAt": {"type": "string", "format": "date-time"},
+          "LastError": {"type": "string"},
+          "DeliveredAt": {"type": "string", "format": "date-time"}
+        }
+      },
+      "WebhookReplayRequest": {
+        "type": "object",
+        "required": ["Since"],
+        "additionalProperties": false,
+        "properties": {
+          "Since": {"type": "string", "format": "date-time"}
+        }
+      },
+      "WebhookReplayResult": {
+        "type": "object",
+        "properties": {
+          "Count": {"type": "integer"}
+        }
+      }
+    }
+  }
+}
+`
+
+//Spec - документ OpenAPI в формате JSON
+func Spec() []byte {
+	return []byte(specJSON)
+}
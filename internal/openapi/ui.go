@@ -0,0 +1,39 @@
+package openapi
+
+//swaggerUIVersion - версия swagger-ui-dist, файлы которой лежат в каталоге DefaultSwaggerUIDir
+const swaggerUIVersion = "3.35.0"
+
+//DefaultSwaggerUIDir - каталог с файлами swagger-ui-dist относительно корня репозитория
+const DefaultSwaggerUIDir = "internal/openapi/swagger-ui"
+
+//SwaggerUIAssets - файлы swagger-ui-dist, которые отдает сервис, и их типы содержимого
+var SwaggerUIAssets = map[string]string{
+	"swagger-ui.css":       "text/css; charset=utf-8",
+	"swagger-ui-bundle.js": "application/javascript; charset=utf-8",
+}
+
+//swaggerUIPage - страница Swagger UI, отображающая документ по адресу /openapi.json.
+//Скрипты и стили swagger-ui-dist отдает сам сервис по адресу /docs/assets
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="ru">
+<head>
+  <meta charset="utf-8">
+  <title>User balance service API</title>
+  <link rel="stylesheet" href="/docs/assets/swagger-ui.css?v=` + swaggerUIVersion + `">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="/docs/assets/swagger-ui-bundle.js?v=` + swaggerUIVersion + `"></script>
+  <script>
+    window.onload = function () {
+      window.ui = SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui"});
+    };
+  </script>
+</body>
+</html>
+`
+
+//SwaggerUI - HTML страница Swagger UI
+func SwaggerUI() []byte {
+	return []byte(swaggerUIPage)
+}
@@ -0,0 +1,383 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/i18n"
+)
+
+const refPrefix = "#/components/"
+
+//DefaultMaxBodyBytes - максимальный размер тела запроса по умолчанию
+const DefaultMaxBodyBytes = 1 << 20
+
+//muxVarPattern - переменная шаблона пути gorilla/mux вида {id:[0-9]+}
+var muxVarPattern = regexp.MustCompile(`\{([^:}]+):[^}]*\}`)
+
+//Schema - подмножество JSON Schema, используемое в описании API
+type Schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Format               string             `json:"format"`
+	Enum                 []interface{}      `json:"enum"`
+	Pattern              string             `json:"pattern"`
+	Minimum              *float64           `json:"minimum"`
+	ExclusiveMinimum     bool               `json:"exclusiveMinimum"`
+	Required             []string           `json:"required"`
+	Properties           map[string]*Schema `json:"properties"`
+	AdditionalProperties *bool              `json:"additionalProperties"`
+	Items                *Schema            `json:"items"`
+}
+
+//Parameter - параметр пути или строки запроса
+type Parameter struct {
+	Ref      string  `json:"$ref"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+//MediaType - описание тела запроса для одного типа содержимого
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+//RequestBody - описание тела запроса
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+//Operation - описание метода маршрута. Ответы не разбираются, т.к. не участвуют в проверке запросов
+type Operation struct {
+	Parameters  []Parameter  `json:"parameters"`
+	RequestBody *RequestBody `json:"requestBody"`
+}
+
+//PathItem - описание маршрута
+type PathItem struct {
+	Parameters []Parameter `json:"parameters"`
+	Get        *Operation  `json:"get"`
+	Post       *Operation  `json:"post"`
+	Put        *Operation  `json:"put"`
+	Delete     *Operation  `json:"delete"`
+}
+
+//Document - документ OpenAPI
+type Document struct {
+	Paths      map[string]*PathItem `json:"paths"`
+	Components struct {
+		Parameters map[string]*Parameter `json:"parameters"`
+		Schemas    map[string]*Schema    `json:"schemas"`
+	} `json:"components"`
+}
+
+//ValidationError - несоответствие запроса описанию API. Key - ключ сообщения каталога i18n, Args - его аргументы
+type ValidationError struct {
+	Field string
+	Key   string
+	Args  []interface{}
+}
+
+//Message - описание ошибки на языке lang
+func (e *ValidationError) Message(lang string) string {
+	message := i18n.Message(lang, e.Key, e.Args...)
+	if e.Field == "" {
+		return message
+	}
+	return fmt.Sprintf("%s: %s", e.Field, message)
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message(i18n.DefaultLang)
+}
+
+//Validator - проверяет запросы по документу OpenAPI
+type Validator struct {
+	doc          *Document
+	patterns     map[string]*regexp.Regexp
+	maxBodyBytes int64
+}
+
+//NewValidator - конструктор *Validator по документу Spec()
+func NewValidator() (*Validator, error) {
+	doc := &Document{}
+	if err := json.Unmarshal(Spec(), doc); err != nil {
+		return nil, fmt.Errorf("openapi.NewValidator: %v", err)
+	}
+	v := &Validator{doc: doc, patterns: make(map[string]*regexp.Regexp), maxBodyBytes: DefaultMaxBodyBytes}
+	for _, schema := range doc.Components.Schemas {
+		if err := v.compilePatterns(schema); err != nil {
+			return nil, fmt.Errorf("openapi.NewValidator: %v", err)
+		}
+	}
+	return v, nil
+}
+
+//compilePatterns (internal) - заранее компилирует регулярные выражения pattern схемы
+func (v *Validator) compilePatterns(schema *Schema) error {
+	if schema == nil {
+		return nil
+	}
+	if schema.Pattern != "" {
+		if _, ok := v.patterns[schema.Pattern]; !ok {
+			re, err := regexp.Compile(schema.Pattern)
+			if err != nil {
+				return err
+			}
+			v.patterns[schema.Pattern] = re
+		}
+	}
+	for _, property := range schema.Properties {
+		if err := v.compilePatterns(property); err != nil {
+			return err
+		}
+	}
+	return v.compilePatterns(schema.Items)
+}
+
+//SetMaxBodyBytes - максимальный размер тела запроса. Запросы с телом большего размера отклоняются без чтения остатка
+func (v *Validator) SetMaxBodyBytes(limit int64) {
+	v.maxBodyBytes = limit
+}
+
+//HasOperation - описан ли метод method маршрута routeTemplate
+func (v *Validator) HasOperation(method, routeTemplate string) bool {
+	_, op := v.operation(method, routeTemplate)
+	return op != nil
+}
+
+//ValidateRequest - проверяет параметры и тело запроса r к маршруту routeTemplate (шаблон пути gorilla/mux).
+//Тело запроса после проверки остается доступным для чтения обработчиком. Запросы к неописанным маршрутам не проверяются
+func (v *Validator) ValidateRequest(r *http.Request, routeTemplate string, pathVars map[string]string) error {
+	item, op := v.operation(r.Method, routeTemplate)
+	if op == nil {
+		return nil
+	}
+
+	params := append(append([]Parameter{}, item.Parameters...), op.Parameters...)
+	query := r.URL.Query()
+	for _, param := range params {
+		param = v.resolveParameter(param)
+		var raw string
+		var present bool
+		switch param.In {
+		case "path":
+			raw, present = pathVars[param.Name]
+		case "query":
+			if values, ok := query[param.Name]; ok && len(values) > 0 {
+				raw, present = values[0], true
+			}
+		default:
+			continue
+		}
+		if !present {
+			if param.Required {
+				return &ValidationError{Field: param.Name, Key: i18n.ValidationMissingParam}
+			}
+			continue
+		}
+		if err := v.validateParameter(param.Name, raw, param.Schema); err != nil {
+			return err
+		}
+	}
+
+	if op.RequestBody == nil {
+		return nil
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(nil, r.Body, v.maxBodyBytes))
+	if err != nil {
+		//MaxBytesReader возвращает ошибку после чтения maxBodyBytes байт
+		if int64(len(body)) >= v.maxBodyBytes {
+			return &ValidationError{Key: i18n.ValidationBodyTooLarge, Args: []interface{}{v.maxBodyBytes}}
+		}
+		return &ValidationError{Key: i18n.ValidationBodyRead}
+	}
+	r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if len(bytes.TrimSpace(body)) == 0 {
+		if op.RequestBody.Required {
+			return &ValidationError{Key: i18n.ValidationBodyMissing}
+		}
+		return nil
+	}
+	media, ok := op.RequestBody.Content["application/json"]
+	if !ok {
+		return nil
+	}
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return &ValidationError{Key: i18n.ValidationBodyJSON}
+	}
+	return v.validateValue("", value, media.Schema)
+}
+
+//operation (internal) - поиск описания метода по шаблону пути gorilla/mux
+func (v *Validator) operation(method, routeTemplate string) (*PathItem, *Operation) {
+	item, ok := v.doc.Paths[muxVarPattern.ReplaceAllString(routeTemplate, "{$1}")]
+	if !ok {
+		return nil, nil
+	}
+	switch method {
+	case http.MethodGet:
+		return item, item.Get
+	case http.MethodPost:
+		return item, item.Post
+	case http.MethodPut:
+		return item, item.Put
+	case http.MethodDelete:
+		return item, item.Delete
+	}
+	return item, nil
+}
+
+func (v *Validator) resolveParameter(param Parameter) Parameter {
+	if strings.HasPrefix(param.Ref, refPrefix+"parameters/") {
+		if resolved, ok := v.doc.Components.Parameters[strings.TrimPrefix(param.Ref, refPrefix+"parameters/")]; ok {
+			return *resolved
+		}
+	}
+	return param
+}
+
+func (v *Validator) resolveSchema(schema *Schema) *Schema {
+	for schema != nil && schema.Ref != "" {
+		schema = v.doc.Components.Schemas[strings.TrimPrefix(schema.Ref, refPrefix+"schemas/")]
+	}
+	return schema
+}
+
+//validateParameter (internal) - приводит строковое значение параметра к типу схемы и проверяет его
+func (v *Validator) validateParameter(name, raw string, schema *Schema) error {
+	schema = v.resolveSchema(schema)
+	if schema == nil {
+		return nil
+	}
+	var value interface{} = raw
+	switch schema.Type {
+	case "integer", "number":
+		if _, err := strconv.ParseFloat(raw, 64); err != nil {
+			return &ValidationError{Field: name, Key: i18n.ValidationNumber}
+		}
+		value = json.Number(raw)
+	case "boolean":
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return &ValidationError{Field: name, Key: i18n.ValidationBoolean}
+		}
+		value = b
+	}
+	return v.validateValue(name, value, schema)
+}
+
+//validateValue (internal) - проверяет значение, полученное при разборе JSON, на соответствие схеме
+func (v *Validator) validateValue(field string, value interface{}, schema *Schema) error {
+	schema = v.resolveSchema(schema)
+	if schema == nil {
+		return nil
+	}
+	switch schema.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return &ValidationError{Field: field, Key: i18n.ValidationObject}
+		}
+		for _, name := range schema.Required {
+			if _, ok := object[name]; !ok {
+				return &ValidationError{Field: joinField(field, name), Key: i18n.ValidationMissingField}
+			}
+		}
+		for name, propertyValue := range object {
+			property, ok := schema.Properties[name]
+			if !ok {
+				if schema.AdditionalProperties != nil && !*schema.AdditionalProperties {
+					return &ValidationError{Field: joinField(field, name), Key: i18n.ValidationUnknownField}
+				}
+				continue
+			}
+			if err := v.validateValue(joinField(field, name), propertyValue, property); err != nil {
+				return err
+			}
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return &ValidationError{Field: field, Key: i18n.ValidationArray}
+		}
+		for i, item := range array {
+			if err := v.validateValue(fmt.Sprintf("%s[%d]", field, i), item, schema.Items); err != nil {
+				return err
+			}
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return &ValidationError{Field: field, Key: i18n.ValidationString}
+		}
+		if schema.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, s); err != nil {
+				return &ValidationError{Field: field, Key: i18n.ValidationDateTime}
+			}
+		}
+		if schema.Pattern != "" && !v.patterns[schema.Pattern].MatchString(s) {
+			return &ValidationError{Field: field, Key: i18n.ValidationPattern}
+		}
+	case "integer", "number":
+		n, ok := value.(json.Number)
+		if !ok {
+			return &ValidationError{Field: field, Key: i18n.ValidationNumber}
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return &ValidationError{Field: field, Key: i18n.ValidationNumber}
+		}
+		if schema.Type == "integer" && f != math.Trunc(f) {
+			return &ValidationError{Field: field, Key: i18n.ValidationInteger}
+		}
+		if schema.Minimum != nil {
+			if f < *schema.Minimum || (schema.ExclusiveMinimum && f == *schema.Minimum) {
+				key := i18n.ValidationMinimum
+				if schema.ExclusiveMinimum {
+					key = i18n.ValidationExclusiveMin
+				}
+				return &ValidationError{Field: field, Key: key, Args: []interface{}{*schema.Minimum}}
+			}
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return &ValidationError{Field: field, Key: i18n.ValidationBoolean}
+		}
+	}
+	if len(schema.Enum) > 0 && !inEnum(value, schema.Enum) {
+		return &ValidationError{Field: field, Key: i18n.ValidationEnum, Args: []interface{}{schema.Enum}}
+	}
+	return nil
+}
+
+func inEnum(value interface{}, enum []interface{}) bool {
+	for _, allowed := range enum {
+		if fmt.Sprint(allowed) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func joinField(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
@@ -0,0 +1,75 @@
+package openapi
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//TestValidateRequestBody - проверка тела запроса и сохранение тела для обработчика
+func TestValidateRequestBody(t *testing.T) {
+	v, err := NewValidator()
+	assert.NoError(t, err)
+
+	cases := []struct {
+		body    string
+		wantErr string
+	}{
+		{body: `{"Id":1,"Id2":2,"Delta":10}`, wantErr: "Id1: обязательное поле отсутствует"},
+		{body: `{"Id1":1,"Id2":2.5,"Delta":10}`, wantErr: "Id2: ожидается целое число"},
+		{body: `{"Id1":0,"Id2":2,"Delta":10}`, wantErr: "Id1: значение должно быть больше или равно 1"},
+		{body: `{"Id1":1,"Id2":2,"Delta":10,"Comment":"x"}`, wantErr: "Comment: неизвестное поле"},
+		{body: `{"Id1":1,"Id2":2`, wantErr: "тело запроса не является корректным JSON"},
+		{body: ``, wantErr: "тело запроса отсутствует"},
+		{body: `{"Id1":1,"Id2":2,"Delta":-10}`},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("POST", "/account/balance/transfer", bytes.NewReader([]byte(c.body)))
+		err := v.ValidateRequest(req, "/account/balance/transfer", nil)
+		if c.wantErr == "" {
+			assert.NoError(t, err, c.body)
+			body, _ := ioutil.ReadAll(req.Body)
+			assert.Equal(t, c.body, string(body))
+		} else if assert.Error(t, err, c.body) {
+			assert.Equal(t, c.wantErr, err.Error())
+		}
+	}
+}
+
+//TestValidateRequestBodyTooLarge - тело запроса больше допустимого размера отклоняется
+func TestValidateRequestBodyTooLarge(t *testing.T) {
+	v, err := NewValidator()
+	assert.NoError(t, err)
+	v.SetMaxBodyBytes(16)
+
+	req := httptest.NewRequest("POST", "/account/balance/transfer", bytes.NewReader([]byte(`{"Id1":1,"Id2":2,"Delta":10}`)))
+	err = v.ValidateRequest(req, "/account/balance/transfer", nil)
+	if assert.Error(t, err) {
+		assert.Equal(t, "размер тела запроса превышает 16 байт", err.Error())
+	}
+}
+
+//TestValidateRequestParameters - проверка параметров пути и строки запроса
+func TestValidateRequestParameters(t *testing.T) {
+	v, err := NewValidator()
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest("GET", "/webhooks/deliveries?status=lost", nil)
+	err = v.ValidateRequest(req, "/webhooks/deliveries", nil)
+	if assert.Error(t, err) {
+		assert.Equal(t, "status: допустимые значения: [pending delivered dead]", err.Error())
+	}
+
+	req = httptest.NewRequest("GET", "/account/balance/info/0?currency=USD", nil)
+	err = v.ValidateRequest(req, "/account/balance/info/{id:[0-9]+}", map[string]string{"id": "0"})
+	if assert.Error(t, err) {
+		assert.Equal(t, "id: значение должно быть больше или равно 1", err.Error())
+	}
+
+	req = httptest.NewRequest("GET", "/account/balance/info/1?currency=USD", nil)
+	assert.NoError(t, v.ValidateRequest(req, "/account/balance/info/{id:[0-9]+}", map[string]string{"id": "1"}))
+	assert.False(t, v.HasOperation("PATCH", "/account/balance/info/{id:[0-9]+}"))
+}
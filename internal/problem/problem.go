@@ -0,0 +1,84 @@
+package problem
+
+import (
+	"net/http"
+
+	"github.com/call-me-snake/user_balance_service/internal/i18n"
+	"github.com/call-me-snake/user_balance_service/internal/model"
+)
+
+//ContentType - тип содержимого ответа с ошибкой (RFC 7807)
+const ContentType = "application/problem+json"
+
+//TypePrefix - префикс идентификатора типа ошибки. Идентификатор типа - TypePrefix + код ошибки
+const TypePrefix = "urn:user-balance-service:problem:"
+
+//statuses - HTTP статус ответа для каждого кода ошибки каталога model.ErrorCode
+var statuses = map[model.ErrorCode]int{
+	model.DefaultErrCode:        http.StatusInternalServerError,
+	model.WrongInputParamsCode:  http.StatusBadRequest,
+	model.ValidationFailedCode:  http.StatusBadRequest,
+	model.ZeroAmountCode:        http.StatusBadRequest,
+	model.SameAccountsCode:      http.StatusBadRequest,
+	model.InsufficientFundsCode: http.StatusForbidden,
+	model.RateUnavailableCode:   http.StatusInternalServerError,
+	model.NotFoundCode:          http.StatusNotFound,
+	model.HistoryNotFoundCode:   http.StatusNotFound,
+	model.ScheduleNotFoundCode:  http.StatusNotFound,
+	model.WebhookNotFoundCode:   http.StatusNotFound,
+	model.RateLimitedCode:       http.StatusTooManyRequests,
+	model.UnavailableCode:       http.StatusServiceUnavailable,
+	model.AccountFrozenCode:     http.StatusConflict,
+	model.ForbiddenCode:         http.StatusForbidden,
+	model.AlreadyReversedCode:   http.StatusConflict,
+	model.NotSubAccountCode:     http.StatusConflict,
+}
+
+//FieldError - ошибка проверки отдельного поля или параметра запроса
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+//Problem - описание ошибки в формате RFC 7807. Code - код ошибки из каталога model.ErrorCode
+type Problem struct {
+	Type   string          `json:"type"`
+	Title  string          `json:"title"`
+	Status int             `json:"status"`
+	Detail string          `json:"detail,omitempty"`
+	Code   model.ErrorCode `json:"code"`
+	Errors []FieldError    `json:"errors,omitempty"`
+}
+
+//New - описание ошибки с кодом code и пояснением detail. Заголовок формируется на языке lang.
+//Неизвестные коды описываются как внутренняя ошибка
+func New(lang string, code model.ErrorCode, detail string) *Problem {
+	status, ok := statuses[code]
+	if !ok {
+		code, status = model.DefaultErrCode, http.StatusInternalServerError
+	}
+	return &Problem{
+		Type:   TypePrefix + string(code),
+		Title:  i18n.ProblemTitle(lang, string(code)),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+//Status - HTTP статус ответа для кода ошибки code
+func Status(code model.ErrorCode) int {
+	if status, ok := statuses[code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+//Codes - все коды ошибок каталога
+func Codes() []model.ErrorCode {
+	codes := make([]model.ErrorCode, 0, len(statuses))
+	for code := range statuses {
+		codes = append(codes, code)
+	}
+	return codes
+}
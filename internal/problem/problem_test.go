@@ -0,0 +1,34 @@
+package problem
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/call-me-snake/user_balance_service/internal/i18n"
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+//TestTitles - у каждого кода каталога есть заголовок на всех поддерживаемых языках
+func TestTitles(t *testing.T) {
+	for _, code := range Codes() {
+		for _, lang := range []string{i18n.Ru, i18n.En} {
+			p := New(lang, code, "")
+			assert.NotEqual(t, "problem_"+string(code), p.Title, "%s/%s", lang, code)
+			assert.Equal(t, TypePrefix+string(code), p.Type)
+		}
+	}
+}
+
+//TestNew - статус ответа определяется кодом, неизвестные коды описываются как внутренняя ошибка
+func TestNew(t *testing.T) {
+	p := New(i18n.En, model.InsufficientFundsCode, "details")
+	assert.Equal(t, http.StatusForbidden, p.Status)
+	assert.Equal(t, "Insufficient funds", p.Title)
+	assert.Equal(t, "details", p.Detail)
+
+	p = New(i18n.Ru, model.ErrorCode("unknown"), "")
+	assert.Equal(t, model.DefaultErrCode, p.Code)
+	assert.Equal(t, http.StatusInternalServerError, p.Status)
+	assert.Equal(t, http.StatusNotFound, Status(model.ScheduleNotFoundCode))
+}
@@ -0,0 +1,273 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	"github.com/labstack/gommon/log"
+)
+
+//AnyRoute - ключ конфигурации, ограничения которого действуют на маршруты без собственных ограничений
+const AnyRoute = "*"
+
+//DefaultConfig - ограничения по умолчанию (формат описан в ParseConfig)
+const DefaultConfig = "* client=50/1s:100; POST /account/balance/change account=5/1s:10; " +
+	"POST /account/balance/transfer client=10/1s:20 account=5/1s:10"
+
+//Rule - ограничение частоты запросов: Rate токенов в секунду, не более Burst токенов в корзине.
+//Нулевое правило ничего не ограничивает
+type Rule struct {
+	Rate  float64
+	Burst int
+}
+
+//Enabled - задано ли ограничение
+func (r Rule) Enabled() bool {
+	return r.Rate > 0 && r.Burst > 0
+}
+
+//RouteRule - ограничения маршрута для отдельного клиента API и для отдельного аккаунта
+type RouteRule struct {
+	Client  Rule
+	Account Rule
+}
+
+//Config - ограничения по маршрутам. Ключ - "МЕТОД шаблон_пути" (шаблон пути gorilla/mux) или AnyRoute
+type Config map[string]RouteRule
+
+//ParseConfig - разбор ограничений из строки вида
+//"* client=50/1s:100; POST /account/balance/transfer client=10/1s:20 account=5/1s:10".
+//Правило N/период:burst разрешает N запросов за период с накоплением не более burst запросов (по умолчанию burst = N)
+func ParseConfig(s string) (Config, error) {
+	config := Config{}
+	for _, entry := range strings.Split(s, ";") {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+		route := fields[0]
+		fields = fields[1:]
+		if route != AnyRoute {
+			if len(fields) == 0 {
+				return nil, fmt.Errorf("ratelimit.ParseConfig: не указан путь маршрута %s", route)
+			}
+			route = strings.ToUpper(route) + " " + fields[0]
+			fields = fields[1:]
+		}
+		routeRule := RouteRule{}
+		for _, field := range fields {
+			parts := strings.SplitN(field, "=", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("ratelimit.ParseConfig: некорректное ограничение %q", field)
+			}
+			rule, err := parseRule(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("ratelimit.ParseConfig: %s: %v", route, err)
+			}
+			switch parts[0] {
+			case "client":
+				routeRule.Client = rule
+			case "account":
+				routeRule.Account = rule
+			default:
+				return nil, fmt.Errorf("ratelimit.ParseConfig: неизвестный ключ ограничения %q", parts[0])
+			}
+		}
+		config[route] = routeRule
+	}
+	return config, nil
+}
+
+//parseRule (internal) - разбор правила вида N/период:burst
+func parseRule(s string) (Rule, error) {
+	burst := ""
+	if i := strings.Index(s, ":"); i >= 0 {
+		s, burst = s[:i], s[i+1:]
+	}
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 {
+		return Rule{}, fmt.Errorf("некорректное правило %q", s)
+	}
+	count, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil || count <= 0 {
+		return Rule{}, fmt.Errorf("некорректное количество запросов %q", parts[0])
+	}
+	period, err := time.ParseDuration(parts[1])
+	if err != nil || period <= 0 {
+		return Rule{}, fmt.Errorf("некорректный период %q", parts[1])
+	}
+	rule := Rule{Rate: count / period.Seconds(), Burst: int(math.Ceil(count))}
+	if burst != "" {
+		if rule.Burst, err = strconv.Atoi(burst); err != nil || rule.Burst <= 0 {
+			return Rule{}, fmt.Errorf("некорректный размер корзины %q", burst)
+		}
+	}
+	return rule, nil
+}
+
+//Route - ограничения маршрута method template и ключ конфигурации, по которому они найдены
+func (c Config) Route(method, template string) (key string, rule RouteRule, ok bool) {
+	key = method + " " + template
+	if rule, ok = c[key]; ok {
+		return key, rule, true
+	}
+	rule, ok = c[AnyRoute]
+	return AnyRoute, rule, ok
+}
+
+//MaxRefill - наибольшее время заполнения пустой корзины среди ограничений конфигурации
+func (c Config) MaxRefill() time.Duration {
+	var refill time.Duration
+	for _, routeRule := range c {
+		for _, rule := range []Rule{routeRule.Client, routeRule.Account} {
+			if !rule.Enabled() {
+				continue
+			}
+			if d := time.Duration(math.Ceil(float64(rule.Burst) / rule.Rate * float64(time.Second))); d > refill {
+				refill = d
+			}
+		}
+	}
+	return refill
+}
+
+//Backend - хранилище корзин токенов
+type Backend interface {
+	//Take - списание токена из корзины key. Возвращает 0, если токен списан, иначе время до появления токена
+	Take(key string, rule Rule, now time.Time) (retryAfter time.Duration, err error)
+}
+
+//sweepEvery - через сколько списаний memoryBackend удаляет заполнившиеся корзины
+const sweepEvery = 10000
+
+type memoryBackend struct {
+	mutex   sync.Mutex
+	buckets map[string]*bucketState
+	takes   int
+}
+
+type bucketState struct {
+	model.RateLimitBucket
+	rule Rule
+}
+
+//NewMemoryBackend - корзины хранятся в памяти процесса. Подходит для сервиса, развернутого в одном экземпляре
+func NewMemoryBackend() Backend {
+	return &memoryBackend{buckets: make(map[string]*bucketState)}
+}
+
+//Take - реализует метод интерфейса Backend
+func (m *memoryBackend) Take(key string, rule Rule, now time.Time) (time.Duration, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.takes++
+	if m.takes%sweepEvery == 0 {
+		m.sweep(now)
+	}
+	bucket, ok := m.buckets[key]
+	if !ok {
+		bucket = &bucketState{RateLimitBucket: model.RateLimitBucket{Key: key, Tokens: float64(rule.Burst), UpdatedAt: now}}
+		m.buckets[key] = bucket
+	}
+	bucket.rule = rule
+	return bucket.Take(rule.Rate, rule.Burst, now), nil
+}
+
+//sweep (internal) - удаляет корзины, которые успели заполниться: они не отличаются от новых
+func (m *memoryBackend) sweep(now time.Time) {
+	for key, bucket := range m.buckets {
+		if bucket.Tokens+now.Sub(bucket.UpdatedAt).Seconds()*bucket.rule.Rate >= float64(bucket.rule.Burst) {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+//storageSweepInterval - как часто storageBackend удаляет заполнившиеся корзины из базы данных
+const storageSweepInterval = time.Minute
+
+type storageBackend struct {
+	accStorage model.IBalanceInfoStorage
+	//refill - время заполнения пустой корзины самого медленного ограничения конфигурации
+	refill time.Duration
+
+	mutex     sync.Mutex
+	lastSweep time.Time
+}
+
+//NewStorageBackend - корзины хранятся в базе данных и разделяются всеми экземплярами сервиса.
+//Корзины, не изменявшиеся дольше времени заполнения самого медленного ограничения config, удаляются раз в storageSweepInterval
+func NewStorageBackend(accStorage model.IBalanceInfoStorage, config Config) Backend {
+	return &storageBackend{accStorage: accStorage, refill: config.MaxRefill()}
+}
+
+//Take - реализует метод интерфейса Backend
+func (s *storageBackend) Take(key string, rule Rule, now time.Time) (time.Duration, error) {
+	if s.sweepDue(now) {
+		//корзина, не изменявшаяся дольше refill, заполнилась и не отличается от новой
+		if _, custErr := s.accStorage.DeleteRateLimitBuckets(now.Add(-s.refill)); custErr != nil {
+			log.Print(custErr.Err.Error())
+		}
+	}
+	retryAfter, custErr := s.accStorage.TakeRateLimitToken(key, rule.Rate, rule.Burst, now)
+	if custErr != nil {
+		return 0, custErr.Err
+	}
+	return retryAfter, nil
+}
+
+//sweepDue (internal) - пора ли удалять заполнившиеся корзины
+func (s *storageBackend) sweepDue(now time.Time) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.lastSweep.IsZero() && now.Sub(s.lastSweep) < storageSweepInterval {
+		return false
+	}
+	s.lastSweep = now
+	return true
+}
+
+//Limiter - проверяет ограничения частоты запросов
+type Limiter struct {
+	config  Config
+	backend Backend
+	now     func() time.Time
+}
+
+//NewLimiter - конструктор *Limiter
+func NewLimiter(config Config, backend Backend) *Limiter {
+	return &Limiter{config: config, backend: backend, now: time.Now}
+}
+
+//Allow - списывает токены клиента client и аккаунта accountId (0 - аккаунт не известен) для маршрута method template.
+//Возвращает 0, если запрос разрешен, иначе время, через которое его можно повторить.
+//При недоступности хранилища корзин запрос разрешается
+func (l *Limiter) Allow(method, template, client string, accountId int) time.Duration {
+	key, rule, ok := l.config.Route(method, template)
+	if !ok {
+		return 0
+	}
+	now := l.now()
+	if rule.Client.Enabled() && client != "" {
+		if retryAfter := l.take(fmt.Sprintf("client:%s:%s", key, client), rule.Client, now); retryAfter > 0 {
+			return retryAfter
+		}
+	}
+	if rule.Account.Enabled() && accountId != 0 {
+		return l.take(fmt.Sprintf("account:%s:%d", key, accountId), rule.Account, now)
+	}
+	return 0
+}
+
+func (l *Limiter) take(key string, rule Rule, now time.Time) time.Duration {
+	retryAfter, err := l.backend.Take(key, rule, now)
+	if err != nil {
+		log.Print(err.Error())
+		return 0
+	}
+	return retryAfter
+}
@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	mock_model "github.com/call-me-snake/user_balance_service/internal/model/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+//TestParseConfig - разбор ограничений по маршрутам
+func TestParseConfig(t *testing.T) {
+	config, err := ParseConfig(DefaultConfig)
+	assert.NoError(t, err)
+	assert.Equal(t, RouteRule{Client: Rule{Rate: 50, Burst: 100}}, config[AnyRoute])
+	assert.Equal(t, RouteRule{Client: Rule{Rate: 10, Burst: 20}, Account: Rule{Rate: 5, Burst: 10}},
+		config["POST /account/balance/transfer"])
+
+	config, err = ParseConfig("get /account/balance/info/{id:[0-9]+} account=30/1m")
+	assert.NoError(t, err)
+	assert.Equal(t, Rule{Rate: 0.5, Burst: 30}, config["GET /account/balance/info/{id:[0-9]+}"].Account)
+
+	for _, wrong := range []string{"POST", "* client=10", "* client=0/1s", "* client=1/1s:x", "* user=1/1s"} {
+		_, err = ParseConfig(wrong)
+		assert.Error(t, err, wrong)
+	}
+}
+
+//TestLimiter - корзины клиента и аккаунта независимы, токены восполняются со временем
+func TestLimiter(t *testing.T) {
+	config, _ := ParseConfig("* client=2/1s; POST /transfer account=1/1s")
+	limiter := NewLimiter(config, NewMemoryBackend())
+	now := time.Date(2020, 9, 21, 0, 0, 0, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+
+	assert.Equal(t, time.Duration(0), limiter.Allow("GET", "/info", "10.0.0.1", 0))
+	assert.Equal(t, time.Duration(0), limiter.Allow("GET", "/history", "10.0.0.1", 0))
+	assert.Equal(t, 500*time.Millisecond, limiter.Allow("GET", "/info", "10.0.0.1", 0))
+	assert.Equal(t, time.Duration(0), limiter.Allow("GET", "/info", "10.0.0.2", 0))
+
+	assert.Equal(t, time.Duration(0), limiter.Allow("POST", "/transfer", "10.0.0.1", 1))
+	assert.Equal(t, time.Second, limiter.Allow("POST", "/transfer", "10.0.0.2", 1))
+	assert.Equal(t, time.Duration(0), limiter.Allow("POST", "/transfer", "10.0.0.2", 2))
+
+	now = now.Add(time.Second)
+	assert.Equal(t, time.Duration(0), limiter.Allow("POST", "/transfer", "10.0.0.2", 1))
+	assert.Equal(t, time.Duration(0), limiter.Allow("GET", "/info", "10.0.0.1", 0))
+}
+
+//TestStorageBackend - при ошибке хранилища корзин запрос разрешается
+func TestStorageBackend(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	accStorage := mock_model.NewMockIBalanceInfoStorage(mockCtrl)
+	now := time.Now()
+	accStorage.EXPECT().DeleteRateLimitBuckets(now.Add(-time.Second)).Return(int64(0), nil)
+	accStorage.EXPECT().TakeRateLimitToken("account:POST /transfer:1", 1.0, 1, now).Return(time.Second, nil)
+	accStorage.EXPECT().TakeRateLimitToken("account:POST /transfer:1", 1.0, 1, now).
+		Return(time.Duration(0), &model.CustomErr{Err: errors.New("Ошибка"), ErrCode: model.DefaultErrCode})
+
+	config, _ := ParseConfig("POST /transfer account=1/1s")
+	limiter := NewLimiter(config, NewStorageBackend(accStorage, config))
+	limiter.now = func() time.Time { return now }
+	assert.Equal(t, time.Second, limiter.Allow("POST", "/transfer", "", 1))
+	assert.Equal(t, time.Duration(0), limiter.Allow("POST", "/transfer", "", 1))
+	assert.Equal(t, time.Duration(0), limiter.Allow("GET", "/info", "", 1))
+}
+
+//TestStorageBackendSweep - заполнившиеся корзины удаляются не чаще раза в storageSweepInterval
+func TestStorageBackendSweep(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	accStorage := mock_model.NewMockIBalanceInfoStorage(mockCtrl)
+	now := time.Now()
+	config, _ := ParseConfig("* client=50/1s:100; POST /transfer account=1/1m")
+	assert.Equal(t, time.Minute, config.MaxRefill())
+
+	accStorage.EXPECT().DeleteRateLimitBuckets(now.Add(-time.Minute)).Return(int64(3), nil)
+	accStorage.EXPECT().DeleteRateLimitBuckets(now.Add(storageSweepInterval-time.Minute)).
+		Return(int64(0), &model.CustomErr{Err: errors.New("Ошибка"), ErrCode: model.DefaultErrCode})
+	accStorage.EXPECT().TakeRateLimitToken("client:*:10.0.0.1", 50.0, 100, gomock.Any()).Return(time.Duration(0), nil).Times(3)
+
+	limiter := NewLimiter(config, NewStorageBackend(accStorage, config))
+	limiter.now = func() time.Time { return now }
+	assert.Equal(t, time.Duration(0), limiter.Allow("GET", "/info", "10.0.0.1", 0))
+	limiter.now = func() time.Time { return now.Add(storageSweepInterval / 2) }
+	assert.Equal(t, time.Duration(0), limiter.Allow("GET", "/info", "10.0.0.1", 0))
+	limiter.now = func() time.Time { return now.Add(storageSweepInterval) }
+	assert.Equal(t, time.Duration(0), limiter.Allow("GET", "/info", "10.0.0.1", 0))
+}
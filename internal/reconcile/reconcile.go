@@ -0,0 +1,57 @@
+package reconcile
+
+import (
+	"log"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/model"
+)
+
+//Job - сверка балансов аккаунтов с историей операций: баланс должен быть равен сумме изменений истории
+//и остатку последней записи истории, а остаток каждой записи - остатку предыдущей записи плюс изменение
+type Job struct {
+	accStorage model.IBalanceInfoStorage
+	interval   time.Duration
+}
+
+//NewJob - конструктор *Job. interval - период между сверками при периодическом запуске
+func NewJob(accStorage model.IBalanceInfoStorage, interval time.Duration) *Job {
+	return &Job{accStorage: accStorage, interval: interval}
+}
+
+//Start - запускает периодическую сверку в отдельной горутине. При нулевом interval сверка не запускается
+func (j *Job) Start() {
+	if j.interval <= 0 {
+		return
+	}
+	go func() {
+		for {
+			time.Sleep(j.interval)
+			j.RunOnce(time.Now())
+		}
+	}()
+}
+
+//RunOnce - выполняет сверку, начатую в момент now, и сохраняет ее результат
+func (j *Job) RunOnce(now time.Time) (*model.ReconciliationRun, *model.CustomErr) {
+	checked, discrepancies, custErr := j.accStorage.FindLedgerDiscrepancies()
+	if custErr != nil {
+		log.Printf("reconcile.RunOnce: %s", custErr.Err.Error())
+		return nil, custErr
+	}
+	run := &model.ReconciliationRun{
+		StartedAt:        now,
+		FinishedAt:       time.Now(),
+		AccountsChecked:  checked,
+		DiscrepancyCount: len(discrepancies),
+		Discrepancies:    discrepancies,
+	}
+	if custErr = j.accStorage.SaveReconciliationRun(run); custErr != nil {
+		log.Printf("reconcile.RunOnce: %s", custErr.Err.Error())
+		return nil, custErr
+	}
+	if run.DiscrepancyCount > 0 {
+		log.Printf("reconcile.RunOnce: проверено аккаунтов: %d, найдено расхождений: %d", run.AccountsChecked, run.DiscrepancyCount)
+	}
+	return run, nil
+}
@@ -0,0 +1,47 @@
+package reconcile
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	mock_model "github.com/call-me-snake/user_balance_service/internal/model/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+//TestRunOnce - результат сверки с расхождениями сохраняется
+func TestRunOnce(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	accStorage := mock_model.NewMockIBalanceInfoStorage(mockCtrl)
+	discrepancies := []model.LedgerDiscrepancy{
+		{AccountId: 1, Kind: model.DiscrepancyBalance, Expected: 100, Actual: 150},
+	}
+	started := time.Date(2020, 9, 21, 12, 0, 0, 0, time.UTC)
+	accStorage.EXPECT().FindLedgerDiscrepancies().Return(3, discrepancies, nil)
+	accStorage.EXPECT().SaveReconciliationRun(gomock.Any()).DoAndReturn(func(run *model.ReconciliationRun) *model.CustomErr {
+		assert.Equal(t, started, run.StartedAt)
+		assert.Equal(t, 3, run.AccountsChecked)
+		assert.Equal(t, 1, run.DiscrepancyCount)
+		assert.Equal(t, discrepancies, run.Discrepancies)
+		run.Id = 7
+		return nil
+	})
+	run, custErr := NewJob(accStorage, 0).RunOnce(started)
+	assert.Nil(t, custErr)
+	assert.Equal(t, int64(7), run.Id)
+}
+
+//TestRunOnceStorageError - при ошибке сверки результат не сохраняется
+func TestRunOnceStorageError(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	accStorage := mock_model.NewMockIBalanceInfoStorage(mockCtrl)
+	accStorage.EXPECT().FindLedgerDiscrepancies().
+		Return(0, nil, &model.CustomErr{Err: errors.New("Ошибка"), ErrCode: model.DefaultErrCode})
+	run, custErr := NewJob(accStorage, 0).RunOnce(time.Now())
+	assert.Nil(t, run)
+	assert.Equal(t, model.DefaultErrCode, custErr.ErrCode)
+}
@@ -0,0 +1,144 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//maxSearchYears - глубина поиска следующего времени выполнения. Выражения, которые не срабатывают за этот период
+//(например, "0 0 31 2 *"), считаются некорректными
+const maxSearchYears = 5
+
+//descriptors - календарные сокращения расписаний
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+//Recurrence - разобранное расписание в формате cron из пяти полей: минута, час, день месяца, месяц, день недели
+type Recurrence struct {
+	minute, hour, dom, month, dow uint64
+	//domAny, dowAny - поля "день месяца" и "день недели" заданы как "*".
+	//Если ограничены оба поля, срабатывание происходит при совпадении любого из них (как в cron)
+	domAny, dowAny bool
+}
+
+//ParseRecurrence - разбирает расписание в формате cron ("0 9 1 * *" - в 9:00 первого числа каждого месяца)
+//или календарное сокращение (@daily, @weekly, @monthly, @yearly, @hourly)
+func ParseRecurrence(expr string) (*Recurrence, error) {
+	expr = strings.TrimSpace(expr)
+	if d, ok := descriptors[expr]; ok {
+		expr = d
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("scheduler.ParseRecurrence: ожидается 5 полей, получено %d: %q", len(fields), expr)
+	}
+	r := &Recurrence{}
+	var err error
+	bounds := []struct {
+		dst      *uint64
+		min, max int
+	}{
+		{&r.minute, 0, 59},
+		{&r.hour, 0, 23},
+		{&r.dom, 1, 31},
+		{&r.month, 1, 12},
+		{&r.dow, 0, 7},
+	}
+	for i, b := range bounds {
+		if *b.dst, err = parseField(fields[i], b.min, b.max); err != nil {
+			return nil, fmt.Errorf("scheduler.ParseRecurrence: поле %d: %v", i+1, err)
+		}
+	}
+	//воскресенье может быть задано как 0 или 7
+	if r.dow&(1<<7) != 0 {
+		r.dow |= 1
+	}
+	r.domAny, r.dowAny = fields[2] == "*", fields[4] == "*"
+	if r.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("scheduler.ParseRecurrence: расписание %q никогда не срабатывает", expr)
+	}
+	return r, nil
+}
+
+//parseField (internal) - разбирает поле cron (списки через запятую, диапазоны a-b, шаг */n и a-b/n) в битовую маску
+func parseField(field string, min, max int) (uint64, error) {
+	var mask uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("некорректный шаг %q", part)
+			}
+			part = part[:i]
+		}
+		from, to := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if from, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("некорректное значение %q", part)
+			}
+			to = from
+			if len(bounds) == 2 {
+				if to, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("некорректное значение %q", part)
+				}
+			} else if step > 1 {
+				to = max
+			}
+		}
+		if from < min || to > max || from > to {
+			return 0, fmt.Errorf("значение %q вне диапазона %d-%d", part, min, max)
+		}
+		for v := from; v <= to; v += step {
+			mask |= 1 << uint(v)
+		}
+	}
+	return mask, nil
+}
+
+//Next - возвращает ближайшее время срабатывания строго после t (с точностью до минуты).
+//Возвращает нулевое время, если срабатывание не найдено за maxSearchYears лет
+func (r *Recurrence) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(maxSearchYears, 0, 0)
+	for t.Before(limit) {
+		if r.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !r.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if r.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if r.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+//dayMatches (internal) - проверка совпадения дня с полями "день месяца" и "день недели"
+func (r *Recurrence) dayMatches(t time.Time) bool {
+	domMatch := r.dom&(1<<uint(t.Day())) != 0
+	dowMatch := r.dow&(1<<uint(t.Weekday())) != 0
+	if r.domAny || r.dowAny {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
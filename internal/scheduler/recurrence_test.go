@@ -0,0 +1,56 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testNow = time.Date(2020, 9, 21, 18, 45, 30, 0, time.UTC)
+
+//TestNextMonthly - тест расчета следующего выполнения для ежемесячного расписания
+func TestNextMonthly(t *testing.T) {
+	r, err := ParseRecurrence("0 9 1 * *")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2020, 10, 1, 9, 0, 0, 0, time.UTC), r.Next(testNow))
+	assert.Equal(t, time.Date(2020, 11, 1, 9, 0, 0, 0, time.UTC), r.Next(time.Date(2020, 10, 1, 9, 0, 0, 0, time.UTC)))
+}
+
+//TestNextDescriptors - тест календарных сокращений
+func TestNextDescriptors(t *testing.T) {
+	r, err := ParseRecurrence("@daily")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2020, 9, 22, 0, 0, 0, 0, time.UTC), r.Next(testNow))
+
+	r, err = ParseRecurrence("@weekly")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2020, 9, 27, 0, 0, 0, 0, time.UTC), r.Next(testNow))
+
+	r, err = ParseRecurrence("@yearly")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), r.Next(testNow))
+}
+
+//TestNextStepsAndLists - тест шагов, диапазонов и списков
+func TestNextStepsAndLists(t *testing.T) {
+	r, err := ParseRecurrence("*/15 10-12 * * 1-5")
+	assert.Nil(t, err)
+	//21.09.2020 - понедельник, после 18:45 ближайшее время - вторник 10:00
+	assert.Equal(t, time.Date(2020, 9, 22, 10, 0, 0, 0, time.UTC), r.Next(testNow))
+	assert.Equal(t, time.Date(2020, 9, 22, 10, 15, 0, 0, time.UTC), r.Next(time.Date(2020, 9, 22, 10, 0, 0, 0, time.UTC)))
+
+	r, err = ParseRecurrence("30 8 15,28 * 7")
+	assert.Nil(t, err)
+	//день месяца и день недели ограничены оба - срабатывает при совпадении любого из них
+	assert.Equal(t, time.Date(2020, 9, 27, 8, 30, 0, 0, time.UTC), r.Next(testNow))
+	assert.Equal(t, time.Date(2020, 9, 28, 8, 30, 0, 0, time.UTC), r.Next(time.Date(2020, 9, 27, 8, 30, 0, 0, time.UTC)))
+}
+
+//TestParseRecurrenceFail - тест некорректных расписаний
+func TestParseRecurrenceFail(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "a * * * *", "0 0 31 2 *"} {
+		_, err := ParseRecurrence(expr)
+		assert.Error(t, err, expr)
+	}
+}
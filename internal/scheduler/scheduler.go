@@ -0,0 +1,101 @@
+package scheduler
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/model"
+)
+
+//claimLease - время блокировки выбранного для выполнения перевода
+const claimLease = time.Minute
+
+//batchSize - максимальное количество переводов, выполняемых за один проход
+const batchSize = 100
+
+//Runner - выполняет запланированные переводы, время которых наступило
+type Runner struct {
+	accStorage model.IBalanceInfoStorage
+	interval   time.Duration
+}
+
+//NewRunner - конструктор *Runner. interval - период проверки наступивших переводов
+func NewRunner(accStorage model.IBalanceInfoStorage, interval time.Duration) *Runner {
+	return &Runner{accStorage: accStorage, interval: interval}
+}
+
+//Start - запускает периодическое выполнение переводов в отдельной горутине
+func (r *Runner) Start() {
+	go func() {
+		for {
+			r.RunDue(time.Now())
+			time.Sleep(r.interval)
+		}
+	}()
+}
+
+//RunDue - выполняет все переводы, время которых наступило к моменту now
+func (r *Runner) RunDue(now time.Time) {
+	for {
+		schedules, custErr := r.accStorage.ClaimDueScheduledTransfers(now, claimLease, batchSize)
+		if custErr != nil {
+			log.Printf("scheduler.RunDue: %s", custErr.Err.Error())
+			return
+		}
+		for i := range schedules {
+			r.execute(&schedules[i], now)
+		}
+		if len(schedules) < batchSize {
+			return
+		}
+	}
+}
+
+//execute (internal) - выполняет перевод, сохраняет результат и рассчитывает время следующего выполнения.
+//Успешный перевод сохраняется вместе с результатом и новым состоянием расписания в одной транзакции
+func (r *Runner) execute(claimed *model.ScheduledTransfer, now time.Time) {
+	run := &model.ScheduledTransferRun{RunAt: now, Attempt: claimed.RetryCount + 1}
+	next := *claimed
+	next.RetryCount = 0
+	next.LastError = ""
+	scheduleNextRun(&next, now)
+	result, custErr := r.accStorage.ExecuteScheduledTransfer(claimed, &next, run)
+	if custErr == nil {
+		if result == nil {
+			log.Printf("scheduler.execute: запланированный перевод %d изменен или удален до выполнения", claimed.Id)
+		}
+		return
+	}
+
+	next = *claimed
+	run.Message = custErr.Err.Error()
+	next.LastError = run.Message
+	if next.RetryCount < next.MaxRetries {
+		next.RetryCount++
+		next.NextRunAt = now.Add(time.Duration(next.RetryIntervalSec) * time.Second)
+	} else {
+		//попытки исчерпаны - перевод пропускается до следующего выполнения по расписанию
+		next.RetryCount = 0
+		scheduleNextRun(&next, now)
+	}
+	if custErr := r.accStorage.SaveScheduledTransferRun(claimed, &next, run); custErr != nil {
+		log.Printf("scheduler.execute: %s", custErr.Err.Error())
+	}
+}
+
+//scheduleNextRun (internal) - переводит расписание на следующее выполнение после now.
+//Разовые переводы и переводы с некорректным расписанием деактивируются
+func scheduleNextRun(schedule *model.ScheduledTransfer, now time.Time) {
+	if schedule.Recurrence == "" {
+		schedule.Active = false
+		return
+	}
+	recurrence, err := ParseRecurrence(schedule.Recurrence)
+	if err != nil {
+		schedule.Active = false
+		schedule.LastError = fmt.Sprintf("scheduler.scheduleNextRun: %v", err)
+		return
+	}
+	schedule.NextRunAt = recurrence.Next(now)
+}
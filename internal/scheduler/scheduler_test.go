@@ -0,0 +1,76 @@
+package scheduler
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	mock_model "github.com/call-me-snake/user_balance_service/internal/model/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+//TestRunDueSuccess - тест успешного выполнения периодического перевода
+func TestRunDueSuccess(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	schedule := model.ScheduledTransfer{Id: 1, FromId: 1, ToId: 2, Delta: 5000, Recurrence: "0 9 1 * *", NextRunAt: testNow, Active: true}
+	mockdb := mock_model.NewMockIBalanceInfoStorage(ctrl)
+	mockdb.EXPECT().ClaimDueScheduledTransfers(testNow, claimLease, batchSize).Return([]model.ScheduledTransfer{schedule}, nil)
+	mockdb.EXPECT().ExecuteScheduledTransfer(&schedule, gomock.Any(), gomock.Any()).DoAndReturn(
+		func(claimed, next *model.ScheduledTransfer, run *model.ScheduledTransferRun) (*model.OperationResult, *model.CustomErr) {
+			assert.Equal(t, 1, run.Attempt)
+			assert.True(t, next.Active)
+			assert.Equal(t, time.Date(2020, 10, 1, 9, 0, 0, 0, time.UTC), next.NextRunAt)
+			assert.Equal(t, testNow, claimed.NextRunAt)
+			return &model.OperationResult{}, nil
+		})
+
+	NewRunner(mockdb, time.Minute).RunDue(testNow)
+}
+
+//TestRunDueRetry - тест повтора перевода после ошибки и отказа от повтора после исчерпания попыток
+func TestRunDueRetry(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	schedule := model.ScheduledTransfer{Id: 1, FromId: 1, ToId: 2, Delta: 5000, NextRunAt: testNow, Active: true, MaxRetries: 1, RetryIntervalSec: 60}
+	insufficientFunds := &model.CustomErr{Err: errors.New("Недостаточно средств"), ErrCode: model.InsufficientFundsCode}
+	mockdb := mock_model.NewMockIBalanceInfoStorage(ctrl)
+	mockdb.EXPECT().ExecuteScheduledTransfer(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, insufficientFunds).Times(2)
+
+	mockdb.EXPECT().ClaimDueScheduledTransfers(testNow, claimLease, batchSize).Return([]model.ScheduledTransfer{schedule}, nil)
+	mockdb.EXPECT().SaveScheduledTransferRun(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(claimed, saved *model.ScheduledTransfer, run *model.ScheduledTransferRun) *model.CustomErr {
+			assert.False(t, run.Success)
+			assert.Equal(t, 1, saved.RetryCount)
+			assert.True(t, saved.Active)
+			assert.Equal(t, testNow.Add(time.Minute), saved.NextRunAt)
+			schedule = *saved
+			return nil
+		})
+	NewRunner(mockdb, time.Minute).RunDue(testNow)
+
+	retryTime := testNow.Add(time.Minute)
+	mockdb.EXPECT().ClaimDueScheduledTransfers(retryTime, claimLease, batchSize).Return([]model.ScheduledTransfer{schedule}, nil)
+	mockdb.EXPECT().SaveScheduledTransferRun(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(claimed, saved *model.ScheduledTransfer, run *model.ScheduledTransferRun) *model.CustomErr {
+			assert.Equal(t, 2, run.Attempt)
+			assert.False(t, saved.Active)
+			assert.Equal(t, insufficientFunds.Err.Error(), saved.LastError)
+			return nil
+		})
+	NewRunner(mockdb, time.Minute).RunDue(retryTime)
+}
+
+//TestRunDueChanged - расписание, измененное или удаленное после выбора, не выполняется и не перезаписывается
+func TestRunDueChanged(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	schedule := model.ScheduledTransfer{Id: 1, FromId: 1, ToId: 2, Delta: 5000, NextRunAt: testNow, Active: true}
+	mockdb := mock_model.NewMockIBalanceInfoStorage(ctrl)
+	mockdb.EXPECT().ClaimDueScheduledTransfers(testNow, claimLease, batchSize).Return([]model.ScheduledTransfer{schedule}, nil)
+	mockdb.EXPECT().ExecuteScheduledTransfer(&schedule, gomock.Any(), gomock.Any()).Return(nil, nil)
+
+	NewRunner(mockdb, time.Minute).RunDue(testNow)
+}
@@ -2,22 +2,29 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/call-me-snake/user_balance_service/internal/convert"
+	"github.com/call-me-snake/user_balance_service/internal/i18n"
 	"github.com/call-me-snake/user_balance_service/internal/model"
 	"github.com/gorilla/mux"
 	"github.com/labstack/gommon/log"
 	"golang.org/x/exp/errors/fmt"
 )
 
-const badRequestMessage = "Некорректные входные данные"
-const internalErrorMessage = "Внутренняя ошибка сервера"
-const insufficientFundsMessage = "Недостаточно средств на счету"
-const nullSumMessage = "Нулевая сумма пополнения"
-const defaultCurrency = "RUB"
+//Строковые константы используются в качестве возможных значений поля RateType запроса истории транзакций
+const (
+	currentRateType    = "current"
+	historicalRateType = "historical"
+)
+
+//convertStorer - источник курсов валют. Переменная нужна для подмены в тестах
+var convertStorer convert.ConvertDataStorer = &convert.ConvertDataStorerStruct{}
 
 func aliveHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("Hello from balance service"))
@@ -29,26 +36,55 @@ func accountBalanceById(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
 		ids := mux.Vars(r)["id"]
 		id, err := strconv.Atoi(ids)
 		if err != nil {
-			makeErrResponce(fmt.Sprintf(badRequestMessage+": Поле id должно быть числовым целочисленным типом больше 0."), http.StatusBadRequest, w)
+			makeErrResponce(r, model.WrongInputParamsCode, message(r, i18n.InvalidId), w)
 			return
 		}
 
-		acc, custErr := accStorage.GetAccountBalance(id)
+		//баланс на момент времени at, иначе текущий баланс
+		var at *time.Time
+		if ats := r.FormValue("at"); ats != "" {
+			parsed, err := time.Parse(time.RFC3339, ats)
+			if err != nil {
+				makeErrResponce(r, model.WrongInputParamsCode, message(r, i18n.InvalidAt), w)
+				return
+			}
+			at = &parsed
+		}
+		var acc *model.BalanceInfo
+		var custErr *model.CustomErr
+		if at != nil {
+			acc, custErr = readStorage(r, accStorage).GetAccountBalanceAt(id, *at)
+		} else {
+			acc, custErr = readStorage(r, accStorage).GetAccountBalance(id)
+		}
 		if custErr != nil {
-			makeErrResponce(internalErrorMessage, http.StatusInternalServerError, w)
-			log.Print(custErr.Err.Error())
+			makeCustomErrResponce(r, custErr, w)
 			return
 		}
 
 		currency := strings.ToUpper(r.FormValue("currency"))
-		respMessage := accountByIdResponse{Id: acc.AccountId, Balance: acc.Balance, Currency: defaultCurrency}
+		if currency == "" && convert.DefaultCurrency() != model.BaseCurrency {
+			currency = convert.DefaultCurrency()
+		}
+		respMessage := accountByIdResponse{Id: acc.AccountId, Balance: acc.Balance, Currency: model.BaseCurrency, At: at}
+		if at == nil {
+			respMessage.BonusBalance = &acc.BonusBalance
+		}
 		if currency != "" {
-			balanceInCurrency, err := convert.ConvertToCurrency(acc.Balance, currency, &convert.ConvertDataStorerStruct{})
+			//баланс на момент времени конвертируется по курсу на дату этого момента
+			var balanceInCurrency, rate float64
+			if at != nil {
+				if rate, _, err = convert.GetCourseForDate(currency, *at, convertStorer); err == nil {
+					balanceInCurrency = acc.Balance * rate
+				}
+			} else {
+				balanceInCurrency, err = convert.ConvertToCurrency(acc.Balance, currency, convertStorer)
+			}
 			if err == nil {
 				respMessage.Balance = balanceInCurrency
 				respMessage.Currency = currency
 			} else {
-				makeErrResponce("Не удалось предоставить информацию для выбранного курса валюты", http.StatusInternalServerError, w)
+				makeErrResponce(r, model.RateUnavailableCode, message(r, i18n.CourseError), w)
 				log.Print(err.Error())
 				return
 			}
@@ -59,34 +95,43 @@ func accountBalanceById(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
 	}
 }
 
-//changeAccBalance - выполняет пополнение аккаунта на delta
-//Пример тела запроса: {"Id":1,"Delta":-200}
+//changeAccBalance - выполняет пополнение аккаунта на delta. Сумма в валюте Currency пересчитывается в рубли по текущему курсу
+//Пример тела запроса: {"Id":1,"Delta":-200,"Purpose":"Оплата заказа","ExternalRef":"order-42"}
 func changeAccountBalance(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		changeRequest := &changeAccBalanceRequest{}
 		err := json.NewDecoder(r.Body).Decode(changeRequest)
 		if err != nil {
-			makeErrResponce(badRequestMessage, http.StatusBadRequest, w)
+			makeErrResponce(r, model.WrongInputParamsCode, "", w)
 			return
 		}
 		if changeRequest.Delta == 0 {
-			makeErrResponce(nullSumMessage, http.StatusBadRequest, w)
+			makeErrResponce(r, model.ZeroAmountCode, message(r, i18n.NullSum), w)
+			return
+		}
+		details, ok := operationDetails(r, changeRequest.Purpose, changeRequest.ExternalRef, changeRequest.Metadata, w)
+		if !ok {
 			return
 		}
+		if details.Currency, details.Rate, ok = operationRate(r, changeRequest.Currency, w); !ok {
+			return
+		}
+		delta := changeRequest.Delta
+		if details.Currency != "" {
+			if delta = toBaseCurrency(delta, details.Rate); delta == 0 {
+				makeErrResponce(r, model.ZeroAmountCode, message(r, i18n.NullSum), w)
+				return
+			}
+		}
 
-		successMessage, custErr := accStorage.ChangeAccountBalance(changeRequest.Id, changeRequest.Delta)
+		result, custErr := accStorage.ChangeAccountBalance(changeRequest.Id, delta, details)
 
 		if custErr != nil {
-			if custErr.ErrCode == model.InsufficientFundsCode {
-				makeErrResponce(insufficientFundsMessage, http.StatusForbidden, w)
-			} else {
-				makeErrResponce(internalErrorMessage, http.StatusInternalServerError, w)
-			}
-			log.Print(custErr.Err.Error())
+			makeCustomErrResponce(r, custErr, w)
 			return
 		}
 
-		respMessage := changeAccBalanceResponse{Message: successMessage}
+		respMessage := changeAccBalanceResponse{Message: i18n.OperationMessage(requestLang(r), result)}
 		resp, _ := json.Marshal(respMessage)
 		w.Header().Set("content-type", "application/json")
 		w.Write(resp)
@@ -95,35 +140,45 @@ func changeAccountBalance(accStorage model.IBalanceInfoStorage) http.HandlerFunc
 
 //transferSum - выполняет перевод суммы между аккаунтами
 //пример тела запроса: {"Id1":1,"Id2":3,"Delta":-20}
+//пример тела запроса с суммой в валюте: {"Id1":1,"Id2":3,"Delta":-20,"Currency":"USD"}
 func transferSum(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		transferRequest := &transferSumRequest{}
 		err := json.NewDecoder(r.Body).Decode(transferRequest)
 		if err != nil {
-			makeErrResponce(badRequestMessage, http.StatusBadRequest, w)
+			makeErrResponce(r, model.WrongInputParamsCode, "", w)
 			return
 		}
 		if transferRequest.Id1 == transferRequest.Id2 {
-			makeErrResponce(badRequestMessage, http.StatusBadRequest, w)
+			makeErrResponce(r, model.SameAccountsCode, "", w)
 			return
 		}
 		if transferRequest.Delta == 0 {
-			makeErrResponce(nullSumMessage, http.StatusBadRequest, w)
+			makeErrResponce(r, model.ZeroAmountCode, message(r, i18n.NullTransferSum), w)
+			return
+		}
+		details, ok := operationDetails(r, transferRequest.Purpose, transferRequest.ExternalRef, transferRequest.Metadata, w)
+		if !ok {
 			return
 		}
+		if details.Currency, details.Rate, ok = operationRate(r, transferRequest.Currency, w); !ok {
+			return
+		}
+		delta := transferRequest.Delta
+		if details.Currency != "" {
+			if delta = toBaseCurrency(delta, details.Rate); delta == 0 {
+				makeErrResponce(r, model.ZeroAmountCode, message(r, i18n.NullTransferSum), w)
+				return
+			}
+		}
 
-		transactionMessage, custErr := accStorage.TransferSumBetweenAccounts(transferRequest.Id1, transferRequest.Id2, transferRequest.Delta)
+		result, custErr := accStorage.TransferSumBetweenAccounts(transferRequest.Id1, transferRequest.Id2, delta, details)
 
 		if custErr != nil {
-			if custErr.ErrCode == model.InsufficientFundsCode {
-				makeErrResponce(insufficientFundsMessage, http.StatusForbidden, w)
-			} else {
-				makeErrResponce(internalErrorMessage, http.StatusInternalServerError, w)
-			}
-			log.Print(custErr.Err.Error())
+			makeCustomErrResponce(r, custErr, w)
 			return
 		}
-		respMessage := transferSumResponce{Message: transactionMessage}
+		respMessage := transferSumResponce{Message: i18n.OperationMessage(requestLang(r), result)}
 		resp, _ := json.Marshal(respMessage)
 		w.Header().Set("content-type", "application/json")
 		w.Write(resp)
@@ -132,32 +187,200 @@ func transferSum(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
 
 //transactionsHistory - выводит историю операций по аккаунту
 //пример тела запроса {"Id":3,"SortedBy":"transaction_sum","SortedByDesc":true}
+//пример тела запроса с конвертацией {"Id":3,"Currency":"USD","RateType":"historical"}
+//пример тела запроса с отбором {"Id":3,"OperationTypes":["transfer_in","transfer_out"],"CounterpartyId":2}
 func transactionsHistory(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		operationsInfoRequest := &transactionsHistoryRequest{}
 		err := json.NewDecoder(r.Body).Decode(operationsInfoRequest)
 		if err != nil {
-			makeErrResponce(badRequestMessage, http.StatusBadRequest, w)
+			makeErrResponce(r, model.WrongInputParamsCode, "", w)
+			return
+		}
+		currency := strings.ToUpper(operationsInfoRequest.Currency)
+		rateType := operationsInfoRequest.RateType
+		if rateType == "" {
+			rateType = currentRateType
+		}
+		if rateType != currentRateType && rateType != historicalRateType {
+			makeErrResponce(r, model.WrongInputParamsCode, message(r, i18n.InvalidRateType), w)
 			return
 		}
 
-		history, custErr := accStorage.GetSortedTransactionsHistory(operationsInfoRequest.Id, operationsInfoRequest.SortedBy, operationsInfoRequest.SortedByDesc)
-		if custErr != nil {
-			if custErr.ErrCode == model.WrongInputParamsCode {
-				makeErrResponce(badRequestMessage, http.StatusBadRequest, w)
-			} else {
-				makeErrResponce(internalErrorMessage, http.StatusInternalServerError, w)
+		for _, operationType := range operationsInfoRequest.OperationTypes {
+			if !isOperationType(operationType) {
+				makeErrResponce(r, model.WrongInputParamsCode, message(r, i18n.InvalidOperationType), w)
+				return
 			}
-			log.Print(custErr.Err.Error())
+		}
+		filter := model.HistoryFilter{OperationTypes: operationsInfoRequest.OperationTypes, CounterpartyId: operationsInfoRequest.CounterpartyId}
+
+		history, custErr := readStorage(r, accStorage).GetSortedTransactionsHistory(operationsInfoRequest.Id, operationsInfoRequest.SortedBy, operationsInfoRequest.SortedByDesc, filter)
+		if custErr != nil {
+			makeCustomErrResponce(r, custErr, w)
 			return
 		}
 
 		if len(history) == 0 {
-			makeErrResponce("Отсутсвуют записи по выбранным условиям поиска", http.StatusNotFound, w)
+			makeErrResponce(r, model.HistoryNotFoundCode, message(r, i18n.HistoryNotFound), w)
+			return
+		}
+
+		i18n.LocalizeHistory(requestLang(r), history)
+		var resp []byte
+		if currency == "" {
+			resp, _ = json.Marshal(history)
+		} else {
+			historyInCurrency, err := convertHistory(history, currency, rateType)
+			if err != nil {
+				makeErrResponce(r, model.RateUnavailableCode, message(r, i18n.CourseError), w)
+				log.Print(err.Error())
+				return
+			}
+			resp, _ = json.Marshal(historyInCurrency)
+		}
+		w.Header().Set("content-type", "application/json")
+		w.Write(resp)
+	}
+}
+
+//feeQuote - расчет комиссии за операцию до ее выполнения. Суммы расчета возвращаются в рублях
+//пример тела запроса {"Operation":"transfer","Id":1,"Delta":1000,"Currency":"USD"}
+func feeQuote(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		quoteRequest := &feeQuoteRequest{}
+		err := json.NewDecoder(r.Body).Decode(quoteRequest)
+		if err != nil {
+			makeErrResponce(r, model.WrongInputParamsCode, "", w)
+			return
+		}
+		if quoteRequest.Delta == 0 {
+			makeErrResponce(r, model.ZeroAmountCode, "", w)
+			return
+		}
+
+		currency, rate, ok := operationRate(r, quoteRequest.Currency, w)
+		if !ok {
+			return
+		}
+		amount := math.Abs(quoteRequest.Delta)
+		if currency != "" {
+			if amount = toBaseCurrency(amount, rate); amount == 0 {
+				makeErrResponce(r, model.ZeroAmountCode, "", w)
+				return
+			}
+		}
+
+		quote, custErr := accStorage.QuoteFee(quoteRequest.Operation, quoteRequest.Id, amount, currency)
+		if custErr != nil {
+			if custErr.ErrCode == model.WrongInputParamsCode {
+				makeErrResponce(r, model.WrongInputParamsCode, message(r, i18n.InvalidFeeOperation), w)
+				log.Print(custErr.Err.Error())
+			} else {
+				makeCustomErrResponce(r, custErr, w)
+			}
 			return
 		}
-		resp, _ := json.Marshal(history)
+		respMessage := feeQuoteResponse{
+			Operation: quote.Operation,
+			Id:        quote.AccountId,
+			Amount:    quote.Amount,
+			Fee:       quote.Fee,
+			Total:     quote.Total,
+			Currency:  quote.Currency,
+			Rate:      rate,
+		}
+		resp, _ := json.Marshal(respMessage)
 		w.Header().Set("content-type", "application/json")
 		w.Write(resp)
 	}
 }
+
+//operationRate - валюта операции currency и ее курс к BaseCurrency, по которому сумма операции пересчитывается
+//в BaseCurrency. Для пустой валюты и BaseCurrency возвращает пустую валюту, сумма не пересчитывается. Если валюта неизвестна
+//или курс недоступен, отправляет ответ с ошибкой и возвращает false
+func operationRate(r *http.Request, currency string, w http.ResponseWriter) (string, float64, bool) {
+	currency = strings.ToUpper(currency)
+	if currency == "" || currency == model.BaseCurrency {
+		return "", 0, true
+	}
+	rate, _, err := convert.GetCourse(currency, convertStorer)
+	if err == nil && rate <= 0 {
+		err = fmt.Errorf("server.operationRate: некорректный курс %s: %v", currency, rate)
+	}
+	if err != nil {
+		if errors.Is(err, convert.ErrUnknownCurrency) {
+			makeErrResponce(r, model.WrongInputParamsCode, message(r, i18n.UnknownCurrency), w)
+		} else {
+			makeErrResponce(r, model.RateUnavailableCode, message(r, i18n.CourseError), w)
+		}
+		log.Print(err.Error())
+		return "", 0, false
+	}
+	return currency, rate, true
+}
+
+//toBaseCurrency - сумма amount в валюте с курсом rate, пересчитанная в BaseCurrency с точностью до копеек
+func toBaseCurrency(amount, rate float64) float64 {
+	return math.Round(amount/rate*100) / 100
+}
+
+//isOperationType - является ли operationType одним из типов операций в истории
+func isOperationType(operationType string) bool {
+	for _, t := range model.OperationTypes {
+		if t == operationType {
+			return true
+		}
+	}
+	return false
+}
+
+//readStorage - хранилище для чтения. С заголовком X-Consistency: strong чтение выполняется на основном сервере
+//базы данных, а не на реплике, и учитывает все ранее выполненные изменения
+func readStorage(r *http.Request, accStorage model.IBalanceInfoStorage) model.IBalanceInfoStorage {
+	if strings.EqualFold(r.Header.Get("X-Consistency"), "strong") {
+		return accStorage.Primary()
+	}
+	return accStorage
+}
+
+//requestLang - язык сообщений, выбранный клиентом заголовком Accept-Language
+func requestLang(r *http.Request) string {
+	return i18n.FromAcceptLanguage(r.Header.Get("Accept-Language"))
+}
+
+//message - текст сообщения key на языке клиента
+func message(r *http.Request, key string, args ...interface{}) string {
+	return i18n.Message(requestLang(r), key, args...)
+}
+
+//convertHistory - конвертирует суммы записей истории в валюту currency.
+//При rateType == historicalRateType для каждой записи используется курс на дату ее создания
+func convertHistory(history []model.TransactionRecord, currency string, rateType string) ([]transactionRecordInCurrency, error) {
+	result := make([]transactionRecordInCurrency, 0, len(history))
+	var rate float64
+	var rateDate string
+	var err error
+	if rateType == currentRateType {
+		if rate, rateDate, err = convert.GetCourse(currency, convertStorer); err != nil {
+			return nil, fmt.Errorf("server.convertHistory: %v", err)
+		}
+	}
+	for _, record := range history {
+		if rateType == historicalRateType {
+			if rate, rateDate, err = convert.GetCourseForDate(currency, record.CreatedAt, convertStorer); err != nil {
+				return nil, fmt.Errorf("server.convertHistory: %v", err)
+			}
+		}
+		record.Delta *= rate
+		record.RemainingBalance *= rate
+		result = append(result, transactionRecordInCurrency{
+			TransactionRecord: record,
+			Currency:          currency,
+			Rate:              rate,
+			RateType:          rateType,
+			RateDate:          rateDate,
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/i18n"
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	"github.com/gorilla/mux"
+)
+
+//creditBonus - начисление партии бонусов Amount, которая сгорает через ExpiresInDays дней
+//пример тела запроса {"Id":1,"Amount":50,"ExpiresInDays":90,"Purpose":"Кэшбэк","ExternalRef":"order-42"}
+func creditBonus(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bonusRequest := &bonusCreditRequest{}
+		err := json.NewDecoder(r.Body).Decode(bonusRequest)
+		if err != nil || bonusRequest.Id <= 0 {
+			makeErrResponce(r, model.WrongInputParamsCode, message(r, i18n.InvalidId), w)
+			return
+		}
+		if bonusRequest.Amount <= 0 {
+			makeErrResponce(r, model.WrongInputParamsCode, message(r, i18n.InvalidBonusAmount), w)
+			return
+		}
+		if bonusRequest.ExpiresInDays <= 0 {
+			makeErrResponce(r, model.WrongInputParamsCode, message(r, i18n.InvalidBonusExpiry), w)
+			return
+		}
+		details, ok := operationDetails(r, bonusRequest.Purpose, bonusRequest.ExternalRef, nil, w)
+		if !ok {
+			return
+		}
+
+		expiresAt := time.Now().AddDate(0, 0, bonusRequest.ExpiresInDays)
+		record, custErr := accStorage.CreditBonus(bonusRequest.Id, bonusRequest.Amount, expiresAt, details)
+		if custErr != nil {
+			makeCustomErrResponce(r, custErr, w)
+			return
+		}
+		makeJSONResponce(bonusOperationResponse{
+			Message:      i18n.BonusRecordMessage(requestLang(r), record),
+			BonusBalance: record.RemainingBalance,
+		}, w)
+	}
+}
+
+//spendBonus - списание бонусов Amount в оплату покупки ExternalRef с партий в порядке начисления
+//пример тела запроса {"Id":1,"Amount":30,"Purpose":"Оплата заказа","ExternalRef":"order-43"}
+func spendBonus(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bonusRequest := &bonusSpendRequest{}
+		err := json.NewDecoder(r.Body).Decode(bonusRequest)
+		if err != nil || bonusRequest.Id <= 0 {
+			makeErrResponce(r, model.WrongInputParamsCode, message(r, i18n.InvalidId), w)
+			return
+		}
+		if bonusRequest.Amount <= 0 {
+			makeErrResponce(r, model.WrongInputParamsCode, message(r, i18n.InvalidBonusAmount), w)
+			return
+		}
+		//бонусы нельзя снять или перевести, только оплатить ими покупку
+		if bonusRequest.ExternalRef == "" {
+			makeErrResponce(r, model.WrongInputParamsCode, message(r, i18n.BonusPurchaseRequired), w)
+			return
+		}
+		details, ok := operationDetails(r, bonusRequest.Purpose, bonusRequest.ExternalRef, nil, w)
+		if !ok {
+			return
+		}
+
+		records, custErr := accStorage.SpendBonus(bonusRequest.Id, bonusRequest.Amount, details)
+		if custErr != nil {
+			makeCustomErrResponce(r, custErr, w)
+			return
+		}
+		//записи по отдельным партиям описываются одной операцией на всю сумму
+		spent := model.BonusRecord{AccountId: bonusRequest.Id, Delta: -bonusRequest.Amount, OperationType: model.BonusSpend}
+		var balance float64
+		if len(records) > 0 {
+			balance = records[len(records)-1].RemainingBalance
+		}
+		makeJSONResponce(bonusOperationResponse{
+			Message:      i18n.BonusRecordMessage(requestLang(r), &spent),
+			BonusBalance: balance,
+		}, w)
+	}
+}
+
+//bonusLots - бонусный баланс аккаунта и действующие партии бонусов в порядке списания
+func bonusLots(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, _ := strconv.Atoi(mux.Vars(r)["id"])
+		lots, custErr := readStorage(r, accStorage).GetBonusLots(id)
+		if custErr != nil {
+			makeCustomErrResponce(r, custErr, w)
+			return
+		}
+		var balance float64
+		for _, lot := range lots {
+			balance += lot.Remaining
+		}
+		makeJSONResponce(bonusLotsResponse{AccountId: id, BonusBalance: math.Round(balance*100) / 100, Lots: lots}, w)
+	}
+}
+
+//bonusHistory - история начислений, списаний и сгорания бонусов аккаунта
+func bonusHistory(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, _ := strconv.Atoi(mux.Vars(r)["id"])
+		history, custErr := readStorage(r, accStorage).GetBonusHistory(id)
+		if custErr != nil {
+			makeCustomErrResponce(r, custErr, w)
+			return
+		}
+		i18n.LocalizeBonusHistory(requestLang(r), history)
+		makeJSONResponce(history, w)
+	}
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	"github.com/gorilla/mux"
+)
+
+//storageIndependentRoutes - маршруты, которые не обращаются к базе данных либо сами сообщают о ее недоступности
+var storageIndependentRoutes = map[string]bool{
+	"/alive":              true,
+	"/healthz":            true,
+	"/readyz":             true,
+	"/openapi.json":       true,
+	"/docs":               true,
+	"/docs/assets/{file}": true,
+}
+
+//circuitBreakerMiddleware - пока автоматический выключатель хранилища разомкнут, запросы, которым нужна
+//база данных, сразу отклоняются с кодом 503
+func circuitBreakerMiddleware(accStorage model.IBalanceInfoStorage) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if route := mux.CurrentRoute(r); route != nil {
+				template, err := route.GetPathTemplate()
+				if err == nil && !storageIndependentRoutes[template] {
+					if state := accStorage.Health(); state.CircuitOpen {
+						w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(state.RetryAfter.Seconds()))))
+						makeErrResponce(r, model.UnavailableCode, "", w)
+						return
+					}
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/call-me-snake/user_balance_service/internal/i18n"
+	"github.com/call-me-snake/user_balance_service/internal/model"
+)
+
+//Ограничения данных операции (длины - в символах)
+const (
+	maxPurposeLength       = 500
+	maxExternalRefLength   = 100
+	maxMetadataPairs       = 20
+	maxMetadataKeyLength   = 64
+	maxMetadataValueLength = 500
+)
+
+//operationDetails - данные операции из запроса на изменение баланса или перевод.
+//При превышении ограничений отправляется ответ с ошибкой
+func operationDetails(r *http.Request, purpose, externalRef string, metadata map[string]string, w http.ResponseWriter) (model.OperationDetails, bool) {
+	valid := utf8.RuneCountInString(purpose) <= maxPurposeLength &&
+		utf8.RuneCountInString(externalRef) <= maxExternalRefLength &&
+		len(metadata) <= maxMetadataPairs
+	for key, value := range metadata {
+		if key == "" || utf8.RuneCountInString(key) > maxMetadataKeyLength || utf8.RuneCountInString(value) > maxMetadataValueLength {
+			valid = false
+		}
+	}
+	if !valid {
+		makeErrResponce(r, model.WrongInputParamsCode, message(r, i18n.InvalidOperationDetails,
+			maxPurposeLength, maxExternalRefLength, maxMetadataPairs, maxMetadataKeyLength, maxMetadataValueLength), w)
+		return model.OperationDetails{}, false
+	}
+	return model.OperationDetails{Purpose: purpose, ExternalRef: externalRef, Metadata: metadata}, true
+}
+
+//historyByExternalRef - записи истории с внешним идентификатором ref всех аккаунтов или аккаунта id
+//пример запроса /account/balance/history/search?ref=order-42&id=1
+func historyByExternalRef(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ref := r.FormValue("ref")
+		if ref == "" {
+			makeErrResponce(r, model.WrongInputParamsCode, message(r, i18n.ExternalRefRequired), w)
+			return
+		}
+		var id int
+		if ids := r.FormValue("id"); ids != "" {
+			var err error
+			if id, err = strconv.Atoi(ids); err != nil {
+				makeErrResponce(r, model.WrongInputParamsCode, message(r, i18n.InvalidId), w)
+				return
+			}
+		}
+		history, custErr := readStorage(r, accStorage).FindTransactionsByExternalRef(ref, id)
+		if custErr != nil {
+			makeCustomErrResponce(r, custErr, w)
+			return
+		}
+		if len(history) == 0 {
+			makeErrResponce(r, model.HistoryNotFoundCode, message(r, i18n.HistoryNotFound), w)
+			return
+		}
+		i18n.LocalizeHistory(requestLang(r), history)
+		makeJSONResponce(history, w)
+	}
+}
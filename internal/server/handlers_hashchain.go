@@ -0,0 +1,32 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/call-me-snake/user_balance_service/internal/hashchain"
+	"github.com/call-me-snake/user_balance_service/internal/i18n"
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	"github.com/gorilla/mux"
+)
+
+//verifyHistoryChain - проверка цепочки хешей истории аккаунта. Если цепочка нарушена,
+//в ответе указывается первая запись, на которой она нарушена
+func verifyHistoryChain(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			makeErrResponce(r, model.WrongInputParamsCode, message(r, i18n.InvalidId), w)
+			return
+		}
+		history, custErr := accStorage.GetHistoryChain(id)
+		if custErr != nil {
+			makeCustomErrResponce(r, custErr, w)
+			return
+		}
+		resp, _ := json.Marshal(hashchain.Verify(id, history))
+		w.Header().Set("content-type", "application/json")
+		w.Write(resp)
+	}
+}
@@ -0,0 +1,30 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/call-me-snake/user_balance_service/internal/health"
+	"github.com/call-me-snake/user_balance_service/internal/model"
+)
+
+//healthzHandler - процесс сервиса запущен и обрабатывает запросы. Зависимости не проверяются
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	resp, _ := json.Marshal(health.Report{Status: health.StatusOk, Checks: map[string]health.CheckResult{}})
+	w.Header().Set("content-type", "application/json")
+	w.Write(resp)
+}
+
+//readyzHandler - готовность сервиса принимать запросы по результатам проверки зависимостей.
+//Если не прошла хотя бы одна критичная проверка, возвращается 503
+func readyzHandler(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := health.Run(health.ReadinessChecks(accStorage, convertStorer), health.DefaultTimeout)
+		resp, _ := json.Marshal(report)
+		w.Header().Set("content-type", "application/json")
+		if !report.Ready() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		w.Write(resp)
+	}
+}
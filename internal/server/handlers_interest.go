@@ -0,0 +1,22 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	"github.com/gorilla/mux"
+)
+
+//accruedInterest - начисленные, но еще не выплаченные проценты аккаунта
+func accruedInterest(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, _ := strconv.Atoi(mux.Vars(r)["id"])
+		preview, custErr := readStorage(r, accStorage).GetAccruedInterest(id)
+		if custErr != nil {
+			makeCustomErrResponce(r, custErr, w)
+			return
+		}
+		makeJSONResponce(preview, w)
+	}
+}
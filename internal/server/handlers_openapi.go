@@ -0,0 +1,53 @@
+package server
+
+import (
+	"net/http"
+	"path/filepath"
+
+	"github.com/call-me-snake/user_balance_service/internal/openapi"
+	"github.com/gorilla/mux"
+)
+
+//openapiHandler - документ OpenAPI с описанием API сервиса
+func openapiHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+	w.Write(openapi.Spec())
+}
+
+//swaggerUIHandler - страница Swagger UI
+func swaggerUIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "text/html; charset=utf-8")
+	w.Write(openapi.SwaggerUI())
+}
+
+//swaggerUIAssetHandler - скрипты и стили Swagger UI из каталога dir. Отдаются только файлы openapi.SwaggerUIAssets
+func swaggerUIAssetHandler(dir string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		file := mux.Vars(r)["file"]
+		contentType, ok := openapi.SwaggerUIAssets[file]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("content-type", contentType)
+		http.ServeFile(w, r, filepath.Join(dir, file))
+	}
+}
+
+//validationMiddleware - отклоняет запросы, не соответствующие документу OpenAPI, до вызова обработчика
+func validationMiddleware(validator *openapi.Validator) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if route := mux.CurrentRoute(r); route != nil {
+				template, err := route.GetPathTemplate()
+				if err == nil {
+					if err = validator.ValidateRequest(r, template, mux.Vars(r)); err != nil {
+						makeValidationErrResponce(r, err, w)
+						return
+					}
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
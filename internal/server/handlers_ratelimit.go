@@ -0,0 +1,89 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/call-me-snake/user_balance_service/internal/i18n"
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	"github.com/call-me-snake/user_balance_service/internal/openapi"
+	"github.com/call-me-snake/user_balance_service/internal/ratelimit"
+	"github.com/gorilla/mux"
+)
+
+//rateLimitMiddleware - отклоняет с кодом 429 запросы клиентов и аккаунтов, превысивших ограничения маршрута.
+//Для определения аккаунта читается не более maxBodyBytes байт тела запроса, более длинные запросы отклоняются
+func rateLimitMiddleware(limiter *ratelimit.Limiter, maxBodyBytes int64) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if route := mux.CurrentRoute(r); route != nil {
+				template, err := route.GetPathTemplate()
+				if err == nil {
+					accountId, err := requestAccountId(r, template, maxBodyBytes)
+					if err != nil {
+						makeValidationErrResponce(r, err, w)
+						return
+					}
+					retryAfter := limiter.Allow(r.Method, template, clientIdentity(r), accountId)
+					if retryAfter > 0 {
+						w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+						makeErrResponce(r, model.RateLimitedCode, "", w)
+						return
+					}
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+//clientIdentity - идентификатор клиента API, по которому ведется учет запросов: идентификатор из сертификата
+//клиента, а без него - IP адрес клиента
+func clientIdentity(r *http.Request) string {
+	if identity := requestClientIdentity(r); identity != "" {
+		return "cert:" + identity
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+//requestAccountId - аккаунт, от имени которого выполняется запрос: переменная пути id маршрутов аккаунта
+//либо поле Id1 (отправитель перевода) или Id тела запроса. 0 - аккаунт не определен.
+//Тело длиннее maxBodyBytes не читается дальше лимита, возвращается ошибка валидации
+func requestAccountId(r *http.Request, template string, maxBodyBytes int64) (int, error) {
+	if strings.HasPrefix(template, "/account/balance/info/") || strings.HasPrefix(template, "/account/balance/schedules/") {
+		id, _ := strconv.Atoi(mux.Vars(r)["id"])
+		return id, nil
+	}
+	if r.Method != http.MethodPost || r.Body == nil {
+		return 0, nil
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(nil, r.Body, maxBodyBytes))
+	r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		//MaxBytesReader возвращает ошибку после чтения maxBodyBytes байт
+		if int64(len(body)) >= maxBodyBytes {
+			return 0, &openapi.ValidationError{Key: i18n.ValidationBodyTooLarge, Args: []interface{}{maxBodyBytes}}
+		}
+		return 0, &openapi.ValidationError{Key: i18n.ValidationBodyRead}
+	}
+	ids := struct {
+		Id  int
+		Id1 int
+	}{}
+	json.Unmarshal(body, &ids)
+	if ids.Id1 != 0 {
+		return ids.Id1, nil
+	}
+	return ids.Id, nil
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/i18n"
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	"github.com/call-me-snake/user_balance_service/internal/reconcile"
+)
+
+//lastReconciliation - результат последней сверки балансов с историей операций
+func lastReconciliation(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		run, custErr := accStorage.GetLastReconciliationRun()
+		if custErr != nil {
+			if custErr.ErrCode == model.NotFoundCode {
+				makeErrResponce(r, model.NotFoundCode, message(r, i18n.ReconcileNotFound), w)
+			} else {
+				makeCustomErrResponce(r, custErr, w)
+			}
+			return
+		}
+		resp, _ := json.Marshal(run)
+		w.Header().Set("content-type", "application/json")
+		w.Write(resp)
+	}
+}
+
+//runReconciliation - выполняет сверку балансов с историей операций и возвращает ее результат
+func runReconciliation(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		run, custErr := reconcile.NewJob(accStorage, 0).RunOnce(time.Now())
+		if custErr != nil {
+			makeCustomErrResponce(r, custErr, w)
+			return
+		}
+		resp, _ := json.Marshal(run)
+		w.Header().Set("content-type", "application/json")
+		w.Write(resp)
+	}
+}
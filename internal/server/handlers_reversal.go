@@ -0,0 +1,42 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/call-me-snake/user_balance_service/internal/i18n"
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	"github.com/labstack/gommon/log"
+)
+
+//reverseOperation - отмена операции, в которой создана запись истории Id
+//пример тела запроса {"Id":18,"Purpose":"Возврат ошибочного перевода"}
+func reverseOperation(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reverseRequest := &reverseOperationRequest{}
+		err := json.NewDecoder(r.Body).Decode(reverseRequest)
+		if err != nil {
+			makeErrResponce(r, model.WrongInputParamsCode, "", w)
+			return
+		}
+		details, ok := operationDetails(r, reverseRequest.Purpose, reverseRequest.ExternalRef, reverseRequest.Metadata, w)
+		if !ok {
+			return
+		}
+
+		result, custErr := accStorage.ReverseOperation(reverseRequest.Id, details)
+		if custErr != nil {
+			switch custErr.ErrCode {
+			case model.WrongInputParamsCode:
+				log.Print(custErr.Err.Error())
+				makeErrResponce(r, model.WrongInputParamsCode, message(r, i18n.NotReversible), w)
+			case model.HistoryNotFoundCode:
+				makeErrResponce(r, model.HistoryNotFoundCode, message(r, i18n.HistoryNotFound), w)
+			default:
+				makeCustomErrResponce(r, custErr, w)
+			}
+			return
+		}
+		makeJSONResponce(reverseOperationResponse{Message: i18n.OperationMessage(requestLang(r), result)}, w)
+	}
+}
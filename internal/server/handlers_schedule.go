@@ -0,0 +1,179 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/i18n"
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	"github.com/call-me-snake/user_balance_service/internal/scheduler"
+	"github.com/gorilla/mux"
+)
+
+//createScheduledTransfer - создание запланированного перевода
+//пример тела запроса: {"FromId":1,"ToId":2,"Delta":5000,"Recurrence":"0 9 1 * *","MaxRetries":3,"RetryIntervalSec":3600}
+func createScheduledTransfer(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		scheduleRequest := &scheduledTransferRequest{}
+		err := json.NewDecoder(r.Body).Decode(scheduleRequest)
+		if err != nil {
+			makeErrResponce(r, model.WrongInputParamsCode, "", w)
+			return
+		}
+		schedule := &model.ScheduledTransfer{Active: true}
+		if detailsKey := applyScheduledTransferRequest(schedule, scheduleRequest, time.Now()); detailsKey != "" {
+			makeErrResponce(r, model.WrongInputParamsCode, message(r, detailsKey), w)
+			return
+		}
+
+		created, custErr := accStorage.CreateScheduledTransfer(schedule)
+		if custErr != nil {
+			makeCustomErrResponce(r, custErr, w)
+			return
+		}
+		makeJSONResponce(makeScheduledTransferResponse(created), w)
+	}
+}
+
+//getScheduledTransfer - получение запланированного перевода
+func getScheduledTransfer(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, _ := strconv.Atoi(mux.Vars(r)["id"])
+		schedule, custErr := accStorage.GetScheduledTransfer(id)
+		if custErr != nil {
+			makeCustomErrResponce(r, custErr, w)
+			return
+		}
+		makeJSONResponce(makeScheduledTransferResponse(schedule), w)
+	}
+}
+
+//updateScheduledTransfer - изменение запланированного перевода. Тело запроса совпадает с телом запроса на создание,
+//дополнительно можно передать поле Active для приостановки и возобновления перевода
+func updateScheduledTransfer(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, _ := strconv.Atoi(mux.Vars(r)["id"])
+		scheduleRequest := &scheduledTransferRequest{}
+		err := json.NewDecoder(r.Body).Decode(scheduleRequest)
+		if err != nil {
+			makeErrResponce(r, model.WrongInputParamsCode, "", w)
+			return
+		}
+		schedule, custErr := accStorage.GetScheduledTransfer(id)
+		if custErr != nil {
+			makeCustomErrResponce(r, custErr, w)
+			return
+		}
+		if detailsKey := applyScheduledTransferRequest(schedule, scheduleRequest, time.Now()); detailsKey != "" {
+			makeErrResponce(r, model.WrongInputParamsCode, message(r, detailsKey), w)
+			return
+		}
+		if scheduleRequest.Active != nil {
+			schedule.Active = *scheduleRequest.Active
+		}
+		schedule.RetryCount = 0
+
+		if custErr = accStorage.UpdateScheduledTransfer(schedule); custErr != nil {
+			makeCustomErrResponce(r, custErr, w)
+			return
+		}
+		makeJSONResponce(makeScheduledTransferResponse(schedule), w)
+	}
+}
+
+//deleteScheduledTransfer - удаление запланированного перевода
+func deleteScheduledTransfer(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, _ := strconv.Atoi(mux.Vars(r)["id"])
+		if custErr := accStorage.DeleteScheduledTransfer(id); custErr != nil {
+			makeCustomErrResponce(r, custErr, w)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+//accountScheduledTransfers - список запланированных переводов аккаунта
+func accountScheduledTransfers(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, _ := strconv.Atoi(mux.Vars(r)["id"])
+		schedules, custErr := accStorage.GetAccountScheduledTransfers(id)
+		if custErr != nil {
+			makeCustomErrResponce(r, custErr, w)
+			return
+		}
+		respMessage := make([]scheduledTransferResponse, 0, len(schedules))
+		for i := range schedules {
+			respMessage = append(respMessage, makeScheduledTransferResponse(&schedules[i]))
+		}
+		makeJSONResponce(respMessage, w)
+	}
+}
+
+//scheduledTransferRuns - история выполнения запланированного перевода
+func scheduledTransferRuns(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, _ := strconv.Atoi(mux.Vars(r)["id"])
+		if _, custErr := accStorage.GetScheduledTransfer(id); custErr != nil {
+			makeCustomErrResponce(r, custErr, w)
+			return
+		}
+		runs, custErr := accStorage.GetScheduledTransferRuns(id)
+		if custErr != nil {
+			makeCustomErrResponce(r, custErr, w)
+			return
+		}
+		respMessage := make([]scheduledTransferRunResponse, 0, len(runs))
+		for _, run := range runs {
+			respMessage = append(respMessage, scheduledTransferRunResponse{
+				RunAt:   run.RunAt,
+				Attempt: run.Attempt,
+				Success: run.Success,
+				Message: run.Message,
+			})
+		}
+		makeJSONResponce(respMessage, w)
+	}
+}
+
+//applyScheduledTransferRequest - проверяет запрос и переносит его поля в schedule.
+//Возвращает ключ сообщения об ошибке для пользователя или пустую строку
+func applyScheduledTransferRequest(schedule *model.ScheduledTransfer, request *scheduledTransferRequest, now time.Time) string {
+	if request.FromId <= 0 || request.ToId <= 0 || request.FromId == request.ToId {
+		return i18n.ScheduleAccounts
+	}
+	if request.Delta <= 0 {
+		return i18n.ScheduleDelta
+	}
+	if request.MaxRetries < 0 || request.RetryIntervalSec < 0 {
+		return i18n.ScheduleRetries
+	}
+	var recurrence *scheduler.Recurrence
+	if request.Recurrence != "" {
+		var err error
+		if recurrence, err = scheduler.ParseRecurrence(request.Recurrence); err != nil {
+			return i18n.ScheduleRecurrence
+		}
+	}
+
+	switch {
+	case request.StartAt != nil:
+		//время хранится по UTC без часового пояса
+		schedule.NextRunAt = request.StartAt.UTC()
+	case schedule.Id == 0 || request.Recurrence != schedule.Recurrence:
+		if recurrence != nil {
+			schedule.NextRunAt = recurrence.Next(now)
+		} else {
+			schedule.NextRunAt = now
+		}
+	}
+	schedule.FromId = request.FromId
+	schedule.ToId = request.ToId
+	schedule.Delta = request.Delta
+	schedule.Recurrence = request.Recurrence
+	schedule.MaxRetries = request.MaxRetries
+	schedule.RetryIntervalSec = request.RetryIntervalSec
+	return ""
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/i18n"
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	"github.com/call-me-snake/user_balance_service/internal/statement"
+	"github.com/gorilla/mux"
+	"github.com/labstack/gommon/log"
+)
+
+//Строковые константы используются в качестве возможных значений параметра format запроса выписки
+const (
+	jsonFormat = "json"
+	htmlFormat = "html"
+)
+
+//accountStatement - выписка по аккаунту за период, рассчитанная по истории операций в момент запроса.
+//Период задается параметром month (YYYY-MM) или параметрами from и to (RFC 3339), по умолчанию - текущий месяц до момента запроса
+//пример запроса /account/balance/statement/1?month=2020-09&format=html
+func accountStatement(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			makeErrResponce(r, model.WrongInputParamsCode, message(r, i18n.InvalidId), w)
+			return
+		}
+		format, ok := statementFormat(r, w)
+		if !ok {
+			return
+		}
+
+		now := time.Now().UTC()
+		from, to := statement.Month(now), now
+		if month := r.FormValue("month"); month != "" {
+			if from, err = statement.ParseMonth(month); err != nil {
+				makeErrResponce(r, model.WrongInputParamsCode, message(r, i18n.InvalidMonth), w)
+				return
+			}
+			to = from.AddDate(0, 1, 0)
+		} else if r.FormValue("from") != "" || r.FormValue("to") != "" {
+			from, err = time.Parse(time.RFC3339, r.FormValue("from"))
+			if err == nil {
+				to, err = time.Parse(time.RFC3339, r.FormValue("to"))
+			}
+			if err != nil || !from.Before(to) {
+				makeErrResponce(r, model.WrongInputParamsCode, message(r, i18n.InvalidPeriod), w)
+				return
+			}
+		}
+
+		result, custErr := accStorage.BuildStatement(id, from, to)
+		if custErr != nil {
+			makeCustomErrResponce(r, custErr, w)
+			return
+		}
+		writeStatement(r, result, format, w)
+	}
+}
+
+//accountStatements - сохраненные ежемесячные выписки аккаунта без операций
+func accountStatements(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			makeErrResponce(r, model.WrongInputParamsCode, message(r, i18n.InvalidId), w)
+			return
+		}
+		statements, custErr := accStorage.GetAccountStatements(id)
+		if custErr != nil {
+			makeCustomErrResponce(r, custErr, w)
+			return
+		}
+		makeJSONResponce(statements, w)
+	}
+}
+
+//storedStatement - сохраненная выписка аккаунта за месяц
+//пример запроса /account/balance/statements/1/2020-09?format=html
+func storedStatement(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			makeErrResponce(r, model.WrongInputParamsCode, message(r, i18n.InvalidId), w)
+			return
+		}
+		month, err := statement.ParseMonth(mux.Vars(r)["month"])
+		if err != nil {
+			makeErrResponce(r, model.WrongInputParamsCode, message(r, i18n.InvalidMonth), w)
+			return
+		}
+		format, ok := statementFormat(r, w)
+		if !ok {
+			return
+		}
+
+		result, custErr := accStorage.GetStatement(id, month)
+		if custErr != nil {
+			if custErr.ErrCode == model.NotFoundCode {
+				makeErrResponce(r, model.NotFoundCode, message(r, i18n.StatementNotFound), w)
+			} else {
+				makeCustomErrResponce(r, custErr, w)
+			}
+			return
+		}
+		writeStatement(r, result, format, w)
+	}
+}
+
+//statementFormat - формат выписки из параметра format. При некорректном значении отправляется ответ с ошибкой
+func statementFormat(r *http.Request, w http.ResponseWriter) (string, bool) {
+	format := r.FormValue("format")
+	switch format {
+	case "":
+		return jsonFormat, true
+	case jsonFormat, htmlFormat:
+		return format, true
+	}
+	makeErrResponce(r, model.WrongInputParamsCode, message(r, i18n.InvalidFormat), w)
+	return "", false
+}
+
+//writeStatement - ответ с выпиской в формате format. Описания операций формируются на языке клиента
+func writeStatement(r *http.Request, result *model.Statement, format string, w http.ResponseWriter) {
+	i18n.LocalizeHistory(requestLang(r), result.Movements)
+	if format == jsonFormat {
+		makeJSONResponce(result, w)
+		return
+	}
+	page := &bytes.Buffer{}
+	if err := statement.RenderHTML(page, requestLang(r), result); err != nil {
+		log.Print(err.Error())
+		makeErrResponce(r, model.DefaultErrCode, "", w)
+		return
+	}
+	w.Header().Set("content-type", "text/html; charset=utf-8")
+	w.Write(page.Bytes())
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/call-me-snake/user_balance_service/internal/i18n"
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	"github.com/gorilla/mux"
+)
+
+//consolidatedBalance - баланс аккаунта вместе с балансами всех его субаккаунтов
+func consolidatedBalance(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, _ := strconv.Atoi(mux.Vars(r)["id"])
+		balance, custErr := readStorage(r, accStorage).GetConsolidatedBalance(id)
+		if custErr != nil {
+			makeCustomErrResponce(r, custErr, w)
+			return
+		}
+		makeJSONResponce(balance, w)
+	}
+}
+
+//setAccountParent - подчинение аккаунта ChildId родительскому аккаунту ParentId
+//пример тела запроса {"ParentId":1,"ChildId":5}
+func setAccountParent(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		subRequest := &subAccountRequest{}
+		err := json.NewDecoder(r.Body).Decode(subRequest)
+		if err != nil || subRequest.ParentId <= 0 || subRequest.ChildId <= 0 {
+			makeErrResponce(r, model.WrongInputParamsCode, "", w)
+			return
+		}
+		if subRequest.ParentId == subRequest.ChildId {
+			makeErrResponce(r, model.SameAccountsCode, "", w)
+			return
+		}
+		custErr := accStorage.SetAccountParent(subRequest.ChildId, subRequest.ParentId)
+		if custErr != nil {
+			if custErr.ErrCode == model.WrongInputParamsCode {
+				makeErrResponce(r, model.WrongInputParamsCode, message(r, i18n.InvalidAccountHierarchy, model.MaxAccountDepth), w)
+				return
+			}
+			makeCustomErrResponce(r, custErr, w)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+//detachSubAccount - отделение субаккаунта от родительского аккаунта
+func detachSubAccount(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, _ := strconv.Atoi(mux.Vars(r)["id"])
+		if custErr := accStorage.SetAccountParent(id, 0); custErr != nil {
+			makeCustomErrResponce(r, custErr, w)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+//fundSubAccount - перевод суммы Delta с родительского аккаунта на субаккаунт
+//пример тела запроса {"ParentId":1,"ChildId":5,"Delta":100,"Purpose":"Бюджет на месяц"}
+func fundSubAccount(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
+	return moveSubAccountFunds(accStorage, true)
+}
+
+//sweepSubAccount - перевод суммы Delta (если не задана - всего баланса) с субаккаунта на родительский аккаунт
+//пример тела запроса {"ParentId":1,"ChildId":5}
+func sweepSubAccount(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
+	return moveSubAccountFunds(accStorage, false)
+}
+
+//moveSubAccountFunds (internal) - общая часть fundSubAccount (fund = true) и sweepSubAccount
+func moveSubAccountFunds(accStorage model.IBalanceInfoStorage, fund bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fundsRequest := &subAccountFundsRequest{}
+		err := json.NewDecoder(r.Body).Decode(fundsRequest)
+		if err != nil || fundsRequest.Delta < 0 {
+			makeErrResponce(r, model.WrongInputParamsCode, "", w)
+			return
+		}
+		if fundsRequest.ParentId == fundsRequest.ChildId {
+			makeErrResponce(r, model.SameAccountsCode, "", w)
+			return
+		}
+		if fundsRequest.Delta == 0 && fund {
+			makeErrResponce(r, model.ZeroAmountCode, message(r, i18n.NullTransferSum), w)
+			return
+		}
+		details, ok := operationDetails(r, fundsRequest.Purpose, fundsRequest.ExternalRef, fundsRequest.Metadata, w)
+		if !ok {
+			return
+		}
+
+		move := accStorage.SweepSubAccount
+		if fund {
+			move = accStorage.FundSubAccount
+		}
+		result, custErr := move(fundsRequest.ParentId, fundsRequest.ChildId, fundsRequest.Delta, details)
+		if custErr != nil {
+			makeCustomErrResponce(r, custErr, w)
+			return
+		}
+		makeJSONResponce(subAccountFundsResponse{Message: i18n.OperationMessage(requestLang(r), result)}, w)
+	}
+}
@@ -2,14 +2,27 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	mock_convert "github.com/call-me-snake/user_balance_service/internal/convert/mock"
+	"github.com/call-me-snake/user_balance_service/internal/hashchain"
+	"github.com/call-me-snake/user_balance_service/internal/health"
+	"github.com/call-me-snake/user_balance_service/internal/i18n"
 	"github.com/call-me-snake/user_balance_service/internal/model"
 	mock_model "github.com/call-me-snake/user_balance_service/internal/model/mock"
+	"github.com/call-me-snake/user_balance_service/internal/openapi"
+	"github.com/call-me-snake/user_balance_service/internal/problem"
+	"github.com/call-me-snake/user_balance_service/internal/ratelimit"
 	"github.com/golang/mock/gomock"
 	"github.com/gorilla/mux"
 	"github.com/labstack/gommon/log"
@@ -24,14 +37,17 @@ var (
 	testBalance2                    = 910.0
 	testDelta1                      = 15.0
 	testDelta2                      = 90.0
+	testBonusBalance1               = 25.0
 	testMessage                     = "Сообщение"
-	testBalanceInfo1                = model.BalanceInfo{AccountId: testId1, Balance: testBalance1}
-	testRespMessage1                = accountByIdResponse{Id: testId1, Balance: testBalance1, Currency: defaultCurrency}
+	testBalanceInfo1                = model.BalanceInfo{AccountId: testId1, Balance: testBalance1, BonusBalance: testBonusBalance1}
+	testRespMessage1                = accountByIdResponse{Id: testId1, Balance: testBalance1, Currency: model.BaseCurrency, BonusBalance: &testBonusBalance1}
 	testErr1                        = model.CustomErr{Err: errors.New("Ошибка"), ErrCode: model.DefaultErrCode}
-	testErrRespMessage1             = errorResponce{Message: internalErrorMessage, ErrCode: http.StatusInternalServerError}
+	testErrRespMessage1             = problem.New(i18n.Ru, model.DefaultErrCode, "")
 	testChangeAccountBalanceRequest = changeAccBalanceRequest{Id: testId1, Delta: testDelta1}
 	testTransferSumRequest          = transferSumRequest{Id1: testId1, Id2: testId2, Delta: testDelta1}
 	testTransactionsHistoryRequest  = transactionsHistoryRequest{Id: testId1}
+	testRate                        = 0.5
+	testConvertData                 = model.ConvertData{Base: model.BaseCurrency, Date: "2020-09-21", Rates: map[string]float64{"USD": testRate}}
 	testHistory                     = []model.TransactionRecord{
 		{
 			AccountId:          testId1,
@@ -100,6 +116,7 @@ func TestAccountBalanceByIdErrResponce(t *testing.T) {
 	router.ServeHTTP(rr, req)
 	res, _ := json.Marshal(testErrRespMessage1)
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Equal(t, problem.ContentType, rr.Header().Get("content-type"))
 	assert.Equal(t, res, rr.Body.Bytes())
 }
 
@@ -109,7 +126,8 @@ func TestChangeAccountBalance(t *testing.T) {
 	defer ctrl.Finish()
 	message := fmt.Sprintf("Аккаунт %d успешно пополнен на сумму %.2f руб.", testId1, testDelta1)
 	mockdb := mock_model.NewMockIBalanceInfoStorage(ctrl)
-	mockdb.EXPECT().ChangeAccountBalance(testId1, testDelta1).Return(message, nil)
+	result := &model.OperationResult{Record: model.TransactionRecord{AccountId: testId1, Delta: testDelta1, OperationType: model.OperationDeposit}}
+	mockdb.EXPECT().ChangeAccountBalance(testId1, testDelta1, model.OperationDetails{}).Return(result, nil)
 
 	requestBody, _ := json.Marshal(testChangeAccountBalanceRequest)
 	res, _ := json.Marshal(changeAccBalanceResponse{Message: message})
@@ -124,13 +142,31 @@ func TestChangeAccountBalance(t *testing.T) {
 	assert.Equal(t, res, rr.Body.Bytes())
 }
 
+//TestChangeAccountBalanceFrozen - изменение баланса заблокированного аккаунта возвращает 409
+func TestChangeAccountBalanceFrozen(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockdb := mock_model.NewMockIBalanceInfoStorage(ctrl)
+	mockdb.EXPECT().ChangeAccountBalance(testId1, testDelta1, model.OperationDetails{}).
+		Return(nil, &model.CustomErr{Err: errors.New("Ошибка"), ErrCode: model.AccountFrozenCode})
+
+	requestBody, _ := json.Marshal(testChangeAccountBalanceRequest)
+	rr := httptest.NewRecorder()
+	changeAccountBalance(mockdb).ServeHTTP(rr, httptest.NewRequest("POST", "/account/balance/change", bytes.NewReader(requestBody)))
+	result := problem.Problem{}
+	json.Unmarshal(rr.Body.Bytes(), &result)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.Equal(t, model.AccountFrozenCode, result.Code)
+}
+
 //TestTransferSum - тест успешной передачи суммы
 func TestTransferSum(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 	message := fmt.Sprintf("Перевод на сумму %.2f руб. с аккаунта %d на аккаунт %d выполнен успешно.", testDelta1, testId1, testId2)
 	mockdb := mock_model.NewMockIBalanceInfoStorage(ctrl)
-	mockdb.EXPECT().TransferSumBetweenAccounts(testId1, testId2, testDelta1).Return(message, nil)
+	result := &model.OperationResult{Record: model.TransactionRecord{AccountId: testId1, Delta: -testDelta1, OperationType: model.OperationTransferOut, CounterpartyId: &testId2}}
+	mockdb.EXPECT().TransferSumBetweenAccounts(testId1, testId2, testDelta1, model.OperationDetails{}).Return(result, nil)
 
 	requestBody, _ := json.Marshal(testTransferSumRequest)
 	res, _ := json.Marshal(transferSumResponce{Message: message})
@@ -150,7 +186,7 @@ func TestTransactionsHistory(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 	mockdb := mock_model.NewMockIBalanceInfoStorage(ctrl)
-	mockdb.EXPECT().GetSortedTransactionsHistory(testId1, "", false).Return(testHistory, nil)
+	mockdb.EXPECT().GetSortedTransactionsHistory(testId1, "", false, model.HistoryFilter{}).Return(testHistory, nil)
 
 	requestBody, _ := json.Marshal(testTransactionsHistoryRequest)
 	res, _ := json.Marshal(testHistory)
@@ -166,3 +202,902 @@ func TestTransactionsHistory(t *testing.T) {
 	assert.Equal(t, res, rr.Body.Bytes())
 
 }
+
+//TestTransactionsHistoryInCurrency - тест вывода истории транзакций в выбранной валюте по курсу на дату операции
+func TestTransactionsHistoryInCurrency(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockdb := mock_model.NewMockIBalanceInfoStorage(ctrl)
+	mockdb.EXPECT().GetSortedTransactionsHistory(testId1, "", false, model.HistoryFilter{}).Return(testHistory, nil)
+	mockStorer := mock_convert.NewMockConvertDataStorer(ctrl)
+	mockStorer.EXPECT().GetConvertDataForDate(gomock.Any()).Return(testConvertData, nil).Times(len(testHistory))
+	defaultStorer := convertStorer
+	convertStorer = mockStorer
+	defer func() { convertStorer = defaultStorer }()
+
+	requestBody, _ := json.Marshal(transactionsHistoryRequest{Id: testId1, Currency: "usd", RateType: historicalRateType})
+	expected := make([]transactionRecordInCurrency, 0, len(testHistory))
+	for _, record := range testHistory {
+		record.Delta *= testRate
+		record.RemainingBalance *= testRate
+		expected = append(expected, transactionRecordInCurrency{
+			TransactionRecord: record,
+			Currency:          "USD",
+			Rate:              testRate,
+			RateType:          historicalRateType,
+			RateDate:          testConvertData.Date,
+		})
+	}
+	res, _ := json.Marshal(expected)
+
+	req, err := http.NewRequest("POST", "/account/balance/history", bytes.NewReader(requestBody))
+	if err != nil {
+		log.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(transactionsHistory(mockdb))
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, res, rr.Body.Bytes())
+}
+
+//TestFeeQuote - тест успешного расчета комиссии в валюте операции: сумма пересчитывается в рубли по текущему курсу
+func TestFeeQuote(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	quote := &model.FeeQuote{
+		Operation: model.FeeOperationTransfer,
+		AccountId: testId1,
+		Amount:    testDelta2 / testRate,
+		Fee:       testDelta1,
+		Total:     testDelta1 + testDelta2/testRate,
+		Currency:  "USD",
+	}
+	mockdb := mock_model.NewMockIBalanceInfoStorage(ctrl)
+	mockdb.EXPECT().QuoteFee(model.FeeOperationTransfer, testId1, testDelta2/testRate, "USD").Return(quote, nil)
+	mockStorer := mock_convert.NewMockConvertDataStorer(ctrl)
+	mockStorer.EXPECT().GetConvertData().Return(testConvertData, nil)
+	defaultStorer := convertStorer
+	convertStorer = mockStorer
+	defer func() { convertStorer = defaultStorer }()
+
+	requestBody, _ := json.Marshal(feeQuoteRequest{Operation: model.FeeOperationTransfer, Id: testId1, Delta: -testDelta2, Currency: "usd"})
+	res, _ := json.Marshal(feeQuoteResponse{
+		Operation: quote.Operation,
+		Id:        quote.AccountId,
+		Amount:    quote.Amount,
+		Fee:       quote.Fee,
+		Total:     quote.Total,
+		Currency:  quote.Currency,
+		Rate:      testRate,
+	})
+	req, err := http.NewRequest("POST", "/account/balance/fee/quote", bytes.NewReader(requestBody))
+	if err != nil {
+		log.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(feeQuote(mockdb))
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, res, rr.Body.Bytes())
+}
+
+//TestCreateScheduledTransfer - тест успешного создания периодического перевода
+func TestCreateScheduledTransfer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockdb := mock_model.NewMockIBalanceInfoStorage(ctrl)
+	mockdb.EXPECT().CreateScheduledTransfer(gomock.Any()).DoAndReturn(
+		func(schedule *model.ScheduledTransfer) (*model.ScheduledTransfer, *model.CustomErr) {
+			created := *schedule
+			created.Id = testId1
+			return &created, nil
+		})
+
+	requestBody, _ := json.Marshal(scheduledTransferRequest{FromId: testId1, ToId: testId2, Delta: testDelta2, Recurrence: "@monthly"})
+	req, err := http.NewRequest("POST", "/account/balance/schedule", bytes.NewReader(requestBody))
+	if err != nil {
+		log.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(createScheduledTransfer(mockdb))
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	resp := scheduledTransferResponse{}
+	assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, testId1, resp.Id)
+	assert.True(t, resp.Active)
+	assert.Equal(t, 1, resp.NextRunAt.Day())
+}
+
+//TestCreateScheduledTransferWrongRecurrence - тест ошибки создания перевода с некорректным расписанием
+func TestCreateScheduledTransferWrongRecurrence(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockdb := mock_model.NewMockIBalanceInfoStorage(ctrl)
+
+	requestBody, _ := json.Marshal(scheduledTransferRequest{FromId: testId1, ToId: testId2, Delta: testDelta2, Recurrence: "каждый месяц"})
+	req, err := http.NewRequest("POST", "/account/balance/schedule", bytes.NewReader(requestBody))
+	if err != nil {
+		log.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(createScheduledTransfer(mockdb))
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+//TestCreateWebhookSubscription - тест регистрации подписки с генерацией ключа подписи
+func TestCreateWebhookSubscription(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockdb := mock_model.NewMockIBalanceInfoStorage(ctrl)
+	mockdb.EXPECT().CreateWebhookSubscription(gomock.Any()).DoAndReturn(
+		func(subscription *model.WebhookSubscription) (*model.WebhookSubscription, *model.CustomErr) {
+			created := *subscription
+			created.Id = testId1
+			return &created, nil
+		})
+
+	requestBody, _ := json.Marshal(webhookSubscriptionRequest{Url: "https://billing.local/hooks"})
+	req, err := http.NewRequest("POST", "/webhooks", bytes.NewReader(requestBody))
+	if err != nil {
+		log.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(createWebhookSubscription(mockdb))
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	resp := webhookSubscriptionResponse{}
+	assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, testId1, resp.Id)
+	assert.True(t, resp.Active)
+	assert.Len(t, resp.Secret, 64)
+}
+
+//TestCreateWebhookSubscriptionWrongUrl - тест ошибки регистрации подписки с некорректным адресом
+func TestCreateWebhookSubscriptionWrongUrl(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockdb := mock_model.NewMockIBalanceInfoStorage(ctrl)
+
+	requestBody, _ := json.Marshal(webhookSubscriptionRequest{Url: "ftp://billing.local"})
+	req, err := http.NewRequest("POST", "/webhooks", bytes.NewReader(requestBody))
+	if err != nil {
+		log.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(createWebhookSubscription(mockdb))
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+//TestOpenapiDescribesAllRoutes - все маршруты executeHandlers описаны в документе OpenAPI
+func TestOpenapiDescribesAllRoutes(t *testing.T) {
+	validator, err := openapi.NewValidator()
+	assert.NoError(t, err)
+	c := New(":0")
+	c.executeHandlers(nil)
+	err = c.router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		assert.NoError(t, err)
+		methods, err := route.GetMethods()
+		assert.NoError(t, err)
+		for _, method := range methods {
+			assert.True(t, validator.HasOperation(method, template), "%s %s отсутствует в документе OpenAPI", method, template)
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+//TestSwaggerUIAssets - файлы Swagger UI отдаются из локального каталога, остальные файлы каталога недоступны
+func TestSwaggerUIAssets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swagger-ui")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "swagger-ui.css"), []byte("body {}"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret"), 0644))
+	c := New(":0")
+	c.SetSwaggerUIDir(dir)
+	c.executeHandlers(nil)
+
+	rr := httptest.NewRecorder()
+	c.router.ServeHTTP(rr, httptest.NewRequest("GET", "/docs/assets/swagger-ui.css", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "text/css; charset=utf-8", rr.Header().Get("content-type"))
+	assert.Equal(t, "body {}", rr.Body.String())
+
+	rr = httptest.NewRecorder()
+	c.router.ServeHTTP(rr, httptest.NewRequest("GET", "/docs/assets/secret.txt", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.NotContains(t, string(openapi.SwaggerUI()), "unpkg.com")
+}
+
+//TestValidationMiddleware - запрос, не соответствующий документу OpenAPI, отклоняется до вызова обработчика
+func TestValidationMiddleware(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	accStorage := mock_model.NewMockIBalanceInfoStorage(mockCtrl)
+	accStorage.EXPECT().ChangeAccountBalance(testId1, testDelta1, model.OperationDetails{}).Return(&model.OperationResult{Record: model.TransactionRecord{AccountId: testId1, Delta: testDelta1, OperationType: model.OperationDeposit}}, nil)
+
+	validator, err := openapi.NewValidator()
+	assert.NoError(t, err)
+	c := New(":0")
+	c.executeHandlers(accStorage)
+	c.router.Use(validationMiddleware(validator))
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/account/balance/change", bytes.NewReader([]byte(`{"Id":"1","Delta":15}`)))
+	c.router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	errResp := problem.Problem{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &errResp))
+	assert.Equal(t, model.ValidationFailedCode, errResp.Code)
+	assert.Equal(t, "Id: ожидается число", errResp.Detail)
+	assert.Equal(t, []problem.FieldError{{Field: "Id", Message: "ожидается число"}}, errResp.Errors)
+
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "/account/balance/change", bytes.NewReader([]byte(`{"Id":1,"Delta":15}`)))
+	c.router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+//TestTransactionsHistoryLocalized - описания операций истории формируются на языке из Accept-Language
+func TestTransactionsHistoryLocalized(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	history := []model.TransactionRecord{{AccountId: testId1, Delta: testDelta1, RemainingBalance: testBalance1, OperationType: model.OperationDeposit}}
+	mockdb := mock_model.NewMockIBalanceInfoStorage(ctrl)
+	mockdb.EXPECT().GetSortedTransactionsHistory(testId1, "", false, model.HistoryFilter{}).Return(history, nil)
+
+	requestBody, _ := json.Marshal(testTransactionsHistoryRequest)
+	req, err := http.NewRequest("POST", "/account/balance/history", bytes.NewReader(requestBody))
+	if err != nil {
+		log.Fatal(err)
+	}
+	req.Header.Set("Accept-Language", "en-US,en;q=0.9,ru;q=0.8")
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(transactionsHistory(mockdb))
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var respHistory []model.TransactionRecord
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &respHistory))
+	assert.Equal(t, fmt.Sprintf("Account %d topped up by %.2f RUB.", testId1, testDelta1), respHistory[0].TransactionMessage)
+	assert.Equal(t, model.OperationDeposit, respHistory[0].OperationType)
+}
+
+//TestRateLimitMiddleware - при превышении ограничения аккаунта возвращается 429 с заголовком Retry-After
+func TestRateLimitMiddleware(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	accStorage := mock_model.NewMockIBalanceInfoStorage(mockCtrl)
+	accStorage.EXPECT().TransferSumBetweenAccounts(testId1, testId2, testDelta1, model.OperationDetails{}).Return(&model.OperationResult{Record: model.TransactionRecord{AccountId: testId1, Delta: -testDelta1, OperationType: model.OperationTransferOut}}, nil)
+
+	limits, err := ratelimit.ParseConfig("POST /account/balance/transfer account=1/10s")
+	assert.NoError(t, err)
+	c := New(":0")
+	c.executeHandlers(accStorage)
+	c.router.Use(rateLimitMiddleware(ratelimit.NewLimiter(limits, ratelimit.NewMemoryBackend()), c.maxBodyBytes))
+
+	body := fmt.Sprintf(`{"Id1":%d,"Id2":%d,"Delta":%v}`, testId1, testId2, testDelta1)
+	rr := httptest.NewRecorder()
+	c.router.ServeHTTP(rr, httptest.NewRequest("POST", "/account/balance/transfer", bytes.NewReader([]byte(body))))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = httptest.NewRecorder()
+	c.router.ServeHTTP(rr, httptest.NewRequest("POST", "/account/balance/transfer", bytes.NewReader([]byte(body))))
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "10", rr.Header().Get("Retry-After"))
+	errResp := problem.Problem{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &errResp))
+	assert.Equal(t, model.RateLimitedCode, errResp.Code)
+}
+
+//TestRequestAccountIdBodyLimit - тело длиннее лимита отклоняется до чтения обработчиками
+func TestRequestAccountIdBodyLimit(t *testing.T) {
+	body := fmt.Sprintf(`{"Id":%d,"Delta":%v}`, testId1, testDelta1)
+	r := httptest.NewRequest("POST", "/account/balance/change", bytes.NewReader([]byte(body)))
+	accountId, err := requestAccountId(r, "/account/balance/change", int64(len(body)))
+	assert.NoError(t, err)
+	assert.Equal(t, testId1, accountId)
+	rest, err := ioutil.ReadAll(r.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, body, string(rest))
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	limits, err := ratelimit.ParseConfig("POST /account/balance/change account=1/10s")
+	assert.NoError(t, err)
+	c := New(":0")
+	c.executeHandlers(mock_model.NewMockIBalanceInfoStorage(mockCtrl))
+	c.router.Use(rateLimitMiddleware(ratelimit.NewLimiter(limits, ratelimit.NewMemoryBackend()), 10))
+	rr := httptest.NewRecorder()
+	c.router.ServeHTTP(rr, httptest.NewRequest("POST", "/account/balance/change", bytes.NewReader([]byte(body))))
+	errResp := problem.Problem{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &errResp))
+	assert.Equal(t, model.ValidationFailedCode, errResp.Code)
+}
+
+//TestReadyzHandler - при недоступности базы данных сервис не готов
+func TestReadyzHandler(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	accStorage := mock_model.NewMockIBalanceInfoStorage(mockCtrl)
+	mockStorer := mock_convert.NewMockConvertDataStorer(mockCtrl)
+	defaultStorer := convertStorer
+	convertStorer = mockStorer
+	defer func() { convertStorer = defaultStorer }()
+
+	accStorage.EXPECT().Ping().Return(&testErr1)
+	accStorage.EXPECT().Health().Return(model.StorageHealth{})
+	accStorage.EXPECT().GetSchemaVersion().Return(model.SchemaVersion, nil)
+	mockStorer.EXPECT().CachedConvertData().Return(model.ConvertData{FillingTime: time.Now()})
+
+	rr := httptest.NewRecorder()
+	readyzHandler(accStorage).ServeHTTP(rr, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	report := health.Report{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &report))
+	assert.Equal(t, health.StatusFail, report.Status)
+	assert.Equal(t, "Ошибка", report.Checks["database"].Error)
+}
+
+//TestCircuitBreakerMiddleware - пока выключатель хранилища разомкнут, запросы к базе данных отклоняются с кодом 503
+func TestCircuitBreakerMiddleware(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	accStorage := mock_model.NewMockIBalanceInfoStorage(mockCtrl)
+	accStorage.EXPECT().Health().Return(model.StorageHealth{CircuitOpen: true, RetryAfter: 1500 * time.Millisecond})
+
+	c := New(":0")
+	c.executeHandlers(accStorage)
+	c.router.Use(circuitBreakerMiddleware(accStorage))
+
+	rr := httptest.NewRecorder()
+	c.router.ServeHTTP(rr, httptest.NewRequest("GET", fmt.Sprintf("/account/balance/info/%d", testId1), nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, "2", rr.Header().Get("Retry-After"))
+	errResp := problem.Problem{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &errResp))
+	assert.Equal(t, model.UnavailableCode, errResp.Code)
+
+	rr = httptest.NewRecorder()
+	c.router.ServeHTTP(rr, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+//TestStrongConsistencyReadsPrimary - с заголовком X-Consistency: strong баланс читается с основного сервера
+func TestStrongConsistencyReadsPrimary(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	accStorage := mock_model.NewMockIBalanceInfoStorage(mockCtrl)
+	primary := mock_model.NewMockIBalanceInfoStorage(mockCtrl)
+	accStorage.EXPECT().Primary().Return(primary)
+	primary.EXPECT().GetAccountBalance(testId1).Return(&testBalanceInfo1, nil)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/account/balance/info/{id:[0-9]+}", accountBalanceById(accStorage)).Methods("GET")
+	req := httptest.NewRequest("GET", fmt.Sprintf("/account/balance/info/%d", testId1), nil)
+	req.Header.Set("X-Consistency", "strong")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	res, _ := json.Marshal(testRespMessage1)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, res, rr.Body.Bytes())
+}
+
+//TestAccountBalanceAt - баланс на момент времени запрашивается по параметру at
+func TestAccountBalanceAt(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	accStorage := mock_model.NewMockIBalanceInfoStorage(mockCtrl)
+	at := time.Date(2020, 9, 21, 18, 0, 0, 0, time.UTC)
+	accStorage.EXPECT().GetAccountBalanceAt(testId1, at).Return(&model.BalanceInfo{AccountId: testId1, Balance: testBalance1}, nil)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/account/balance/info/{id:[0-9]+}", accountBalanceById(accStorage)).Methods("GET")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", fmt.Sprintf("/account/balance/info/%d?at=2020-09-21T18:00:00Z", testId1), nil))
+	res, _ := json.Marshal(accountByIdResponse{Id: testId1, Balance: testBalance1, Currency: model.BaseCurrency, At: &at})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, res, rr.Body.Bytes())
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", fmt.Sprintf("/account/balance/info/%d?at=yesterday", testId1), nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+//TestLastReconciliation - результат последней сверки; если сверка не выполнялась, возвращается 404
+func TestLastReconciliation(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	accStorage := mock_model.NewMockIBalanceInfoStorage(mockCtrl)
+	run := &model.ReconciliationRun{
+		Id:               1,
+		AccountsChecked:  2,
+		DiscrepancyCount: 1,
+		Discrepancies:    []model.LedgerDiscrepancy{{AccountId: testId1, Kind: model.DiscrepancyBalance, Expected: 100, Actual: testBalance1}},
+	}
+	gomock.InOrder(
+		accStorage.EXPECT().GetLastReconciliationRun().
+			Return(nil, &model.CustomErr{Err: errors.New("Ошибка"), ErrCode: model.NotFoundCode}),
+		accStorage.EXPECT().GetLastReconciliationRun().Return(run, nil),
+	)
+
+	handler := lastReconciliation(accStorage)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/reconciliation", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/reconciliation", nil))
+	res, _ := json.Marshal(run)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, res, rr.Body.Bytes())
+}
+
+//TestVerifyHistoryChain - измененная запись истории обнаруживается проверкой цепочки хешей
+func TestVerifyHistoryChain(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	accStorage := mock_model.NewMockIBalanceInfoStorage(mockCtrl)
+	record := model.TransactionRecord{Id: 5, AccountId: testId1, Delta: testBalance1, RemainingBalance: testBalance1,
+		OperationType: model.OperationDeposit, CreatedAt: time.Date(2020, 9, 21, 18, 0, 0, 0, time.UTC)}
+	record.Hash = hashchain.Hash(record, "")
+	record.Delta = 1
+	accStorage.EXPECT().GetHistoryChain(testId1).Return([]model.TransactionRecord{record}, nil)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/account/balance/history/verify/{id:[0-9]+}", verifyHistoryChain(accStorage)).Methods("GET")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", fmt.Sprintf("/account/balance/history/verify/%d", testId1), nil))
+	result := model.ChainVerification{}
+	json.Unmarshal(rr.Body.Bytes(), &result)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.False(t, result.Valid)
+	assert.Equal(t, int64(5), result.BrokenRecordId)
+	assert.Equal(t, model.ChainHashMismatch, result.Reason)
+}
+
+//TestClientCertMiddleware - без сертификата клиента доступны только проверки доступности,
+//идентификатор из сертификата используется для учета запросов клиента
+func TestClientCertMiddleware(t *testing.T) {
+	handler := clientCertMiddleware(nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(clientIdentity(r)))
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/account/balance/info/1", nil))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	errResp := problem.Problem{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &errResp))
+	assert.Equal(t, model.ForbiddenCode, errResp.Code)
+
+	r := httptest.NewRequest("GET", "/account/balance/info/1", nil)
+	r = r.WithContext(context.WithValue(r.Context(), clientIdentityKey{}, "billing"))
+	assert.Equal(t, "cert:billing", clientIdentity(r))
+}
+
+//TestAccountStatement - выписка за месяц рассчитывается за период с начала месяца до начала следующего
+//и возвращается в формате HTML на языке клиента
+func TestAccountStatement(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	accStorage := mock_model.NewMockIBalanceInfoStorage(mockCtrl)
+	from, to := time.Date(2020, 9, 1, 0, 0, 0, 0, time.UTC), time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC)
+	accStorage.EXPECT().BuildStatement(testId1, from, to).Return(&model.Statement{
+		AccountId: testId1, PeriodStart: from, PeriodEnd: to, ClosingBalance: testBalance1, TotalCredits: testBalance1, MovementCount: 1,
+		Movements: []model.TransactionRecord{{AccountId: testId1, Delta: testBalance1, RemainingBalance: testBalance1, OperationType: model.OperationDeposit}},
+	}, nil)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/account/balance/statement/{id:[0-9]+}", accountStatement(accStorage)).Methods("GET")
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", fmt.Sprintf("/account/balance/statement/%d?month=2020-09&format=html", testId1), nil)
+	req.Header.Set("Accept-Language", "en")
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "text/html; charset=utf-8", rr.Header().Get("content-type"))
+	assert.Contains(t, rr.Body.String(), fmt.Sprintf("Statement of account %d", testId1))
+	assert.Contains(t, rr.Body.String(), fmt.Sprintf("Account %d topped up by %.2f RUB.", testId1, testBalance1))
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", fmt.Sprintf("/account/balance/statement/%d?from=2020-09-02T00:00:00Z&to=2020-09-01T00:00:00Z", testId1), nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+//TestStoredStatementNotFound - ошибка not_found при отсутствии сохраненной выписки за месяц
+func TestStoredStatementNotFound(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	accStorage := mock_model.NewMockIBalanceInfoStorage(mockCtrl)
+	accStorage.EXPECT().GetStatement(testId1, time.Date(2020, 9, 1, 0, 0, 0, 0, time.UTC)).
+		Return(nil, &model.CustomErr{Err: errors.New("record not found"), ErrCode: model.NotFoundCode})
+
+	router := mux.NewRouter()
+	router.HandleFunc("/account/balance/statements/{id:[0-9]+}/{month}", storedStatement(accStorage)).Methods("GET")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", fmt.Sprintf("/account/balance/statements/%d/2020-09", testId1), nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", fmt.Sprintf("/account/balance/statements/%d/2020-13", testId1), nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+//TestAccountTurnover - обороты аккаунта запрашиваются за указанные дни с группировкой по типам операций;
+//некорректный период группировки отклоняется
+func TestAccountTurnover(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	accStorage := mock_model.NewMockIBalanceInfoStorage(mockCtrl)
+	deposit := model.OperationDeposit
+	accStorage.EXPECT().GetTurnover(model.TurnoverFilter{
+		AccountId:       testId1,
+		Period:          model.TurnoverWeek,
+		From:            time.Date(2020, 9, 7, 0, 0, 0, 0, time.UTC),
+		To:              time.Date(2020, 9, 21, 0, 0, 0, 0, time.UTC),
+		ByOperationType: true,
+	}).Return([]model.Turnover{{PeriodStart: time.Date(2020, 9, 14, 0, 0, 0, 0, time.UTC), OperationType: &deposit,
+		Credits: testBalance1, OperationCount: 1, NetChange: testBalance1}}, nil)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/account/balance/turnover/{id:[0-9]+}", accountTurnover(accStorage)).Methods("GET")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", fmt.Sprintf("/account/balance/turnover/%d?period=week&from=2020-09-07&to=2020-09-21&by=operation_type", testId1), nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	result := turnoverResponse{}
+	json.Unmarshal(rr.Body.Bytes(), &result)
+	assert.Equal(t, testId1, result.AccountId)
+	assert.Equal(t, "2020-09-07", result.From)
+	if assert.Len(t, result.Turnover, 1) {
+		assert.Equal(t, deposit, *result.Turnover[0].OperationType)
+		assert.Equal(t, testBalance1, result.Turnover[0].NetChange)
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", fmt.Sprintf("/account/balance/turnover/%d?period=year", testId1), nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+//TestTurnoverFilterDefaults - по умолчанию обороты запрашиваются по неделям за 12 недель, начиная с понедельника
+func TestTurnoverFilterDefaults(t *testing.T) {
+	filter, ok := turnoverFilter(httptest.NewRequest("GET", "/admin/turnover?period=week&to=2020-09-24", nil), httptest.NewRecorder())
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2020, 6, 29, 0, 0, 0, 0, time.UTC), filter.From)
+	assert.Equal(t, time.Monday, filter.From.Weekday())
+	assert.Equal(t, 0, filter.AccountId)
+}
+
+//TestTransferSumDetails - назначение, внешний идентификатор, метаданные и валюта перевода с курсом передаются в хранилище,
+//сумма в валюте пересчитывается в рубли, при превышении ограничений перевод не выполняется
+func TestTransferSumDetails(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	accStorage := mock_model.NewMockIBalanceInfoStorage(mockCtrl)
+	mockStorer := mock_convert.NewMockConvertDataStorer(mockCtrl)
+	mockStorer.EXPECT().GetConvertData().Return(testConvertData, nil)
+	defaultStorer := convertStorer
+	convertStorer = mockStorer
+	defer func() { convertStorer = defaultStorer }()
+	details := model.OperationDetails{Purpose: "Оплата заказа", ExternalRef: "order-42", Metadata: model.Metadata{"channel": "web"}, Currency: "USD", Rate: testRate}
+	accStorage.EXPECT().TransferSumBetweenAccounts(testId1, testId2, testDelta1/testRate, details).
+		Return(&model.OperationResult{Record: model.TransactionRecord{AccountId: testId1, Delta: -testDelta1, OperationType: model.OperationTransferOut, CounterpartyId: &testId2}}, nil)
+
+	request := transferSumRequest{Id1: testId1, Id2: testId2, Delta: testDelta1, Currency: "usd", Purpose: details.Purpose, ExternalRef: details.ExternalRef, Metadata: details.Metadata}
+	requestBody, _ := json.Marshal(request)
+	rr := httptest.NewRecorder()
+	transferSum(accStorage).ServeHTTP(rr, httptest.NewRequest("POST", "/account/balance/transfer", bytes.NewReader(requestBody)))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	request.ExternalRef = strings.Repeat("x", maxExternalRefLength+1)
+	requestBody, _ = json.Marshal(request)
+	rr = httptest.NewRecorder()
+	transferSum(accStorage).ServeHTTP(rr, httptest.NewRequest("POST", "/account/balance/transfer", bytes.NewReader(requestBody)))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+//TestChangeAccountBalanceCurrency - операция в неизвестной валюте или без курса валюты не выполняется
+func TestChangeAccountBalanceCurrency(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	accStorage := mock_model.NewMockIBalanceInfoStorage(mockCtrl)
+	mockStorer := mock_convert.NewMockConvertDataStorer(mockCtrl)
+	mockStorer.EXPECT().GetConvertData().Return(testConvertData, nil)
+	mockStorer.EXPECT().GetConvertData().Return(model.ConvertData{}, errors.New("Ошибка"))
+	defaultStorer := convertStorer
+	convertStorer = mockStorer
+	defer func() { convertStorer = defaultStorer }()
+
+	requestBody, _ := json.Marshal(changeAccBalanceRequest{Id: testId1, Delta: -testDelta1, Currency: "xyz"})
+	rr := httptest.NewRecorder()
+	changeAccountBalance(accStorage).ServeHTTP(rr, httptest.NewRequest("POST", "/account/balance/change", bytes.NewReader(requestBody)))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	requestBody, _ = json.Marshal(changeAccBalanceRequest{Id: testId1, Delta: -testDelta1, Currency: "usd"})
+	rr = httptest.NewRecorder()
+	changeAccountBalance(accStorage).ServeHTTP(rr, httptest.NewRequest("POST", "/account/balance/change", bytes.NewReader(requestBody)))
+	assert.NotEqual(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), string(model.RateUnavailableCode))
+}
+
+//TestHistoryByExternalRef - поиск записей истории по внешнему идентификатору всех аккаунтов или одного аккаунта
+func TestHistoryByExternalRef(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	accStorage := mock_model.NewMockIBalanceInfoStorage(mockCtrl)
+	records := []model.TransactionRecord{
+		{AccountId: testId1, Delta: -testDelta1, OperationType: model.OperationTransferOut, CounterpartyId: &testId2, ExternalRef: "order-42"},
+		{AccountId: testId2, Delta: testDelta1, OperationType: model.OperationTransferIn, CounterpartyId: &testId1, ExternalRef: "order-42"},
+	}
+	accStorage.EXPECT().FindTransactionsByExternalRef("order-42", 0).Return(records, nil)
+	accStorage.EXPECT().FindTransactionsByExternalRef("order-42", testId2).Return([]model.TransactionRecord{}, nil)
+
+	rr := httptest.NewRecorder()
+	historyByExternalRef(accStorage).ServeHTTP(rr, httptest.NewRequest("GET", "/account/balance/history/search?ref=order-42", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	result := []model.TransactionRecord{}
+	json.Unmarshal(rr.Body.Bytes(), &result)
+	if assert.Len(t, result, 2) {
+		assert.Equal(t, "order-42", result[1].ExternalRef)
+		assert.NotEmpty(t, result[1].TransactionMessage)
+	}
+
+	rr = httptest.NewRecorder()
+	historyByExternalRef(accStorage).ServeHTTP(rr, httptest.NewRequest("GET", fmt.Sprintf("/account/balance/history/search?ref=order-42&id=%d", testId2), nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = httptest.NewRecorder()
+	historyByExternalRef(accStorage).ServeHTTP(rr, httptest.NewRequest("GET", "/account/balance/history/search", nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+//TestTransactionsHistoryFilter - отбор истории по типам операций и второму аккаунту, неизвестный тип операции отклоняется
+func TestTransactionsHistoryFilter(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	accStorage := mock_model.NewMockIBalanceInfoStorage(mockCtrl)
+	filter := model.HistoryFilter{OperationTypes: []string{model.OperationTransferOut, model.OperationReversal}, CounterpartyId: testId2}
+	accStorage.EXPECT().GetSortedTransactionsHistory(testId1, "", false, filter).Return(testHistory, nil)
+
+	requestBody, _ := json.Marshal(transactionsHistoryRequest{Id: testId1, OperationTypes: filter.OperationTypes, CounterpartyId: testId2})
+	rr := httptest.NewRecorder()
+	transactionsHistory(accStorage).ServeHTTP(rr, httptest.NewRequest("POST", "/account/balance/history", bytes.NewReader(requestBody)))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	requestBody, _ = json.Marshal(transactionsHistoryRequest{Id: testId1, OperationTypes: []string{"refund"}})
+	rr = httptest.NewRecorder()
+	transactionsHistory(accStorage).ServeHTTP(rr, httptest.NewRequest("POST", "/account/balance/history", bytes.NewReader(requestBody)))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+//TestReverseOperation - отмена операции возвращает описание записи отмены, повторная отмена - ошибку 409,
+//отмена записи, которую нельзя отменить, - ошибку 400
+func TestReverseOperation(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	accStorage := mock_model.NewMockIBalanceInfoStorage(mockCtrl)
+	reversalOf := int64(18)
+	details := model.OperationDetails{Purpose: "Ошибочный перевод"}
+	gomock.InOrder(
+		accStorage.EXPECT().ReverseOperation(reversalOf, details).Return(&model.OperationResult{Record: model.TransactionRecord{
+			AccountId: testId1, Delta: testDelta1, OperationType: model.OperationReversal, CounterpartyId: &testId2, ReversalOf: &reversalOf}}, nil),
+		accStorage.EXPECT().ReverseOperation(reversalOf, details).
+			Return(nil, &model.CustomErr{Err: errors.New("Ошибка"), ErrCode: model.AlreadyReversedCode}),
+		accStorage.EXPECT().ReverseOperation(reversalOf, details).
+			Return(nil, &model.CustomErr{Err: errors.New("Ошибка"), ErrCode: model.WrongInputParamsCode}),
+	)
+
+	requestBody, _ := json.Marshal(reverseOperationRequest{Id: reversalOf, Purpose: details.Purpose})
+	rr := httptest.NewRecorder()
+	reverseOperation(accStorage).ServeHTTP(rr, httptest.NewRequest("POST", "/account/balance/reversal", bytes.NewReader(requestBody)))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	result := reverseOperationResponse{}
+	json.Unmarshal(rr.Body.Bytes(), &result)
+	assert.Equal(t, fmt.Sprintf("Отмена операции 18: баланс аккаунта %d изменен на +%.2f руб.", testId1, testDelta1), result.Message)
+
+	rr = httptest.NewRecorder()
+	reverseOperation(accStorage).ServeHTTP(rr, httptest.NewRequest("POST", "/account/balance/reversal", bytes.NewReader(requestBody)))
+	assert.Equal(t, http.StatusConflict, rr.Code)
+
+	rr = httptest.NewRecorder()
+	reverseOperation(accStorage).ServeHTTP(rr, httptest.NewRequest("POST", "/account/balance/reversal", bytes.NewReader(requestBody)))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+//TestSubAccounts - подчинение, отделение, пополнение и перевод средств субаккаунта
+func TestSubAccounts(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	accStorage := mock_model.NewMockIBalanceInfoStorage(mockCtrl)
+	details := model.OperationDetails{Purpose: "Бюджет"}
+	gomock.InOrder(
+		accStorage.EXPECT().SetAccountParent(testId2, testId1).Return(nil),
+		accStorage.EXPECT().SetAccountParent(testId2, testId1).
+			Return(&model.CustomErr{Err: errors.New("Ошибка"), ErrCode: model.WrongInputParamsCode}),
+		accStorage.EXPECT().SetAccountParent(testId2, 0).Return(nil),
+		accStorage.EXPECT().FundSubAccount(testId1, testId2, testDelta1, details).Return(&model.OperationResult{Record: model.TransactionRecord{
+			AccountId: testId1, Delta: -testDelta1, OperationType: model.OperationTransferOut, CounterpartyId: &testId2}}, nil),
+		accStorage.EXPECT().SweepSubAccount(testId1, testId2, 0.0, model.OperationDetails{}).
+			Return(nil, &model.CustomErr{Err: errors.New("Ошибка"), ErrCode: model.NotSubAccountCode}),
+	)
+
+	requestBody, _ := json.Marshal(subAccountRequest{ParentId: testId1, ChildId: testId2})
+	rr := httptest.NewRecorder()
+	setAccountParent(accStorage).ServeHTTP(rr, httptest.NewRequest("POST", "/account/subaccounts", bytes.NewReader(requestBody)))
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+
+	rr = httptest.NewRecorder()
+	setAccountParent(accStorage).ServeHTTP(rr, httptest.NewRequest("POST", "/account/subaccounts", bytes.NewReader(requestBody)))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/account/subaccounts/{id:[0-9]+}", detachSubAccount(accStorage)).Methods("DELETE")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("DELETE", fmt.Sprintf("/account/subaccounts/%d", testId2), nil))
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+
+	requestBody, _ = json.Marshal(subAccountFundsRequest{ParentId: testId1, ChildId: testId2, Delta: testDelta1, Purpose: details.Purpose})
+	rr = httptest.NewRecorder()
+	fundSubAccount(accStorage).ServeHTTP(rr, httptest.NewRequest("POST", "/account/subaccounts/fund", bytes.NewReader(requestBody)))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	result := subAccountFundsResponse{}
+	json.Unmarshal(rr.Body.Bytes(), &result)
+	assert.Equal(t, fmt.Sprintf("Перевод на сумму %.2f руб. с аккаунта %d на аккаунт %d выполнен успешно.", testDelta1, testId1, testId2), result.Message)
+
+	//для пополнения сумма обязательна, при переводе на родительский аккаунт переводится весь баланс
+	requestBody, _ = json.Marshal(subAccountFundsRequest{ParentId: testId1, ChildId: testId2})
+	rr = httptest.NewRecorder()
+	fundSubAccount(accStorage).ServeHTTP(rr, httptest.NewRequest("POST", "/account/subaccounts/fund", bytes.NewReader(requestBody)))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = httptest.NewRecorder()
+	sweepSubAccount(accStorage).ServeHTTP(rr, httptest.NewRequest("POST", "/account/subaccounts/sweep", bytes.NewReader(requestBody)))
+	assert.Equal(t, http.StatusConflict, rr.Code)
+}
+
+//TestConsolidatedBalance - консолидированный баланс возвращается вместе с субаккаунтами
+func TestConsolidatedBalance(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	accStorage := mock_model.NewMockIBalanceInfoStorage(mockCtrl)
+	balance := &model.ConsolidatedBalance{AccountId: testId1, Balance: testBalance1, ConsolidatedBalance: testBalance1 + testBalance2,
+		SubAccounts: []model.SubAccountBalance{{AccountId: testId2, ParentId: testId1, Depth: 1, Balance: testBalance2, ConsolidatedBalance: testBalance2}}}
+	accStorage.EXPECT().GetConsolidatedBalance(testId1).Return(balance, nil)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/account/balance/consolidated/{id:[0-9]+}", consolidatedBalance(accStorage)).Methods("GET")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", fmt.Sprintf("/account/balance/consolidated/%d", testId1), nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	result := model.ConsolidatedBalance{}
+	json.Unmarshal(rr.Body.Bytes(), &result)
+	assert.Equal(t, *balance, result)
+}
+
+//TestAccruedInterest - невыплаченные проценты аккаунта; для отсутствующего аккаунта возвращается 404
+func TestAccruedInterest(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	accStorage := mock_model.NewMockIBalanceInfoStorage(mockCtrl)
+	day := time.Date(2020, 9, 21, 0, 0, 0, 0, time.UTC)
+	preview := &model.InterestPreview{AccountId: testId1, Product: "savings", AnnualRate: 3.65, Accrued: 0.1, AccruedFrom: &day, AccruedTo: &day,
+		Accruals: []model.InterestAccrual{{AccountId: testId1, Day: day, Balance: testBalance1, AnnualRate: 3.65, Amount: 0.1, ExpenseAccountId: testId2}}}
+	gomock.InOrder(
+		accStorage.EXPECT().GetAccruedInterest(testId1).Return(preview, nil),
+		accStorage.EXPECT().GetAccruedInterest(testId2).
+			Return(nil, &model.CustomErr{Err: errors.New("Ошибка"), ErrCode: model.NotFoundCode}),
+	)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/account/interest/{id:[0-9]+}", accruedInterest(accStorage)).Methods("GET")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", fmt.Sprintf("/account/interest/%d", testId1), nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	result := model.InterestPreview{}
+	json.Unmarshal(rr.Body.Bytes(), &result)
+	assert.Equal(t, *preview, result)
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", fmt.Sprintf("/account/interest/%d", testId2), nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+//TestBonusOperations - начисление бонусов со сроком действия и списание только в оплату покупки
+func TestBonusOperations(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	accStorage := mock_model.NewMockIBalanceInfoStorage(mockCtrl)
+	details := model.OperationDetails{Purpose: "Кэшбэк", ExternalRef: "order-42"}
+	purchase := model.OperationDetails{ExternalRef: "order-43"}
+	before := time.Now().AddDate(0, 0, 30)
+	gomock.InOrder(
+		accStorage.EXPECT().CreditBonus(testId1, 50.0, gomock.Any(), details).
+			DoAndReturn(func(id int, amount float64, expiresAt time.Time, details model.OperationDetails) (*model.BonusRecord, *model.CustomErr) {
+				assert.False(t, expiresAt.Before(before))
+				assert.True(t, expiresAt.Before(before.Add(time.Minute)))
+				return &model.BonusRecord{AccountId: id, Delta: amount, RemainingBalance: 80, OperationType: model.BonusCredit}, nil
+			}),
+		accStorage.EXPECT().SpendBonus(testId1, 60.0, purchase).Return([]model.BonusRecord{
+			{AccountId: testId1, LotId: 1, Delta: -30, RemainingBalance: 50, OperationType: model.BonusSpend},
+			{AccountId: testId1, LotId: 2, Delta: -30, RemainingBalance: 20, OperationType: model.BonusSpend},
+		}, nil),
+		accStorage.EXPECT().SpendBonus(testId1, 60.0, purchase).
+			Return(nil, &model.CustomErr{Err: errors.New("Ошибка"), ErrCode: model.InsufficientFundsCode}),
+	)
+
+	requestBody, _ := json.Marshal(bonusCreditRequest{Id: testId1, Amount: 50, ExpiresInDays: 30, Purpose: details.Purpose, ExternalRef: details.ExternalRef})
+	rr := httptest.NewRecorder()
+	creditBonus(accStorage).ServeHTTP(rr, httptest.NewRequest("POST", "/account/bonus/credit", bytes.NewReader(requestBody)))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	result := bonusOperationResponse{}
+	json.Unmarshal(rr.Body.Bytes(), &result)
+	assert.Equal(t, bonusOperationResponse{Message: "На аккаунт 1 начислено 50.00 бонусов.", BonusBalance: 80}, result)
+
+	//срок действия обязателен
+	requestBody, _ = json.Marshal(bonusCreditRequest{Id: testId1, Amount: 50})
+	rr = httptest.NewRecorder()
+	creditBonus(accStorage).ServeHTTP(rr, httptest.NewRequest("POST", "/account/bonus/credit", bytes.NewReader(requestBody)))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	requestBody, _ = json.Marshal(bonusSpendRequest{Id: testId1, Amount: 60, ExternalRef: purchase.ExternalRef})
+	rr = httptest.NewRecorder()
+	spendBonus(accStorage).ServeHTTP(rr, httptest.NewRequest("POST", "/account/bonus/spend", bytes.NewReader(requestBody)))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	result = bonusOperationResponse{}
+	json.Unmarshal(rr.Body.Bytes(), &result)
+	assert.Equal(t, bonusOperationResponse{Message: "С аккаунта 1 списано 60.00 бонусов в оплату покупки.", BonusBalance: 20}, result)
+
+	rr = httptest.NewRecorder()
+	spendBonus(accStorage).ServeHTTP(rr, httptest.NewRequest("POST", "/account/bonus/spend", bytes.NewReader(requestBody)))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	//без заказа бонусы не списываются
+	requestBody, _ = json.Marshal(bonusSpendRequest{Id: testId1, Amount: 60})
+	rr = httptest.NewRecorder()
+	spendBonus(accStorage).ServeHTTP(rr, httptest.NewRequest("POST", "/account/bonus/spend", bytes.NewReader(requestBody)))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+//TestBonusLots - бонусный баланс считается по действующим партиям, история бонусов локализуется
+func TestBonusLots(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	accStorage := mock_model.NewMockIBalanceInfoStorage(mockCtrl)
+	lots := []model.BonusLot{
+		{Id: 1, AccountId: testId1, Amount: 50, Remaining: 20.1},
+		{Id: 2, AccountId: testId1, Amount: 30, Remaining: 30.2},
+	}
+	accStorage.EXPECT().GetBonusLots(testId1).Return(lots, nil)
+	accStorage.EXPECT().GetBonusHistory(testId1).Return([]model.BonusRecord{
+		{Id: 1, AccountId: testId1, LotId: 1, Delta: -29.9, RemainingBalance: 50.3, OperationType: model.BonusExpiry},
+	}, nil)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/account/bonus/{id:[0-9]+}", bonusLots(accStorage)).Methods("GET")
+	router.HandleFunc("/account/bonus/{id:[0-9]+}/history", bonusHistory(accStorage)).Methods("GET")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", fmt.Sprintf("/account/bonus/%d", testId1), nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	result := bonusLotsResponse{}
+	json.Unmarshal(rr.Body.Bytes(), &result)
+	assert.Equal(t, 50.3, result.BonusBalance)
+	assert.Equal(t, lots, result.Lots)
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/account/bonus/%d/history", testId1), nil)
+	req.Header.Set("Accept-Language", "en")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	history := []model.BonusRecord{}
+	json.Unmarshal(rr.Body.Bytes(), &history)
+	assert.Equal(t, "29.90 bonus points expired on account 1.", history[0].TransactionMessage)
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/call-me-snake/user_balance_service/internal/i18n"
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	"github.com/call-me-snake/user_balance_service/internal/tlsconfig"
+)
+
+//clientIdentityKey - ключ контекста запроса, под которым хранится идентификатор клиента из его сертификата
+type clientIdentityKey struct{}
+
+//probePaths - проверки доступности, доступные клиентам без сертификата при необязательном сертификате клиента
+var probePaths = map[string]bool{
+	"/alive":   true,
+	"/healthz": true,
+	"/readyz":  true,
+}
+
+//clientCertMiddleware - запросы клиентов без сертификата (кроме проверок доступности) и клиентов, субъекта
+//сертификата которых нет в списке допустимых, отклоняются с кодом 403. Идентификатор клиента сохраняется
+//в контексте запроса
+func clientCertMiddleware(manager *tlsconfig.Manager, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+			if !probePaths[r.URL.Path] {
+				makeErrResponce(r, model.ForbiddenCode, message(r, i18n.ClientCertRequired), w)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		cert := r.TLS.PeerCertificates[0]
+		identity, ok := manager.ClientIdentity(cert)
+		if !ok {
+			makeErrResponce(r, model.ForbiddenCode, message(r, i18n.ClientNotAllowed, cert.Subject.String()), w)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIdentityKey{}, identity)))
+	})
+}
+
+//requestClientIdentity - идентификатор клиента из его сертификата. Пустая строка - клиент не предъявил сертификат
+func requestClientIdentity(r *http.Request) string {
+	identity, _ := r.Context().Value(clientIdentityKey{}).(string)
+	return identity
+}
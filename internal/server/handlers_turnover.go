@@ -0,0 +1,105 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/i18n"
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	"github.com/gorilla/mux"
+)
+
+//dateLayout - формат дат параметров from и to запроса оборотов
+const dateLayout = "2006-01-02"
+
+//groupByOperationType - значение параметра by для группировки оборотов по типам операций
+const groupByOperationType = "operation_type"
+
+//accountTurnover - обороты аккаунта по дням, неделям или месяцам
+//пример запроса /account/balance/turnover/1?period=week&from=2020-09-01&to=2020-10-01&by=operation_type
+func accountTurnover(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			makeErrResponce(r, model.WrongInputParamsCode, message(r, i18n.InvalidId), w)
+			return
+		}
+		filter, ok := turnoverFilter(r, w)
+		if !ok {
+			return
+		}
+		filter.AccountId = id
+		writeTurnover(r, accStorage, filter, w)
+	}
+}
+
+//serviceTurnover - обороты всех аккаунтов сервиса по дням, неделям или месяцам
+func serviceTurnover(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, ok := turnoverFilter(r, w)
+		if !ok {
+			return
+		}
+		writeTurnover(r, accStorage, filter, w)
+	}
+}
+
+//turnoverFilter - условия запроса оборотов из параметров period (по умолчанию day), from и to (даты YYYY-MM-DD, to не
+//включается) и by. По умолчанию to - завтрашний день, from - за 30 дней, 12 недель или 12 месяцев до него.
+//При некорректных параметрах отправляется ответ с ошибкой
+func turnoverFilter(r *http.Request, w http.ResponseWriter) (model.TurnoverFilter, bool) {
+	filter := model.TurnoverFilter{Period: r.FormValue("period"), ByOperationType: r.FormValue("by") == groupByOperationType}
+	if filter.Period == "" {
+		filter.Period = model.TurnoverDay
+	}
+	if filter.Period != model.TurnoverDay && filter.Period != model.TurnoverWeek && filter.Period != model.TurnoverMonth {
+		makeErrResponce(r, model.WrongInputParamsCode, message(r, i18n.InvalidTurnoverPeriod), w)
+		return filter, false
+	}
+	if by := r.FormValue("by"); by != "" && by != groupByOperationType {
+		makeErrResponce(r, model.WrongInputParamsCode, message(r, i18n.InvalidTurnoverGroup), w)
+		return filter, false
+	}
+
+	var err error
+	now := time.Now().UTC()
+	filter.To = time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	if to := r.FormValue("to"); to != "" {
+		filter.To, err = time.Parse(dateLayout, to)
+	}
+	if from := r.FormValue("from"); from != "" && err == nil {
+		filter.From, err = time.Parse(dateLayout, from)
+	} else if err == nil {
+		switch filter.Period {
+		case model.TurnoverDay:
+			filter.From = filter.To.AddDate(0, 0, -30)
+		case model.TurnoverWeek:
+			//начало недели, отстоящей на 12 недель от to: недели считаются с понедельника
+			filter.From = filter.To.AddDate(0, 0, -12*7-(int(filter.To.Weekday())+6)%7)
+		case model.TurnoverMonth:
+			filter.From = time.Date(filter.To.Year(), filter.To.Month()-12, 1, 0, 0, 0, 0, time.UTC)
+		}
+	}
+	if err != nil || !filter.From.Before(filter.To) {
+		makeErrResponce(r, model.WrongInputParamsCode, message(r, i18n.InvalidDateRange), w)
+		return filter, false
+	}
+	return filter, true
+}
+
+//writeTurnover - ответ с оборотами по условиям filter
+func writeTurnover(r *http.Request, accStorage model.IBalanceInfoStorage, filter model.TurnoverFilter, w http.ResponseWriter) {
+	turnover, custErr := readStorage(r, accStorage).GetTurnover(filter)
+	if custErr != nil {
+		makeCustomErrResponce(r, custErr, w)
+		return
+	}
+	makeJSONResponce(turnoverResponse{
+		AccountId: filter.AccountId,
+		Period:    filter.Period,
+		From:      filter.From.Format(dateLayout),
+		To:        filter.To.Format(dateLayout),
+		Turnover:  turnover,
+	}, w)
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/call-me-snake/user_balance_service/internal/i18n"
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	"github.com/gorilla/mux"
+)
+
+//deliveriesListLimit - максимальное количество доставок в ответе webhookDeliveries
+const deliveriesListLimit = 100
+
+//createWebhookSubscription - регистрация адреса для получения событий об изменении баланса.
+//Если Secret не передан, он генерируется и возвращается в ответе (только при создании)
+//пример тела запроса: {"Url":"https://billing.local/hooks/balance","Secret":"s3cr3t"}
+func createWebhookSubscription(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		subscriptionRequest := &webhookSubscriptionRequest{}
+		err := json.NewDecoder(r.Body).Decode(subscriptionRequest)
+		if err != nil {
+			makeErrResponce(r, model.WrongInputParamsCode, "", w)
+			return
+		}
+		u, err := url.Parse(subscriptionRequest.Url)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			makeErrResponce(r, model.WrongInputParamsCode, message(r, i18n.InvalidWebhookUrl), w)
+			return
+		}
+		secret := subscriptionRequest.Secret
+		if secret == "" {
+			secret = generateSecret()
+		}
+
+		created, custErr := accStorage.CreateWebhookSubscription(&model.WebhookSubscription{Url: u.String(), Secret: secret, Active: true})
+		if custErr != nil {
+			makeCustomErrResponce(r, custErr, w)
+			return
+		}
+		respMessage := makeWebhookSubscriptionResponse(created)
+		respMessage.Secret = created.Secret
+		makeJSONResponce(respMessage, w)
+	}
+}
+
+//webhookSubscriptions - список подписок (без ключей подписи)
+func webhookSubscriptions(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		subscriptions, custErr := accStorage.GetWebhookSubscriptions()
+		if custErr != nil {
+			makeCustomErrResponce(r, custErr, w)
+			return
+		}
+		respMessage := make([]webhookSubscriptionResponse, 0, len(subscriptions))
+		for i := range subscriptions {
+			respMessage = append(respMessage, makeWebhookSubscriptionResponse(&subscriptions[i]))
+		}
+		makeJSONResponce(respMessage, w)
+	}
+}
+
+//deleteWebhookSubscription - удаление подписки
+func deleteWebhookSubscription(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, _ := strconv.Atoi(mux.Vars(r)["id"])
+		if custErr := accStorage.DeleteWebhookSubscription(id); custErr != nil {
+			makeCustomErrResponce(r, custErr, w)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+//webhookDeliveries - список последних доставок. Параметр status=pending|delivered|dead ограничивает выборку
+func webhookDeliveries(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := r.FormValue("status")
+		if status != "" && status != model.DeliveryPending && status != model.DeliveryDelivered && status != model.DeliveryDead {
+			makeErrResponce(r, model.WrongInputParamsCode, message(r, i18n.InvalidStatus), w)
+			return
+		}
+		deliveries, custErr := accStorage.GetWebhookDeliveries(status, deliveriesListLimit)
+		if custErr != nil {
+			makeCustomErrResponce(r, custErr, w)
+			return
+		}
+		respMessage := make([]webhookDeliveryResponse, 0, len(deliveries))
+		for _, delivery := range deliveries {
+			respMessage = append(respMessage, webhookDeliveryResponse{
+				Id:             delivery.Id,
+				EventId:        delivery.EventId,
+				SubscriptionId: delivery.SubscriptionId,
+				Status:         delivery.Status,
+				Attempts:       delivery.Attempts,
+				NextAttemptAt:  delivery.NextAttemptAt,
+				LastError:      delivery.LastError,
+				DeliveredAt:    delivery.DeliveredAt,
+			})
+		}
+		makeJSONResponce(respMessage, w)
+	}
+}
+
+//replayWebhookDelivery - повторная отправка доставки, в том числе перешедшей в состояние dead
+func replayWebhookDelivery(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if custErr := accStorage.ReplayWebhookDelivery(id); custErr != nil {
+			makeCustomErrResponce(r, custErr, w)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+//replayWebhookEvents - повторная отправка подписчику всех событий начиная с Since
+//пример тела запроса: {"Since":"2020-09-21T00:00:00Z"}
+func replayWebhookEvents(accStorage model.IBalanceInfoStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, _ := strconv.Atoi(mux.Vars(r)["id"])
+		replayRequest := &webhookReplayRequest{}
+		err := json.NewDecoder(r.Body).Decode(replayRequest)
+		if err != nil || replayRequest.Since.IsZero() {
+			makeErrResponce(r, model.WrongInputParamsCode, "", w)
+			return
+		}
+		count, custErr := accStorage.ReplayWebhookEvents(id, replayRequest.Since)
+		if custErr != nil {
+			makeCustomErrResponce(r, custErr, w)
+			return
+		}
+		w.Header().Set("content-type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		resp, _ := json.Marshal(webhookReplayResponse{Count: count})
+		w.Write(resp)
+	}
+}
+
+func makeWebhookSubscriptionResponse(subscription *model.WebhookSubscription) webhookSubscriptionResponse {
+	return webhookSubscriptionResponse{
+		Id:        subscription.Id,
+		Url:       subscription.Url,
+		Active:    subscription.Active,
+		CreatedAt: subscription.CreatedAt,
+	}
+}
+
+//generateSecret - случайный ключ подписи событий
+func generateSecret() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
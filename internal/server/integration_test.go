@@ -86,7 +86,7 @@ func (mySuite *balanceIntegrationTestSuite) TestAccountBalanceByIdSuccessful() {
 	if mySuite.Db != nil {
 		var accId = 1
 		var balance = 500.0
-		_, custErr := mySuite.Db.ChangeAccountBalance(accId, balance)
+		_, custErr := mySuite.Db.ChangeAccountBalance(accId, balance, model.OperationDetails{})
 		assert.Nil(mySuite.T(), custErr)
 
 		router := mux.NewRouter()
@@ -99,7 +99,8 @@ func (mySuite *balanceIntegrationTestSuite) TestAccountBalanceByIdSuccessful() {
 		router.ServeHTTP(rr, req)
 		assert.Equal(mySuite.T(), http.StatusOK, rr.Code)
 
-		testRespMessage := accountByIdResponse{Id: accId, Balance: balance, Currency: defaultCurrency}
+		var bonusBalance float64
+		testRespMessage := accountByIdResponse{Id: accId, Balance: balance, Currency: model.BaseCurrency, BonusBalance: &bonusBalance}
 		res, _ := json.Marshal(testRespMessage)
 		assert.Equal(mySuite.T(), res, rr.Body.Bytes())
 	}
@@ -148,7 +149,7 @@ func (mySuite *balanceIntegrationTestSuite) TestTransferSumSuccess() {
 		var accId2 = 5
 		var delta = 500.0
 
-		_, custErr := mySuite.Db.ChangeAccountBalance(accId1, delta)
+		_, custErr := mySuite.Db.ChangeAccountBalance(accId1, delta, model.OperationDetails{})
 		assert.Nil(mySuite.T(), custErr)
 
 		requestBody, _ := json.Marshal(transferSumRequest{Id1: accId1, Id2: accId2, Delta: delta})
@@ -188,7 +189,7 @@ func (mySuite *balanceIntegrationTestSuite) TestTransactionsHistorySuccess() {
 		var accId = 8
 		var delta = 500.0
 
-		_, custErr := mySuite.Db.ChangeAccountBalance(accId, delta)
+		_, custErr := mySuite.Db.ChangeAccountBalance(accId, delta, model.OperationDetails{})
 		assert.Nil(mySuite.T(), custErr)
 
 		requestBody, _ := json.Marshal(transactionsHistoryRequest{Id: accId})
@@ -240,7 +241,7 @@ func (mySuite *balanceIntegrationTestSuite) TestTransactionsHistoryFailWrongInpu
 func waitDbConnection(connString string, maxWait time.Duration) (db model.IBalanceInfoStorage, err error) {
 	done := time.Now().Add(maxWait)
 	for time.Now().Before(done) {
-		db, err = storage.New(testStorageConnString)
+		db, err = storage.New(testStorageConnString, model.StorageOptions{})
 		if err == nil {
 			return db, nil
 		}
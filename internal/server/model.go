@@ -3,17 +3,32 @@ package server
 import (
 	"encoding/json"
 	"net/http"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/i18n"
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	"github.com/call-me-snake/user_balance_service/internal/openapi"
+	"github.com/call-me-snake/user_balance_service/internal/problem"
+	"github.com/labstack/gommon/log"
 )
 
+//accountByIdResponse - баланс аккаунта. BonusBalance возвращается только для текущего баланса
+//и не конвертируется в валюту Currency
 type accountByIdResponse struct {
-	Id       int     `json:"Id"`
-	Balance  float64 `json:"Balance"`
-	Currency string  `json:"Currency"`
+	Id           int        `json:"Id"`
+	Balance      float64    `json:"Balance"`
+	Currency     string     `json:"Currency"`
+	BonusBalance *float64   `json:"BonusBalance,omitempty"`
+	At           *time.Time `json:"At,omitempty"`
 }
 
 type changeAccBalanceRequest struct {
-	Id    int     `json:"Id"`
-	Delta float64 `json:"Delta"`
+	Id          int               `json:"Id"`
+	Delta       float64           `json:"Delta"`
+	Currency    string            `json:"Currency,omitempty"`
+	Purpose     string            `json:"Purpose,omitempty"`
+	ExternalRef string            `json:"ExternalRef,omitempty"`
+	Metadata    map[string]string `json:"Metadata,omitempty"`
 }
 
 type changeAccBalanceResponse struct {
@@ -21,9 +36,13 @@ type changeAccBalanceResponse struct {
 }
 
 type transferSumRequest struct {
-	Id1   int     `json:"Id1"`
-	Id2   int     `json:"Id2"`
-	Delta float64 `json:"Delta"`
+	Id1         int               `json:"Id1"`
+	Id2         int               `json:"Id2"`
+	Delta       float64           `json:"Delta"`
+	Currency    string            `json:"Currency,omitempty"`
+	Purpose     string            `json:"Purpose,omitempty"`
+	ExternalRef string            `json:"ExternalRef,omitempty"`
+	Metadata    map[string]string `json:"Metadata,omitempty"`
 }
 
 type transferSumResponce struct {
@@ -31,19 +50,223 @@ type transferSumResponce struct {
 }
 
 type transactionsHistoryRequest struct {
-	Id           int    `json:"Id"`
-	SortedBy     string `json:"SortedBy,omitempty"`
-	SortedByDesc bool   `json:"SortedByDesc,omitempty"`
+	Id             int      `json:"Id"`
+	SortedBy       string   `json:"SortedBy,omitempty"`
+	SortedByDesc   bool     `json:"SortedByDesc,omitempty"`
+	Currency       string   `json:"Currency,omitempty"`
+	RateType       string   `json:"RateType,omitempty"`
+	OperationTypes []string `json:"OperationTypes,omitempty"`
+	CounterpartyId int      `json:"CounterpartyId,omitempty"`
+}
+
+type reverseOperationRequest struct {
+	Id          int64             `json:"Id"`
+	Purpose     string            `json:"Purpose,omitempty"`
+	ExternalRef string            `json:"ExternalRef,omitempty"`
+	Metadata    map[string]string `json:"Metadata,omitempty"`
 }
 
-type errorResponce struct {
+type reverseOperationResponse struct {
 	Message string `json:"Message"`
-	ErrCode int    `json:"ErrCode"`
 }
 
-func makeErrResponce(userMessage string, errCode int, w http.ResponseWriter) {
-	res, _ := json.Marshal(errorResponce{Message: userMessage, ErrCode: errCode})
-	w.Header().Set("content-type", "application/json")
-	w.WriteHeader(errCode)
+type subAccountRequest struct {
+	ParentId int `json:"ParentId"`
+	ChildId  int `json:"ChildId"`
+}
+
+type subAccountFundsRequest struct {
+	ParentId    int               `json:"ParentId"`
+	ChildId     int               `json:"ChildId"`
+	Delta       float64           `json:"Delta"`
+	Purpose     string            `json:"Purpose,omitempty"`
+	ExternalRef string            `json:"ExternalRef,omitempty"`
+	Metadata    map[string]string `json:"Metadata,omitempty"`
+}
+
+type subAccountFundsResponse struct {
+	Message string `json:"Message"`
+}
+
+type bonusCreditRequest struct {
+	Id            int     `json:"Id"`
+	Amount        float64 `json:"Amount"`
+	ExpiresInDays int     `json:"ExpiresInDays"`
+	Purpose       string  `json:"Purpose,omitempty"`
+	ExternalRef   string  `json:"ExternalRef,omitempty"`
+}
+
+type bonusSpendRequest struct {
+	Id          int     `json:"Id"`
+	Amount      float64 `json:"Amount"`
+	Purpose     string  `json:"Purpose,omitempty"`
+	ExternalRef string  `json:"ExternalRef"`
+}
+
+//bonusOperationResponse - сообщение об операции с бонусами и бонусный баланс аккаунта после нее
+type bonusOperationResponse struct {
+	Message      string  `json:"Message"`
+	BonusBalance float64 `json:"BonusBalance"`
+}
+
+type bonusLotsResponse struct {
+	AccountId    int              `json:"AccountId"`
+	BonusBalance float64          `json:"BonusBalance"`
+	Lots         []model.BonusLot `json:"Lots"`
+}
+
+//transactionRecordInCurrency - запись истории с суммами, сконвертированными в валюту Currency по курсу Rate
+type transactionRecordInCurrency struct {
+	model.TransactionRecord
+	Currency string  `json:"Currency"`
+	Rate     float64 `json:"Rate"`
+	RateType string  `json:"RateType"`
+	RateDate string  `json:"RateDate"`
+}
+
+type feeQuoteRequest struct {
+	Operation string  `json:"Operation"`
+	Id        int     `json:"Id"`
+	Delta     float64 `json:"Delta"`
+	Currency  string  `json:"Currency,omitempty"`
+}
+
+type feeQuoteResponse struct {
+	Operation string  `json:"Operation"`
+	Id        int     `json:"Id"`
+	Amount    float64 `json:"Amount"`
+	Fee       float64 `json:"Fee"`
+	Total     float64 `json:"Total"`
+	Currency  string  `json:"Currency"`
+	Rate      float64 `json:"Rate,omitempty"`
+}
+
+type scheduledTransferRequest struct {
+	FromId           int        `json:"FromId"`
+	ToId             int        `json:"ToId"`
+	Delta            float64    `json:"Delta"`
+	Recurrence       string     `json:"Recurrence,omitempty"`
+	StartAt          *time.Time `json:"StartAt,omitempty"`
+	MaxRetries       int        `json:"MaxRetries,omitempty"`
+	RetryIntervalSec int        `json:"RetryIntervalSec,omitempty"`
+	Active           *bool      `json:"Active,omitempty"`
+}
+
+type scheduledTransferResponse struct {
+	Id               int       `json:"Id"`
+	FromId           int       `json:"FromId"`
+	ToId             int       `json:"ToId"`
+	Delta            float64   `json:"Delta"`
+	Recurrence       string    `json:"Recurrence"`
+	NextRunAt        time.Time `json:"NextRunAt"`
+	Active           bool      `json:"Active"`
+	MaxRetries       int       `json:"MaxRetries"`
+	RetryIntervalSec int       `json:"RetryIntervalSec"`
+	RetryCount       int       `json:"RetryCount"`
+	LastError        string    `json:"LastError"`
+	CreatedAt        time.Time `json:"CreatedAt"`
+}
+
+type scheduledTransferRunResponse struct {
+	RunAt   time.Time `json:"RunAt"`
+	Attempt int       `json:"Attempt"`
+	Success bool      `json:"Success"`
+	Message string    `json:"Message"`
+}
+
+type webhookSubscriptionRequest struct {
+	Url    string `json:"Url"`
+	Secret string `json:"Secret,omitempty"`
+}
+
+type webhookSubscriptionResponse struct {
+	Id        int       `json:"Id"`
+	Url       string    `json:"Url"`
+	Secret    string    `json:"Secret,omitempty"`
+	Active    bool      `json:"Active"`
+	CreatedAt time.Time `json:"CreatedAt"`
+}
+
+type webhookDeliveryResponse struct {
+	Id             int64      `json:"Id"`
+	EventId        int64      `json:"EventId"`
+	SubscriptionId int        `json:"SubscriptionId"`
+	Status         string     `json:"Status"`
+	Attempts       int        `json:"Attempts"`
+	NextAttemptAt  time.Time  `json:"NextAttemptAt"`
+	LastError      string     `json:"LastError"`
+	DeliveredAt    *time.Time `json:"DeliveredAt,omitempty"`
+}
+
+type webhookReplayRequest struct {
+	Since time.Time `json:"Since"`
+}
+
+type webhookReplayResponse struct {
+	Count int64 `json:"Count"`
+}
+
+//turnoverResponse - обороты аккаунта AccountId (0 - всего сервиса) за дни [From, To)
+type turnoverResponse struct {
+	AccountId int              `json:"AccountId,omitempty"`
+	Period    string           `json:"Period"`
+	From      string           `json:"From"`
+	To        string           `json:"To"`
+	Turnover  []model.Turnover `json:"Turnover"`
+}
+
+//makeErrResponce - ответ с ошибкой code в формате RFC 7807. detail - пояснение на языке клиента или пустая строка
+func makeErrResponce(r *http.Request, code model.ErrorCode, detail string, w http.ResponseWriter) {
+	writeProblem(problem.New(requestLang(r), code, detail), w)
+}
+
+//makeCustomErrResponce - ответ с ошибкой хранилища. Текст ошибки пишется в лог и не передается клиенту
+func makeCustomErrResponce(r *http.Request, custErr *model.CustomErr, w http.ResponseWriter) {
+	log.Print(custErr.Err.Error())
+	makeErrResponce(r, custErr.ErrCode, "", w)
+}
+
+//makeValidationErrResponce - ответ с ошибкой проверки запроса по документу OpenAPI
+func makeValidationErrResponce(r *http.Request, err error, w http.ResponseWriter) {
+	lang := requestLang(r)
+	validationErr, ok := err.(*openapi.ValidationError)
+	if !ok {
+		writeProblem(problem.New(lang, model.ValidationFailedCode, err.Error()), w)
+		return
+	}
+	p := problem.New(lang, model.ValidationFailedCode, validationErr.Message(lang))
+	if validationErr.Field != "" {
+		p.Errors = []problem.FieldError{{Field: validationErr.Field, Message: i18n.Message(lang, validationErr.Key, validationErr.Args...)}}
+	}
+	writeProblem(p, w)
+}
+
+func writeProblem(p *problem.Problem, w http.ResponseWriter) {
+	res, _ := json.Marshal(p)
+	w.Header().Set("content-type", problem.ContentType)
+	w.WriteHeader(p.Status)
 	w.Write(res)
 }
+
+func makeScheduledTransferResponse(schedule *model.ScheduledTransfer) scheduledTransferResponse {
+	return scheduledTransferResponse{
+		Id:               schedule.Id,
+		FromId:           schedule.FromId,
+		ToId:             schedule.ToId,
+		Delta:            schedule.Delta,
+		Recurrence:       schedule.Recurrence,
+		NextRunAt:        schedule.NextRunAt,
+		Active:           schedule.Active,
+		MaxRetries:       schedule.MaxRetries,
+		RetryIntervalSec: schedule.RetryIntervalSec,
+		RetryCount:       schedule.RetryCount,
+		LastError:        schedule.LastError,
+		CreatedAt:        schedule.CreatedAt,
+	}
+}
+
+func makeJSONResponce(body interface{}, w http.ResponseWriter) {
+	resp, _ := json.Marshal(body)
+	w.Header().Set("content-type", "application/json")
+	w.Write(resp)
+}
@@ -5,12 +5,20 @@ import (
 	"net/http"
 
 	"github.com/call-me-snake/user_balance_service/internal/model"
+	"github.com/call-me-snake/user_balance_service/internal/openapi"
+	"github.com/call-me-snake/user_balance_service/internal/ratelimit"
+	"github.com/call-me-snake/user_balance_service/internal/tlsconfig"
 	"github.com/gorilla/mux"
 )
 
 type Connector struct {
-	router  *mux.Router
-	address string
+	router       *mux.Router
+	address      string
+	limiter      *ratelimit.Limiter
+	timeouts     model.ServerTimeouts
+	tls          *tlsconfig.Manager
+	maxBodyBytes int64
+	swaggerUIDir string
 }
 
 //New - Конструктор *Connector
@@ -18,20 +26,111 @@ func New(addr string) *Connector {
 	c := &Connector{}
 	c.router = mux.NewRouter()
 	c.address = addr
+	c.maxBodyBytes = openapi.DefaultMaxBodyBytes
+	c.swaggerUIDir = openapi.DefaultSwaggerUIDir
 	return c
 }
 
 func (c *Connector) executeHandlers(accStorage model.IBalanceInfoStorage) {
 	c.router.HandleFunc("/alive", aliveHandler).Methods("GET")
+	c.router.HandleFunc("/healthz", healthzHandler).Methods("GET")
+	c.router.HandleFunc("/readyz", readyzHandler(accStorage)).Methods("GET")
+	c.router.HandleFunc("/openapi.json", openapiHandler).Methods("GET")
+	c.router.HandleFunc("/docs", swaggerUIHandler).Methods("GET")
+	c.router.HandleFunc("/docs/assets/{file}", swaggerUIAssetHandler(c.swaggerUIDir)).Methods("GET")
 	c.router.HandleFunc("/account/balance/info/{id:[0-9]+}", accountBalanceById(accStorage)).Methods("GET")
 	c.router.HandleFunc("/account/balance/change", changeAccountBalance(accStorage)).Methods("POST")
 	c.router.HandleFunc("/account/balance/transfer", transferSum(accStorage)).Methods("POST")
+	c.router.HandleFunc("/account/balance/reversal", reverseOperation(accStorage)).Methods("POST")
+	c.router.HandleFunc("/account/balance/consolidated/{id:[0-9]+}", consolidatedBalance(accStorage)).Methods("GET")
+	c.router.HandleFunc("/account/interest/{id:[0-9]+}", accruedInterest(accStorage)).Methods("GET")
+	c.router.HandleFunc("/account/bonus/credit", creditBonus(accStorage)).Methods("POST")
+	c.router.HandleFunc("/account/bonus/spend", spendBonus(accStorage)).Methods("POST")
+	c.router.HandleFunc("/account/bonus/{id:[0-9]+}", bonusLots(accStorage)).Methods("GET")
+	c.router.HandleFunc("/account/bonus/{id:[0-9]+}/history", bonusHistory(accStorage)).Methods("GET")
+	c.router.HandleFunc("/account/subaccounts", setAccountParent(accStorage)).Methods("POST")
+	c.router.HandleFunc("/account/subaccounts/{id:[0-9]+}", detachSubAccount(accStorage)).Methods("DELETE")
+	c.router.HandleFunc("/account/subaccounts/fund", fundSubAccount(accStorage)).Methods("POST")
+	c.router.HandleFunc("/account/subaccounts/sweep", sweepSubAccount(accStorage)).Methods("POST")
 	c.router.HandleFunc("/account/balance/history", transactionsHistory(accStorage)).Methods("POST")
+	c.router.HandleFunc("/account/balance/history/search", historyByExternalRef(accStorage)).Methods("GET")
+	c.router.HandleFunc("/account/balance/history/verify/{id:[0-9]+}", verifyHistoryChain(accStorage)).Methods("GET")
+	c.router.HandleFunc("/account/balance/statement/{id:[0-9]+}", accountStatement(accStorage)).Methods("GET")
+	c.router.HandleFunc("/account/balance/statements/{id:[0-9]+}", accountStatements(accStorage)).Methods("GET")
+	c.router.HandleFunc("/account/balance/statements/{id:[0-9]+}/{month}", storedStatement(accStorage)).Methods("GET")
+	c.router.HandleFunc("/account/balance/turnover/{id:[0-9]+}", accountTurnover(accStorage)).Methods("GET")
+	c.router.HandleFunc("/account/balance/fee/quote", feeQuote(accStorage)).Methods("POST")
+	c.router.HandleFunc("/account/balance/schedule", createScheduledTransfer(accStorage)).Methods("POST")
+	c.router.HandleFunc("/account/balance/schedule/{id:[0-9]+}", getScheduledTransfer(accStorage)).Methods("GET")
+	c.router.HandleFunc("/account/balance/schedule/{id:[0-9]+}", updateScheduledTransfer(accStorage)).Methods("PUT")
+	c.router.HandleFunc("/account/balance/schedule/{id:[0-9]+}", deleteScheduledTransfer(accStorage)).Methods("DELETE")
+	c.router.HandleFunc("/account/balance/schedule/{id:[0-9]+}/runs", scheduledTransferRuns(accStorage)).Methods("GET")
+	c.router.HandleFunc("/account/balance/schedules/{id:[0-9]+}", accountScheduledTransfers(accStorage)).Methods("GET")
+	c.router.HandleFunc("/webhooks", createWebhookSubscription(accStorage)).Methods("POST")
+	c.router.HandleFunc("/webhooks", webhookSubscriptions(accStorage)).Methods("GET")
+	c.router.HandleFunc("/webhooks/{id:[0-9]+}", deleteWebhookSubscription(accStorage)).Methods("DELETE")
+	c.router.HandleFunc("/webhooks/{id:[0-9]+}/replay", replayWebhookEvents(accStorage)).Methods("POST")
+	c.router.HandleFunc("/webhooks/deliveries", webhookDeliveries(accStorage)).Methods("GET")
+	c.router.HandleFunc("/webhooks/deliveries/{id:[0-9]+}/replay", replayWebhookDelivery(accStorage)).Methods("POST")
+	c.router.HandleFunc("/admin/reconciliation", lastReconciliation(accStorage)).Methods("GET")
+	c.router.HandleFunc("/admin/reconciliation", runReconciliation(accStorage)).Methods("POST")
+	c.router.HandleFunc("/admin/turnover", serviceTurnover(accStorage)).Methods("GET")
+}
+
+//SetRateLimiter - включение ограничения частоты запросов. Должен вызываться до Start
+func (c *Connector) SetRateLimiter(limiter *ratelimit.Limiter) {
+	c.limiter = limiter
+}
+
+//SetTimeouts - тайм-ауты чтения запроса, записи ответа и простоя соединения. Должен вызываться до Start
+func (c *Connector) SetTimeouts(timeouts model.ServerTimeouts) {
+	c.timeouts = timeouts
+}
+
+//SetMaxBodyBytes - максимальный размер тела запроса. Должен вызываться до Start
+func (c *Connector) SetMaxBodyBytes(limit int64) {
+	c.maxBodyBytes = limit
+}
+
+//SetSwaggerUIDir - каталог с файлами swagger-ui-dist для страницы /docs. Должен вызываться до Start
+func (c *Connector) SetSwaggerUIDir(dir string) {
+	c.swaggerUIDir = dir
+}
+
+//SetTLS - прием соединений по TLS с сертификатами manager. Должен вызываться до Start
+func (c *Connector) SetTLS(manager *tlsconfig.Manager) {
+	c.tls = manager
 }
 
 //Start запуск http сервера
 func (c *Connector) Start(accStorage model.IBalanceInfoStorage) error {
+	validator, err := openapi.NewValidator()
+	if err != nil {
+		return fmt.Errorf("server.Start: %v", err)
+	}
+	validator.SetMaxBodyBytes(c.maxBodyBytes)
 	c.executeHandlers(accStorage)
-	err := http.ListenAndServe(c.address, c.router)
+	c.router.Use(circuitBreakerMiddleware(accStorage))
+	c.router.Use(validationMiddleware(validator))
+	if c.limiter != nil {
+		c.router.Use(rateLimitMiddleware(c.limiter, c.maxBodyBytes))
+	}
+	server := &http.Server{
+		Addr:              c.address,
+		Handler:           c.router,
+		ReadTimeout:       c.timeouts.ReadTimeout,
+		ReadHeaderTimeout: c.timeouts.ReadHeaderTimeout,
+		WriteTimeout:      c.timeouts.WriteTimeout,
+		IdleTimeout:       c.timeouts.IdleTimeout,
+	}
+	if c.tls == nil {
+		err = server.ListenAndServe()
+		return fmt.Errorf("server.Start: %v", err)
+	}
+	if c.tls.VerifiesClients() {
+		server.Handler = clientCertMiddleware(c.tls, c.router)
+	}
+	server.TLSConfig = c.tls.Config()
+	err = server.ListenAndServeTLS("", "")
 	return fmt.Errorf("server.Start: %v", err)
 }
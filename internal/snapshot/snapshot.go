@@ -0,0 +1,61 @@
+package snapshot
+
+import (
+	"log"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/model"
+)
+
+//settleDelay - задержка снимка после окончания дня, чтобы успели завершиться операции, начатые до полуночи
+const settleDelay = 10 * time.Minute
+
+//Job - сохраняет снимки балансов аккаунтов на конец каждого дня (по UTC)
+type Job struct {
+	accStorage model.IBalanceInfoStorage
+	interval   time.Duration
+}
+
+//NewJob - конструктор *Job. interval - период проверки завершившихся дней без снимка
+func NewJob(accStorage model.IBalanceInfoStorage, interval time.Duration) *Job {
+	return &Job{accStorage: accStorage, interval: interval}
+}
+
+//Start - запускает периодическое сохранение снимков в отдельной горутине
+func (j *Job) Start() {
+	go func() {
+		for {
+			j.RunDue(time.Now())
+			time.Sleep(j.interval)
+		}
+	}()
+}
+
+//RunDue - сохраняет снимки за все дни, завершившиеся к моменту now, начиная со дня после последнего снимка.
+//Если снимков еще нет, сохраняется снимок только за последний завершившийся день
+func (j *Job) RunDue(now time.Time) {
+	lastDay := day(now.Add(-settleDelay)).AddDate(0, 0, -1)
+	last, custErr := j.accStorage.GetLastBalanceSnapshotDate()
+	if custErr != nil {
+		log.Printf("snapshot.RunDue: %s", custErr.Err.Error())
+		return
+	}
+	next := lastDay
+	if last != nil {
+		next = day(*last).AddDate(0, 0, 1)
+	}
+	for ; !next.After(lastDay); next = next.AddDate(0, 0, 1) {
+		count, custErr := j.accStorage.CreateBalanceSnapshots(next)
+		if custErr != nil {
+			log.Printf("snapshot.RunDue: %s", custErr.Err.Error())
+			return
+		}
+		log.Printf("snapshot.RunDue: сохранено снимков за %s: %d", next.Format("2006-01-02"), count)
+	}
+}
+
+//day (internal) - начало дня (по UTC), которому принадлежит момент t
+func day(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,48 @@
+package snapshot
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	mock_model "github.com/call-me-snake/user_balance_service/internal/model/mock"
+	"github.com/golang/mock/gomock"
+)
+
+//TestRunDueCatchUp - снимки сохраняются за все пропущенные дни, кроме текущего
+func TestRunDueCatchUp(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	accStorage := mock_model.NewMockIBalanceInfoStorage(mockCtrl)
+	last := time.Date(2020, 9, 18, 0, 0, 0, 0, time.UTC)
+	accStorage.EXPECT().GetLastBalanceSnapshotDate().Return(&last, nil)
+	gomock.InOrder(
+		accStorage.EXPECT().CreateBalanceSnapshots(time.Date(2020, 9, 19, 0, 0, 0, 0, time.UTC)).Return(int64(2), nil),
+		accStorage.EXPECT().CreateBalanceSnapshots(time.Date(2020, 9, 20, 0, 0, 0, 0, time.UTC)).Return(int64(2), nil),
+	)
+	NewJob(accStorage, time.Hour).RunDue(time.Date(2020, 9, 21, 12, 0, 0, 0, time.UTC))
+}
+
+//TestRunDueFirstRun - без снимков сохраняется только снимок за последний завершившийся день;
+//сразу после полуночи день еще не считается завершившимся
+func TestRunDueFirstRun(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	accStorage := mock_model.NewMockIBalanceInfoStorage(mockCtrl)
+	accStorage.EXPECT().GetLastBalanceSnapshotDate().Return(nil, nil)
+	accStorage.EXPECT().CreateBalanceSnapshots(time.Date(2020, 9, 19, 0, 0, 0, 0, time.UTC)).Return(int64(2), nil)
+	NewJob(accStorage, time.Hour).RunDue(time.Date(2020, 9, 21, 0, 5, 0, 0, time.UTC))
+}
+
+//TestRunDueStorageError - при ошибке хранилища следующие дни не обрабатываются
+func TestRunDueStorageError(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	accStorage := mock_model.NewMockIBalanceInfoStorage(mockCtrl)
+	last := time.Date(2020, 9, 18, 0, 0, 0, 0, time.UTC)
+	accStorage.EXPECT().GetLastBalanceSnapshotDate().Return(&last, nil)
+	accStorage.EXPECT().CreateBalanceSnapshots(gomock.Any()).
+		Return(int64(0), &model.CustomErr{Err: errors.New("Ошибка"), ErrCode: model.DefaultErrCode})
+	NewJob(accStorage, time.Hour).RunDue(time.Date(2020, 9, 21, 12, 0, 0, 0, time.UTC))
+}
@@ -0,0 +1,102 @@
+package statement
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/i18n"
+	"github.com/call-me-snake/user_balance_service/internal/model"
+)
+
+//htmlTimeLayout - формат времени в HTML выписке
+const htmlTimeLayout = "2006-01-02 15:04:05"
+
+//htmlTemplate - HTML выписка. Тексты подставляются на языке клиента, суммы - в базовой валюте
+var htmlTemplate = template.Must(template.New("statement").Funcs(template.FuncMap{
+	"money": func(amount float64) string { return fmt.Sprintf("%.2f", amount) },
+	"time":  func(t time.Time) string { return t.Format(htmlTimeLayout) },
+}).Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}">
+<head>
+  <meta charset="utf-8">
+  <title>{{.Title}}</title>
+  <style>
+    body {font-family: sans-serif; margin: 2em;}
+    table {border-collapse: collapse;}
+    th, td {border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left;}
+    td.amount {text-align: right;}
+  </style>
+</head>
+<body>
+  <h1>{{.Title}}</h1>
+  <p>{{.Period}}</p>
+  <table>
+    <tr><th>{{.Labels.Opening}}</th><td class="amount">{{money .Statement.OpeningBalance}} {{.Currency}}</td></tr>
+    <tr><th>{{.Labels.Credits}}</th><td class="amount">{{money .Statement.TotalCredits}} {{.Currency}}</td></tr>
+    <tr><th>{{.Labels.Debits}}</th><td class="amount">{{money .Statement.TotalDebits}} {{.Currency}}</td></tr>
+    <tr><th>{{.Labels.Closing}}</th><td class="amount">{{money .Statement.ClosingBalance}} {{.Currency}}</td></tr>
+  </table>
+  <h2>{{.Labels.Movements}}</h2>
+  {{if .Statement.Movements}}
+  <table>
+    <tr><th>{{.Labels.Date}}</th><th>{{.Labels.Operation}}</th><th>{{.Labels.Amount}}</th><th>{{.Labels.Balance}}</th></tr>
+    {{range .Statement.Movements}}
+    <tr><td>{{time .CreatedAt}}</td><td>{{.TransactionMessage}}</td><td class="amount">{{money .Delta}}</td><td class="amount">{{money .RemainingBalance}}</td></tr>
+    {{end}}
+  </table>
+  {{else}}
+  <p>{{.Labels.NoMovements}}</p>
+  {{end}}
+</body>
+</html>
+`))
+
+//htmlLabels (internal) - подписи HTML выписки на языке клиента
+type htmlLabels struct {
+	Opening     string
+	Closing     string
+	Credits     string
+	Debits      string
+	Movements   string
+	Date        string
+	Operation   string
+	Amount      string
+	Balance     string
+	NoMovements string
+}
+
+//RenderHTML - вывод выписки statement в формате HTML на языке lang. TransactionMessage операций
+//должны быть заполнены на этом языке (i18n.LocalizeHistory)
+func RenderHTML(w io.Writer, lang string, statement *model.Statement) error {
+	message := func(key string, args ...interface{}) string {
+		return i18n.Message(lang, key, args...)
+	}
+	return htmlTemplate.Execute(w, struct {
+		Lang      string
+		Title     string
+		Period    string
+		Currency  string
+		Labels    htmlLabels
+		Statement *model.Statement
+	}{
+		Lang:     lang,
+		Title:    message(i18n.StatementTitle, statement.AccountId),
+		Period:   message(i18n.StatementPeriod, statement.PeriodStart.Format(htmlTimeLayout), statement.PeriodEnd.Format(htmlTimeLayout)),
+		Currency: model.BaseCurrency,
+		Labels: htmlLabels{
+			Opening:     message(i18n.StatementOpening),
+			Closing:     message(i18n.StatementClosing),
+			Credits:     message(i18n.StatementCredits),
+			Debits:      message(i18n.StatementDebits),
+			Movements:   message(i18n.StatementMovements),
+			Date:        message(i18n.StatementDate),
+			Operation:   message(i18n.StatementOperation),
+			Amount:      message(i18n.StatementAmount),
+			Balance:     message(i18n.StatementBalance),
+			NoMovements: message(i18n.StatementNoMovements),
+		},
+		Statement: statement,
+	})
+}
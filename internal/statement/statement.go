@@ -0,0 +1,91 @@
+package statement
+
+import (
+	"log"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/model"
+)
+
+//settleDelay - задержка выписок после окончания месяца, чтобы успели завершиться операции, начатые до полуночи
+const settleDelay = 10 * time.Minute
+
+//monthLayout - формат месяца выписки
+const monthLayout = "2006-01"
+
+//Job - сохраняет выписки по аккаунтам за каждый завершившийся месяц (по UTC)
+type Job struct {
+	accStorage model.IBalanceInfoStorage
+	interval   time.Duration
+}
+
+//NewJob - конструктор *Job. interval - период проверки завершившихся месяцев без выписок
+func NewJob(accStorage model.IBalanceInfoStorage, interval time.Duration) *Job {
+	return &Job{accStorage: accStorage, interval: interval}
+}
+
+//Start - запускает периодическое сохранение выписок в отдельной горутине
+func (j *Job) Start() {
+	go func() {
+		for {
+			j.RunDue(time.Now())
+			time.Sleep(j.interval)
+		}
+	}()
+}
+
+//RunDue - сохраняет выписки за все месяцы, завершившиеся к моменту now, начиная с месяца последней сохраненной выписки:
+//выписки за него могли быть сохранены не для всех аккаунтов. Если выписок еще нет, сохраняются выписки только
+//за последний завершившийся месяц
+func (j *Job) RunDue(now time.Time) {
+	lastMonth := Month(now.Add(-settleDelay)).AddDate(0, -1, 0)
+	last, custErr := j.accStorage.GetLastStatementPeriod()
+	if custErr != nil {
+		log.Printf("statement.RunDue: %s", custErr.Err.Error())
+		return
+	}
+	next := lastMonth
+	if last != nil {
+		next = Month(*last)
+	}
+	for ; !next.After(lastMonth); next = next.AddDate(0, 1, 0) {
+		count, custErr := j.saveMonth(next)
+		if custErr != nil {
+			log.Printf("statement.RunDue: %s", custErr.Err.Error())
+			return
+		}
+		if count > 0 {
+			log.Printf("statement.RunDue: сохранено выписок за %s: %d", next.Format(monthLayout), count)
+		}
+	}
+}
+
+//saveMonth (internal) - сохраняет выписки за месяц, начинающийся в month, по аккаунтам, у которых их еще нет
+func (j *Job) saveMonth(month time.Time) (int, *model.CustomErr) {
+	end := month.AddDate(0, 1, 0)
+	ids, custErr := j.accStorage.GetMissingStatementAccountIds(month, end)
+	if custErr != nil {
+		return 0, custErr
+	}
+	for i, id := range ids {
+		statement, custErr := j.accStorage.BuildStatement(id, month, end)
+		if custErr == nil {
+			custErr = j.accStorage.SaveStatement(statement)
+		}
+		if custErr != nil {
+			return i, custErr
+		}
+	}
+	return len(ids), nil
+}
+
+//Month - начало месяца (по UTC), которому принадлежит момент t
+func Month(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+//ParseMonth - начало месяца, заданного строкой в формате YYYY-MM
+func ParseMonth(s string) (time.Time, error) {
+	return time.Parse(monthLayout, s)
+}
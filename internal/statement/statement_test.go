@@ -0,0 +1,94 @@
+package statement
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/i18n"
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	mock_model "github.com/call-me-snake/user_balance_service/internal/model/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+//TestRunDueCatchUp - выписки сохраняются за месяц последней выписки (по недостающим аккаунтам) и все следующие
+//завершившиеся месяцы, кроме текущего
+func TestRunDueCatchUp(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	accStorage := mock_model.NewMockIBalanceInfoStorage(mockCtrl)
+	august := time.Date(2020, 8, 1, 0, 0, 0, 0, time.UTC)
+	september := time.Date(2020, 9, 1, 0, 0, 0, 0, time.UTC)
+	october := time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC)
+	accStorage.EXPECT().GetLastStatementPeriod().Return(&august, nil)
+	statement := &model.Statement{AccountId: 2, PeriodStart: september, PeriodEnd: october}
+	gomock.InOrder(
+		accStorage.EXPECT().GetMissingStatementAccountIds(august, september).Return([]int{}, nil),
+		accStorage.EXPECT().GetMissingStatementAccountIds(september, october).Return([]int{2}, nil),
+		accStorage.EXPECT().BuildStatement(2, september, october).Return(statement, nil),
+		accStorage.EXPECT().SaveStatement(statement).Return(nil),
+	)
+	NewJob(accStorage, time.Hour).RunDue(time.Date(2020, 10, 15, 12, 0, 0, 0, time.UTC))
+}
+
+//TestRunDueFirstRun - без выписок сохраняются выписки только за последний завершившийся месяц;
+//сразу после полуночи месяц еще не считается завершившимся
+func TestRunDueFirstRun(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	accStorage := mock_model.NewMockIBalanceInfoStorage(mockCtrl)
+	accStorage.EXPECT().GetLastStatementPeriod().Return(nil, nil)
+	accStorage.EXPECT().GetMissingStatementAccountIds(time.Date(2020, 8, 1, 0, 0, 0, 0, time.UTC), time.Date(2020, 9, 1, 0, 0, 0, 0, time.UTC)).
+		Return([]int{}, nil)
+	NewJob(accStorage, time.Hour).RunDue(time.Date(2020, 10, 1, 0, 5, 0, 0, time.UTC))
+}
+
+//TestRunDueStorageError - при ошибке хранилища следующие аккаунты и месяцы не обрабатываются
+func TestRunDueStorageError(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	accStorage := mock_model.NewMockIBalanceInfoStorage(mockCtrl)
+	august := time.Date(2020, 8, 1, 0, 0, 0, 0, time.UTC)
+	accStorage.EXPECT().GetLastStatementPeriod().Return(&august, nil)
+	accStorage.EXPECT().GetMissingStatementAccountIds(gomock.Any(), gomock.Any()).Return([]int{1, 2}, nil)
+	accStorage.EXPECT().BuildStatement(1, gomock.Any(), gomock.Any()).
+		Return(nil, &model.CustomErr{Err: errors.New("Ошибка"), ErrCode: model.DefaultErrCode})
+	NewJob(accStorage, time.Hour).RunDue(time.Date(2020, 10, 15, 12, 0, 0, 0, time.UTC))
+}
+
+//TestParseMonth - месяц выписки задается в формате YYYY-MM
+func TestParseMonth(t *testing.T) {
+	month, err := ParseMonth("2020-09")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2020, 9, 1, 0, 0, 0, 0, time.UTC), month)
+	_, err = ParseMonth("2020-13")
+	assert.Error(t, err)
+	assert.Equal(t, month, Month(time.Date(2020, 9, 30, 23, 59, 0, 0, time.UTC)))
+}
+
+//TestRenderHTML - HTML выписка содержит остатки, операции и подписи на языке клиента; тексты экранируются
+func TestRenderHTML(t *testing.T) {
+	statement := &model.Statement{
+		AccountId:      7,
+		PeriodStart:    time.Date(2020, 9, 1, 0, 0, 0, 0, time.UTC),
+		PeriodEnd:      time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC),
+		OpeningBalance: 100,
+		ClosingBalance: 50.5,
+		TotalDebits:    49.5,
+		Movements:      []model.TransactionRecord{{AccountId: 7, Delta: -49.5, RemainingBalance: 50.5, TransactionMessage: "<script>"}},
+	}
+	page := &bytes.Buffer{}
+	assert.Nil(t, RenderHTML(page, i18n.Ru, statement))
+	assert.Contains(t, page.String(), "Выписка по аккаунту 7")
+	assert.Contains(t, page.String(), "Остаток на конец периода")
+	assert.Contains(t, page.String(), "-49.50")
+	assert.Contains(t, page.String(), "&lt;script&gt;")
+	assert.NotContains(t, page.String(), "Операций за период нет.")
+
+	statement.Movements = nil
+	page.Reset()
+	assert.Nil(t, RenderHTML(page, i18n.En, statement))
+	assert.Contains(t, page.String(), "No movements in the period.")
+}
@@ -3,6 +3,7 @@ package storage
 import (
 	"errors"
 	"fmt"
+	"math"
 	"strings"
 	"time"
 
@@ -16,9 +17,17 @@ const positiveBalanceConstraint = "positive_balance"
 //методы, реализующие интерфейс model.IBalanceInfoStorage
 
 //GetAccountBalance - реализует метод интерфейса IBalanceInfoStorage
-func (db *storage) GetAccountBalance(id int) (*model.BalanceInfo, *model.CustomErr) {
+func (db *storage) GetAccountBalance(id int) (result *model.BalanceInfo, err *model.CustomErr) {
+	db.read(id, db.replicas.balanceReads, func(database *gorm.DB) *model.CustomErr {
+		result, err = getAccountBalance(database, id)
+		return err
+	})
+	return result, err
+}
+
+func getAccountBalance(database *gorm.DB, id int) (*model.BalanceInfo, *model.CustomErr) {
 	result := &model.BalanceInfo{}
-	query := db.database.First(result, id)
+	query := database.First(result, id)
 	if query.Error != nil {
 		if query.Error == gorm.ErrRecordNotFound {
 			return &model.BalanceInfo{AccountId: id, Balance: 0}, nil
@@ -29,19 +38,34 @@ func (db *storage) GetAccountBalance(id int) (*model.BalanceInfo, *model.CustomE
 		}
 		return nil, err
 	}
+	bonusBalance, err := getBonusBalance(database, id, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	result.BonusBalance = bonusBalance
 	return result, nil
 }
 
 //ChangeAccountBalance - реализует метод интерфейса IBalanceInfoStorage
-func (db *storage) ChangeAccountBalance(id int, delta float64) (successMessage string, err *model.CustomErr) {
+func (db *storage) ChangeAccountBalance(id int, delta float64, details model.OperationDetails) (result *model.OperationResult, err *model.CustomErr) {
 	//начало транзакции
 	transaction := db.database.Begin()
 	acc := &model.BalanceInfo{AccountId: id}
+	//расчет комиссии за снятие средств
+	var feeRule *model.FeeRule
+	var feeSum float64
+	if delta < 0 {
+		feeRule, feeSum, err = calculateFee(transaction, model.FeeOperationWithdrawal, id, -delta, details.OperationCurrency())
+		if err != nil {
+			transaction.Rollback()
+			return nil, err
+		}
+	}
 	//попытка изменения баланса
 	err = updateOrCreateBalanceInfo(transaction, id, delta)
 	if err != nil {
 		transaction.Rollback()
-		return "", err
+		return nil, err
 	}
 
 	//получение измененной суммы
@@ -52,80 +76,145 @@ func (db *storage) ChangeAccountBalance(id int, delta float64) (successMessage s
 			Err:     fmt.Errorf("storage.ChangeAccountBalance: %v", query.Error),
 			ErrCode: model.DefaultErrCode,
 		}
-		return "", err
+		return nil, err
+	}
+	err = checkNotFrozen(transaction, acc)
+	if err != nil {
+		transaction.Rollback()
+		return nil, err
 	}
 
 	record := &model.TransactionRecord{
 		AccountId:        id,
 		Delta:            delta,
 		RemainingBalance: acc.Balance,
+		OperationType:    model.OperationDeposit,
 		CreatedAt:        time.Now(),
 	}
-
-	if delta > 0 {
-		record.TransactionMessage = fmt.Sprintf("Аккаунт %d успешно пополнен на сумму %.2f руб.", id, delta)
-	} else {
-		record.TransactionMessage = fmt.Sprintf("С аккаунта %d успешно снята сумма %.2f руб.", id, -delta)
+	if delta < 0 {
+		record.OperationType = model.OperationWithdrawal
 	}
+	details.Apply(record)
 	//сохранение изменения баланса
-	query = transaction.Create(record)
-
-	if query.Error != nil {
+	err = appendHistoryRecord(transaction, record)
+	if err != nil {
 		transaction.Rollback()
-		err = &model.CustomErr{
-			Err:     fmt.Errorf("storage.ChangeAccountBalance: %v", query.Error),
-			ErrCode: model.DefaultErrCode,
+		return nil, err
+	}
+	records := []model.TransactionRecord{*record}
+	//списание комиссии
+	if feeSum > 0 {
+		feeRecords, err := chargeFee(transaction, id, feeSum, feeRule, details)
+		if err != nil {
+			transaction.Rollback()
+			return nil, err
 		}
-		return "", err
+		records = append(records, feeRecords...)
+	}
+	//сохранение события для подписчиков
+	err = writeOutboxEvent(transaction, model.BalanceChangedEvent, records)
+	if err != nil {
+		transaction.Rollback()
+		return nil, err
 	}
 	//конец транзакции
 	transaction.Commit()
+	db.replicas.noteWrites(records, time.Now())
 
-	return record.TransactionMessage, nil
+	return &model.OperationResult{Record: *record, Fee: feeSum}, nil
 }
 
 //TransferSumBetweenAccounts - реализует метод интерфейса IBalanceInfoStorage
-func (db *storage) TransferSumBetweenAccounts(id1, id2 int, delta float64) (successMessage string, err *model.CustomErr) {
+func (db *storage) TransferSumBetweenAccounts(id1, id2 int, delta float64, details model.OperationDetails) (result *model.OperationResult, err *model.CustomErr) {
 	//начало транзакции
 	transaction := db.database.Begin()
+	records, result, err := transferSum(transaction, id1, id2, delta, details)
+	if err != nil {
+		transaction.Rollback()
+		return nil, err
+	}
+	transaction.Commit()
+	db.replicas.noteWrites(records, time.Now())
+	return result, nil
+}
+
+//transferSum (internal) - перевод суммы между аккаунтами с комиссией и событием для подписчиков в рамках транзакции.
+//Возвращает все записи истории операции
+func transferSum(transaction *gorm.DB, id1, id2 int, delta float64, details model.OperationDetails) ([]model.TransactionRecord, *model.OperationResult, *model.CustomErr) {
+	//расчет комиссии, которую оплачивает отправитель перевода
+	payerId := id1
+	if delta < 0 {
+		payerId = id2
+	}
+	feeRule, feeSum, err := calculateFee(transaction, model.FeeOperationTransfer, payerId, math.Abs(delta), details.OperationCurrency())
+	if err != nil {
+		return nil, nil, err
+	}
+	records, err := transferBetweenAccounts(transaction, id1, id2, delta, details)
+	if err != nil {
+		return nil, nil, err
+	}
+	//списание комиссии
+	if feeSum > 0 {
+		feeRecords, err := chargeFee(transaction, payerId, feeSum, feeRule, details)
+		if err != nil {
+			return nil, nil, err
+		}
+		records = append(records, feeRecords...)
+	}
+	//сохранение события для подписчиков
+	err = writeOutboxEvent(transaction, model.BalanceTransferredEvent, records)
+	if err != nil {
+		return nil, nil, err
+	}
+	return records, &model.OperationResult{Record: records[0], Fee: feeSum}, nil
+}
+
+//transferBetweenAccounts (internal) - перевод суммы между аккаунтами в рамках транзакции без комиссии.
+//Возвращает записи истории аккаунтов id1 и id2
+func transferBetweenAccounts(transaction *gorm.DB, id1, id2 int, delta float64, details model.OperationDetails) ([]model.TransactionRecord, *model.CustomErr) {
 	acc1, acc2 := &model.BalanceInfo{AccountId: id1}, &model.BalanceInfo{AccountId: id2}
 	//попытка передачи суммы
-	err = updateOrCreateBalanceInfo(transaction, id1, -delta)
+	err := updateOrCreateBalanceInfo(transaction, id1, -delta)
 	if err != nil {
-		transaction.Rollback()
-		return "", err
+		return nil, err
 	}
 
 	err = updateOrCreateBalanceInfo(transaction, id2, delta)
 	if err != nil {
-		transaction.Rollback()
-		return "", err
+		return nil, err
 	}
 
 	//получение изменений
 	query := transaction.First(acc1, id1)
 	if query.Error != nil {
-		transaction.Rollback()
 		err = &model.CustomErr{
 			Err:     fmt.Errorf("storage.TransferSumBetweenAccounts: %v", query.Error),
 			ErrCode: model.DefaultErrCode,
 		}
-		return "", err
+		return nil, err
 	}
 	query = transaction.First(acc2, id2)
 	if query.Error != nil {
-		transaction.Rollback()
 		err = &model.CustomErr{
 			Err:     fmt.Errorf("storage.TransferSumBetweenAccounts: %v", query.Error),
 			ErrCode: model.DefaultErrCode,
 		}
-		return "", err
+		return nil, err
+	}
+	if err = checkNotFrozen(transaction, acc1); err == nil {
+		err = checkNotFrozen(transaction, acc2)
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	record1 := &model.TransactionRecord{
 		AccountId:        id1,
 		Delta:            -delta,
 		RemainingBalance: acc1.Balance,
+		OperationType:    model.OperationTransferOut,
+		CounterpartyId:   &id2,
 		CreatedAt:        time.Now(),
 	}
 
@@ -133,44 +222,48 @@ func (db *storage) TransferSumBetweenAccounts(id1, id2 int, delta float64) (succ
 		AccountId:        id2,
 		Delta:            delta,
 		RemainingBalance: acc2.Balance,
+		OperationType:    model.OperationTransferIn,
+		CounterpartyId:   &id1,
 		CreatedAt:        time.Now(),
 	}
-
-	var transactionMessage string
-	if delta > 0 {
-		transactionMessage = fmt.Sprintf("Перевод на сумму %.2f руб. с аккаунта %d на аккаунт %d выполнен успешно.", delta, id1, id2)
-	} else {
-		transactionMessage = fmt.Sprintf("Перевод на сумму %.2f руб. с аккаунта %d на аккаунт %d выполнен успешно.", -delta, id2, id1)
+	if delta < 0 {
+		record1.OperationType, record2.OperationType = model.OperationTransferIn, model.OperationTransferOut
 	}
-	record1.TransactionMessage, record2.TransactionMessage = transactionMessage, transactionMessage
+	details.Apply(record1)
+	details.Apply(record2)
 
 	//сохранение в истории
-	query = transaction.Create(record1)
-	if query.Error != nil {
-		transaction.Rollback()
-		err = &model.CustomErr{
-			Err:     fmt.Errorf("storage.ChangeAccountBalance: %v", query.Error),
-			ErrCode: model.DefaultErrCode,
-		}
-		return "", err
+	err = appendHistoryRecord(transaction, record1)
+	if err != nil {
+		return nil, err
 	}
 
-	query = transaction.Create(record2)
-	if query.Error != nil {
-		transaction.Rollback()
-		err = &model.CustomErr{
-			Err:     fmt.Errorf("storage.ChangeAccountBalance: %v", query.Error),
-			ErrCode: model.DefaultErrCode,
-		}
-		return "", err
+	//запись получателя связывается с записью отправителя для отмены перевода
+	record2.PairId = &record1.Id
+	err = appendHistoryRecord(transaction, record2)
+	if err != nil {
+		return nil, err
 	}
-	transaction.Commit()
-	return transactionMessage, nil
+	return []model.TransactionRecord{*record1, *record2}, nil
 }
 
 //GetSortedTransactionsHistory - реализует метод интерфейса IBalanceInfoStorage
-func (db *storage) GetSortedTransactionsHistory(id int, sortedBy string, sortedByDesc bool) (history []model.TransactionRecord, err *model.CustomErr) {
-	query := db.database.Where("account_id = ?", id)
+func (db *storage) GetSortedTransactionsHistory(id int, sortedBy string, sortedByDesc bool, filter model.HistoryFilter) (history []model.TransactionRecord, err *model.CustomErr) {
+	db.read(id, true, func(database *gorm.DB) *model.CustomErr {
+		history, err = getSortedTransactionsHistory(database, id, sortedBy, sortedByDesc, filter)
+		return err
+	})
+	return history, err
+}
+
+func getSortedTransactionsHistory(database *gorm.DB, id int, sortedBy string, sortedByDesc bool, filter model.HistoryFilter) (history []model.TransactionRecord, err *model.CustomErr) {
+	query := database.Where("account_id = ?", id)
+	if len(filter.OperationTypes) > 0 {
+		query = query.Where("operation_type IN (?)", filter.OperationTypes)
+	}
+	if filter.CounterpartyId != 0 {
+		query = query.Where("counterparty_id = ?", filter.CounterpartyId)
+	}
 
 	if sortedBy != "" {
 		var sortBy string
@@ -208,6 +301,73 @@ func (db *storage) GetSortedTransactionsHistory(id int, sortedBy string, sortedB
 	return history, nil
 }
 
+//FindTransactionsByExternalRef - реализует метод интерфейса IBalanceInfoStorage.
+//Поиск выполняется на основном сервере: по внешнему идентификатору клиент проверяет, выполнена ли операция, перед
+//повтором, а реплика могла еще не получить операцию, выполненную другим экземпляром сервиса
+func (db *storage) FindTransactionsByExternalRef(externalRef string, accountId int) ([]model.TransactionRecord, *model.CustomErr) {
+	return findTransactionsByExternalRef(db.database, externalRef, accountId)
+}
+
+func findTransactionsByExternalRef(database *gorm.DB, externalRef string, accountId int) ([]model.TransactionRecord, *model.CustomErr) {
+	history := []model.TransactionRecord{}
+	query := database.Where("external_ref = ?", externalRef)
+	if accountId != 0 {
+		query = query.Where("account_id = ?", accountId)
+	}
+	if err := query.Order("id").Find(&history).Error; err != nil {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.FindTransactionsByExternalRef: %v", err),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	return history, nil
+}
+
+//checkNotFrozen (internal) - ошибка с кодом AccountFrozenCode, если аккаунт или один из его родительских аккаунтов
+//заблокирован
+func checkNotFrozen(transaction *gorm.DB, acc *model.BalanceInfo) *model.CustomErr {
+	if acc.Frozen {
+		return &model.CustomErr{
+			Err:     fmt.Errorf("storage.checkNotFrozen: аккаунт %d заблокирован", acc.AccountId),
+			ErrCode: model.AccountFrozenCode,
+		}
+	}
+	if acc.ParentId == nil {
+		return nil
+	}
+	ancestors, err := getAncestors(transaction, acc.AccountId)
+	if err != nil {
+		return err
+	}
+	for _, ancestor := range ancestors {
+		if ancestor.Frozen {
+			return &model.CustomErr{
+				Err:     fmt.Errorf("storage.checkNotFrozen: аккаунт %d заблокирован вместе с родительским аккаунтом %d", acc.AccountId, ancestor.AccountId),
+				ErrCode: model.AccountFrozenCode,
+			}
+		}
+	}
+	return nil
+}
+
+//SetAccountFrozen - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) SetAccountFrozen(id int, frozen bool) *model.CustomErr {
+	query := db.database.Model(model.BalanceInfo{AccountId: id}).UpdateColumn("frozen", frozen)
+	if query.Error != nil {
+		return &model.CustomErr{
+			Err:     fmt.Errorf("storage.SetAccountFrozen: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	if query.RowsAffected == 0 {
+		return &model.CustomErr{
+			Err:     fmt.Errorf("storage.SetAccountFrozen: аккаунт %d не найден", id),
+			ErrCode: model.NotFoundCode,
+		}
+	}
+	return nil
+}
+
 func updateOrCreateBalanceInfo(transaction *gorm.DB, id int, delta float64) (err *model.CustomErr) {
 	query := transaction.Model(model.BalanceInfo{AccountId: id}).UpdateColumn("balance", gorm.Expr("balance + ?", delta))
 	if query.Error == nil && query.RowsAffected == 0 {
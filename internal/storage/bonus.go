@@ -0,0 +1,307 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	"github.com/jinzhu/gorm"
+)
+
+//expireBonusBatchSize - максимальное количество партий бонусов, списываемых ExpireBonusLots в одной транзакции
+const expireBonusBatchSize = 500
+
+//getBonusBalance (internal) - сумма остатков партий бонусов аккаунта id, действующих в момент at
+func getBonusBalance(database *gorm.DB, id int, at time.Time) (float64, *model.CustomErr) {
+	result := struct {
+		Balance float64
+	}{}
+	err := database.Raw(`SELECT COALESCE(SUM(remaining), 0) AS balance FROM bonus_lots
+		WHERE account_id = ? AND remaining > 0 AND expires_at > ?`, id, at).Scan(&result).Error
+	if err != nil {
+		return 0, &model.CustomErr{
+			Err:     fmt.Errorf("storage.getBonusBalance: %v", err),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	return result.Balance, nil
+}
+
+//lockBonusAccount (internal) - блокировка строки аккаунта id до конца транзакции, чтобы операции с бонусами аккаунта
+//выполнялись по очереди. Возвращает ошибку с кодом AccountFrozenCode, если аккаунт заблокирован
+func lockBonusAccount(transaction *gorm.DB, id int) (*model.BalanceInfo, *model.CustomErr) {
+	acc := &model.BalanceInfo{}
+	query := transaction.Set("gorm:query_option", "FOR UPDATE").First(acc, id)
+	if query.Error != nil {
+		err := &model.CustomErr{
+			Err:     fmt.Errorf("storage.lockBonusAccount: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+		if query.Error == gorm.ErrRecordNotFound {
+			err.Err = fmt.Errorf("storage.lockBonusAccount: у аккаунта %d нет бонусов", id)
+			err.ErrCode = model.InsufficientFundsCode
+		}
+		return nil, err
+	}
+	if err := checkNotFrozen(transaction, acc); err != nil {
+		return nil, err
+	}
+	return acc, nil
+}
+
+//CreditBonus - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) CreditBonus(id int, amount float64, expiresAt time.Time, details model.OperationDetails) (*model.BonusRecord, *model.CustomErr) {
+	now := time.Now()
+	//начало транзакции
+	transaction := db.database.Begin()
+	err := transaction.Exec("INSERT INTO accounts (account_id, balance) VALUES (?, 0) ON CONFLICT (account_id) DO NOTHING", id).Error
+	if err != nil {
+		transaction.Rollback()
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.CreditBonus: %v", err),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	if _, custErr := lockBonusAccount(transaction, id); custErr != nil {
+		transaction.Rollback()
+		return nil, custErr
+	}
+	lot := &model.BonusLot{
+		AccountId:   id,
+		Amount:      amount,
+		Remaining:   amount,
+		Purpose:     details.Purpose,
+		ExternalRef: details.ExternalRef,
+		CreatedAt:   now,
+		ExpiresAt:   dbTime(expiresAt),
+	}
+	if err = transaction.Create(lot).Error; err != nil {
+		transaction.Rollback()
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.CreditBonus: %v", err),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	balance, custErr := getBonusBalance(transaction, id, now)
+	if custErr != nil {
+		transaction.Rollback()
+		return nil, custErr
+	}
+	record := &model.BonusRecord{
+		AccountId:        id,
+		LotId:            lot.Id,
+		Delta:            amount,
+		RemainingBalance: balance,
+		OperationType:    model.BonusCredit,
+		Purpose:          details.Purpose,
+		ExternalRef:      details.ExternalRef,
+		CreatedAt:        now,
+	}
+	if custErr = appendBonusRecord(transaction, record); custErr != nil {
+		transaction.Rollback()
+		return nil, custErr
+	}
+	transaction.Commit()
+	db.replicas.noteBonusWrites([]model.BonusRecord{*record}, time.Now())
+	return record, nil
+}
+
+//SpendBonus - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) SpendBonus(id int, amount float64, details model.OperationDetails) ([]model.BonusRecord, *model.CustomErr) {
+	now := time.Now()
+	//начало транзакции
+	transaction := db.database.Begin()
+	if _, err := lockBonusAccount(transaction, id); err != nil {
+		transaction.Rollback()
+		return nil, err
+	}
+	//блокировка партий в порядке начисления, чтобы их остатки не изменились до списания
+	lots := []model.BonusLot{}
+	query := transaction.Set("gorm:query_option", "FOR UPDATE").
+		Where("account_id = ? AND remaining > 0 AND expires_at > ?", id, now).Order("id").Find(&lots)
+	if query.Error != nil {
+		transaction.Rollback()
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.SpendBonus: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	var balance float64
+	for _, lot := range lots {
+		balance += lot.Remaining
+	}
+	balance = math.Round(balance*100) / 100
+	if balance < amount {
+		transaction.Rollback()
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.SpendBonus: на аккаунте %d %.2f бонусов, требуется %.2f", id, balance, amount),
+			ErrCode: model.InsufficientFundsCode,
+		}
+	}
+
+	//списание с партий в порядке начисления
+	records := []model.BonusRecord{}
+	left := amount
+	for i := 0; left > 0 && i < len(lots); i++ {
+		spent := math.Min(lots[i].Remaining, left)
+		query = transaction.Model(&lots[i]).UpdateColumn("remaining", gorm.Expr("remaining - ?", spent))
+		if query.Error != nil {
+			transaction.Rollback()
+			return nil, &model.CustomErr{
+				Err:     fmt.Errorf("storage.SpendBonus: %v", query.Error),
+				ErrCode: model.DefaultErrCode,
+			}
+		}
+		left = math.Round((left-spent)*100) / 100
+		balance = math.Round((balance-spent)*100) / 100
+		record := model.BonusRecord{
+			AccountId:        id,
+			LotId:            lots[i].Id,
+			Delta:            -spent,
+			RemainingBalance: balance,
+			OperationType:    model.BonusSpend,
+			Purpose:          details.Purpose,
+			ExternalRef:      details.ExternalRef,
+			CreatedAt:        now,
+		}
+		if err := appendBonusRecord(transaction, &record); err != nil {
+			transaction.Rollback()
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	transaction.Commit()
+	db.replicas.noteBonusWrites(records, time.Now())
+	return records, nil
+}
+
+//ExpireBonusLots - реализует метод интерфейса IBalanceInfoStorage.
+//Партии списываются пачками по expireBonusBatchSize, каждая в отдельной транзакции. Партии, заблокированные
+//списанием бонусов, пропускаются до следующего запуска
+func (db *storage) ExpireBonusLots(now time.Time) (int64, *model.CustomErr) {
+	var total int64
+	for {
+		count, err := db.expireBonusBatch(now)
+		total += count
+		if err != nil {
+			return total, err
+		}
+		if count < expireBonusBatchSize {
+			return total, nil
+		}
+	}
+}
+
+//expireBonusBatch (internal) - списание остатков не более expireBonusBatchSize просроченных партий в одной транзакции
+func (db *storage) expireBonusBatch(now time.Time) (int64, *model.CustomErr) {
+	//начало транзакции
+	transaction := db.database.Begin()
+	lots := []model.BonusLot{}
+	query := transaction.Set("gorm:query_option", "FOR UPDATE SKIP LOCKED").
+		Where("remaining > 0 AND expires_at <= ?", now).Order("account_id, id").Limit(expireBonusBatchSize).Find(&lots)
+	if query.Error != nil {
+		transaction.Rollback()
+		return 0, &model.CustomErr{
+			Err:     fmt.Errorf("storage.expireBonusBatch: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	records := make([]model.BonusRecord, 0, len(lots))
+	for i := range lots {
+		remaining := lots[i].Remaining
+		query = transaction.Model(&lots[i]).UpdateColumn("remaining", 0)
+		if query.Error != nil {
+			transaction.Rollback()
+			return 0, &model.CustomErr{
+				Err:     fmt.Errorf("storage.expireBonusBatch: %v", query.Error),
+				ErrCode: model.DefaultErrCode,
+			}
+		}
+		//сгоревшая партия уже не входит в бонусный баланс
+		balance, err := getBonusBalance(transaction, lots[i].AccountId, now)
+		if err != nil {
+			transaction.Rollback()
+			return 0, err
+		}
+		record := &model.BonusRecord{
+			AccountId:        lots[i].AccountId,
+			LotId:            lots[i].Id,
+			Delta:            -remaining,
+			RemainingBalance: balance,
+			OperationType:    model.BonusExpiry,
+			CreatedAt:        now,
+		}
+		if err = appendBonusRecord(transaction, record); err != nil {
+			transaction.Rollback()
+			return 0, err
+		}
+		records = append(records, *record)
+	}
+	transaction.Commit()
+	db.replicas.noteBonusWrites(records, time.Now())
+	return int64(len(lots)), nil
+}
+
+//appendBonusRecord (internal) - сохранение записи истории бонусов в рамках транзакции
+func appendBonusRecord(transaction *gorm.DB, record *model.BonusRecord) *model.CustomErr {
+	if err := transaction.Create(record).Error; err != nil {
+		return &model.CustomErr{
+			Err:     fmt.Errorf("storage.appendBonusRecord: %v", err),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	return nil
+}
+
+//GetBonusLots - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) GetBonusLots(id int) (lots []model.BonusLot, err *model.CustomErr) {
+	db.read(id, db.replicas.balanceReads, func(database *gorm.DB) *model.CustomErr {
+		lots, err = getBonusLots(database, id)
+		return err
+	})
+	return lots, err
+}
+
+//GetBonusLots - реализует метод интерфейса IBalanceInfoStorage
+func (db *primaryStorage) GetBonusLots(id int) ([]model.BonusLot, *model.CustomErr) {
+	return getBonusLots(db.database, id)
+}
+
+func getBonusLots(database *gorm.DB, id int) ([]model.BonusLot, *model.CustomErr) {
+	lots := []model.BonusLot{}
+	query := database.Where("account_id = ? AND remaining > 0 AND expires_at > ?", id, time.Now()).Order("id").Find(&lots)
+	if query.Error != nil {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.GetBonusLots: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	return lots, nil
+}
+
+//GetBonusHistory - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) GetBonusHistory(id int) (history []model.BonusRecord, err *model.CustomErr) {
+	db.read(id, true, func(database *gorm.DB) *model.CustomErr {
+		history, err = getBonusHistory(database, id)
+		return err
+	})
+	return history, err
+}
+
+//GetBonusHistory - реализует метод интерфейса IBalanceInfoStorage
+func (db *primaryStorage) GetBonusHistory(id int) ([]model.BonusRecord, *model.CustomErr) {
+	return getBonusHistory(db.database, id)
+}
+
+func getBonusHistory(database *gorm.DB, id int) ([]model.BonusRecord, *model.CustomErr) {
+	history := []model.BonusRecord{}
+	query := database.Where("account_id = ?", id).Order("id").Find(&history)
+	if query.Error != nil {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.GetBonusHistory: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	return history, nil
+}
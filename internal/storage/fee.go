@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/fee"
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	"github.com/jinzhu/gorm"
+)
+
+//QuoteFee - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) QuoteFee(operation string, id int, amount float64, currency string) (*model.FeeQuote, *model.CustomErr) {
+	if operation != model.FeeOperationWithdrawal && operation != model.FeeOperationTransfer {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.QuoteFee: некорректный входной параметр operation: %s", operation),
+			ErrCode: model.WrongInputParamsCode,
+		}
+	}
+	if currency == "" {
+		currency = model.BaseCurrency
+	}
+	rule, feeSum, err := calculateFee(db.database, operation, id, amount, currency)
+	if err != nil {
+		return nil, err
+	}
+	quote := &model.FeeQuote{
+		Operation: operation,
+		AccountId: id,
+		Amount:    amount,
+		Fee:       feeSum,
+		Total:     amount + feeSum,
+		Currency:  currency,
+	}
+	if rule != nil {
+		quote.RevenueAccountId = rule.RevenueAccountId
+	}
+	return quote, nil
+}
+
+//calculateFee (internal) - подбирает правило комиссии для операции operation в валюте currency, оплачиваемой аккаунтом id,
+//и считает комиссию
+func calculateFee(database *gorm.DB, operation string, id int, amount float64, currency string) (*model.FeeRule, float64, *model.CustomErr) {
+	acc := &model.BalanceInfo{}
+	tier := model.DefaultAccountTier
+	query := database.Select("tier").Where("account_id = ?", id).First(acc)
+	if query.Error == nil {
+		tier = acc.Tier
+	} else if query.Error != gorm.ErrRecordNotFound {
+		return nil, 0, &model.CustomErr{
+			Err:     fmt.Errorf("storage.calculateFee: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+
+	//из равноценных правил FindRule выбирает первое, поэтому правила упорядочены по id
+	var rules []model.FeeRule
+	query = database.Where("operation = ?", operation).Order("id").Find(&rules)
+	if query.Error != nil {
+		return nil, 0, &model.CustomErr{
+			Err:     fmt.Errorf("storage.calculateFee: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	rule := fee.FindRule(rules, operation, currency, tier)
+	return rule, fee.Calculate(rule, amount), nil
+}
+
+//chargeFee (internal) - списывает комиссию feeSum с аккаунта id на счет доходов rule.RevenueAccountId в рамках транзакции
+//и сохраняет списание и зачисление комиссии отдельными записями истории с данными операции details. Возвращает созданные записи
+func chargeFee(transaction *gorm.DB, id int, feeSum float64, rule *model.FeeRule, details model.OperationDetails) ([]model.TransactionRecord, *model.CustomErr) {
+	err := updateOrCreateBalanceInfo(transaction, id, -feeSum)
+	if err != nil {
+		return nil, err
+	}
+	err = updateOrCreateBalanceInfo(transaction, rule.RevenueAccountId, feeSum)
+	if err != nil {
+		return nil, err
+	}
+
+	payer, revenue := &model.BalanceInfo{}, &model.BalanceInfo{}
+	query := transaction.First(payer, id)
+	if query.Error == nil {
+		query = transaction.First(revenue, rule.RevenueAccountId)
+	}
+	if query.Error != nil {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.chargeFee: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+
+	now := time.Now()
+	revenueId := rule.RevenueAccountId
+	records := []model.TransactionRecord{
+		{
+			AccountId:        id,
+			Delta:            -feeSum,
+			RemainingBalance: payer.Balance,
+			OperationType:    model.OperationFee,
+			CounterpartyId:   &revenueId,
+			CreatedAt:        now,
+		},
+		{
+			AccountId:        rule.RevenueAccountId,
+			Delta:            feeSum,
+			RemainingBalance: revenue.Balance,
+			OperationType:    model.OperationFee,
+			CounterpartyId:   &id,
+			CreatedAt:        now,
+		},
+	}
+	for i := range records {
+		details.Apply(&records[i])
+		if i > 0 {
+			records[i].PairId = &records[0].Id
+		}
+		if err := appendHistoryRecord(transaction, &records[i]); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
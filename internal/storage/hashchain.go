@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/call-me-snake/user_balance_service/internal/hashchain"
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	"github.com/jinzhu/gorm"
+)
+
+//appendHistoryRecord (internal) - сохранение записи истории в рамках транзакции с продолжением цепочки хешей аккаунта
+//и учетом в обороте аккаунта. Строка аккаунта к этому моменту заблокирована изменением баланса, поэтому записи аккаунта
+//добавляются по очереди
+func appendHistoryRecord(transaction *gorm.DB, record *model.TransactionRecord) *model.CustomErr {
+	last := &model.TransactionRecord{}
+	query := transaction.Select("hash").Where("account_id = ?", record.AccountId).Order("id DESC").Limit(1).Find(last)
+	if query.Error != nil && query.Error != gorm.ErrRecordNotFound {
+		return &model.CustomErr{
+			Err:     fmt.Errorf("storage.appendHistoryRecord: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	record.CreatedAt = record.CreatedAt.Truncate(hashchain.Precision)
+	record.PrevHash = last.Hash
+	record.Hash = hashchain.Hash(*record, record.PrevHash)
+	query = transaction.Create(record)
+	if query.Error != nil {
+		return &model.CustomErr{
+			Err:     fmt.Errorf("storage.appendHistoryRecord: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	return addTurnover(transaction, record)
+}
+
+//GetHistoryChain - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) GetHistoryChain(accountId int) ([]model.TransactionRecord, *model.CustomErr) {
+	history := []model.TransactionRecord{}
+	query := db.database.Where("account_id = ?", accountId).Order("id").Find(&history)
+	if query.Error != nil {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.GetHistoryChain: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	return history, nil
+}
+
+//GetAccountIds - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) GetAccountIds() ([]int, *model.CustomErr) {
+	ids := []int{}
+	query := db.database.Model(&model.BalanceInfo{}).Order("account_id").Pluck("account_id", &ids)
+	if query.Error != nil {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.GetAccountIds: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,343 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	"github.com/jinzhu/gorm"
+)
+
+//endOfDayBalanceQuery - баланс аккаунта a на конец дня: последний снимок не позже этого дня плюс сумма изменений истории
+//после конца дня снимка до конца дня (без снимка - сумма всех изменений до конца дня)
+const endOfDayBalanceQuery = `SELECT COALESCE(s.balance, 0) + COALESCE((
+		SELECT SUM(h.delta) FROM transactions_history h
+		WHERE h.account_id = a.account_id AND h.created_at < ? AND (s.snapshot_date IS NULL OR h.created_at >= s.snapshot_date + 1)
+	), 0) AS balance
+	FROM (SELECT 1) AS one
+	LEFT JOIN LATERAL (
+		SELECT balance, snapshot_date FROM balance_snapshots
+		WHERE account_id = a.account_id AND snapshot_date <= ?
+		ORDER BY snapshot_date DESC LIMIT 1
+	) s ON TRUE`
+
+//SetAccountProduct - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) SetAccountProduct(id int, product string) *model.CustomErr {
+	var value interface{} = gorm.Expr("NULL")
+	if product != "" {
+		query := db.database.First(&model.AccountProduct{}, "product = ?", product)
+		if query.Error == gorm.ErrRecordNotFound {
+			return &model.CustomErr{
+				Err:     fmt.Errorf("storage.SetAccountProduct: продукт %q не найден", product),
+				ErrCode: model.NotFoundCode,
+			}
+		}
+		if query.Error != nil {
+			return &model.CustomErr{
+				Err:     fmt.Errorf("storage.SetAccountProduct: %v", query.Error),
+				ErrCode: model.DefaultErrCode,
+			}
+		}
+		value = product
+	}
+	query := db.database.Model(model.BalanceInfo{AccountId: id}).UpdateColumn("product", value)
+	if query.Error != nil {
+		return &model.CustomErr{
+			Err:     fmt.Errorf("storage.SetAccountProduct: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	if query.RowsAffected == 0 {
+		return &model.CustomErr{
+			Err:     fmt.Errorf("storage.SetAccountProduct: аккаунт %d не найден", id),
+			ErrCode: model.NotFoundCode,
+		}
+	}
+	return nil
+}
+
+//GetLastInterestAccrualDate - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) GetLastInterestAccrualDate() (*time.Time, *model.CustomErr) {
+	result := struct {
+		Day *time.Time
+	}{}
+	err := db.database.Raw("SELECT MAX(day) AS day FROM interest_accrual_days").Scan(&result).Error
+	if err != nil {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.GetLastInterestAccrualDate: %v", err),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	return result.Day, nil
+}
+
+//AccrueInterest - реализует метод интерфейса IBalanceInfoStorage.
+//Проценты за день - баланс на конец дня, умноженный на годовую ставку и деленный на количество дней в году.
+//Начисления сохраняются без округления, вместе с ними сохраняется день начисления
+func (db *storage) AccrueInterest(day time.Time) (int64, *model.CustomErr) {
+	day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	daysInYear := time.Date(day.Year()+1, 1, 1, 0, 0, 0, 0, time.UTC).Sub(time.Date(day.Year(), 1, 1, 0, 0, 0, 0, time.UTC)).Hours() / 24
+	//начало транзакции
+	transaction := db.database.Begin()
+	query := transaction.Exec(`INSERT INTO interest_accruals (account_id, day, balance, annual_rate, amount, expense_account_id)
+		SELECT a.account_id, ?, b.balance, p.annual_rate, b.balance * p.annual_rate / 100 / ?, p.expense_account_id
+		FROM accounts a
+		JOIN account_products p ON p.product = a.product
+		CROSS JOIN LATERAL (`+endOfDayBalanceQuery+`) b
+		WHERE p.annual_rate > 0 AND b.balance > 0
+		ON CONFLICT (account_id, day) DO NOTHING`,
+		day.Format("2006-01-02"), int(daysInYear), day.AddDate(0, 0, 1), day.Format("2006-01-02"))
+	if query.Error == nil {
+		query = transaction.Exec(`INSERT INTO interest_accrual_days (day, account_count, created_at) VALUES (?, ?, ?)
+			ON CONFLICT (day) DO NOTHING`, day.Format("2006-01-02"), query.RowsAffected, time.Now())
+	}
+	if query.Error != nil {
+		transaction.Rollback()
+		return 0, &model.CustomErr{
+			Err:     fmt.Errorf("storage.AccrueInterest: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	count := query.RowsAffected
+	transaction.Commit()
+	return count, nil
+}
+
+//GetUnpaidInterestAccountIds - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) GetUnpaidInterestAccountIds(periodEnd time.Time) ([]int, *model.CustomErr) {
+	ids := []int{}
+	query := db.database.Model(&model.InterestAccrual{}).
+		Where("paid_record_id IS NULL AND day < ?", periodEnd.Format("2006-01-02")).
+		Order("account_id").Pluck("DISTINCT account_id", &ids)
+	if query.Error != nil {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.GetUnpaidInterestAccountIds: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	return ids, nil
+}
+
+//CapitalizeInterest - реализует метод интерфейса IBalanceInfoStorage.
+//Проценты, начисленные по продуктам с разными счетами расходов, выплачиваются отдельными операциями
+func (db *storage) CapitalizeInterest(accountId int, periodEnd time.Time) (float64, *model.CustomErr) {
+	//начало транзакции
+	transaction := db.database.Begin()
+	expenseIds := []int{}
+	query := transaction.Model(&model.InterestAccrual{}).
+		Where("account_id = ? AND day < ? AND paid_record_id IS NULL", accountId, periodEnd.Format("2006-01-02")).
+		Pluck("DISTINCT expense_account_id", &expenseIds)
+	if query.Error != nil {
+		transaction.Rollback()
+		return 0, &model.CustomErr{
+			Err:     fmt.Errorf("storage.CapitalizeInterest: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	if len(expenseIds) == 0 {
+		transaction.Rollback()
+		return 0, nil
+	}
+	//блокировка аккаунта и счетов расходов в порядке возрастания id, чтобы проценты не были выплачены дважды
+	//параллельными выплатами и встречные операции со счетами расходов не приводили к взаимоблокировке
+	err := lockAccounts(transaction, append(expenseIds, accountId), accountId)
+	if err != nil {
+		transaction.Rollback()
+		return 0, err
+	}
+	unpaid := []struct {
+		ExpenseAccountId int
+		Amount           float64
+	}{}
+	//учитываются только заблокированные счета расходов; начисления по новым счетам будут выплачены следующей выплатой
+	query = transaction.Raw(`SELECT expense_account_id, SUM(amount) AS amount FROM interest_accruals
+		WHERE account_id = ? AND day < ? AND paid_record_id IS NULL AND expense_account_id IN (?)
+		GROUP BY expense_account_id ORDER BY expense_account_id`, accountId, periodEnd.Format("2006-01-02"), expenseIds).Scan(&unpaid)
+	if query.Error != nil {
+		transaction.Rollback()
+		return 0, &model.CustomErr{
+			Err:     fmt.Errorf("storage.CapitalizeInterest: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+
+	var paid float64
+	var records []model.TransactionRecord
+	for _, group := range unpaid {
+		amount := math.Round(group.Amount*100) / 100
+		if amount <= 0 {
+			continue
+		}
+		credit, err := creditInterest(transaction, accountId, group.ExpenseAccountId, amount)
+		if err != nil {
+			transaction.Rollback()
+			return 0, err
+		}
+		query = transaction.Model(&model.InterestAccrual{}).
+			Where("account_id = ? AND day < ? AND paid_record_id IS NULL AND expense_account_id = ?",
+				accountId, periodEnd.Format("2006-01-02"), group.ExpenseAccountId).
+			UpdateColumn("paid_record_id", credit[0].Id)
+		if query.Error != nil {
+			transaction.Rollback()
+			return 0, &model.CustomErr{
+				Err:     fmt.Errorf("storage.CapitalizeInterest: %v", query.Error),
+				ErrCode: model.DefaultErrCode,
+			}
+		}
+		paid += amount
+		records = append(records, credit...)
+	}
+	if len(records) == 0 {
+		transaction.Rollback()
+		return 0, nil
+	}
+	//сохранение события для подписчиков
+	err = writeOutboxEvent(transaction, model.BalanceInterestEvent, records)
+	if err != nil {
+		transaction.Rollback()
+		return 0, err
+	}
+	transaction.Commit()
+	db.replicas.noteWrites(records, time.Now())
+	return paid, nil
+}
+
+//lockAccounts (internal) - блокировка строк аккаунтов ids (FOR UPDATE) в порядке возрастания id в рамках транзакции.
+//Отсутствующие аккаунты пропускаются (они будут созданы при изменении баланса), кроме обязательного аккаунта requiredId
+func lockAccounts(transaction *gorm.DB, ids []int, requiredId int) *model.CustomErr {
+	accs := []model.BalanceInfo{}
+	query := transaction.Set("gorm:query_option", "FOR UPDATE").
+		Where("account_id IN (?)", ids).Order("account_id").Find(&accs)
+	if query.Error != nil {
+		return &model.CustomErr{
+			Err:     fmt.Errorf("storage.lockAccounts: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	for _, acc := range accs {
+		if acc.AccountId == requiredId {
+			return nil
+		}
+	}
+	return &model.CustomErr{
+		Err:     fmt.Errorf("storage.lockAccounts: %v", gorm.ErrRecordNotFound),
+		ErrCode: model.DefaultErrCode,
+	}
+}
+
+//creditInterest (internal) - выплата процентов amount на аккаунт id со счета расходов expenseId в рамках транзакции.
+//Возвращает записи истории аккаунта и счета расходов
+func creditInterest(transaction *gorm.DB, id, expenseId int, amount float64) ([]model.TransactionRecord, *model.CustomErr) {
+	err := updateOrCreateBalanceInfo(transaction, expenseId, -amount)
+	if err != nil {
+		return nil, err
+	}
+	err = updateOrCreateBalanceInfo(transaction, id, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	acc, expense := &model.BalanceInfo{}, &model.BalanceInfo{}
+	query := transaction.First(acc, id)
+	if query.Error == nil {
+		query = transaction.First(expense, expenseId)
+	}
+	if query.Error != nil {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.creditInterest: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	if err = checkNotFrozen(transaction, acc); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	records := []model.TransactionRecord{
+		{
+			AccountId:        id,
+			Delta:            amount,
+			RemainingBalance: acc.Balance,
+			OperationType:    model.OperationInterest,
+			CounterpartyId:   &expenseId,
+			CreatedAt:        now,
+		},
+		{
+			AccountId:        expenseId,
+			Delta:            -amount,
+			RemainingBalance: expense.Balance,
+			OperationType:    model.OperationInterest,
+			CounterpartyId:   &id,
+			CreatedAt:        now,
+		},
+	}
+	for i := range records {
+		if i > 0 {
+			records[i].PairId = &records[0].Id
+		}
+		if err := appendHistoryRecord(transaction, &records[i]); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+//GetAccruedInterest - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) GetAccruedInterest(accountId int) (preview *model.InterestPreview, err *model.CustomErr) {
+	db.read(accountId, true, func(database *gorm.DB) *model.CustomErr {
+		preview, err = getAccruedInterest(database, accountId)
+		return err
+	})
+	return preview, err
+}
+
+//GetAccruedInterest - реализует метод интерфейса IBalanceInfoStorage
+func (db *primaryStorage) GetAccruedInterest(accountId int) (*model.InterestPreview, *model.CustomErr) {
+	return getAccruedInterest(db.database, accountId)
+}
+
+func getAccruedInterest(database *gorm.DB, accountId int) (*model.InterestPreview, *model.CustomErr) {
+	acc := &model.BalanceInfo{}
+	query := database.First(acc, accountId)
+	if query.Error != nil {
+		err := &model.CustomErr{
+			Err:     fmt.Errorf("storage.GetAccruedInterest: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+		if query.Error == gorm.ErrRecordNotFound {
+			err.Err = fmt.Errorf("storage.GetAccruedInterest: аккаунт %d не найден", accountId)
+			err.ErrCode = model.NotFoundCode
+		}
+		return nil, err
+	}
+	preview := &model.InterestPreview{AccountId: accountId, Accruals: []model.InterestAccrual{}}
+	if acc.Product != nil {
+		product := &model.AccountProduct{}
+		query = database.First(product, "product = ?", *acc.Product)
+		if query.Error != nil {
+			return nil, &model.CustomErr{
+				Err:     fmt.Errorf("storage.GetAccruedInterest: %v", query.Error),
+				ErrCode: model.DefaultErrCode,
+			}
+		}
+		preview.Product, preview.AnnualRate = product.Product, product.AnnualRate
+	}
+	query = database.Where("account_id = ? AND paid_record_id IS NULL", accountId).Order("day").Find(&preview.Accruals)
+	if query.Error != nil {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.GetAccruedInterest: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	var accrued float64
+	for _, accrual := range preview.Accruals {
+		accrued += accrual.Amount
+	}
+	preview.Accrued = math.Round(accrued*100) / 100
+	if len(preview.Accruals) > 0 {
+		preview.AccruedFrom = &preview.Accruals[0].Day
+		preview.AccruedTo = &preview.Accruals[len(preview.Accruals)-1].Day
+	}
+	return preview, nil
+}
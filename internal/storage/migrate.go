@@ -0,0 +1,322 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/call-me-snake/user_balance_service/internal/model"
+)
+
+//migration (internal) - изменение схемы базы данных до версии version.
+//Изменения идемпотентны, чтобы миграцию можно было применить к базе, созданной до появления таблицы schema_migrations
+type migration struct {
+	version    int
+	statements string
+}
+
+//migrations - миграции схемы по возрастанию версий. Последняя версия должна быть равна model.SchemaVersion,
+//а итоговая схема - схеме docker_storage/tables.sql
+var migrations = []migration{
+	{version: 1, statements: `
+		CREATE TABLE IF NOT EXISTS accounts
+		(
+			account_id INTEGER CONSTRAINT account_id_pk PRIMARY KEY,
+			balance NUMERIC CONSTRAINT positive_balance CHECK (balance>=0),
+			CONSTRAINT positive_id CHECK (account_id>0)
+		);
+		ALTER TABLE accounts ADD COLUMN IF NOT EXISTS tier TEXT NOT NULL DEFAULT 'standard';
+
+		CREATE TABLE IF NOT EXISTS transactions_history
+		(
+			account_id INTEGER REFERENCES accounts ON DELETE RESTRICT,
+			delta NUMERIC,
+			remaining_balance NUMERIC CONSTRAINT positive_balance CHECK (remaining_balance>=0),
+			transaction_message TEXT,
+			created_at TIMESTAMP
+		);
+		ALTER TABLE transactions_history ADD COLUMN IF NOT EXISTS operation_type TEXT,
+			ADD COLUMN IF NOT EXISTS counterparty_id INTEGER;
+
+		CREATE TABLE IF NOT EXISTS fee_rules
+		(
+			id SERIAL CONSTRAINT fee_rules_pk PRIMARY KEY,
+			operation TEXT NOT NULL,
+			currency TEXT NOT NULL DEFAULT '',
+			account_tier TEXT NOT NULL DEFAULT '',
+			fixed NUMERIC NOT NULL DEFAULT 0,
+			percent NUMERIC NOT NULL DEFAULT 0,
+			min_fee NUMERIC NOT NULL DEFAULT 0,
+			max_fee NUMERIC NOT NULL DEFAULT 0,
+			revenue_account_id INTEGER NOT NULL CONSTRAINT positive_revenue_account_id CHECK (revenue_account_id>0)
+		);
+
+		CREATE TABLE IF NOT EXISTS scheduled_transfers
+		(
+			id SERIAL CONSTRAINT scheduled_transfers_pk PRIMARY KEY,
+			from_id INTEGER NOT NULL CONSTRAINT positive_from_id CHECK (from_id>0),
+			to_id INTEGER NOT NULL CONSTRAINT positive_to_id CHECK (to_id>0),
+			delta NUMERIC NOT NULL CONSTRAINT positive_delta CHECK (delta>0),
+			recurrence TEXT NOT NULL DEFAULT '',
+			next_run_at TIMESTAMP NOT NULL,
+			active BOOLEAN NOT NULL DEFAULT TRUE,
+			max_retries INTEGER NOT NULL DEFAULT 0,
+			retry_interval_sec INTEGER NOT NULL DEFAULT 0,
+			retry_count INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT NOT NULL DEFAULT '',
+			locked_until TIMESTAMP,
+			created_at TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS scheduled_transfers_due_idx ON scheduled_transfers (next_run_at) WHERE active;
+
+		CREATE TABLE IF NOT EXISTS scheduled_transfer_runs
+		(
+			id SERIAL CONSTRAINT scheduled_transfer_runs_pk PRIMARY KEY,
+			schedule_id INTEGER NOT NULL REFERENCES scheduled_transfers ON DELETE CASCADE,
+			run_at TIMESTAMP NOT NULL,
+			attempt INTEGER NOT NULL,
+			success BOOLEAN NOT NULL,
+			message TEXT NOT NULL DEFAULT ''
+		);
+
+		CREATE TABLE IF NOT EXISTS outbox_events
+		(
+			id BIGSERIAL CONSTRAINT outbox_events_pk PRIMARY KEY,
+			event_type TEXT NOT NULL,
+			payload JSONB NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS outbox_events_created_at_idx ON outbox_events (created_at);
+
+		CREATE TABLE IF NOT EXISTS webhook_subscriptions
+		(
+			id SERIAL CONSTRAINT webhook_subscriptions_pk PRIMARY KEY,
+			url TEXT NOT NULL,
+			secret TEXT NOT NULL,
+			active BOOLEAN NOT NULL DEFAULT TRUE,
+			created_at TIMESTAMP NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS webhook_deliveries
+		(
+			id BIGSERIAL CONSTRAINT webhook_deliveries_pk PRIMARY KEY,
+			event_id BIGINT NOT NULL REFERENCES outbox_events ON DELETE CASCADE,
+			subscription_id INTEGER NOT NULL REFERENCES webhook_subscriptions ON DELETE CASCADE,
+			status TEXT NOT NULL DEFAULT 'pending',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			next_attempt_at TIMESTAMP NOT NULL,
+			last_error TEXT NOT NULL DEFAULT '',
+			locked_until TIMESTAMP,
+			delivered_at TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS webhook_deliveries_pending_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+
+		CREATE TABLE IF NOT EXISTS rate_limit_buckets
+		(
+			key TEXT CONSTRAINT rate_limit_buckets_pk PRIMARY KEY,
+			tokens DOUBLE PRECISION NOT NULL,
+			updated_at TIMESTAMP NOT NULL
+		);`},
+	{version: 2, statements: `
+		CREATE TABLE IF NOT EXISTS balance_snapshots
+		(
+			account_id INTEGER NOT NULL,
+			snapshot_date DATE NOT NULL,
+			balance NUMERIC NOT NULL,
+			created_at TIMESTAMP NOT NULL,
+			CONSTRAINT balance_snapshots_pk PRIMARY KEY (account_id, snapshot_date)
+		);
+		CREATE INDEX IF NOT EXISTS transactions_history_account_created_idx ON transactions_history (account_id, created_at);`},
+	{version: 3, statements: `
+		CREATE TABLE IF NOT EXISTS reconciliation_runs
+		(
+			id BIGSERIAL CONSTRAINT reconciliation_runs_pk PRIMARY KEY,
+			started_at TIMESTAMP NOT NULL,
+			finished_at TIMESTAMP NOT NULL,
+			accounts_checked INTEGER NOT NULL,
+			discrepancy_count INTEGER NOT NULL,
+			report JSONB NOT NULL
+		);`},
+	{version: 4, statements: `
+		ALTER TABLE transactions_history ADD COLUMN IF NOT EXISTS id BIGSERIAL CONSTRAINT transactions_history_pk PRIMARY KEY,
+			ADD COLUMN IF NOT EXISTS prev_hash TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS hash TEXT NOT NULL DEFAULT '';
+		CREATE INDEX IF NOT EXISTS transactions_history_account_id_idx ON transactions_history (account_id, id);`},
+	{version: 5, statements: `
+		ALTER TABLE accounts ADD COLUMN IF NOT EXISTS frozen BOOLEAN NOT NULL DEFAULT FALSE;`},
+	{version: 6, statements: `
+		CREATE TABLE IF NOT EXISTS account_statements
+		(
+			id BIGSERIAL CONSTRAINT account_statements_pk PRIMARY KEY,
+			account_id INTEGER NOT NULL,
+			period_start TIMESTAMP NOT NULL,
+			period_end TIMESTAMP NOT NULL,
+			opening_balance NUMERIC NOT NULL,
+			closing_balance NUMERIC NOT NULL,
+			total_credits NUMERIC NOT NULL,
+			total_debits NUMERIC NOT NULL,
+			movement_count INTEGER NOT NULL,
+			generated_at TIMESTAMP NOT NULL,
+			movements JSONB NOT NULL,
+			CONSTRAINT account_statements_period_key UNIQUE (account_id, period_start, period_end)
+		);`},
+	{version: 7, statements: `
+		CREATE TABLE IF NOT EXISTS daily_turnover
+		(
+			account_id INTEGER NOT NULL,
+			day DATE NOT NULL,
+			operation_type TEXT NOT NULL,
+			credits NUMERIC NOT NULL,
+			debits NUMERIC NOT NULL,
+			operation_count INTEGER NOT NULL,
+			CONSTRAINT daily_turnover_pk PRIMARY KEY (account_id, day, operation_type)
+		);
+		CREATE INDEX IF NOT EXISTS daily_turnover_day_idx ON daily_turnover (day);
+		INSERT INTO daily_turnover (account_id, day, operation_type, credits, debits, operation_count)
+			SELECT account_id, created_at::date, COALESCE(operation_type, ''),
+				COALESCE(SUM(delta) FILTER (WHERE delta > 0), 0), COALESCE(-SUM(delta) FILTER (WHERE delta < 0), 0), COUNT(*)
+			FROM transactions_history
+			GROUP BY account_id, created_at::date, COALESCE(operation_type, '')
+		ON CONFLICT (account_id, day, operation_type) DO NOTHING;`},
+	{version: 8, statements: `
+		ALTER TABLE transactions_history ADD COLUMN IF NOT EXISTS purpose TEXT NOT NULL DEFAULT '';
+		ALTER TABLE transactions_history ADD COLUMN IF NOT EXISTS external_ref TEXT NOT NULL DEFAULT '';
+		ALTER TABLE transactions_history ADD COLUMN IF NOT EXISTS metadata JSONB;
+		CREATE INDEX IF NOT EXISTS transactions_history_external_ref_idx ON transactions_history (external_ref)
+			WHERE external_ref <> '';`},
+	{version: 9, statements: `
+		ALTER TABLE transactions_history ADD COLUMN IF NOT EXISTS reversal_of BIGINT;
+		CREATE UNIQUE INDEX IF NOT EXISTS transactions_history_reversal_of_idx ON transactions_history (reversal_of)
+			WHERE reversal_of IS NOT NULL;
+		CREATE INDEX IF NOT EXISTS transactions_history_counterparty_idx ON transactions_history (account_id, counterparty_id);
+		UPDATE transactions_history SET
+			operation_type = CASE
+				WHEN transaction_message LIKE 'Перевод на сумму %' THEN
+					CASE WHEN delta < 0 THEN 'transfer_out' ELSE 'transfer_in' END
+				WHEN transaction_message LIKE '% списана комиссия %' OR transaction_message LIKE 'Зачислена комиссия %' THEN 'fee'
+				WHEN delta < 0 THEN 'withdrawal'
+				ELSE 'deposit'
+			END,
+			counterparty_id = CASE
+				WHEN transaction_message LIKE 'Перевод на сумму %' AND delta < 0 THEN
+					CAST(substring(transaction_message FROM 'на аккаунт ([0-9]+)') AS INTEGER)
+				WHEN transaction_message LIKE 'Перевод на сумму %' OR transaction_message LIKE 'Зачислена комиссия %' THEN
+					CAST(substring(transaction_message FROM 'с аккаунта ([0-9]+)') AS INTEGER)
+			END
+		WHERE COALESCE(operation_type, '') = '' AND hash = '';
+		ALTER TABLE transactions_history ALTER COLUMN operation_type SET NOT NULL;
+		TRUNCATE daily_turnover;
+		INSERT INTO daily_turnover (account_id, day, operation_type, credits, debits, operation_count)
+			SELECT account_id, created_at::date, operation_type,
+				COALESCE(SUM(delta) FILTER (WHERE delta > 0), 0), COALESCE(-SUM(delta) FILTER (WHERE delta < 0), 0), COUNT(*)
+			FROM transactions_history
+			GROUP BY account_id, created_at::date, operation_type;`},
+	{version: 10, statements: `
+		ALTER TABLE accounts ADD COLUMN IF NOT EXISTS parent_id INTEGER REFERENCES accounts ON DELETE RESTRICT;
+		CREATE INDEX IF NOT EXISTS accounts_parent_id_idx ON accounts (parent_id) WHERE parent_id IS NOT NULL;`},
+	{version: 11, statements: `
+		CREATE TABLE IF NOT EXISTS account_products
+		(
+			product TEXT CONSTRAINT account_products_pk PRIMARY KEY,
+			annual_rate NUMERIC NOT NULL CONSTRAINT non_negative_annual_rate CHECK (annual_rate>=0),
+			expense_account_id INTEGER NOT NULL REFERENCES accounts ON DELETE RESTRICT,
+			description TEXT NOT NULL DEFAULT ''
+		);
+		ALTER TABLE accounts ADD COLUMN IF NOT EXISTS product TEXT REFERENCES account_products ON DELETE RESTRICT;
+
+		CREATE TABLE IF NOT EXISTS interest_accruals
+		(
+			account_id INTEGER NOT NULL,
+			day DATE NOT NULL,
+			balance NUMERIC NOT NULL,
+			annual_rate NUMERIC NOT NULL,
+			amount NUMERIC NOT NULL,
+			expense_account_id INTEGER NOT NULL,
+			paid_record_id BIGINT,
+			CONSTRAINT interest_accruals_pk PRIMARY KEY (account_id, day)
+		);
+		CREATE INDEX IF NOT EXISTS interest_accruals_unpaid_idx ON interest_accruals (account_id, day) WHERE paid_record_id IS NULL;
+
+		CREATE TABLE IF NOT EXISTS interest_accrual_days
+		(
+			day DATE CONSTRAINT interest_accrual_days_pk PRIMARY KEY,
+			account_count INTEGER NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		);`},
+	{version: 12, statements: `
+		CREATE TABLE IF NOT EXISTS bonus_lots
+		(
+			id BIGSERIAL CONSTRAINT bonus_lots_pk PRIMARY KEY,
+			account_id INTEGER NOT NULL REFERENCES accounts ON DELETE RESTRICT,
+			amount NUMERIC NOT NULL CONSTRAINT positive_bonus_amount CHECK (amount>0),
+			remaining NUMERIC NOT NULL CONSTRAINT valid_bonus_remaining CHECK (remaining>=0 AND remaining<=amount),
+			purpose TEXT NOT NULL DEFAULT '',
+			external_ref TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP NOT NULL,
+			expires_at TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS bonus_lots_active_idx ON bonus_lots (account_id, id) WHERE remaining > 0;
+		CREATE INDEX IF NOT EXISTS bonus_lots_expiry_idx ON bonus_lots (expires_at) WHERE remaining > 0;
+
+		CREATE TABLE IF NOT EXISTS bonus_history
+		(
+			id BIGSERIAL CONSTRAINT bonus_history_pk PRIMARY KEY,
+			account_id INTEGER NOT NULL REFERENCES accounts ON DELETE RESTRICT,
+			lot_id BIGINT NOT NULL REFERENCES bonus_lots ON DELETE RESTRICT,
+			delta NUMERIC NOT NULL,
+			remaining_balance NUMERIC NOT NULL,
+			operation_type TEXT NOT NULL,
+			purpose TEXT NOT NULL DEFAULT '',
+			external_ref TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS bonus_history_account_idx ON bonus_history (account_id, id);`},
+	{version: 13, statements: `
+		ALTER TABLE transactions_history ADD COLUMN IF NOT EXISTS pair_id BIGINT;
+		CREATE INDEX IF NOT EXISTS transactions_history_pair_id_idx ON transactions_history (pair_id) WHERE pair_id IS NOT NULL;`},
+	{version: 14, statements: `
+		ALTER TABLE transactions_history ADD COLUMN IF NOT EXISTS operation_currency TEXT NOT NULL DEFAULT '';
+		ALTER TABLE transactions_history ADD COLUMN IF NOT EXISTS operation_rate NUMERIC;`},
+}
+
+//Migrate - реализует метод интерфейса IBalanceInfoStorage. Каждая миграция применяется в отдельной транзакции
+//вместе с записью ее версии в schema_migrations
+func (db *storage) Migrate() ([]int, *model.CustomErr) {
+	err := db.database.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations
+		(
+			version INTEGER CONSTRAINT schema_migrations_pk PRIMARY KEY,
+			applied_at TIMESTAMP NOT NULL DEFAULT now()
+		)`).Error
+	if err != nil {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.Migrate: %v", err),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	current, custErr := db.GetSchemaVersion()
+	if custErr != nil {
+		return nil, custErr
+	}
+	applied := []int{}
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		transaction := db.database.Begin()
+		err = transaction.Exec(m.statements).Error
+		if err == nil {
+			err = transaction.Exec("INSERT INTO schema_migrations (version) VALUES (?)", m.version).Error
+		}
+		if err == nil {
+			err = transaction.Commit().Error
+		} else {
+			transaction.Rollback()
+		}
+		if err != nil {
+			return applied, &model.CustomErr{
+				Err:     fmt.Errorf("storage.Migrate: версия %d: %v", m.version, err),
+				ErrCode: model.DefaultErrCode,
+			}
+		}
+		applied = append(applied, m.version)
+	}
+	return applied, nil
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+//TestMigrationsOrder - миграции следуют по возрастанию версий без пропусков до версии, с которой работает сервис
+func TestMigrationsOrder(t *testing.T) {
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.version)
+	}
+	assert.Equal(t, model.SchemaVersion, migrations[len(migrations)-1].version)
+}
+
+var (
+	createTablePattern   = regexp.MustCompile(`(?s)CREATE TABLE (?:IF NOT EXISTS )?(\w+)\s*\((.*?)\n\s*\);`)
+	alterTablePattern    = regexp.MustCompile(`ALTER TABLE (\w+)([^;]*);`)
+	addColumnPattern     = regexp.MustCompile(`ADD COLUMN (?:IF NOT EXISTS )?(\w+)`)
+	schemaVersionPattern = regexp.MustCompile(`INSERT INTO schema_migrations \(version\) VALUES \((\d+)\);`)
+	schemaChangePattern  = regexp.MustCompile(`(CREATE (?:UNIQUE )?(?:TABLE|INDEX)|ADD COLUMN) (\S+ \S+ \S+)`)
+)
+
+//schemaColumns (internal) - колонки таблиц, создаваемых и дополняемых скриптом sql, в виде "таблица.колонка"
+func schemaColumns(sql string) []string {
+	columns := []string{}
+	for _, table := range createTablePattern.FindAllStringSubmatch(sql, -1) {
+		for _, line := range strings.Split(table[2], "\n") {
+			fields := strings.Fields(line)
+			if len(fields) == 0 || fields[0] == "CONSTRAINT" || strings.HasPrefix(fields[0], "--") {
+				continue
+			}
+			columns = append(columns, table[1]+"."+fields[0])
+		}
+	}
+	for _, alter := range alterTablePattern.FindAllStringSubmatch(sql, -1) {
+		for _, column := range addColumnPattern.FindAllStringSubmatch(alter[2], -1) {
+			columns = append(columns, alter[1]+"."+column[1])
+		}
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+//TestMigrationsIdempotent - миграции создают таблицы, индексы и колонки только при их отсутствии, поэтому применяются
+//к базе, созданной до появления schema_migrations, в которой часть изменений уже есть
+func TestMigrationsIdempotent(t *testing.T) {
+	for _, m := range migrations {
+		for _, change := range schemaChangePattern.FindAllStringSubmatch(m.statements, -1) {
+			assert.Equal(t, "IF NOT EXISTS", change[2], "версия %d: %s", m.version, change[0])
+		}
+	}
+}
+
+//TestMigrationsMatchTablesSQL - миграции, примененные по порядку, дают схему docker_storage/tables.sql,
+//а tables.sql отмечает все версии схемы как примененные
+func TestMigrationsMatchTablesSQL(t *testing.T) {
+	tables, err := ioutil.ReadFile("../../docker_storage/tables.sql")
+	if !assert.NoError(t, err) {
+		return
+	}
+	statements := make([]string, 0, len(migrations))
+	for _, m := range migrations {
+		statements = append(statements, m.statements)
+	}
+	//таблицу schema_migrations создает сам Migrate
+	expected := []string{}
+	for _, column := range schemaColumns(string(tables)) {
+		if !strings.HasPrefix(column, "schema_migrations.") {
+			expected = append(expected, column)
+		}
+	}
+	assert.Equal(t, expected, schemaColumns(strings.Join(statements, "\n")))
+
+	versions := []int{}
+	for _, match := range schemaVersionPattern.FindAllStringSubmatch(string(tables), -1) {
+		version, _ := strconv.Atoi(match[1])
+		versions = append(versions, version)
+	}
+	for i, version := range versions {
+		assert.Equal(t, i+1, version)
+	}
+	assert.Len(t, versions, model.SchemaVersion)
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/model"
+)
+
+//TakeRateLimitToken - реализует метод интерфейса IBalanceInfoStorage.
+//Корзина блокируется на время списания, поэтому экземпляры сервиса разделяют общий лимит. Создание и блокировка
+//корзины выполняются одним запросом, поэтому корзина, удаленная DeleteRateLimitBuckets между ними, создается заново
+func (db *storage) TakeRateLimitToken(key string, rate float64, burst int, now time.Time) (time.Duration, *model.CustomErr) {
+	transaction := db.database.Begin()
+	bucket := &model.RateLimitBucket{}
+	query := transaction.Raw(`INSERT INTO rate_limit_buckets (key, tokens, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET key = EXCLUDED.key
+		RETURNING *`, key, float64(burst), now).Scan(bucket)
+	var retryAfter time.Duration
+	if query.Error == nil {
+		retryAfter = bucket.Take(rate, burst, now)
+		query = transaction.Save(bucket)
+	}
+	if query.Error != nil {
+		transaction.Rollback()
+		return 0, &model.CustomErr{
+			Err:     fmt.Errorf("storage.TakeRateLimitToken: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	transaction.Commit()
+	return retryAfter, nil
+}
+
+//DeleteRateLimitBuckets - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) DeleteRateLimitBuckets(updatedBefore time.Time) (int64, *model.CustomErr) {
+	query := db.database.Where("updated_at < ?", updatedBefore).Delete(&model.RateLimitBucket{})
+	if query.Error != nil {
+		return 0, &model.CustomErr{
+			Err:     fmt.Errorf("storage.DeleteRateLimitBuckets: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	return query.RowsAffected, nil
+}
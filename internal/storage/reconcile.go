@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	"github.com/jinzhu/gorm"
+)
+
+//reconcileTolerance - допустимая погрешность сравнения сумм
+const reconcileTolerance = 0.005
+
+//reconcileLimit - максимальное количество расхождений каждого вида в одном отчете
+const reconcileLimit = 1000
+
+//balanceMismatchQuery - аккаунты, баланс которых не равен сумме изменений в истории операций
+const balanceMismatchQuery = `SELECT a.account_id, COALESCE(h.total, 0) AS expected, a.balance AS actual
+	FROM accounts a
+	LEFT JOIN (SELECT account_id, SUM(delta) AS total FROM transactions_history GROUP BY account_id) h
+		ON h.account_id = a.account_id
+	WHERE ABS(a.balance - COALESCE(h.total, 0)) > ?
+	ORDER BY a.account_id LIMIT ?`
+
+//chainMismatchQuery - записи истории, остаток которых не равен остатку предыдущей записи аккаунта плюс изменение
+const chainMismatchQuery = `SELECT account_id, COALESCE(previous, 0) + delta AS expected, remaining_balance AS actual, created_at AS record_created_at
+	FROM (
+		SELECT id, account_id, delta, remaining_balance, created_at,
+			LAG(remaining_balance) OVER (PARTITION BY account_id ORDER BY id) AS previous
+		FROM transactions_history
+	) h
+	WHERE ABS(COALESCE(previous, 0) + delta - remaining_balance) > ?
+	ORDER BY account_id, id LIMIT ?`
+
+//lastRecordMismatchQuery - аккаунты, баланс которых не равен остатку последней записи истории
+const lastRecordMismatchQuery = `SELECT a.account_id, h.remaining_balance AS expected, a.balance AS actual, h.created_at AS record_created_at
+	FROM accounts a
+	JOIN LATERAL (
+		SELECT remaining_balance, created_at FROM transactions_history
+		WHERE account_id = a.account_id
+		ORDER BY id DESC LIMIT 1
+	) h ON TRUE
+	WHERE ABS(a.balance - h.remaining_balance) > ?
+	ORDER BY a.account_id LIMIT ?`
+
+//FindLedgerDiscrepancies - реализует метод интерфейса IBalanceInfoStorage.
+//Все проверки выполняются в одной транзакции только для чтения с уровнем изоляции REPEATABLE READ,
+//поэтому операции, выполняемые во время сверки, не приводят к ложным расхождениям
+func (db *storage) FindLedgerDiscrepancies() (int, []model.LedgerDiscrepancy, *model.CustomErr) {
+	transaction := db.database.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if transaction.Error != nil {
+		return 0, nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.FindLedgerDiscrepancies: %v", transaction.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	defer transaction.Rollback()
+
+	count := struct {
+		Total int
+	}{}
+	err := transaction.Raw("SELECT COUNT(*) AS total FROM accounts").Scan(&count).Error
+	if err != nil {
+		return 0, nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.FindLedgerDiscrepancies: %v", err),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+
+	discrepancies := []model.LedgerDiscrepancy{}
+	checks := []struct {
+		kind  string
+		query string
+	}{
+		{kind: model.DiscrepancyBalance, query: balanceMismatchQuery},
+		{kind: model.DiscrepancyChain, query: chainMismatchQuery},
+		{kind: model.DiscrepancyLastRecord, query: lastRecordMismatchQuery},
+	}
+	for _, check := range checks {
+		found, custErr := findDiscrepancies(transaction, check.kind, check.query)
+		if custErr != nil {
+			return 0, nil, custErr
+		}
+		discrepancies = append(discrepancies, found...)
+	}
+	return count.Total, discrepancies, nil
+}
+
+//findDiscrepancies (internal) - выполнение запроса проверки query, возвращающего расхождения вида kind
+func findDiscrepancies(transaction *gorm.DB, kind string, query string) ([]model.LedgerDiscrepancy, *model.CustomErr) {
+	rows := []model.LedgerDiscrepancy{}
+	err := transaction.Raw(query, reconcileTolerance, reconcileLimit).Scan(&rows).Error
+	if err != nil {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.FindLedgerDiscrepancies: %s: %v", kind, err),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	for i := range rows {
+		rows[i].Kind = kind
+	}
+	return rows, nil
+}
+
+//SaveReconciliationRun - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) SaveReconciliationRun(run *model.ReconciliationRun) *model.CustomErr {
+	report, err := json.Marshal(run.Discrepancies)
+	if err == nil {
+		run.Report = string(report)
+		err = db.database.Create(run).Error
+	}
+	if err != nil {
+		return &model.CustomErr{
+			Err:     fmt.Errorf("storage.SaveReconciliationRun: %v", err),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	return nil
+}
+
+//GetLastReconciliationRun - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) GetLastReconciliationRun() (*model.ReconciliationRun, *model.CustomErr) {
+	run := &model.ReconciliationRun{}
+	query := db.database.Order("id DESC").First(run)
+	if query.Error != nil {
+		err := &model.CustomErr{
+			Err:     fmt.Errorf("storage.GetLastReconciliationRun: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+		if query.Error == gorm.ErrRecordNotFound {
+			err.ErrCode = model.NotFoundCode
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(run.Report), &run.Discrepancies); err != nil {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.GetLastReconciliationRun: %v", err),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	return run, nil
+}
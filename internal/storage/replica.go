@@ -0,0 +1,252 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	"github.com/jinzhu/gorm"
+)
+
+//replicaCheckInterval - период измерения отставания реплик
+const replicaCheckInterval = time.Second
+
+//defaultReplicaMaxLag - допустимое отставание реплики по умолчанию
+const defaultReplicaMaxLag = 5 * time.Second
+
+//replicaLagQuery - отставание реплики в секундах. Реплика, воспроизведшая все полученные изменения, не отстает
+const replicaLagQuery = `SELECT CASE
+	WHEN NOT pg_is_in_recovery() OR pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 1e9)
+	END AS lag`
+
+//replica (internal) - реплика базы данных для чтения и результат последнего измерения ее отставания
+type replica struct {
+	name     string
+	database *gorm.DB
+
+	mutex      sync.RWMutex
+	healthy    bool
+	lag        time.Duration
+	measuredAt time.Time
+	lastError  string
+}
+
+//replicaSet (internal) - реплики для чтения и время последнего изменения аккаунтов, выполненного этим экземпляром
+//сервиса. Чтение аккаунта направляется на реплику, только если она успела получить его последнее изменение
+type replicaSet struct {
+	replicas     []*replica
+	maxLag       time.Duration
+	balanceReads bool
+	next         uint32
+
+	writesMutex sync.Mutex
+	writes      map[int]time.Time
+	//lastWrite - время последнего изменения любого аккаунта, для чтения данных нескольких аккаунтов
+	lastWrite time.Time
+}
+
+//newReplicaSet (internal) - подключение к репликам с настройками пула options
+func newReplicaSet(options model.StorageOptions) (*replicaSet, error) {
+	set := &replicaSet{
+		maxLag:       options.ReplicaMaxLag,
+		balanceReads: options.ReplicaBalanceReads,
+		writes:       make(map[int]time.Time),
+	}
+	if set.maxLag <= 0 {
+		set.maxLag = defaultReplicaMaxLag
+	}
+	for i, address := range options.ReplicaConns {
+		database, err := openDatabase(address, options)
+		if err != nil {
+			set.close()
+			return nil, fmt.Errorf("storage.newReplicaSet: реплика %d: %v", i+1, err)
+		}
+		r := &replica{name: fmt.Sprintf("replica-%d", i+1), database: database}
+		set.replicas = append(set.replicas, r)
+		set.measure(r)
+	}
+	return set, nil
+}
+
+func (s *replicaSet) close() {
+	for _, r := range s.replicas {
+		r.database.Close()
+	}
+}
+
+//start (internal) - периодическое измерение отставания реплик
+func (s *replicaSet) start() {
+	if s == nil || len(s.replicas) == 0 {
+		return
+	}
+	go func() {
+		for {
+			time.Sleep(replicaCheckInterval)
+			for _, r := range s.replicas {
+				s.measure(r)
+			}
+		}
+	}()
+}
+
+//measure (internal) - измерение отставания реплики r
+func (s *replicaSet) measure(r *replica) {
+	result := struct {
+		Lag float64
+	}{}
+	now := time.Now()
+	err := r.database.Raw(replicaLagQuery).Scan(&result).Error
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.measuredAt = now
+	if err != nil {
+		if r.healthy || r.lastError == "" {
+			log.Printf("storage.replicaSet: %s недоступна: %v", r.name, err)
+		}
+		r.healthy, r.lastError = false, err.Error()
+		return
+	}
+	r.healthy, r.lastError = true, ""
+	r.lag = time.Duration(result.Lag * float64(time.Second))
+}
+
+//fail (internal) - реплика r считается недоступной до следующего измерения
+func (r *replica) fail(err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.healthy, r.lastError = false, err.Error()
+}
+
+//usable (internal) - можно ли читать с реплики в момент now изменения, выполненные до момента since
+func (r *replica) usable(now, since time.Time, maxLag time.Duration) bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if !r.healthy || r.lag > maxLag || now.Sub(r.measuredAt) > 3*replicaCheckInterval {
+		return false
+	}
+	//к моменту измерения реплика получила все изменения, выполненные до measuredAt - lag
+	return since.Before(r.measuredAt.Add(-r.lag))
+}
+
+//noteWrites (internal) - запоминает время изменения аккаунтов записей истории records
+func (s *replicaSet) noteWrites(records []model.TransactionRecord, at time.Time) {
+	if s == nil || len(s.replicas) == 0 {
+		return
+	}
+	s.writesMutex.Lock()
+	defer s.writesMutex.Unlock()
+	for _, record := range records {
+		s.writes[record.AccountId] = at
+	}
+	if at.After(s.lastWrite) {
+		s.lastWrite = at
+	}
+	if len(s.writes) > 10000 {
+		//изменения старше допустимого отставания уже не влияют на выбор реплики
+		expired := at.Add(-s.maxLag - 3*replicaCheckInterval)
+		for accountId, writtenAt := range s.writes {
+			if writtenAt.Before(expired) {
+				delete(s.writes, accountId)
+			}
+		}
+	}
+}
+
+//noteBonusWrites (internal) - запоминает время изменения аккаунтов записей истории бонусов records
+func (s *replicaSet) noteBonusWrites(records []model.BonusRecord, at time.Time) {
+	accounts := make([]model.TransactionRecord, 0, len(records))
+	for _, record := range records {
+		accounts = append(accounts, model.TransactionRecord{AccountId: record.AccountId})
+	}
+	s.noteWrites(accounts, at)
+}
+
+//pick (internal) - реплика для чтения данных аккаунта accountId или nil, если читать нужно с основного сервера.
+//Данные без аккаунта (accountId = 0) читаются с реплики, получившей последнее изменение любого аккаунта
+func (s *replicaSet) pick(accountId int) *replica {
+	if s == nil || len(s.replicas) == 0 {
+		return nil
+	}
+	s.writesMutex.Lock()
+	since := s.writes[accountId]
+	if accountId == 0 {
+		since = s.lastWrite
+	}
+	s.writesMutex.Unlock()
+	now := time.Now()
+	start := atomic.AddUint32(&s.next, 1)
+	for i := range s.replicas {
+		r := s.replicas[(int(start)+i)%len(s.replicas)]
+		if r.usable(now, since, s.maxLag) {
+			return r
+		}
+	}
+	return nil
+}
+
+//health (internal) - состояние реплик
+func (s *replicaSet) health() []model.ReplicaHealth {
+	if s == nil {
+		return nil
+	}
+	now := time.Now()
+	result := make([]model.ReplicaHealth, 0, len(s.replicas))
+	for _, r := range s.replicas {
+		usable := r.usable(now, time.Time{}, s.maxLag)
+		r.mutex.RLock()
+		result = append(result, model.ReplicaHealth{
+			Name:      r.name,
+			Healthy:   r.healthy,
+			Usable:    usable,
+			Lag:       r.lag,
+			LastError: r.lastError,
+		})
+		r.mutex.RUnlock()
+	}
+	return result
+}
+
+//read (internal) - чтение данных аккаунта accountId функцией fn с реплики (если useReplica и есть подходящая реплика)
+//или с основного сервера. При ошибке чтения с реплики чтение повторяется на основном сервере
+func (db *storage) read(accountId int, useReplica bool, fn func(database *gorm.DB) *model.CustomErr) {
+	if useReplica {
+		if r := db.replicas.pick(accountId); r != nil {
+			err := fn(r.database)
+			if err == nil || err.ErrCode != model.DefaultErrCode {
+				return
+			}
+			log.Printf("storage.read: %s: %v", r.name, err.Err)
+			r.fail(err.Err)
+		}
+	}
+	fn(db.database)
+}
+
+//primaryStorage (internal) - хранилище, все чтения которого выполняются на основном сервере
+type primaryStorage struct {
+	*storage
+}
+
+//Primary - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) Primary() model.IBalanceInfoStorage {
+	return &primaryStorage{storage: db}
+}
+
+//Primary - реализует метод интерфейса IBalanceInfoStorage
+func (db *primaryStorage) Primary() model.IBalanceInfoStorage {
+	return db
+}
+
+//GetAccountBalance - реализует метод интерфейса IBalanceInfoStorage
+func (db *primaryStorage) GetAccountBalance(id int) (*model.BalanceInfo, *model.CustomErr) {
+	return getAccountBalance(db.database, id)
+}
+
+//GetSortedTransactionsHistory - реализует метод интерфейса IBalanceInfoStorage
+func (db *primaryStorage) GetSortedTransactionsHistory(id int, sortedBy string, sortedByDesc bool, filter model.HistoryFilter) ([]model.TransactionRecord, *model.CustomErr) {
+	return getSortedTransactionsHistory(db.database, id, sortedBy, sortedByDesc, filter)
+}
@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	"github.com/jinzhu/gorm"
+)
+
+//reversalConstraint - уникальный индекс, по которому операция не может быть отменена дважды
+const reversalConstraint = "transactions_history_reversal_of_idx"
+
+//ReverseOperation - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) ReverseOperation(recordId int64, details model.OperationDetails) (result *model.OperationResult, err *model.CustomErr) {
+	//начало транзакции
+	transaction := db.database.Begin()
+	records, err := reverseOperation(transaction, recordId, details)
+	if err != nil {
+		transaction.Rollback()
+		return nil, err
+	}
+	//сохранение события для подписчиков
+	err = writeOutboxEvent(transaction, model.BalanceReversedEvent, records)
+	if err != nil {
+		transaction.Rollback()
+		return nil, err
+	}
+	transaction.Commit()
+	db.replicas.noteWrites(records, time.Now())
+	return &model.OperationResult{Record: records[0]}, nil
+}
+
+//reverseOperation (internal) - отмена операции записи recordId в рамках транзакции. Возвращает созданные записи отмены,
+//первая из них - запись аккаунта отменяемой записи
+func reverseOperation(transaction *gorm.DB, recordId int64, details model.OperationDetails) ([]model.TransactionRecord, *model.CustomErr) {
+	original := model.TransactionRecord{}
+	query := transaction.First(&original, recordId)
+	if query.Error == gorm.ErrRecordNotFound {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.ReverseOperation: запись истории %d не найдена", recordId),
+			ErrCode: model.HistoryNotFoundCode,
+		}
+	}
+	if query.Error != nil {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.ReverseOperation: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+
+	//записи операции: для перевода и комиссии - записи обоих аккаунтов
+	originals := []model.TransactionRecord{original}
+	switch original.OperationType {
+	case model.OperationDeposit, model.OperationWithdrawal:
+	case model.OperationTransferIn, model.OperationTransferOut, model.OperationFee:
+		if original.CounterpartyId != nil {
+			pair, err := findPairRecord(transaction, &original)
+			if err != nil {
+				return nil, err
+			}
+			originals = append(originals, *pair)
+		}
+	default:
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.ReverseOperation: операция с типом %q не может быть отменена", original.OperationType),
+			ErrCode: model.WrongInputParamsCode,
+		}
+	}
+	ids := make([]int64, len(originals))
+	for i := range originals {
+		ids[i] = originals[i].Id
+	}
+	var reversed int
+	if err := transaction.Model(&model.TransactionRecord{}).Where("reversal_of IN (?)", ids).Count(&reversed).Error; err != nil {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.ReverseOperation: %v", err),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	if reversed > 0 {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.ReverseOperation: операция записи %d уже отменена", recordId),
+			ErrCode: model.AlreadyReversedCode,
+		}
+	}
+
+	//возврат сумм операции
+	for i := range originals {
+		if err := updateOrCreateBalanceInfo(transaction, originals[i].AccountId, -originals[i].Delta); err != nil {
+			return nil, err
+		}
+	}
+	records := make([]model.TransactionRecord, len(originals))
+	for i := range originals {
+		acc := &model.BalanceInfo{}
+		if err := transaction.First(acc, originals[i].AccountId).Error; err != nil {
+			return nil, &model.CustomErr{
+				Err:     fmt.Errorf("storage.ReverseOperation: %v", err),
+				ErrCode: model.DefaultErrCode,
+			}
+		}
+		if err := checkNotFrozen(transaction, acc); err != nil {
+			return nil, err
+		}
+		records[i] = model.TransactionRecord{
+			AccountId:         originals[i].AccountId,
+			Delta:             -originals[i].Delta,
+			RemainingBalance:  acc.Balance,
+			OperationType:     model.OperationReversal,
+			CounterpartyId:    originals[i].CounterpartyId,
+			ReversalOf:        &originals[i].Id,
+			OperationCurrency: originals[i].OperationCurrency,
+			OperationRate:     originals[i].OperationRate,
+			CreatedAt:         time.Now(),
+		}
+		details.Apply(&records[i])
+	}
+	for i := range records {
+		if i > 0 {
+			records[i].PairId = &records[0].Id
+		}
+		if err := appendHistoryRecord(transaction, &records[i]); err != nil {
+			if strings.Contains(err.Err.Error(), reversalConstraint) {
+				err.ErrCode = model.AlreadyReversedCode
+			}
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+//findPairRecord (internal) - запись второго аккаунта перевода или комиссии record по связи PairId между записями
+//операции. Записи, сохраненные до появления связи, не отменяются: их вторую запись нельзя определить однозначно
+func findPairRecord(transaction *gorm.DB, record *model.TransactionRecord) (*model.TransactionRecord, *model.CustomErr) {
+	pair := &model.TransactionRecord{}
+	var query *gorm.DB
+	if record.PairId != nil {
+		query = transaction.First(pair, *record.PairId)
+	} else {
+		query = transaction.Where("pair_id = ?", record.Id).First(pair)
+	}
+	if query.Error == gorm.ErrRecordNotFound {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.findPairRecord: запись %d не связана со второй записью операции", record.Id),
+			ErrCode: model.WrongInputParamsCode,
+		}
+	}
+	if query.Error != nil {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.findPairRecord: запись аккаунта %d для записи %d: %v", *record.CounterpartyId, record.Id, query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	return pair, nil
+}
@@ -0,0 +1,215 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/i18n"
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	"github.com/jinzhu/gorm"
+)
+
+//CreateScheduledTransfer - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) CreateScheduledTransfer(schedule *model.ScheduledTransfer) (*model.ScheduledTransfer, *model.CustomErr) {
+	created := *schedule
+	created.Id = 0
+	created.CreatedAt = time.Now()
+	query := db.database.Create(&created)
+	if query.Error != nil {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.CreateScheduledTransfer: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	return &created, nil
+}
+
+//GetScheduledTransfer - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) GetScheduledTransfer(id int) (*model.ScheduledTransfer, *model.CustomErr) {
+	schedule := &model.ScheduledTransfer{}
+	query := db.database.First(schedule, id)
+	if query.Error != nil {
+		err := &model.CustomErr{
+			Err:     fmt.Errorf("storage.GetScheduledTransfer: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+		if query.Error == gorm.ErrRecordNotFound {
+			err.ErrCode = model.ScheduleNotFoundCode
+		}
+		return nil, err
+	}
+	return schedule, nil
+}
+
+//GetAccountScheduledTransfers - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) GetAccountScheduledTransfers(accountId int) (schedules []model.ScheduledTransfer, err *model.CustomErr) {
+	query := db.database.Where("from_id = ? OR to_id = ?", accountId, accountId).Order("id").Find(&schedules)
+	if query.Error != nil {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.GetAccountScheduledTransfers: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	return schedules, nil
+}
+
+//UpdateScheduledTransfer - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) UpdateScheduledTransfer(schedule *model.ScheduledTransfer) *model.CustomErr {
+	//обновляются только параметры, которые задает пользователь: ошибку выполнения и блокировку ведет планировщик
+	query := db.database.Model(&model.ScheduledTransfer{}).Where("id = ?", schedule.Id).UpdateColumns(map[string]interface{}{
+		"from_id":            schedule.FromId,
+		"to_id":              schedule.ToId,
+		"delta":              schedule.Delta,
+		"recurrence":         schedule.Recurrence,
+		"next_run_at":        schedule.NextRunAt,
+		"active":             schedule.Active,
+		"max_retries":        schedule.MaxRetries,
+		"retry_interval_sec": schedule.RetryIntervalSec,
+		"retry_count":        schedule.RetryCount,
+	})
+	if query.Error != nil {
+		return &model.CustomErr{
+			Err:     fmt.Errorf("storage.UpdateScheduledTransfer: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	if query.RowsAffected == 0 {
+		return &model.CustomErr{
+			Err:     fmt.Errorf("storage.UpdateScheduledTransfer: запланированный перевод %d не найден", schedule.Id),
+			ErrCode: model.ScheduleNotFoundCode,
+		}
+	}
+	return nil
+}
+
+//DeleteScheduledTransfer - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) DeleteScheduledTransfer(id int) *model.CustomErr {
+	query := db.database.Delete(&model.ScheduledTransfer{Id: id})
+	if query.Error != nil {
+		return &model.CustomErr{
+			Err:     fmt.Errorf("storage.DeleteScheduledTransfer: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	if query.RowsAffected == 0 {
+		return &model.CustomErr{
+			Err:     fmt.Errorf("storage.DeleteScheduledTransfer: запланированный перевод %d не найден", id),
+			ErrCode: model.ScheduleNotFoundCode,
+		}
+	}
+	return nil
+}
+
+//ClaimDueScheduledTransfers - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) ClaimDueScheduledTransfers(now time.Time, lease time.Duration, limit int) (schedules []model.ScheduledTransfer, err *model.CustomErr) {
+	query := db.database.Raw(`UPDATE scheduled_transfers SET locked_until = ?
+		WHERE id IN (
+			SELECT id FROM scheduled_transfers
+			WHERE active AND next_run_at <= ? AND (locked_until IS NULL OR locked_until < ?)
+			ORDER BY next_run_at LIMIT ?
+			FOR UPDATE SKIP LOCKED)
+		RETURNING *`, now.Add(lease), now, now, limit).Scan(&schedules)
+	if query.Error != nil && query.Error != gorm.ErrRecordNotFound {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.ClaimDueScheduledTransfers: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	return schedules, nil
+}
+
+//ExecuteScheduledTransfer - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) ExecuteScheduledTransfer(claimed, next *model.ScheduledTransfer, run *model.ScheduledTransferRun) (*model.OperationResult, *model.CustomErr) {
+	//начало транзакции
+	transaction := db.database.Begin()
+	applied, _, err := updateScheduleRunState(transaction, claimed, next)
+	if err != nil {
+		transaction.Rollback()
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.ExecuteScheduledTransfer: %v", err),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	if !applied {
+		//расписание изменили или удалили после выбора: перевод не выполняется, снимается только блокировка
+		transaction.Commit()
+		return nil, nil
+	}
+	records, result, custErr := transferSum(transaction, claimed.FromId, claimed.ToId, claimed.Delta, model.OperationDetails{})
+	if custErr != nil {
+		transaction.Rollback()
+		return nil, custErr
+	}
+	//результат сохраняется вместе с переводом, чтобы после истечения блокировки перевод не выполнился повторно
+	run.ScheduleId = claimed.Id
+	run.Success = true
+	run.Message = i18n.OperationMessage(i18n.DefaultLang, result)
+	if err = transaction.Create(run).Error; err != nil {
+		transaction.Rollback()
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.ExecuteScheduledTransfer: %v", err),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	if err = transaction.Commit().Error; err != nil {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.ExecuteScheduledTransfer: %v", err),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	db.replicas.noteWrites(records, time.Now())
+	return result, nil
+}
+
+//SaveScheduledTransferRun - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) SaveScheduledTransferRun(claimed, next *model.ScheduledTransfer, run *model.ScheduledTransferRun) *model.CustomErr {
+	transaction := db.database.Begin()
+	_, exists, err := updateScheduleRunState(transaction, claimed, next)
+	//результат выполнения удаленного расписания не сохраняется
+	if err == nil && exists {
+		run.ScheduleId = claimed.Id
+		err = transaction.Create(run).Error
+	}
+	if err != nil {
+		transaction.Rollback()
+		return &model.CustomErr{
+			Err:     fmt.Errorf("storage.SaveScheduledTransferRun: %v", err),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	transaction.Commit()
+	return nil
+}
+
+//updateScheduleRunState (internal) - перевод расписания, выбранного для выполнения в состоянии claimed, в состояние next
+//со снятием блокировки. Время следующего выполнения, активность и счетчик попыток меняются, только если их не изменили
+//параллельно (applied). exists - расписание не удалено
+func updateScheduleRunState(transaction *gorm.DB, claimed, next *model.ScheduledTransfer) (applied, exists bool, err error) {
+	query := transaction.Model(&model.ScheduledTransfer{}).
+		Where("id = ? AND next_run_at = ? AND active = ? AND retry_count = ?", claimed.Id, claimed.NextRunAt, claimed.Active, claimed.RetryCount).
+		UpdateColumns(map[string]interface{}{
+			"next_run_at":  next.NextRunAt,
+			"active":       next.Active,
+			"retry_count":  next.RetryCount,
+			"last_error":   next.LastError,
+			"locked_until": nil,
+		})
+	if query.Error != nil || query.RowsAffected > 0 {
+		return query.Error == nil, query.Error == nil, query.Error
+	}
+	query = transaction.Model(&model.ScheduledTransfer{}).Where("id = ?", claimed.Id).
+		UpdateColumns(map[string]interface{}{"last_error": next.LastError, "locked_until": nil})
+	return false, query.RowsAffected > 0, query.Error
+}
+
+//GetScheduledTransferRuns - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) GetScheduledTransferRuns(scheduleId int) (runs []model.ScheduledTransferRun, err *model.CustomErr) {
+	query := db.database.Where("schedule_id = ?", scheduleId).Order("run_at desc").Find(&runs)
+	if query.Error != nil {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.GetScheduledTransferRuns: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	return runs, nil
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	"github.com/jinzhu/gorm"
+)
+
+//balanceAtQuery - баланс аккаунта на момент времени: последний снимок, день которого завершился не позже этого момента,
+//плюс сумма изменений истории после конца дня снимка (без снимка - сумма всех изменений)
+const balanceAtQuery = `SELECT COALESCE(s.balance, 0) + COALESCE((
+		SELECT SUM(h.delta) FROM transactions_history h
+		WHERE h.account_id = ? AND h.created_at <= ? AND (s.snapshot_date IS NULL OR h.created_at >= s.snapshot_date + 1)
+	), 0) AS balance
+	FROM (SELECT 1) AS one
+	LEFT JOIN LATERAL (
+		SELECT balance, snapshot_date FROM balance_snapshots
+		WHERE account_id = ? AND snapshot_date + 1 <= ?
+		ORDER BY snapshot_date DESC LIMIT 1
+	) s ON TRUE`
+
+//GetAccountBalanceAt - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) GetAccountBalanceAt(id int, at time.Time) (result *model.BalanceInfo, err *model.CustomErr) {
+	db.read(id, true, func(database *gorm.DB) *model.CustomErr {
+		result, err = getAccountBalanceAt(database, id, at)
+		return err
+	})
+	return result, err
+}
+
+//GetAccountBalanceAt - реализует метод интерфейса IBalanceInfoStorage
+func (db *primaryStorage) GetAccountBalanceAt(id int, at time.Time) (*model.BalanceInfo, *model.CustomErr) {
+	return getAccountBalanceAt(db.database, id, at)
+}
+
+func getAccountBalanceAt(database *gorm.DB, id int, at time.Time) (*model.BalanceInfo, *model.CustomErr) {
+	result := struct {
+		Balance float64
+	}{}
+	at = dbTime(at)
+	err := database.Raw(balanceAtQuery, id, at, id, at).Scan(&result).Error
+	if err != nil {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.GetAccountBalanceAt: %v", err),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	return &model.BalanceInfo{AccountId: id, Balance: result.Balance}, nil
+}
+
+//GetLastBalanceSnapshotDate - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) GetLastBalanceSnapshotDate() (*time.Time, *model.CustomErr) {
+	result := struct {
+		Day *time.Time
+	}{}
+	err := db.database.Raw("SELECT MAX(snapshot_date) AS day FROM balance_snapshots").Scan(&result).Error
+	if err != nil {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.GetLastBalanceSnapshotDate: %v", err),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	return result.Day, nil
+}
+
+//CreateBalanceSnapshots - реализует метод интерфейса IBalanceInfoStorage.
+//Баланс на конец дня - предыдущий снимок плюс изменения истории после него до конца дня
+func (db *storage) CreateBalanceSnapshots(day time.Time) (int64, *model.CustomErr) {
+	day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	query := db.database.Exec(`INSERT INTO balance_snapshots (account_id, snapshot_date, balance, created_at)
+		SELECT a.account_id, ?, COALESCE(s.balance, 0) + COALESCE(h.total, 0), ?
+		FROM accounts a
+		LEFT JOIN LATERAL (
+			SELECT balance, snapshot_date FROM balance_snapshots
+			WHERE account_id = a.account_id AND snapshot_date < ?
+			ORDER BY snapshot_date DESC LIMIT 1
+		) s ON TRUE
+		LEFT JOIN LATERAL (
+			SELECT SUM(delta) AS total FROM transactions_history
+			WHERE account_id = a.account_id AND created_at < ?
+				AND (s.snapshot_date IS NULL OR created_at >= s.snapshot_date + 1)
+		) h ON TRUE
+		ON CONFLICT (account_id, snapshot_date) DO NOTHING`,
+		day.Format("2006-01-02"), time.Now(), day.Format("2006-01-02"), day.AddDate(0, 0, 1))
+	if query.Error != nil {
+		return 0, &model.CustomErr{
+			Err:     fmt.Errorf("storage.CreateBalanceSnapshots: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	return query.RowsAffected, nil
+}
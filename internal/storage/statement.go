@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	"github.com/jinzhu/gorm"
+)
+
+//BuildStatement - реализует метод интерфейса IBalanceInfoStorage.
+//Остаток на начало периода и операции периода читаются в одной транзакции только для чтения с уровнем изоляции
+//REPEATABLE READ, поэтому остаток на конец периода согласован с операциями
+func (db *storage) BuildStatement(accountId int, from, to time.Time) (*model.Statement, *model.CustomErr) {
+	transaction := db.database.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if transaction.Error != nil {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.BuildStatement: %v", transaction.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	defer transaction.Rollback()
+
+	query := transaction.First(&model.BalanceInfo{}, accountId)
+	if query.Error != nil {
+		err := &model.CustomErr{
+			Err:     fmt.Errorf("storage.BuildStatement: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+		if query.Error == gorm.ErrRecordNotFound {
+			err.Err = fmt.Errorf("storage.BuildStatement: аккаунт %d не найден", accountId)
+			err.ErrCode = model.NotFoundCode
+		}
+		return nil, err
+	}
+	//created_at хранится с точностью до микросекунды, поэтому остаток на начало периода - баланс на момент
+	//за микросекунду до from
+	opening, custErr := getAccountBalanceAt(transaction, accountId, from.Add(-time.Microsecond))
+	if custErr != nil {
+		return nil, custErr
+	}
+	movements := []model.TransactionRecord{}
+	query = transaction.Where("account_id = ? AND created_at >= ? AND created_at < ?", accountId, dbTime(from), dbTime(to)).
+		Order("id").Find(&movements)
+	if query.Error != nil {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.BuildStatement: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+
+	statement := &model.Statement{
+		AccountId:      accountId,
+		PeriodStart:    from,
+		PeriodEnd:      to,
+		OpeningBalance: opening.Balance,
+		ClosingBalance: opening.Balance,
+		MovementCount:  len(movements),
+		GeneratedAt:    time.Now(),
+		Movements:      movements,
+	}
+	for _, record := range movements {
+		if record.Delta > 0 {
+			statement.TotalCredits += record.Delta
+		} else {
+			statement.TotalDebits -= record.Delta
+		}
+		statement.ClosingBalance += record.Delta
+	}
+	return statement, nil
+}
+
+//SaveStatement - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) SaveStatement(statement *model.Statement) *model.CustomErr {
+	movements, err := json.Marshal(statement.Movements)
+	if err == nil {
+		statement.MovementsData = string(movements)
+		err = db.database.Exec(`INSERT INTO account_statements (account_id, period_start, period_end, opening_balance,
+				closing_balance, total_credits, total_debits, movement_count, generated_at, movements)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (account_id, period_start, period_end) DO NOTHING`,
+			statement.AccountId, statement.PeriodStart, statement.PeriodEnd, statement.OpeningBalance,
+			statement.ClosingBalance, statement.TotalCredits, statement.TotalDebits, statement.MovementCount,
+			statement.GeneratedAt, statement.MovementsData).Error
+	}
+	if err != nil {
+		return &model.CustomErr{
+			Err:     fmt.Errorf("storage.SaveStatement: %v", err),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	return nil
+}
+
+//GetStatement - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) GetStatement(accountId int, periodStart time.Time) (*model.Statement, *model.CustomErr) {
+	statement := &model.Statement{}
+	query := db.database.Where("account_id = ? AND period_start = ?", accountId, periodStart).Order("period_end DESC").First(statement)
+	if query.Error != nil {
+		err := &model.CustomErr{
+			Err:     fmt.Errorf("storage.GetStatement: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+		if query.Error == gorm.ErrRecordNotFound {
+			err.ErrCode = model.NotFoundCode
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(statement.MovementsData), &statement.Movements); err != nil {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.GetStatement: %v", err),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	return statement, nil
+}
+
+//GetAccountStatements - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) GetAccountStatements(accountId int) ([]model.Statement, *model.CustomErr) {
+	statements := []model.Statement{}
+	query := db.database.Select("id, account_id, period_start, period_end, opening_balance, closing_balance, total_credits, total_debits, movement_count, generated_at").
+		Where("account_id = ?", accountId).Order("period_start DESC").Find(&statements)
+	if query.Error != nil {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.GetAccountStatements: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	return statements, nil
+}
+
+//GetLastStatementPeriod - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) GetLastStatementPeriod() (*time.Time, *model.CustomErr) {
+	result := struct {
+		PeriodStart *time.Time
+	}{}
+	err := db.database.Raw("SELECT MAX(period_start) AS period_start FROM account_statements").Scan(&result).Error
+	if err != nil {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.GetLastStatementPeriod: %v", err),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	return result.PeriodStart, nil
+}
+
+//GetMissingStatementAccountIds - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) GetMissingStatementAccountIds(periodStart, periodEnd time.Time) ([]int, *model.CustomErr) {
+	ids := []int{}
+	query := db.database.Model(&model.BalanceInfo{}).
+		Where("EXISTS (SELECT 1 FROM transactions_history h WHERE h.account_id = accounts.account_id AND h.created_at < ?)", periodEnd).
+		Where("NOT EXISTS (SELECT 1 FROM account_statements s WHERE s.account_id = accounts.account_id AND s.period_start = ? AND s.period_end = ?)", periodStart, periodEnd).
+		Order("account_id").Pluck("account_id", &ids)
+	if query.Error != nil {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.GetMissingStatementAccountIds: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	return ids, nil
+}
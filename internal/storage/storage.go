@@ -1,43 +1,114 @@
 package storage
 
 import (
+	"database/sql"
+	"database/sql/driver"
 	"fmt"
+	"io"
 	"log"
+	"net"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/call-me-snake/user_balance_service/internal/breaker"
 	"github.com/call-me-snake/user_balance_service/internal/model"
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/postgres"
+	"github.com/lib/pq"
 )
 
-//sleepDurationInSec - время пинга функции checkConnection в секундах
-const sleepDurationInSec = 5
+//defaultPingInterval - интервал пинга функции checkConnection по умолчанию
+const defaultPingInterval = 5 * time.Second
 
 //storage ...
 type storage struct {
 	database *gorm.DB
-	address  string
+	breaker  *breaker.Breaker
+	replicas *replicaSet
+	//pingInterval - интервал пинга функции checkConnection
+	pingInterval time.Duration
+
+	healthMutex sync.RWMutex
+	health      model.StorageHealth
 }
 
-//New возвращает объект интерфейса IBalanceInfoStorage (storage)
-func New(adress string) (model.IBalanceInfoStorage, error) {
+//New возвращает объект интерфейса IBalanceInfoStorage (storage).
+//Нулевые значения параметров options оставляют настройки по умолчанию
+func New(adress string, options model.StorageOptions) (model.IBalanceInfoStorage, error) {
 	var err error
 	db := &storage{}
-	db.address = adress
-	db.database, err = gorm.Open("postgres", adress)
+	db.breaker = breaker.New(options.BreakerThreshold, options.BreakerCooldown)
+	db.pingInterval = options.PingInterval
+	if db.pingInterval <= 0 {
+		db.pingInterval = defaultPingInterval
+	}
+	db.database, err = openDatabase(adress, options)
 	if err != nil {
 		return nil, fmt.Errorf("storage.New: %v", err)
 	}
 
 	err = db.ping()
 	if err != nil {
+		db.database.Close()
 		return nil, fmt.Errorf("storage.New: %s", err.Error())
 	}
+	db.replicas, err = newReplicaSet(options)
+	if err != nil {
+		db.database.Close()
+		return nil, fmt.Errorf("storage.New: %v", err)
+	}
+	db.registerBreakerCallbacks()
+	db.setHealth(nil)
 	db.checkConnection()
+	db.replicas.start()
 
 	return db, nil
 }
 
+//openDatabase (internal) - подключение к базе данных с настройками пула options.
+//Пул соединений database/sql сам восстанавливает разорванные соединения,
+//поэтому объект соединения создается один раз и не заменяется
+func openDatabase(adress string, options model.StorageOptions) (*gorm.DB, error) {
+	database, err := gorm.Open("postgres", withStatementTimeout(adress, options.StatementTimeout))
+	if err != nil {
+		return nil, err
+	}
+	pool := database.DB()
+	if options.MaxOpenConns > 0 {
+		pool.SetMaxOpenConns(options.MaxOpenConns)
+	}
+	if options.MaxIdleConns > 0 {
+		pool.SetMaxIdleConns(options.MaxIdleConns)
+	}
+	if options.ConnMaxLifetime > 0 {
+		pool.SetConnMaxLifetime(options.ConnMaxLifetime)
+	}
+	return database, nil
+}
+
+//withStatementTimeout (internal) - добавляет в строку подключения ограничение времени выполнения запросов
+func withStatementTimeout(adress string, timeout time.Duration) string {
+	if timeout <= 0 {
+		return adress
+	}
+	ms := timeout.Nanoseconds() / int64(time.Millisecond)
+	if strings.HasPrefix(adress, "postgres://") || strings.HasPrefix(adress, "postgresql://") {
+		separator := "?"
+		if strings.Contains(adress, "?") {
+			separator = "&"
+		}
+		return fmt.Sprintf("%s%sstatement_timeout=%d", adress, separator, ms)
+	}
+	return fmt.Sprintf("%s statement_timeout=%d", adress, ms)
+}
+
+//dbTime (internal) - момент t по UTC. Колонки TIMESTAMP хранят время created_at по UTC без часового пояса,
+//и смещение параметра запроса отбрасывается, поэтому моменты от клиента приводятся к UTC
+func dbTime(t time.Time) time.Time {
+	return t.UTC()
+}
+
 //ping (internal)
 func (db *storage) ping() error {
 	//db.database.LogMode(true)
@@ -55,23 +126,111 @@ func (db *storage) ping() error {
 	return nil
 }
 
-//checkConnection (internal)
+//checkConnection (internal) - периодическая проверка соединения. Результат проверки управляет
+//автоматическим выключателем и возвращается методом Health
 func (db *storage) checkConnection() {
 	go func() {
 		for {
+			time.Sleep(db.pingInterval)
 			err := db.ping()
 			if err != nil {
-
 				log.Printf("storage.checkConnection: no connection: %s", err.Error())
-				tempDb, err := gorm.Open("postgres", db.address)
-
-				if err != nil {
-					log.Printf("storage.checkConnection: could not establish connection: %v", err)
-				} else {
-					db.database = tempDb
-				}
+				db.breaker.Failure(time.Now())
+			} else {
+				db.breaker.Success()
 			}
-			time.Sleep(sleepDurationInSec * time.Second)
+			db.setHealth(err)
 		}
 	}()
 }
+
+//registerBreakerCallbacks (internal) - результаты запросов gorm передаются автоматическому выключателю,
+//чтобы разрыв соединения обнаруживался, не дожидаясь фоновой проверки
+func (db *storage) registerBreakerCallbacks() {
+	callback := func(scope *gorm.Scope) {
+		for _, err := range scope.DB().GetErrors() {
+			if isConnectionError(err) {
+				db.breaker.Failure(time.Now())
+				return
+			}
+		}
+		if !scope.HasError() {
+			db.breaker.Success()
+		}
+	}
+	callbacks := db.database.Callback()
+	callbacks.Create().Register("storage:breaker", callback)
+	callbacks.Update().Register("storage:breaker", callback)
+	callbacks.Delete().Register("storage:breaker", callback)
+	callbacks.Query().Register("storage:breaker", callback)
+	callbacks.RowQuery().Register("storage:breaker", callback)
+}
+
+//isConnectionError (internal) - является ли ошибка ошибкой соединения с базой данных
+func isConnectionError(err error) bool {
+	switch err {
+	case nil, gorm.ErrRecordNotFound:
+		return false
+	case driver.ErrBadConn, sql.ErrConnDone, io.EOF, io.ErrUnexpectedEOF:
+		return true
+	}
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	if pqErr, ok := err.(*pq.Error); ok {
+		//класс 08 - connection exception, 57P01-57P03 - остановка сервера
+		return pqErr.Code.Class() == "08" || pqErr.Code == "57P01" || pqErr.Code == "57P02" || pqErr.Code == "57P03"
+	}
+	return strings.Contains(err.Error(), "database is closed")
+}
+
+//setHealth (internal) - сохраняет результат проверки соединения
+func (db *storage) setHealth(err error) {
+	db.healthMutex.Lock()
+	defer db.healthMutex.Unlock()
+	if err == nil && !db.health.Connected && !db.health.CheckedAt.IsZero() {
+		db.health.Reconnects++
+	}
+	db.health.Connected = err == nil
+	db.health.CheckedAt = time.Now()
+	db.health.LastError = ""
+	if err != nil {
+		db.health.LastError = err.Error()
+	}
+}
+
+//Health - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) Health() model.StorageHealth {
+	db.healthMutex.RLock()
+	health := db.health
+	db.healthMutex.RUnlock()
+	health.CircuitOpen, health.RetryAfter = db.breaker.Open(time.Now())
+	health.Replicas = db.replicas.health()
+	return health
+}
+
+//Ping - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) Ping() *model.CustomErr {
+	if err := db.ping(); err != nil {
+		return &model.CustomErr{
+			Err:     fmt.Errorf("storage.Ping: %v", err),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	return nil
+}
+
+//GetSchemaVersion - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) GetSchemaVersion() (int, *model.CustomErr) {
+	result := struct {
+		Version int
+	}{}
+	err := db.database.Raw("SELECT COALESCE(MAX(version), 0) AS version FROM schema_migrations").Scan(&result).Error
+	if err != nil {
+		return 0, &model.CustomErr{
+			Err:     fmt.Errorf("storage.GetSchemaVersion: %v", err),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	return result.Version, nil
+}
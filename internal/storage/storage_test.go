@@ -0,0 +1,245 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+//recordedQuery (internal) - запрос к базе данных recordingDriver с параметрами
+type recordedQuery struct {
+	query string
+	args  []driver.Value
+}
+
+//recordingDriver (internal) - драйвер database/sql для тестов: запоминает запросы с параметрами и возвращает
+//аккаунт на запрос к accounts, нулевой баланс на запрос баланса и пустой результат на остальные запросы
+type recordingDriver struct {
+	mutex   sync.Mutex
+	queries []recordedQuery
+}
+
+var testDriver = &recordingDriver{}
+
+func init() {
+	sql.Register("recording", testDriver)
+}
+
+func (d *recordingDriver) Open(string) (driver.Conn, error) { return &recordingConn{driver: d}, nil }
+
+//find (internal) - запросы, содержащие substring
+func (d *recordingDriver) find(substring string) []recordedQuery {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	found := []recordedQuery{}
+	for _, q := range d.queries {
+		if strings.Contains(q.query, substring) {
+			found = append(found, q)
+		}
+	}
+	return found
+}
+
+type recordingConn struct{ driver *recordingDriver }
+
+func (c *recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return &recordingStmt{conn: c, query: query}, nil
+}
+func (c *recordingConn) Close() error              { return nil }
+func (c *recordingConn) Begin() (driver.Tx, error) { return c, nil }
+func (c *recordingConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	return c, nil
+}
+func (c *recordingConn) Commit() error   { return nil }
+func (c *recordingConn) Rollback() error { return nil }
+
+type recordingStmt struct {
+	conn  *recordingConn
+	query string
+}
+
+func (s *recordingStmt) Close() error  { return nil }
+func (s *recordingStmt) NumInput() int { return -1 }
+func (s *recordingStmt) record(args []driver.Value) {
+	s.conn.driver.mutex.Lock()
+	defer s.conn.driver.mutex.Unlock()
+	s.conn.driver.queries = append(s.conn.driver.queries, recordedQuery{query: s.query, args: args})
+}
+func (s *recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.record(args)
+	return driver.RowsAffected(0), nil
+}
+func (s *recordingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.record(args)
+	switch {
+	case strings.Contains(s.query, `FROM "accounts"`):
+		return &recordingRows{columns: []string{"account_id"}, values: [][]driver.Value{{int64(1)}}}, nil
+	case strings.Contains(s.query, "AS balance"):
+		return &recordingRows{columns: []string{"balance"}, values: [][]driver.Value{{float64(0)}}}, nil
+	}
+	return &recordingRows{}, nil
+}
+
+type recordingRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *recordingRows) Columns() []string { return r.columns }
+func (r *recordingRows) Close() error      { return nil }
+func (r *recordingRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+//newRecordingStorage (internal) - хранилище, запросы которого запоминает testDriver
+func newRecordingStorage(t *testing.T) *storage {
+	database, err := gorm.Open("postgres", "recording", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testDriver.mutex.Lock()
+	testDriver.queries = nil
+	testDriver.mutex.Unlock()
+	return &storage{database: database}
+}
+
+//setLocalZone (internal) - часовой пояс сервиса на время теста
+func setLocalZone(t *testing.T, zone *time.Location) {
+	local := time.Local
+	time.Local = zone
+	t.Cleanup(func() { time.Local = local })
+}
+
+//TestDbTime - момент со смещением приводится к UTC независимо от часового пояса хоста
+func TestDbTime(t *testing.T) {
+	setLocalZone(t, time.FixedZone("UTC+5", 5*60*60))
+
+	at := time.Date(2026, 10, 19, 15, 0, 0, 0, time.FixedZone("UTC+3", 3*60*60))
+	converted := dbTime(at)
+	assert.True(t, at.Equal(converted))
+	assert.Equal(t, "2026-10-19 12:00:00 +0000", converted.Format("2006-01-02 15:04:05 -0700"))
+}
+
+//TestBuildStatementOffset - границы периода выписки со смещением передаются в запросы по UTC
+func TestBuildStatementOffset(t *testing.T) {
+	setLocalZone(t, time.FixedZone("UTC+5", 5*60*60))
+	db := newRecordingStorage(t)
+
+	moscow := time.FixedZone("UTC+3", 3*60*60)
+	from, to := time.Date(2026, 10, 1, 0, 0, 0, 0, moscow), time.Date(2026, 11, 1, 0, 0, 0, 0, moscow)
+	statement, err := db.BuildStatement(1, from, to)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, from, statement.PeriodStart)
+
+	movements := testDriver.find(`FROM "transactions_history"`)
+	if assert.Len(t, movements, 1) && assert.Len(t, movements[0].args, 3) {
+		assert.Equal(t, "2026-09-30 21:00:00", movements[0].args[1].(time.Time).Format("2006-01-02 15:04:05"))
+		assert.Equal(t, "2026-10-31 21:00:00", movements[0].args[2].(time.Time).Format("2006-01-02 15:04:05"))
+	}
+	opening := testDriver.find("AS balance")
+	if assert.Len(t, opening, 1) && assert.Len(t, opening[0].args, 4) {
+		assert.Equal(t, "2026-09-30 20:59:59.999999", opening[0].args[1].(time.Time).Format("2006-01-02 15:04:05.999999"))
+	}
+}
+
+//TestAddTurnoverUTCDay - операция учитывается в обороте за день по UTC, а не по часовому поясу хоста или записи
+func TestAddTurnoverUTCDay(t *testing.T) {
+	setLocalZone(t, time.FixedZone("UTC+5", 5*60*60))
+	db := newRecordingStorage(t)
+
+	record := &model.TransactionRecord{AccountId: 1, Delta: 10, OperationType: model.OperationDeposit,
+		CreatedAt: time.Date(2026, 10, 1, 1, 0, 0, 0, time.FixedZone("UTC+3", 3*60*60))}
+	if err := addTurnover(db.database, record); err != nil {
+		t.Fatal(err.Err)
+	}
+	turnover := testDriver.find("INSERT INTO daily_turnover")
+	if assert.Len(t, turnover, 1) && assert.Len(t, turnover[0].args, 5) {
+		assert.Equal(t, "2026-09-30", turnover[0].args[1])
+	}
+}
+
+//TestSaveWebhookDeliveryLease - результат доставки сохраняется обновлением полей при неизменной блокировке выборки,
+//без вставки удаленной доставки; доставка без блокировки не сохраняется
+func TestSaveWebhookDeliveryLease(t *testing.T) {
+	db := newRecordingStorage(t)
+	lockedUntil := time.Date(2026, 10, 19, 12, 5, 0, 0, time.UTC)
+	delivery := &model.WebhookDelivery{Id: 3, Status: model.DeliveryDelivered, Attempts: 1, LockedUntil: &lockedUntil}
+
+	err := db.SaveWebhookDelivery(delivery)
+	//testDriver не изменяет строк, как при удаленной или заново выбранной доставке
+	if assert.NotNil(t, err) {
+		assert.Equal(t, model.WebhookNotFoundCode, err.ErrCode)
+	}
+	assert.Empty(t, testDriver.find("INSERT"))
+	updates := testDriver.find(`UPDATE "webhook_deliveries"`)
+	if assert.Len(t, updates, 1) {
+		assert.Contains(t, updates[0].query, "locked_until = $")
+		assert.Contains(t, updates[0].args, driver.Value(lockedUntil))
+	}
+
+	delivery.LockedUntil = nil
+	err = db.SaveWebhookDelivery(delivery)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, model.WebhookNotFoundCode, err.ErrCode)
+	}
+	assert.Len(t, testDriver.find(`UPDATE "webhook_deliveries"`), 1)
+}
+
+//TestDeleteRateLimitBuckets - удаляются корзины, не изменявшиеся с заданного момента
+func TestDeleteRateLimitBuckets(t *testing.T) {
+	db := newRecordingStorage(t)
+	updatedBefore := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	deleted, err := db.DeleteRateLimitBuckets(updatedBefore)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), deleted)
+	deletes := testDriver.find(`DELETE FROM "rate_limit_buckets"`)
+	if assert.Len(t, deletes, 1) {
+		assert.Contains(t, deletes[0].query, "updated_at < $")
+		assert.Contains(t, deletes[0].args, driver.Value(updatedBefore))
+	}
+}
+
+//TestReplicaPickAnyAccount - данные без аккаунта читаются с реплики только после получения последнего изменения
+func TestReplicaPickAnyAccount(t *testing.T) {
+	now := time.Now()
+	r := &replica{name: "replica-1", healthy: true, measuredAt: now}
+	set := &replicaSet{replicas: []*replica{r}, maxLag: defaultReplicaMaxLag, writes: make(map[int]time.Time)}
+	assert.Equal(t, r, set.pick(0))
+
+	set.noteWrites([]model.TransactionRecord{{AccountId: 5}}, now.Add(time.Millisecond))
+	assert.Nil(t, set.pick(5))
+	assert.Nil(t, set.pick(0))
+	assert.Equal(t, r, set.pick(7))
+}
+
+//TestExpireBonusLotsBatch - просроченные партии выбираются ограниченными пачками без ожидания заблокированных
+func TestExpireBonusLotsBatch(t *testing.T) {
+	db := newRecordingStorage(t)
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	count, err := db.ExpireBonusLots(now)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), count)
+	lots := testDriver.find(`FROM "bonus_lots"`)
+	if assert.Len(t, lots, 1) {
+		assert.Contains(t, lots[0].query, "LIMIT 500")
+		assert.Contains(t, lots[0].query, "FOR UPDATE SKIP LOCKED")
+	}
+}
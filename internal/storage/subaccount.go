@@ -0,0 +1,260 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	"github.com/jinzhu/gorm"
+)
+
+//hierarchyLockKey - ключ рекомендательной блокировки, под которой изменяется иерархия аккаунтов
+const hierarchyLockKey = 4801
+
+//SetAccountParent - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) SetAccountParent(id, parentId int) *model.CustomErr {
+	if id == parentId {
+		return &model.CustomErr{
+			Err:     fmt.Errorf("storage.SetAccountParent: аккаунт %d не может быть субаккаунтом самого себя", id),
+			ErrCode: model.SameAccountsCode,
+		}
+	}
+	transaction := db.database.Begin()
+	err := setAccountParent(transaction, id, parentId)
+	if err != nil {
+		transaction.Rollback()
+		return err
+	}
+	transaction.Commit()
+	return nil
+}
+
+func setAccountParent(transaction *gorm.DB, id, parentId int) *model.CustomErr {
+	//изменения иерархии выполняются по очереди, чтобы параллельные подчинения не образовали цикл
+	if err := transaction.Exec("SELECT pg_advisory_xact_lock(?)", hierarchyLockKey).Error; err != nil {
+		return &model.CustomErr{
+			Err:     fmt.Errorf("storage.SetAccountParent: %v", err),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	if parentId == 0 {
+		query := transaction.Model(model.BalanceInfo{AccountId: id}).UpdateColumn("parent_id", gorm.Expr("NULL"))
+		if query.Error != nil {
+			return &model.CustomErr{
+				Err:     fmt.Errorf("storage.SetAccountParent: %v", query.Error),
+				ErrCode: model.DefaultErrCode,
+			}
+		}
+		if query.RowsAffected == 0 {
+			return &model.CustomErr{
+				Err:     fmt.Errorf("storage.SetAccountParent: аккаунт %d не найден", id),
+				ErrCode: model.NotFoundCode,
+			}
+		}
+		return nil
+	}
+
+	parentTree, err := getAccountTree(transaction, parentId)
+	if err != nil {
+		return err
+	}
+	if len(parentTree) == 0 {
+		return &model.CustomErr{
+			Err:     fmt.Errorf("storage.SetAccountParent: родительский аккаунт %d не найден", parentId),
+			ErrCode: model.NotFoundCode,
+		}
+	}
+	ancestors, err := getAncestors(transaction, parentId)
+	if err != nil {
+		return err
+	}
+	for _, ancestor := range ancestors {
+		if ancestor.AccountId == id {
+			return &model.CustomErr{
+				Err:     fmt.Errorf("storage.SetAccountParent: аккаунт %d является родительским для аккаунта %d", id, parentId),
+				ErrCode: model.WrongInputParamsCode,
+			}
+		}
+	}
+	tree, err := getAccountTree(transaction, id)
+	if err != nil {
+		return err
+	}
+	height := 0
+	for _, sub := range tree {
+		if sub.Depth > height {
+			height = sub.Depth
+		}
+	}
+	if depth := len(ancestors) + 1 + height; depth > model.MaxAccountDepth {
+		return &model.CustomErr{
+			Err:     fmt.Errorf("storage.SetAccountParent: глубина иерархии %d превышает %d уровней", depth, model.MaxAccountDepth),
+			ErrCode: model.WrongInputParamsCode,
+		}
+	}
+
+	query := transaction.Exec(`INSERT INTO accounts (account_id, balance, parent_id) VALUES (?, 0, ?)
+		ON CONFLICT (account_id) DO UPDATE SET parent_id = EXCLUDED.parent_id`, id, parentId)
+	if query.Error != nil {
+		return &model.CustomErr{
+			Err:     fmt.Errorf("storage.SetAccountParent: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	return nil
+}
+
+//getAncestors (internal) - родительские аккаунты аккаунта id, начиная с ближайшего
+func getAncestors(database *gorm.DB, id int) ([]model.BalanceInfo, *model.CustomErr) {
+	ancestors := []model.BalanceInfo{}
+	err := database.Raw(`WITH RECURSIVE ancestors (account_id, depth) AS (
+			SELECT parent_id, 1 FROM accounts WHERE account_id = ? AND parent_id IS NOT NULL
+			UNION ALL
+			SELECT accounts.parent_id, ancestors.depth + 1 FROM accounts JOIN ancestors USING (account_id)
+			WHERE accounts.parent_id IS NOT NULL AND ancestors.depth <= ?
+		)
+		SELECT accounts.* FROM accounts JOIN ancestors USING (account_id) ORDER BY ancestors.depth`, id, model.MaxAccountDepth).
+		Scan(&ancestors).Error
+	if err != nil {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.getAncestors: %v", err),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	return ancestors, nil
+}
+
+//getAccountTree (internal) - аккаунт id (Depth = 0) и все его субаккаунты по возрастанию уровня, прочитанные одним запросом.
+//При отсутствии аккаунта возвращается пустой список
+func getAccountTree(database *gorm.DB, id int) ([]model.SubAccountBalance, *model.CustomErr) {
+	tree := []model.SubAccountBalance{}
+	err := database.Raw(`WITH RECURSIVE tree (account_id, depth) AS (
+			SELECT account_id, 0 FROM accounts WHERE account_id = ?
+			UNION ALL
+			SELECT accounts.account_id, tree.depth + 1 FROM accounts JOIN tree ON accounts.parent_id = tree.account_id
+			WHERE tree.depth < ?
+		)
+		SELECT accounts.account_id, COALESCE(accounts.parent_id, 0) AS parent_id, tree.depth, accounts.balance, accounts.frozen
+		FROM accounts JOIN tree USING (account_id) ORDER BY tree.depth, accounts.account_id`, id, model.MaxAccountDepth).
+		Scan(&tree).Error
+	if err != nil {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.getAccountTree: %v", err),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	return tree, nil
+}
+
+//GetConsolidatedBalance - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) GetConsolidatedBalance(id int) (result *model.ConsolidatedBalance, err *model.CustomErr) {
+	db.read(id, db.replicas.balanceReads, func(database *gorm.DB) *model.CustomErr {
+		result, err = getConsolidatedBalance(database, id)
+		return err
+	})
+	return result, err
+}
+
+//GetConsolidatedBalance - реализует метод интерфейса IBalanceInfoStorage
+func (db *primaryStorage) GetConsolidatedBalance(id int) (*model.ConsolidatedBalance, *model.CustomErr) {
+	return getConsolidatedBalance(db.database, id)
+}
+
+func getConsolidatedBalance(database *gorm.DB, id int) (*model.ConsolidatedBalance, *model.CustomErr) {
+	tree, err := getAccountTree(database, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(tree) == 0 {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.GetConsolidatedBalance: аккаунт %d не найден", id),
+			ErrCode: model.NotFoundCode,
+		}
+	}
+	//балансы суммируются снизу вверх: субаккаунты упорядочены по возрастанию уровня
+	index := make(map[int]int, len(tree))
+	for i := range tree {
+		tree[i].ConsolidatedBalance = tree[i].Balance
+		index[tree[i].AccountId] = i
+	}
+	for i := len(tree) - 1; i > 0; i-- {
+		tree[index[tree[i].ParentId]].ConsolidatedBalance += tree[i].ConsolidatedBalance
+	}
+	result := &model.ConsolidatedBalance{
+		AccountId:           id,
+		Balance:             tree[0].Balance,
+		ConsolidatedBalance: tree[0].ConsolidatedBalance,
+		SubAccounts:         tree[1:],
+	}
+	if tree[0].ParentId != 0 {
+		result.ParentId = &tree[0].ParentId
+	}
+	return result, nil
+}
+
+//FundSubAccount - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) FundSubAccount(parentId, childId int, amount float64, details model.OperationDetails) (*model.OperationResult, *model.CustomErr) {
+	return db.moveSubAccountFunds(parentId, childId, amount, details, true)
+}
+
+//SweepSubAccount - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) SweepSubAccount(parentId, childId int, amount float64, details model.OperationDetails) (*model.OperationResult, *model.CustomErr) {
+	return db.moveSubAccountFunds(parentId, childId, amount, details, false)
+}
+
+//moveSubAccountFunds (internal) - перевод между родительским аккаунтом и его субаккаунтом: с родителя на субаккаунт
+//при fund, иначе - с субаккаунта на родителя. Возвращается запись истории аккаунта, с которого переведены средства
+func (db *storage) moveSubAccountFunds(parentId, childId int, amount float64, details model.OperationDetails, fund bool) (*model.OperationResult, *model.CustomErr) {
+	if amount < 0 || (fund && amount == 0) {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.moveSubAccountFunds: некорректная сумма %v", amount),
+			ErrCode: model.WrongInputParamsCode,
+		}
+	}
+	//начало транзакции
+	transaction := db.database.Begin()
+	child := &model.BalanceInfo{}
+	query := transaction.Set("gorm:query_option", "FOR UPDATE").First(child, childId)
+	if query.Error != nil && query.Error != gorm.ErrRecordNotFound {
+		transaction.Rollback()
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.moveSubAccountFunds: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	if query.Error == gorm.ErrRecordNotFound || child.ParentId == nil || *child.ParentId != parentId {
+		transaction.Rollback()
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.moveSubAccountFunds: аккаунт %d не является субаккаунтом аккаунта %d", childId, parentId),
+			ErrCode: model.NotSubAccountCode,
+		}
+	}
+	fromId, toId := parentId, childId
+	if !fund {
+		fromId, toId = childId, parentId
+		if amount == 0 {
+			amount = child.Balance
+		}
+	}
+	if amount == 0 {
+		transaction.Rollback()
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.moveSubAccountFunds: на субаккаунте %d нет средств", childId),
+			ErrCode: model.ZeroAmountCode,
+		}
+	}
+	records, err := transferBetweenAccounts(transaction, fromId, toId, amount, details)
+	if err != nil {
+		transaction.Rollback()
+		return nil, err
+	}
+	//сохранение события для подписчиков
+	err = writeOutboxEvent(transaction, model.BalanceTransferredEvent, records)
+	if err != nil {
+		transaction.Rollback()
+		return nil, err
+	}
+	transaction.Commit()
+	db.replicas.noteWrites(records, time.Now())
+	return &model.OperationResult{Record: records[0]}, nil
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	"github.com/jinzhu/gorm"
+)
+
+//addTurnover (internal) - учет записи истории в обороте аккаунта за день ее создания (по UTC) в рамках той же транзакции
+func addTurnover(transaction *gorm.DB, record *model.TransactionRecord) *model.CustomErr {
+	var credit, debit float64
+	if record.Delta > 0 {
+		credit = record.Delta
+	} else {
+		debit = -record.Delta
+	}
+	err := transaction.Exec(`INSERT INTO daily_turnover (account_id, day, operation_type, credits, debits, operation_count)
+		VALUES (?, ?, ?, ?, ?, 1)
+		ON CONFLICT (account_id, day, operation_type) DO UPDATE SET credits = daily_turnover.credits + EXCLUDED.credits,
+			debits = daily_turnover.debits + EXCLUDED.debits, operation_count = daily_turnover.operation_count + 1`,
+		record.AccountId, record.CreatedAt.UTC().Format("2006-01-02"), record.OperationType, credit, debit).Error
+	if err != nil {
+		return &model.CustomErr{
+			Err:     fmt.Errorf("storage.addTurnover: %v", err),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	return nil
+}
+
+//GetTurnover - реализует метод интерфейса IBalanceInfoStorage.
+//Обороты суммируются по таблице daily_turnover, а не по истории операций, поэтому запрос не зависит от количества операций
+func (db *storage) GetTurnover(filter model.TurnoverFilter) (result []model.Turnover, err *model.CustomErr) {
+	db.read(filter.AccountId, true, func(database *gorm.DB) *model.CustomErr {
+		result, err = getTurnover(database, filter)
+		return err
+	})
+	return result, err
+}
+
+//GetTurnover - реализует метод интерфейса IBalanceInfoStorage
+func (db *primaryStorage) GetTurnover(filter model.TurnoverFilter) ([]model.Turnover, *model.CustomErr) {
+	return getTurnover(db.database, filter)
+}
+
+func getTurnover(database *gorm.DB, filter model.TurnoverFilter) ([]model.Turnover, *model.CustomErr) {
+	switch filter.Period {
+	case model.TurnoverDay, model.TurnoverWeek, model.TurnoverMonth:
+	default:
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.GetTurnover: некорректный период %q", filter.Period),
+			ErrCode: model.WrongInputParamsCode,
+		}
+	}
+	columns := "date_trunc('" + filter.Period + "', day) AS period_start"
+	if filter.ByOperationType {
+		columns += ", operation_type"
+	}
+	query := database.Table("daily_turnover").
+		Select(columns+", SUM(credits) AS credits, SUM(debits) AS debits, SUM(operation_count) AS operation_count, SUM(credits) - SUM(debits) AS net_change").
+		Where("day >= ? AND day < ?", filter.From.Format("2006-01-02"), filter.To.Format("2006-01-02"))
+	if filter.AccountId != 0 {
+		query = query.Where("account_id = ?", filter.AccountId)
+	}
+	group := "period_start"
+	if filter.ByOperationType {
+		group += ", operation_type"
+	}
+	turnover := []model.Turnover{}
+	if err := query.Group(group).Order(group).Scan(&turnover).Error; err != nil {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.GetTurnover: %v", err),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	return turnover, nil
+}
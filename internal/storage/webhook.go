@@ -0,0 +1,206 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/i18n"
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	"github.com/jinzhu/gorm"
+)
+
+//writeOutboxEvent (internal) - сохраняет событие об изменении баланса и ставит его в очередь доставки
+//всем активным подпискам. Вызывается в транзакции, в которой сохраняются записи истории records.
+//Описания операций в событии формируются на языке по умолчанию
+func writeOutboxEvent(transaction *gorm.DB, eventType string, records []model.TransactionRecord) *model.CustomErr {
+	localized := append([]model.TransactionRecord{}, records...)
+	i18n.LocalizeHistory(i18n.DefaultLang, localized)
+	payload, _ := json.Marshal(model.BalanceEventPayload{EventType: eventType, Records: localized})
+	event := &model.OutboxEvent{
+		EventType: eventType,
+		Payload:   string(payload),
+		CreatedAt: time.Now(),
+	}
+	query := transaction.Create(event)
+	if query.Error == nil {
+		query = transaction.Exec(`INSERT INTO webhook_deliveries (event_id, subscription_id, next_attempt_at)
+			SELECT ?, id, ? FROM webhook_subscriptions WHERE active`, event.Id, event.CreatedAt)
+	}
+	if query.Error != nil {
+		return &model.CustomErr{
+			Err:     fmt.Errorf("storage.writeOutboxEvent: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	return nil
+}
+
+//CreateWebhookSubscription - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) CreateWebhookSubscription(subscription *model.WebhookSubscription) (*model.WebhookSubscription, *model.CustomErr) {
+	created := *subscription
+	created.Id = 0
+	created.CreatedAt = time.Now()
+	query := db.database.Create(&created)
+	if query.Error != nil {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.CreateWebhookSubscription: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	return &created, nil
+}
+
+//GetWebhookSubscriptions - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) GetWebhookSubscriptions() (subscriptions []model.WebhookSubscription, err *model.CustomErr) {
+	query := db.database.Order("id").Find(&subscriptions)
+	if query.Error != nil {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.GetWebhookSubscriptions: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	return subscriptions, nil
+}
+
+//DeleteWebhookSubscription - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) DeleteWebhookSubscription(id int) *model.CustomErr {
+	query := db.database.Delete(&model.WebhookSubscription{Id: id})
+	if query.Error != nil {
+		return &model.CustomErr{
+			Err:     fmt.Errorf("storage.DeleteWebhookSubscription: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	if query.RowsAffected == 0 {
+		return &model.CustomErr{
+			Err:     fmt.Errorf("storage.DeleteWebhookSubscription: подписка %d не найдена", id),
+			ErrCode: model.WebhookNotFoundCode,
+		}
+	}
+	return nil
+}
+
+//ClaimPendingWebhookDeliveries - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) ClaimPendingWebhookDeliveries(now time.Time, lease time.Duration, limit int) (tasks []model.WebhookDeliveryTask, err *model.CustomErr) {
+	query := db.database.Raw(`WITH claimed AS (
+			UPDATE webhook_deliveries SET locked_until = ?
+			WHERE id IN (
+				SELECT id FROM webhook_deliveries
+				WHERE status = ? AND next_attempt_at <= ? AND (locked_until IS NULL OR locked_until < ?)
+				ORDER BY next_attempt_at LIMIT ?
+				FOR UPDATE SKIP LOCKED)
+			RETURNING *)
+		SELECT claimed.*, e.event_type, e.payload, e.created_at, s.url, s.secret
+		FROM claimed
+		JOIN outbox_events e ON e.id = claimed.event_id
+		JOIN webhook_subscriptions s ON s.id = claimed.subscription_id
+		ORDER BY claimed.event_id`, now.Add(lease), model.DeliveryPending, now, now, limit).Scan(&tasks)
+	if query.Error != nil && query.Error != gorm.ErrRecordNotFound {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.ClaimPendingWebhookDeliveries: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	return tasks, nil
+}
+
+//SaveWebhookDelivery - реализует метод интерфейса IBalanceInfoStorage.
+//Обновляются только поля результата попытки и только пока блокировка выборки не изменилась, поэтому удаленная
+//доставка не создается заново, а повтор доставки и выборка другим обработчиком не перезаписываются
+func (db *storage) SaveWebhookDelivery(delivery *model.WebhookDelivery) *model.CustomErr {
+	if delivery.LockedUntil == nil {
+		return &model.CustomErr{
+			Err:     fmt.Errorf("storage.SaveWebhookDelivery: доставка %d не выбрана для отправки", delivery.Id),
+			ErrCode: model.WebhookNotFoundCode,
+		}
+	}
+	query := db.database.Model(&model.WebhookDelivery{}).
+		Where("id = ? AND locked_until = ?", delivery.Id, *delivery.LockedUntil).
+		UpdateColumns(map[string]interface{}{
+			"status":          delivery.Status,
+			"attempts":        delivery.Attempts,
+			"next_attempt_at": delivery.NextAttemptAt,
+			"last_error":      delivery.LastError,
+			"delivered_at":    delivery.DeliveredAt,
+			"locked_until":    nil,
+		})
+	if query.Error != nil {
+		return &model.CustomErr{
+			Err:     fmt.Errorf("storage.SaveWebhookDelivery: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	if query.RowsAffected == 0 {
+		return &model.CustomErr{
+			Err:     fmt.Errorf("storage.SaveWebhookDelivery: доставка %d удалена или заблокирована другой выборкой", delivery.Id),
+			ErrCode: model.WebhookNotFoundCode,
+		}
+	}
+	delivery.LockedUntil = nil
+	return nil
+}
+
+//GetWebhookDeliveries - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) GetWebhookDeliveries(status string, limit int) (deliveries []model.WebhookDelivery, err *model.CustomErr) {
+	query := db.database
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	query = query.Order("id desc").Limit(limit).Find(&deliveries)
+	if query.Error != nil {
+		return nil, &model.CustomErr{
+			Err:     fmt.Errorf("storage.GetWebhookDeliveries: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	return deliveries, nil
+}
+
+//ReplayWebhookDelivery - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) ReplayWebhookDelivery(id int64) *model.CustomErr {
+	query := db.database.Model(&model.WebhookDelivery{Id: id}).Updates(map[string]interface{}{
+		"status":          model.DeliveryPending,
+		"attempts":        0,
+		"next_attempt_at": time.Now(),
+		"locked_until":    nil,
+	})
+	if query.Error != nil {
+		return &model.CustomErr{
+			Err:     fmt.Errorf("storage.ReplayWebhookDelivery: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	if query.RowsAffected == 0 {
+		return &model.CustomErr{
+			Err:     fmt.Errorf("storage.ReplayWebhookDelivery: доставка %d не найдена", id),
+			ErrCode: model.WebhookNotFoundCode,
+		}
+	}
+	return nil
+}
+
+//ReplayWebhookEvents - реализует метод интерфейса IBalanceInfoStorage
+func (db *storage) ReplayWebhookEvents(subscriptionId int, since time.Time) (int64, *model.CustomErr) {
+	subscription := &model.WebhookSubscription{}
+	query := db.database.First(subscription, subscriptionId)
+	if query.Error != nil {
+		err := &model.CustomErr{
+			Err:     fmt.Errorf("storage.ReplayWebhookEvents: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+		if query.Error == gorm.ErrRecordNotFound {
+			err.ErrCode = model.WebhookNotFoundCode
+		}
+		return 0, err
+	}
+	query = db.database.Exec(`INSERT INTO webhook_deliveries (event_id, subscription_id, next_attempt_at)
+		SELECT id, ?, ? FROM outbox_events WHERE created_at >= ? ORDER BY id`, subscriptionId, time.Now(), dbTime(since))
+	if query.Error != nil {
+		return 0, &model.CustomErr{
+			Err:     fmt.Errorf("storage.ReplayWebhookEvents: %v", query.Error),
+			ErrCode: model.DefaultErrCode,
+		}
+	}
+	return query.RowsAffected, nil
+}
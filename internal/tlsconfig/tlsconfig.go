@@ -0,0 +1,195 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/model"
+)
+
+//defaultReloadInterval - интервал проверки изменения файлов сертификатов по умолчанию
+const defaultReloadInterval = 30 * time.Second
+
+//Manager - сертификат сервера и сертификаты центров, которыми подписаны сертификаты клиентов. Файлы перечитываются
+//при изменении, новые сертификаты применяются к новым соединениям. Сертификаты клиентов сопоставляются с их
+//идентификаторами по списку допустимых субъектов
+type Manager struct {
+	options model.TLSOptions
+
+	mutex       sync.RWMutex
+	certificate *tls.Certificate
+	clientCAs   *x509.CertPool
+	modTimes    map[string]time.Time
+}
+
+//New - конструктор *Manager. Возвращает ошибку, если файлы сертификатов не удалось прочитать
+func New(options model.TLSOptions) (*Manager, error) {
+	if options.CertFile == "" || options.KeyFile == "" {
+		return nil, errors.New("tlsconfig.New: не указаны файлы сертификата и ключа сервера")
+	}
+	if options.ReloadInterval <= 0 {
+		options.ReloadInterval = defaultReloadInterval
+	}
+	m := &Manager{options: options}
+	if err := m.Reload(); err != nil {
+		return nil, fmt.Errorf("tlsconfig.New: %v", err)
+	}
+	return m, nil
+}
+
+//Config - настройки TLS сервера. Сертификаты берутся из Manager при каждом подключении, поэтому после
+//перечитывания файлов настройки не пересоздаются
+func (m *Manager) Config() *tls.Config {
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: m.getCertificate,
+	}
+	if m.VerifiesClients() {
+		//цепочка проверяется в verifyClient по текущему набору центров, а не по ClientCAs из настроек
+		config.ClientAuth = tls.RequireAnyClientCert
+		if m.options.ClientCertOptional {
+			config.ClientAuth = tls.RequestClientCert
+		}
+		config.VerifyPeerCertificate = m.verifyClient
+	}
+	return config
+}
+
+//VerifiesClients - проверяются ли сертификаты клиентов (задан файл центров ClientCAFile)
+func (m *Manager) VerifiesClients() bool {
+	return m.options.ClientCAFile != ""
+}
+
+//ClientIdentity - идентификатор клиента, предъявившего сертификат cert: значение AllowedClients для полного субъекта
+//сертификата (например, "CN=billing,O=Acme") или его CommonName. При пустом AllowedClients идентификатор - CommonName.
+//ok == false - субъекта нет в списке допустимых
+func (m *Manager) ClientIdentity(cert *x509.Certificate) (identity string, ok bool) {
+	if len(m.options.AllowedClients) == 0 {
+		return cert.Subject.CommonName, true
+	}
+	if identity, ok = m.options.AllowedClients[cert.Subject.String()]; ok {
+		return identity, true
+	}
+	identity, ok = m.options.AllowedClients[cert.Subject.CommonName]
+	return identity, ok
+}
+
+//Start - запускает периодическую проверку изменения файлов сертификатов в отдельной горутине
+func (m *Manager) Start() {
+	go func() {
+		for {
+			time.Sleep(m.options.ReloadInterval)
+			if !m.changed() {
+				continue
+			}
+			if err := m.Reload(); err != nil {
+				log.Printf("tlsconfig.Start: используются прежние сертификаты: %s", err.Error())
+				continue
+			}
+			log.Print("tlsconfig.Start: сертификаты перечитаны")
+		}
+	}()
+}
+
+//Reload - перечитывает файлы сертификатов. При ошибке сохраняются прежние сертификаты
+func (m *Manager) Reload() error {
+	modTimes := map[string]time.Time{}
+	for _, path := range m.files() {
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("tlsconfig.Reload: %v", err)
+		}
+		modTimes[path] = info.ModTime()
+	}
+	certificate, err := tls.LoadX509KeyPair(m.options.CertFile, m.options.KeyFile)
+	if err != nil {
+		return fmt.Errorf("tlsconfig.Reload: %v", err)
+	}
+	var clientCAs *x509.CertPool
+	if m.VerifiesClients() {
+		pem, err := ioutil.ReadFile(m.options.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("tlsconfig.Reload: %v", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("tlsconfig.Reload: файл %s не содержит сертификатов", m.options.ClientCAFile)
+		}
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.certificate = &certificate
+	m.clientCAs = clientCAs
+	m.modTimes = modTimes
+	return nil
+}
+
+//files (internal) - файлы сертификатов, изменение которых отслеживается
+func (m *Manager) files() []string {
+	files := []string{m.options.CertFile, m.options.KeyFile}
+	if m.VerifiesClients() {
+		files = append(files, m.options.ClientCAFile)
+	}
+	return files
+}
+
+//changed (internal) - изменился ли какой-либо файл сертификатов после последнего чтения
+func (m *Manager) changed() bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	for _, path := range m.files() {
+		info, err := os.Stat(path)
+		if err == nil && !info.ModTime().Equal(m.modTimes[path]) {
+			return true
+		}
+	}
+	return false
+}
+
+//getCertificate (internal) - текущий сертификат сервера
+func (m *Manager) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.certificate, nil
+}
+
+//verifyClient (internal) - проверка цепочки сертификата клиента по текущему набору центров. Отсутствие сертификата
+//при ClientCertOptional проверяется после установки соединения
+func (m *Manager) verifyClient(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	if len(rawCerts) == 0 {
+		return nil
+	}
+	certs := make([]*x509.Certificate, 0, len(rawCerts))
+	for _, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("tlsconfig: некорректный сертификат клиента: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+	m.mutex.RLock()
+	roots := m.clientCAs
+	m.mutex.RUnlock()
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return fmt.Errorf("tlsconfig: сертификат клиента не прошел проверку: %v", err)
+	}
+	return nil
+}
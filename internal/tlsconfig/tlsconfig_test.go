@@ -0,0 +1,207 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+//testCert - сертификат с ключом для тестов
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+//newTestCert - сертификат с субъектом subject, подписанный parent (nil - самоподписанный центр)
+func newTestCert(t *testing.T, subject pkix.Name, parent *testCert, usage x509.ExtKeyUsage) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		DNSNames:     []string{"localhost"},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{usage}
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+//write - запись сертификата и ключа в файлы dir/name.crt и dir/name.key
+func (c *testCert) write(t *testing.T, dir, name string) (certFile, keyFile string) {
+	certFile, keyFile = filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	keyDer, _ := x509.MarshalECPrivateKey(c.key)
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+//tlsCertificate - сертификат клиента для tls.Config
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+//newTestManager - Manager с сертификатом сервера и центром сертификатов клиентов ca во временном каталоге
+func newTestManager(t *testing.T, ca *testCert, allowed map[string]string) (*Manager, string) {
+	dir, err := ioutil.TempDir("", "tlsconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newTestCert(t, pkix.Name{CommonName: "localhost"}, ca, x509.ExtKeyUsageServerAuth)
+	certFile, keyFile := server.write(t, dir, "server")
+	caFile, _ := ca.write(t, dir, "ca")
+	m, err := New(model.TLSOptions{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile, AllowedClients: allowed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, dir
+}
+
+//handshake - установка TLS соединения клиента с сертификатами certs с сервером, настроенным m
+func handshake(t *testing.T, m *Manager, certs []tls.Certificate) error {
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", m.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	serverErr := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			err = conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+		serverErr <- err
+	}()
+	conn, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{InsecureSkipVerify: true, Certificates: certs})
+	if err == nil {
+		//в TLS 1.3 ошибка проверки сертификата клиента приходит при первом чтении
+		conn.Read(make([]byte, 1))
+		conn.Close()
+	}
+	return <-serverErr
+}
+
+//TestNewMissingFiles - ошибка при отсутствии файлов сертификата
+func TestNewMissingFiles(t *testing.T) {
+	_, err := New(model.TLSOptions{CertFile: "missing.crt", KeyFile: "missing.key"})
+	assert.Error(t, err)
+	_, err = New(model.TLSOptions{})
+	assert.Error(t, err)
+}
+
+//TestClientIdentity - сопоставление субъекта сертификата клиента с идентификатором
+func TestClientIdentity(t *testing.T) {
+	billing := &x509.Certificate{Subject: pkix.Name{CommonName: "billing", Organization: []string{"Acme"}}}
+	reports := &x509.Certificate{Subject: pkix.Name{CommonName: "reports"}}
+
+	m := &Manager{options: model.TLSOptions{AllowedClients: map[string]string{"CN=billing,O=Acme": "billing-service", "reports": "reporting"}}}
+	identity, ok := m.ClientIdentity(billing)
+	assert.True(t, ok)
+	assert.Equal(t, "billing-service", identity)
+	identity, ok = m.ClientIdentity(reports)
+	assert.True(t, ok)
+	assert.Equal(t, "reporting", identity)
+	_, ok = m.ClientIdentity(&x509.Certificate{Subject: pkix.Name{CommonName: "billing"}})
+	assert.False(t, ok)
+
+	m = &Manager{}
+	identity, ok = m.ClientIdentity(reports)
+	assert.True(t, ok)
+	assert.Equal(t, "reports", identity)
+}
+
+//TestClientVerification - соединение устанавливается только с сертификатом клиента, подписанным центром из ClientCAFile
+func TestClientVerification(t *testing.T) {
+	ca := newTestCert(t, pkix.Name{CommonName: "test ca"}, nil, 0)
+	m, dir := newTestManager(t, ca, nil)
+	defer os.RemoveAll(dir)
+
+	client := newTestCert(t, pkix.Name{CommonName: "billing"}, ca, x509.ExtKeyUsageClientAuth)
+	assert.Nil(t, handshake(t, m, []tls.Certificate{client.tlsCertificate()}))
+
+	otherCA := newTestCert(t, pkix.Name{CommonName: "other ca"}, nil, 0)
+	stranger := newTestCert(t, pkix.Name{CommonName: "billing"}, otherCA, x509.ExtKeyUsageClientAuth)
+	assert.Error(t, handshake(t, m, []tls.Certificate{stranger.tlsCertificate()}))
+	assert.Error(t, handshake(t, m, nil))
+
+	serverOnly := newTestCert(t, pkix.Name{CommonName: "billing"}, ca, x509.ExtKeyUsageServerAuth)
+	assert.Error(t, handshake(t, m, []tls.Certificate{serverOnly.tlsCertificate()}))
+}
+
+//TestReload - после изменения файлов используется новый сертификат сервера и новый центр сертификатов клиентов
+func TestReload(t *testing.T) {
+	ca := newTestCert(t, pkix.Name{CommonName: "test ca"}, nil, 0)
+	m, dir := newTestManager(t, ca, nil)
+	defer os.RemoveAll(dir)
+	assert.False(t, m.changed())
+	before, _ := m.getCertificate(nil)
+
+	newCA := newTestCert(t, pkix.Name{CommonName: "new ca"}, nil, 0)
+	server := newTestCert(t, pkix.Name{CommonName: "localhost"}, newCA, x509.ExtKeyUsageServerAuth)
+	server.write(t, dir, "server")
+	newCA.write(t, dir, "ca")
+	//время изменения файлов может совпасть с временем предыдущей записи
+	future := time.Now().Add(time.Minute)
+	for _, name := range []string{"server.crt", "server.key", "ca.crt"} {
+		os.Chtimes(filepath.Join(dir, name), future, future)
+	}
+	assert.True(t, m.changed())
+	assert.Nil(t, m.Reload())
+	assert.False(t, m.changed())
+
+	after, _ := m.getCertificate(nil)
+	assert.NotEqual(t, before.Certificate[0], after.Certificate[0])
+	assert.Equal(t, server.der, after.Certificate[0])
+
+	client := newTestCert(t, pkix.Name{CommonName: "billing"}, newCA, x509.ExtKeyUsageClientAuth)
+	assert.Nil(t, handshake(t, m, []tls.Certificate{client.tlsCertificate()}))
+	oldClient := newTestCert(t, pkix.Name{CommonName: "billing"}, ca, x509.ExtKeyUsageClientAuth)
+	assert.Error(t, handshake(t, m, []tls.Certificate{oldClient.tlsCertificate()}))
+}
+
+//TestReloadKeepsCertificatesOnError - при некорректных файлах сохраняются прежние сертификаты
+func TestReloadKeepsCertificatesOnError(t *testing.T) {
+	ca := newTestCert(t, pkix.Name{CommonName: "test ca"}, nil, 0)
+	m, dir := newTestManager(t, ca, nil)
+	defer os.RemoveAll(dir)
+	before, _ := m.getCertificate(nil)
+
+	ioutil.WriteFile(filepath.Join(dir, "server.crt"), []byte("not a certificate"), 0600)
+	assert.Error(t, m.Reload())
+	after, _ := m.getCertificate(nil)
+	assert.Equal(t, before, after)
+}
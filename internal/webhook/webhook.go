@@ -0,0 +1,152 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/model"
+)
+
+//Заголовки запроса с событием
+const (
+	SignatureHeader = "X-Signature-SHA256"
+	TimestampHeader = "X-Timestamp"
+	EventIdHeader   = "X-Event-Id"
+	EventTypeHeader = "X-Event-Type"
+)
+
+const (
+	//maxAttempts - количество попыток доставки, после которого доставка переводится в состояние model.DeliveryDead
+	maxAttempts = 10
+	//baseBackoff, maxBackoff - начальный и максимальный интервал между попытками. Интервал удваивается после каждой неудачи
+	baseBackoff = 10 * time.Second
+	maxBackoff  = time.Hour
+	//claimLease - время блокировки выбранной для отправки доставки
+	claimLease = 5 * time.Minute
+	//requestTimeout - время ожидания ответа подписчика
+	requestTimeout = 10 * time.Second
+	//batchSize - максимальное количество доставок, отправляемых за один проход. Доставки отправляются по очереди,
+	//поэтому размер выбран так, чтобы даже при ожидании каждого ответа requestTimeout проход занимал не больше
+	//половины claimLease и блокировка не истекала до сохранения результатов
+	batchSize = int(claimLease / requestTimeout / 2)
+)
+
+//Dispatcher - отправляет события подписчикам
+type Dispatcher struct {
+	accStorage model.IBalanceInfoStorage
+	client     *http.Client
+	interval   time.Duration
+}
+
+//NewDispatcher - конструктор *Dispatcher. interval - период проверки очереди доставок
+func NewDispatcher(accStorage model.IBalanceInfoStorage, interval time.Duration) *Dispatcher {
+	return &Dispatcher{
+		accStorage: accStorage,
+		client:     &http.Client{Timeout: requestTimeout},
+		interval:   interval,
+	}
+}
+
+//Start - запускает периодическую отправку событий в отдельной горутине
+func (d *Dispatcher) Start() {
+	go func() {
+		for {
+			d.DispatchPending(time.Now())
+			time.Sleep(d.interval)
+		}
+	}()
+}
+
+//DispatchPending - отправляет все доставки, время попытки которых наступило к моменту now
+func (d *Dispatcher) DispatchPending(now time.Time) {
+	for {
+		tasks, custErr := d.accStorage.ClaimPendingWebhookDeliveries(now, claimLease, batchSize)
+		if custErr != nil {
+			log.Printf("webhook.DispatchPending: %s", custErr.Err.Error())
+			return
+		}
+		for i := range tasks {
+			d.deliver(&tasks[i], now)
+		}
+		if len(tasks) < batchSize {
+			return
+		}
+	}
+}
+
+//deliver (internal) - отправляет событие подписчику и сохраняет результат попытки
+func (d *Dispatcher) deliver(task *model.WebhookDeliveryTask, now time.Time) {
+	delivery := &task.WebhookDelivery
+	delivery.Attempts++
+	if err := d.send(task, now); err != nil {
+		delivery.LastError = err.Error()
+		if delivery.Attempts >= maxAttempts {
+			delivery.Status = model.DeliveryDead
+		} else {
+			delivery.NextAttemptAt = now.Add(Backoff(delivery.Attempts))
+		}
+	} else {
+		delivery.Status = model.DeliveryDelivered
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+	}
+	if custErr := d.accStorage.SaveWebhookDelivery(delivery); custErr != nil {
+		log.Printf("webhook.deliver: %s", custErr.Err.Error())
+	}
+}
+
+//send (internal) - выполняет запрос к подписчику. Успешным считается ответ с кодом 2xx
+func (d *Dispatcher) send(task *model.WebhookDeliveryTask, now time.Time) error {
+	body := []byte(task.Payload)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req, err := http.NewRequest(http.MethodPost, task.Url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("webhook.send: %v", err)
+	}
+	req.Header.Set("content-type", "application/json")
+	req.Header.Set(EventIdHeader, strconv.FormatInt(task.EventId, 10))
+	req.Header.Set(EventTypeHeader, task.EventType)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(task.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook.send: %v", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook.send: подписчик вернул код %d", resp.StatusCode)
+	}
+	return nil
+}
+
+//Sign - подпись события: hex(HMAC-SHA256(secret, timestamp + "." + body))
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+//Backoff - интервал до следующей попытки после attempts неудачных попыток
+func Backoff(attempts int) time.Duration {
+	backoff := baseBackoff
+	for i := 1; i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
@@ -0,0 +1,98 @@
+package webhook
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/call-me-snake/user_balance_service/internal/model"
+	mock_model "github.com/call-me-snake/user_balance_service/internal/model/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testNow     = time.Date(2020, 9, 21, 18, 45, 0, 0, time.UTC)
+	testSecret  = "secret"
+	testPayload = `{"EventType":"balance.changed","Records":[]}`
+)
+
+//TestBackoff - тест роста интервала между попытками
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, baseBackoff, Backoff(1))
+	assert.Equal(t, 4*baseBackoff, Backoff(3))
+	assert.Equal(t, maxBackoff, Backoff(maxAttempts))
+}
+
+//TestDispatchPendingDelivered - тест успешной доставки подписанного события
+func TestDispatchPendingDelivered(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	subscriber := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, testPayload, string(body))
+		assert.Equal(t, Sign(testSecret, r.Header.Get(TimestampHeader), body), r.Header.Get(SignatureHeader))
+		assert.Equal(t, "7", r.Header.Get(EventIdHeader))
+	}))
+	defer subscriber.Close()
+
+	task := model.WebhookDeliveryTask{
+		WebhookDelivery: model.WebhookDelivery{Id: 1, EventId: 7, Status: model.DeliveryPending},
+		EventType:       model.BalanceChangedEvent,
+		Payload:         testPayload,
+		Url:             subscriber.URL,
+		Secret:          testSecret,
+	}
+	mockdb := mock_model.NewMockIBalanceInfoStorage(ctrl)
+	mockdb.EXPECT().ClaimPendingWebhookDeliveries(testNow, claimLease, batchSize).Return([]model.WebhookDeliveryTask{task}, nil)
+	mockdb.EXPECT().SaveWebhookDelivery(gomock.Any()).DoAndReturn(func(delivery *model.WebhookDelivery) *model.CustomErr {
+		assert.Equal(t, model.DeliveryDelivered, delivery.Status)
+		assert.Equal(t, 1, delivery.Attempts)
+		return nil
+	})
+
+	NewDispatcher(mockdb, time.Second).DispatchPending(testNow)
+}
+
+//TestDispatchPendingDead - тест перевода доставки в dead после исчерпания попыток
+func TestDispatchPendingDead(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	subscriber := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer subscriber.Close()
+
+	task := model.WebhookDeliveryTask{
+		WebhookDelivery: model.WebhookDelivery{Id: 1, EventId: 7, Status: model.DeliveryPending, Attempts: maxAttempts - 2},
+		Payload:         testPayload,
+		Url:             subscriber.URL,
+		Secret:          testSecret,
+	}
+	mockdb := mock_model.NewMockIBalanceInfoStorage(ctrl)
+	mockdb.EXPECT().ClaimPendingWebhookDeliveries(testNow, claimLease, batchSize).Return([]model.WebhookDeliveryTask{task}, nil)
+	mockdb.EXPECT().SaveWebhookDelivery(gomock.Any()).DoAndReturn(func(delivery *model.WebhookDelivery) *model.CustomErr {
+		assert.Equal(t, model.DeliveryPending, delivery.Status)
+		assert.Equal(t, testNow.Add(Backoff(maxAttempts-1)), delivery.NextAttemptAt)
+		task.WebhookDelivery = *delivery
+		return nil
+	})
+	NewDispatcher(mockdb, time.Second).DispatchPending(testNow)
+
+	mockdb.EXPECT().ClaimPendingWebhookDeliveries(testNow, claimLease, batchSize).Return([]model.WebhookDeliveryTask{task}, nil)
+	mockdb.EXPECT().SaveWebhookDelivery(gomock.Any()).DoAndReturn(func(delivery *model.WebhookDelivery) *model.CustomErr {
+		assert.Equal(t, model.DeliveryDead, delivery.Status)
+		assert.NotEmpty(t, delivery.LastError)
+		return nil
+	})
+	NewDispatcher(mockdb, time.Second).DispatchPending(testNow)
+}
+
+//TestBatchFitsLease - проход по пачке доставок с ожиданием каждого ответа не дольше requestTimeout
+//укладывается в половину времени блокировки
+func TestBatchFitsLease(t *testing.T) {
+	assert.True(t, batchSize > 0)
+	assert.True(t, time.Duration(batchSize)*requestTimeout <= claimLease/2)
+}